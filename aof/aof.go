@@ -35,6 +35,7 @@ type Handler struct {
 	aofFinished chan struct{} //aof写入完成通道
 	pausingAof  sync.RWMutex  //数据写入锁
 	currentDB   int           //当前Db index
+	rewriting   utils.Boolean //是否正在重写
 }
 
 // NewAOFHandler new aof.Handler
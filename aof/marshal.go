@@ -1,11 +1,13 @@
 package aof
 
 import (
+	"gedis/pkg/utils"
 	"gedis/reply"
 	"gedis/types/dict"
 	List "gedis/types/list"
 	"gedis/types/redis"
 	"gedis/types/set"
+	"gedis/types/stream"
 	SortedSet "gedis/types/zset"
 	"strconv"
 	"time"
@@ -20,7 +22,7 @@ func EntityToCmd(key string, entity *redis.DataEntity) *reply.MultiBulkReply {
 	switch val := entity.Data.(type) {
 	case []byte:
 		cmd = stringToCmd(key, val)
-	case *List.LinkedList:
+	case List.List:
 		cmd = listToCmd(key, val)
 	case *set.Set:
 		cmd = setToCmd(key, val)
@@ -32,6 +34,23 @@ func EntityToCmd(key string, entity *redis.DataEntity) *reply.MultiBulkReply {
 	return cmd
 }
 
+// EntityToCmds 序列化DataEntity为一条或多条命令, stream 需要多条命令才能恢复消费组, hash 需要额外的命令恢复 field 的过期时间
+func EntityToCmds(key string, entity *redis.DataEntity) []*reply.MultiBulkReply {
+	if entity == nil {
+		return nil
+	}
+	switch val := entity.Data.(type) {
+	case *stream.Stream:
+		return streamToCmds(key, val)
+	case dict.Expirable:
+		return expirableHashToCmds(key, val)
+	}
+	if cmd := EntityToCmd(key, entity); cmd != nil {
+		return []*reply.MultiBulkReply{cmd}
+	}
+	return nil
+}
+
 var setCmd = []byte("SET")
 
 func stringToCmd(key string, bytes []byte) *reply.MultiBulkReply {
@@ -44,7 +63,7 @@ func stringToCmd(key string, bytes []byte) *reply.MultiBulkReply {
 
 var rPushAllCmd = []byte("RPUSH")
 
-func listToCmd(key string, list *List.LinkedList) *reply.MultiBulkReply {
+func listToCmd(key string, list List.List) *reply.MultiBulkReply {
 	args := make([][]byte, 2+list.Len())
 	args[0] = rPushAllCmd
 	args[1] = []byte(key)
@@ -74,20 +93,34 @@ func setToCmd(key string, set *set.Set) *reply.MultiBulkReply {
 var hMSetCmd = []byte("HMSET")
 
 func hashToCmd(key string, hash dict.Dict) *reply.MultiBulkReply {
-	args := make([][]byte, 2+hash.Len()*2)
+	args := make([][]byte, 2, 2+hash.Len()*2)
 	args[0] = hMSetCmd
 	args[1] = []byte(key)
-	i := 0
+	// 遍历期间可能有 field 过期, 所以不按 Len 预先确定参数位置
 	hash.ForEach(func(field string, val interface{}) bool {
 		bytes, _ := val.([]byte)
-		args[2+i*2] = []byte(field)
-		args[3+i*2] = bytes
-		i++
+		args = append(args, []byte(field), bytes)
 		return true
 	})
 	return reply.MakeMultiBulkReply(args)
 }
 
+// expirableHashToCmds 生成 HMSET 以及每个设置了过期时间的 field 的 HPEXPIREAT
+func expirableHashToCmds(key string, hash dict.Expirable) []*reply.MultiBulkReply {
+	cmd := hashToCmd(key, hash)
+	if len(cmd.Args) == 2 { // field 都已过期
+		return nil
+	}
+	cmds := []*reply.MultiBulkReply{cmd}
+	for i := 2; i < len(cmd.Args); i += 2 {
+		field := string(cmd.Args[i])
+		if expireTime, ok := hash.ExpireTime(field); ok {
+			cmds = append(cmds, MakeFieldExpireCmd(key, field, expireTime))
+		}
+	}
+	return cmds
+}
+
 var zAddCmd = []byte("ZADD")
 
 //
@@ -106,8 +139,48 @@ func zSetToCmd(key string, zset *SortedSet.SortedSet) *reply.MultiBulkReply {
 	return reply.MakeMultiBulkReply(args)
 }
 
+var xAddCmd = []byte("XADD")
+
+// streamToCmds 依次恢复条目, 最大 ID, 消费组, 消费者和待确认列表
+func streamToCmds(key string, s *stream.Stream) []*reply.MultiBulkReply {
+	keyBytes := []byte(key)
+	cmds := make([]*reply.MultiBulkReply, 0, s.Len()+1)
+	s.ForEach(func(entry *stream.Entry) bool {
+		args := make([][]byte, 0, 3+len(entry.Fields))
+		args = append(args, xAddCmd, keyBytes, []byte(entry.ID.String()))
+		args = append(args, entry.Fields...)
+		cmds = append(cmds, reply.MakeMultiBulkReply(args))
+		return true
+	})
+	if s.Len() == 0 { // 添加一个条目后立即裁剪, 创建空的 stream, 最大 ID 由随后的 XSETID 恢复
+		cmds = append(cmds, reply.MakeMultiBulkReply(utils.ToCmdLine("XADD", key, "MAXLEN", "0", "0-1", "_", "_")))
+	}
+	cmds = append(cmds, reply.MakeMultiBulkReply(utils.ToCmdLine("XSETID", key, s.LastID().String())))
+	for _, group := range s.Groups() {
+		cmds = append(cmds, reply.MakeMultiBulkReply(utils.ToCmdLine("XGROUP", "CREATE", key, group.Name, group.LastID.String())))
+		for _, consumer := range group.Consumers() {
+			cmds = append(cmds, reply.MakeMultiBulkReply(utils.ToCmdLine("XGROUP", "CREATECONSUMER", key, group.Name, consumer.Name)))
+		}
+		for _, pe := range group.PendingRange(stream.MinID, stream.MaxID, 0, nil) {
+			cmds = append(cmds, reply.MakeMultiBulkReply(utils.ToCmdLine(
+				"XCLAIM", key, group.Name, pe.Consumer, "0", pe.ID.String(),
+				"TIME", strconv.FormatInt(pe.DeliveryTime, 10),
+				"RETRYCOUNT", strconv.FormatInt(pe.DeliveryCount, 10),
+				"FORCE", "JUSTID",
+			)))
+		}
+	}
+	return cmds
+}
+
 var pExpireAtBytes = []byte("PEXPIREAT")
 
+// MakeFieldExpireCmd 生成设置 hash field 过期时间的指令
+func MakeFieldExpireCmd(key string, field string, expireAt time.Time) *reply.MultiBulkReply {
+	ms := strconv.FormatInt(expireAt.UnixNano()/1e6, 10)
+	return reply.MakeMultiBulkReply(utils.ToCmdLine("HPEXPIREAT", key, ms, "FIELDS", "1", field))
+}
+
 // MakeExpireCmd 生成一个设置过期的指令Reply
 func MakeExpireCmd(key string, expireAt time.Time) *reply.MultiBulkReply {
 	args := make([][]byte, 3)
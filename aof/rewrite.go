@@ -28,6 +28,8 @@ type RewriteCtx struct {
 
 // Rewrite carries out AOF rewrite
 func (handler *Handler) Rewrite() {
+	handler.rewriting.Set(true)
+	defer handler.rewriting.Set(false)
 	ctx, err := handler.StartRewrite()
 	if err != nil {
 		logger.Warn(err.Error())
@@ -42,6 +44,11 @@ func (handler *Handler) Rewrite() {
 	handler.FinishRewrite(ctx)
 }
 
+// Rewriting tells whether an AOF rewrite is in progress
+func (handler *Handler) Rewriting() bool {
+	return handler.rewriting.Get()
+}
+
 // DoRewrite actually rewrite aof file
 // makes DoRewrite public for testing only, please use Rewrite instead
 func (handler *Handler) DoRewrite(ctx *RewriteCtx) error {
@@ -61,8 +68,7 @@ func (handler *Handler) DoRewrite(ctx *RewriteCtx) error {
 		}
 		// dump db
 		tmpAof.db.ForEach(i, func(key string, entity *redis.DataEntity, expiration *time.Time) bool {
-			cmd := EntityToCmd(key, entity)
-			if cmd != nil {
+			for _, cmd := range EntityToCmds(key, entity) {
 				_, _ = tmpFile.Write(cmd.ToBytes())
 			}
 			if expiration != nil {
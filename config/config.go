@@ -12,9 +12,35 @@ var (
 
 type Config struct {
 	Server struct {
-		Password  string `toml:"Password"`  //服务器密码
-		Port      string `toml:"Port"`      //服务器默认监听端口
-		EnableAof bool   `toml:"EnableAof"` //是否开启Aof
+		Password    string `toml:"Password"`    //服务器密码
+		Port        string `toml:"Port"`        //服务器默认监听端口
+		EnableAof   bool   `toml:"EnableAof"`   //是否开启Aof
+		RdbFilename string `toml:"RdbFilename"` //Rdb快照文件名
+		StorageMode string `toml:"StorageMode"` //存储引擎: memory(默认) 或 leveldb
+		LevelDbPath string `toml:"LevelDbPath"` //LevelDB 数据目录
+		MaxHotKeys  int    `toml:"MaxHotKeys"`  //leveldb 模式下每个库常驻内存的 key 数量上限, 0 表示全部常驻
+
+		ReplicaOf       string `toml:"ReplicaOf"`       //启动时作为副本连接的主节点, 格式 "host port"
+		MasterAuth      string `toml:"MasterAuth"`      //主节点密码
+		ReplBacklogSize int    `toml:"ReplBacklogSize"` //复制积压缓冲区大小(字节)
+
+		ClusterEnabled  bool     `toml:"ClusterEnabled"`  //是否开启集群模式
+		ClusterAnnounce string   `toml:"ClusterAnnounce"` //本节点在集群中的地址, 格式 "host:port"
+		ClusterNodes    []string `toml:"ClusterNodes"`    //集群节点及其负责的槽位, 格式 "host:port 0-5460"
+
+		HashMaxListpackEntries int `toml:"HashMaxListpackEntries"` //hash 使用紧凑编码的最大 field 数量
+		HashMaxListpackValue   int `toml:"HashMaxListpackValue"`   //hash 使用紧凑编码的 field 及 value 的最大长度
+		SetMaxIntsetEntries    int `toml:"SetMaxIntsetEntries"`    //set 使用 intset 编码的最大成员数量
+		SetMaxListpackEntries  int `toml:"SetMaxListpackEntries"`  //set 使用 listpack 编码的最大成员数量
+		SetMaxListpackValue    int `toml:"SetMaxListpackValue"`    //set 使用 listpack 编码的成员最大长度
+		ZSetMaxListpackEntries int `toml:"ZSetMaxListpackEntries"` //zset 使用紧凑编码的最大成员数量
+		ZSetMaxListpackValue   int `toml:"ZSetMaxListpackValue"`   //zset 使用紧凑编码的成员最大长度
+		HllSparseMaxBytes      int `toml:"HllSparseMaxBytes"`      //HyperLogLog 使用 sparse 编码的最大字节数
+		Hz                     int `toml:"Hz"`                     //后台任务(主动过期清理)每秒执行的次数, 范围 1-500
+
+		MaxMemory        int64  `toml:"MaxMemory"`        //数据占用的内存上限(字节), 0 表示不限制
+		MaxMemoryPolicy  string `toml:"MaxMemoryPolicy"`  //超出 MaxMemory 时的淘汰策略, 与 redis 的 maxmemory-policy 一致
+		MaxMemorySamples int    `toml:"MaxMemorySamples"` //LRU/LFU/TTL 策略每次从每个库采样的 key 数量
 	} `toml:"Server"`
 }
 
@@ -24,6 +50,18 @@ func Get() *Config {
 		viper.SetConfigName("gedis")
 		viper.SetConfigType("toml")
 		viper.AddConfigPath("config")
+		// 紧凑编码阈值的默认值与 redis 一致, 配置为 0 表示总是使用完整编码
+		viper.SetDefault("Server.HashMaxListpackEntries", 128)
+		viper.SetDefault("Server.HashMaxListpackValue", 64)
+		viper.SetDefault("Server.SetMaxIntsetEntries", 512)
+		viper.SetDefault("Server.SetMaxListpackEntries", 128)
+		viper.SetDefault("Server.SetMaxListpackValue", 64)
+		viper.SetDefault("Server.ZSetMaxListpackEntries", 128)
+		viper.SetDefault("Server.ZSetMaxListpackValue", 64)
+		viper.SetDefault("Server.HllSparseMaxBytes", 3000)
+		viper.SetDefault("Server.Hz", 10)
+		viper.SetDefault("Server.MaxMemoryPolicy", "noeviction")
+		viper.SetDefault("Server.MaxMemorySamples", 5)
 
 		if err := viper.ReadInConfig(); err != nil {
 			panic(err)
@@ -32,6 +70,12 @@ func Get() *Config {
 		if err := viper.Unmarshal(config); err != nil {
 			panic(err)
 		}
+		// 与 redis 一致, hz 限制在 1-500
+		if config.Server.Hz < 1 {
+			config.Server.Hz = 1
+		} else if config.Server.Hz > 500 {
+			config.Server.Hz = 500
+		}
 	})
 
 	return config
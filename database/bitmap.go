@@ -0,0 +1,490 @@
+package database
+
+import (
+	"gedis/pkg/utils"
+	"gedis/reply"
+	"gedis/types/bitmap"
+	"gedis/types/cmd"
+	"gedis/types/redis"
+	"strconv"
+	"strings"
+)
+
+// 位图命令直接读写字符串类型的 []byte, SETBIT 和 BITFIELD 原地修改, 不复制整个字符串
+
+// parseBitOffset 解析位偏移量, 以 # 开头时表示第 N 个 width 位的整数
+func parseBitOffset(arg []byte, hashAllowed bool, width uint) (int64, reply.ErrorReply) {
+	s := string(arg)
+	multiply := false
+	if hashAllowed && strings.HasPrefix(s, "#") {
+		s = s[1:]
+		multiply = true
+	}
+	offset, err := strconv.ParseInt(s, 10, 64)
+	if err == nil && multiply {
+		if offset > bitmap.MaxOffset/int64(width) {
+			err = strconv.ErrRange
+		}
+		offset *= int64(width)
+	}
+	if err != nil || offset < 0 || offset >= bitmap.MaxOffset {
+		return 0, reply.MakeErrReply("ERR bit offset is not an integer or out of range")
+	}
+	return offset, nil
+}
+
+// rollbackBits 位图和 HyperLogLog 命令原地修改字符串, 回滚命令需要保存修改之前的副本
+func rollbackBits(db *DB, args [][]byte) [][][]byte {
+	key := string(args[0])
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil || bytes == nil {
+		return rollbackGivenKeys(db, key)
+	}
+	value := make([]byte, len(bytes))
+	copy(value, bytes)
+	return [][][]byte{
+		utils.ToCmdLine("DEL", key),
+		{[]byte("SET"), []byte(key), value},
+		toTTLCmd(db, key).Args,
+	}
+}
+
+// execSetBit SETBIT key offset value, 返回原来的值
+func execSetBit(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	offset, errReply := parseBitOffset(args[1], false, 1)
+	if errReply != nil {
+		return errReply
+	}
+	val := string(args[2])
+	if val != "0" && val != "1" {
+		return reply.MakeErrReply("ERR bit is not an integer or out of range")
+	}
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	bytes = bitmap.Grow(bytes, offset)
+	old := bitmap.GetBit(bytes, offset)
+	bitmap.SetBit(bytes, offset, val[0]-'0')
+	db.PutEntity(key, &redis.DataEntity{
+		Data: bytes,
+	})
+	db.addAof(utils.ToCmdLine3("setbit", args...))
+	return reply.MakeIntReply(int64(old))
+}
+
+// execGetBit GETBIT key offset
+func execGetBit(db *DB, args [][]byte) redis.Reply {
+	offset, errReply := parseBitOffset(args[1], false, 1)
+	if errReply != nil {
+		return errReply
+	}
+	bytes, errReply := db.getAsString(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return reply.MakeIntReply(int64(bitmap.GetBit(bytes, offset)))
+}
+
+// bitRange 按位表示的闭区间 [start, end]
+type bitRange struct {
+	start int64
+	end   int64
+	isBit bool // 参数单位为位, 否则为字节
+}
+
+// parseBitRange 解析 start end [BYTE | BIT]
+func parseBitRange(args [][]byte) (*bitRange, reply.ErrorReply) {
+	r := &bitRange{}
+	var err error
+	if r.start, err = strconv.ParseInt(string(args[0]), 10, 64); err != nil {
+		return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if r.end, err = strconv.ParseInt(string(args[1]), 10, 64); err != nil {
+		return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if len(args) == 3 {
+		switch strings.ToUpper(string(args[2])) {
+		case "BIT":
+			r.isBit = true
+		case "BYTE":
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	return r, nil
+}
+
+// clip 按字符串长度处理负数下标并截断, 返回按位计算的区间, 区间为空时返回 false
+func (r *bitRange) clip(strLen int64) (int64, int64, bool) {
+	total := strLen
+	if r.isBit {
+		total = strLen * 8
+	}
+	start, end := r.start, r.end
+	if start < 0 {
+		start += total
+	}
+	if end < 0 {
+		end += total
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= total {
+		end = total - 1
+	}
+	if start > end {
+		return 0, 0, false
+	}
+	if r.isBit {
+		return start, end, true
+	}
+	return start * 8, end*8 + 7, true
+}
+
+// execBitCount BITCOUNT key [start end [BYTE | BIT]]
+func execBitCount(db *DB, args [][]byte) redis.Reply {
+	r := &bitRange{start: 0, end: -1}
+	switch len(args) {
+	case 1:
+	case 3, 4:
+		var errReply reply.ErrorReply
+		if r, errReply = parseBitRange(args[1:]); errReply != nil {
+			return errReply
+		}
+	default:
+		return reply.MakeSyntaxErrReply()
+	}
+	bytes, errReply := db.getAsString(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	start, end, ok := r.clip(int64(len(bytes)))
+	if !ok {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(bitmap.Count(bytes, start, end))
+}
+
+// execBitPos BITPOS key bit [start [end [BYTE | BIT]]]
+func execBitPos(db *DB, args [][]byte) redis.Reply {
+	if len(args) > 5 {
+		return reply.MakeSyntaxErrReply()
+	}
+	bitArg := string(args[1])
+	if bitArg != "0" && bitArg != "1" {
+		return reply.MakeErrReply("ERR The bit argument must be 1 or 0.")
+	}
+	bit := bitArg[0] - '0'
+	r := &bitRange{start: 0, end: -1}
+	endGiven := len(args) >= 4
+	if len(args) == 3 {
+		var err error
+		if r.start, err = strconv.ParseInt(string(args[2]), 10, 64); err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+	} else if endGiven {
+		var errReply reply.ErrorReply
+		if r, errReply = parseBitRange(args[2:]); errReply != nil {
+			return errReply
+		}
+	}
+
+	bytes, errReply := db.getAsString(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if bytes == nil {
+		if bit == 1 {
+			return reply.MakeIntReply(-1)
+		}
+		return reply.MakeIntReply(0)
+	}
+	start, end, ok := r.clip(int64(len(bytes)))
+	if !ok {
+		return reply.MakeIntReply(-1)
+	}
+	pos := bitmap.Pos(bytes, bit, start, end)
+	// 没有指定 end 时字符串右侧视为无限的 0
+	if pos < 0 && bit == 0 && !endGiven {
+		pos = end + 1
+	}
+	return reply.MakeIntReply(pos)
+}
+
+// execBitOp BITOP AND | OR | XOR | NOT destkey key [key ...]
+func execBitOp(db *DB, args [][]byte) redis.Reply {
+	op := strings.ToUpper(string(args[0]))
+	dest := string(args[1])
+	switch op {
+	case "AND", "OR", "XOR":
+	case "NOT":
+		if len(args) != 3 {
+			return reply.MakeErrReply("ERR BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return reply.MakeSyntaxErrReply()
+	}
+
+	sources := make([][]byte, len(args)-2)
+	maxLen := 0
+	for i, arg := range args[2:] {
+		bytes, errReply := db.getAsString(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		sources[i] = bytes
+		if len(bytes) > maxLen {
+			maxLen = len(bytes)
+		}
+	}
+
+	result := make([]byte, maxLen)
+	for i := range result {
+		// 较短的字符串视为以 0 填充
+		var b byte
+		if i < len(sources[0]) {
+			b = sources[0][i]
+		}
+		if op == "NOT" {
+			result[i] = ^b
+			continue
+		}
+		for _, source := range sources[1:] {
+			var other byte
+			if i < len(source) {
+				other = source[i]
+			}
+			switch op {
+			case "AND":
+				b &= other
+			case "OR":
+				b |= other
+			case "XOR":
+				b ^= other
+			}
+		}
+		result[i] = b
+	}
+
+	if maxLen == 0 {
+		db.Remove(dest)
+	} else {
+		db.PutEntity(dest, &redis.DataEntity{
+			Data: result,
+		})
+		db.Persist(dest) // override ttl
+	}
+	db.addAof(utils.ToCmdLine3("bitop", args...))
+	return reply.MakeIntReply(int64(maxLen))
+}
+
+func prepareBitOp(args [][]byte) ([]string, []string) {
+	sources := make([]string, len(args)-2)
+	for i, arg := range args[2:] {
+		sources[i] = string(arg)
+	}
+	return []string{string(args[1])}, sources
+}
+
+func undoBitOp(db *DB, args [][]byte) [][][]byte {
+	return rollbackGivenKeys(db, string(args[1]))
+}
+
+const (
+	bitFieldGet = iota
+	bitFieldSet
+	bitFieldIncrBy
+)
+
+type bitFieldOp struct {
+	kind     int
+	offset   int64
+	width    uint
+	signed   bool
+	value    int64 // SET 的值或 INCRBY 的增量
+	overflow int
+}
+
+// parseBitFieldType 解析 i1 ~ i64 或 u1 ~ u63
+func parseBitFieldType(arg []byte) (uint, bool, reply.ErrorReply) {
+	s := strings.ToLower(string(arg))
+	if len(s) >= 2 {
+		width, err := strconv.Atoi(s[1:])
+		if err == nil && s[0] == 'i' && width >= 1 && width <= 64 {
+			return uint(width), true, nil
+		}
+		if err == nil && s[0] == 'u' && width >= 1 && width <= 63 {
+			return uint(width), false, nil
+		}
+	}
+	return 0, false, reply.MakeErrReply("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+}
+
+// parseBitField 解析 BITFIELD 的子命令, OVERFLOW 作用于其后的 SET 和 INCRBY
+func parseBitField(args [][]byte, readOnly bool) ([]*bitFieldOp, reply.ErrorReply) {
+	var ops []*bitFieldOp
+	overflow := bitmap.OverflowWrap
+	for i := 0; i < len(args); {
+		subCmd := strings.ToUpper(string(args[i]))
+		if subCmd == "OVERFLOW" {
+			if i+1 >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			switch strings.ToUpper(string(args[i+1])) {
+			case "WRAP":
+				overflow = bitmap.OverflowWrap
+			case "SAT":
+				overflow = bitmap.OverflowSat
+			case "FAIL":
+				overflow = bitmap.OverflowFail
+			default:
+				return nil, reply.MakeErrReply("ERR Invalid OVERFLOW type specified")
+			}
+			i += 2
+			continue
+		}
+
+		op := &bitFieldOp{overflow: overflow}
+		argCount := 3
+		switch subCmd {
+		case "GET":
+			op.kind = bitFieldGet
+			argCount = 2
+		case "SET":
+			op.kind = bitFieldSet
+		case "INCRBY":
+			op.kind = bitFieldIncrBy
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		if i+argCount >= len(args) {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		if readOnly && op.kind != bitFieldGet {
+			return nil, reply.MakeErrReply("ERR BITFIELD_RO only supports the GET subcommand")
+		}
+		var errReply reply.ErrorReply
+		if op.width, op.signed, errReply = parseBitFieldType(args[i+1]); errReply != nil {
+			return nil, errReply
+		}
+		if op.offset, errReply = parseBitOffset(args[i+2], true, op.width); errReply != nil {
+			return nil, errReply
+		}
+		if op.offset+int64(op.width) > bitmap.MaxOffset {
+			return nil, reply.MakeErrReply("ERR bit offset is not an integer or out of range")
+		}
+		if op.kind != bitFieldGet {
+			value, err := strconv.ParseInt(string(args[i+3]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			op.value = value
+		}
+		ops = append(ops, op)
+		i += argCount + 1
+	}
+	return ops, nil
+}
+
+// applyBitFieldOp 执行一个子命令, 因溢出而没有执行时返回 nil
+func applyBitFieldOp(bytes []byte, op *bitFieldOp) redis.Reply {
+	if op.signed {
+		old := bitmap.GetSigned(bytes, op.offset, op.width)
+		if op.kind == bitFieldGet {
+			return reply.MakeIntReply(old)
+		}
+		var overflowed int
+		var val int64
+		if op.kind == bitFieldSet {
+			overflowed, val = bitmap.CheckSignedOverflow(op.value, 0, op.width, op.overflow)
+		} else {
+			overflowed, val = bitmap.CheckSignedOverflow(old, op.value, op.width, op.overflow)
+		}
+		if overflowed != 0 && op.overflow == bitmap.OverflowFail {
+			return &reply.NullBulkReply{}
+		}
+		bitmap.SetUnsigned(bytes, op.offset, op.width, uint64(val))
+		if op.kind == bitFieldSet {
+			return reply.MakeIntReply(old)
+		}
+		return reply.MakeIntReply(val)
+	}
+
+	old := bitmap.GetUnsigned(bytes, op.offset, op.width)
+	if op.kind == bitFieldGet {
+		return reply.MakeIntReply(int64(old))
+	}
+	var overflowed int
+	var val uint64
+	if op.kind == bitFieldSet {
+		overflowed, val = bitmap.CheckUnsignedOverflow(uint64(op.value), 0, op.width, op.overflow)
+	} else {
+		overflowed, val = bitmap.CheckUnsignedOverflow(old, op.value, op.width, op.overflow)
+	}
+	if overflowed != 0 && op.overflow == bitmap.OverflowFail {
+		return &reply.NullBulkReply{}
+	}
+	bitmap.SetUnsigned(bytes, op.offset, op.width, val)
+	if op.kind == bitFieldSet {
+		return reply.MakeIntReply(int64(old))
+	}
+	return reply.MakeIntReply(int64(val))
+}
+
+func execBitField0(db *DB, args [][]byte, readOnly bool) redis.Reply {
+	key := string(args[0])
+	ops, errReply := parseBitField(args[1:], readOnly)
+	if errReply != nil {
+		return errReply
+	}
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	// 先按写操作涉及的最大偏移量扩展字符串
+	write := false
+	for _, op := range ops {
+		if op.kind != bitFieldGet {
+			write = true
+			bytes = bitmap.Grow(bytes, op.offset+int64(op.width)-1)
+		}
+	}
+	results := make([]redis.Reply, len(ops))
+	for i, op := range ops {
+		results[i] = applyBitFieldOp(bytes, op)
+	}
+	if write {
+		db.PutEntity(key, &redis.DataEntity{
+			Data: bytes,
+		})
+		db.addAof(utils.ToCmdLine3("bitfield", args...))
+	}
+	return reply.MakeMultiRawReply(results)
+}
+
+// execBitField BITFIELD key [GET encoding offset | [OVERFLOW WRAP | SAT | FAIL] SET encoding offset value | INCRBY encoding offset increment ...]
+func execBitField(db *DB, args [][]byte) redis.Reply {
+	return execBitField0(db, args, false)
+}
+
+// execBitFieldRO BITFIELD_RO key [GET encoding offset ...]
+func execBitFieldRO(db *DB, args [][]byte) redis.Reply {
+	return execBitField0(db, args, true)
+}
+
+func init() {
+	RegisterCommand(cmd.SetBit, execSetBit, writeFirstKey, rollbackBits, 4)
+	RegisterCommand(cmd.GetBit, execGetBit, readFirstKey, nil, 3)
+	RegisterCommand(cmd.BitCount, execBitCount, readFirstKey, nil, -2)
+	RegisterCommand(cmd.BitPos, execBitPos, readFirstKey, nil, -3)
+	RegisterCommand(cmd.BitOp, execBitOp, prepareBitOp, undoBitOp, -4)
+	RegisterCommand(cmd.BitField, execBitField, writeFirstKey, rollbackBits, -2)
+	RegisterCommand(cmd.BitFieldRO, execBitFieldRO, readFirstKey, nil, -2)
+}
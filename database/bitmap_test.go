@@ -0,0 +1,62 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestBitmapCommands(t *testing.T) {
+	db := makeDB()
+	cases := []cmdCase{
+		{[]string{"SETBIT", "bm", "7", "1"}, ":0\r\n"},
+		{[]string{"SETBIT", "bm", "7", "0"}, ":1\r\n"},
+		{[]string{"SETBIT", "bm", "7", "1"}, ":0\r\n"},
+		{[]string{"SETBIT", "bm", "7", "2"}, "-ERR bit is not an integer or out of range\r\n"},
+		{[]string{"SETBIT", "bm", "4294967296", "1"}, "-ERR bit offset is not an integer or out of range\r\n"},
+		{[]string{"GETBIT", "bm", "0"}, ":0\r\n"},
+		{[]string{"GETBIT", "bm", "7"}, ":1\r\n"},
+		{[]string{"GETBIT", "bm", "100"}, ":0\r\n"},
+		{[]string{"SET", "s", "foobar"}, "+OK\r\n"},
+		{[]string{"BITCOUNT", "s"}, ":26\r\n"},
+		{[]string{"BITCOUNT", "s", "0", "0"}, ":4\r\n"},
+		{[]string{"BITCOUNT", "s", "1", "1", "BYTE"}, ":6\r\n"},
+		{[]string{"BITCOUNT", "s", "5", "30", "BIT"}, ":17\r\n"},
+		{[]string{"BITCOUNT", "s", "-2", "-1"}, ":7\r\n"},
+		{[]string{"BITCOUNT", "s", "0"}, "-Err syntax error\r\n"},
+		{[]string{"BITCOUNT", "none"}, ":0\r\n"},
+		{[]string{"SET", "p", "\xff\xf0\x00"}, "+OK\r\n"},
+		{[]string{"BITPOS", "p", "0"}, ":12\r\n"},
+		{[]string{"SET", "p", "\x00\xff\xf0"}, "+OK\r\n"},
+		{[]string{"BITPOS", "p", "1", "0"}, ":8\r\n"},
+		{[]string{"BITPOS", "p", "1", "2"}, ":16\r\n"},
+		{[]string{"BITPOS", "p", "1", "2", "-1", "BYTE"}, ":16\r\n"},
+		{[]string{"BITPOS", "p", "1", "7", "15", "BIT"}, ":8\r\n"},
+		{[]string{"SET", "p", "\xff\xff"}, "+OK\r\n"},
+		{[]string{"BITPOS", "p", "0"}, ":16\r\n"},
+		{[]string{"BITPOS", "p", "0", "0", "-1"}, ":-1\r\n"},
+		{[]string{"BITPOS", "none", "0"}, ":0\r\n"},
+		{[]string{"BITPOS", "none", "1"}, ":-1\r\n"},
+		{[]string{"BITPOS", "p", "2"}, "-ERR The bit argument must be 1 or 0.\r\n"},
+		{[]string{"SET", "k1", "foobar"}, "+OK\r\n"},
+		{[]string{"SET", "k2", "abcdef"}, "+OK\r\n"},
+		{[]string{"BITOP", "AND", "dest", "k1", "k2"}, ":6\r\n"},
+		{[]string{"GET", "dest"}, "$6\r\n`bc`ab\r\n"},
+		{[]string{"BITOP", "NOT", "dest", "k1", "k2"}, "-ERR BITOP NOT must be called with a single source key.\r\n"},
+		{[]string{"BITOP", "OR", "dest", "none"}, ":0\r\n"},
+		{[]string{"EXISTS", "dest"}, ":0\r\n"},
+		{[]string{"BITFIELD", "bf", "INCRBY", "i5", "100", "1", "GET", "u4", "0"}, "*2\r\n:1\r\n:0\r\n"},
+		{[]string{"BITFIELD", "bf", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1"}, "*2\r\n:1\r\n:1\r\n"},
+		{[]string{"BITFIELD", "bf", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1"}, "*2\r\n:2\r\n:2\r\n"},
+		{[]string{"BITFIELD", "bf", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1"}, "*2\r\n:3\r\n:3\r\n"},
+		{[]string{"BITFIELD", "bf", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1"}, "*2\r\n:0\r\n:3\r\n"},
+		{[]string{"BITFIELD", "bf", "OVERFLOW", "FAIL", "INCRBY", "u2", "102", "1"}, "*1\r\n$-1\r\n"},
+		{[]string{"BITFIELD", "bf2", "SET", "i8", "#1", "-100", "GET", "i8", "8", "GET", "u8", "#1"}, "*3\r\n:0\r\n:-100\r\n:156\r\n"},
+		{[]string{"BITFIELD", "bf2", "OVERFLOW", "SAT", "INCRBY", "i8", "8", "-100"}, "*1\r\n:-128\r\n"},
+		{[]string{"BITFIELD", "bf2", "INCRBY", "i8", "8", "-1"}, "*1\r\n:127\r\n"},
+		{[]string{"BITFIELD", "bf2", "GET", "u64", "0"}, "-ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.\r\n"},
+		{[]string{"BITFIELD_RO", "bf2", "GET", "i8", "8"}, "*1\r\n:127\r\n"},
+		{[]string{"BITFIELD_RO", "bf2", "SET", "i8", "8", "1"}, "-ERR BITFIELD_RO only supports the GET subcommand\r\n"},
+		{[]string{"BITFIELD", "none", "GET", "u8", "0"}, "*1\r\n:0\r\n"},
+		{[]string{"EXISTS", "none"}, ":0\r\n"},
+	}
+	runCases(t, db, cases)
+}
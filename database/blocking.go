@@ -0,0 +1,225 @@
+package database
+
+import (
+	"container/list"
+	"gedis/reply"
+	"gedis/types/redis"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// blockingSpec 阻塞命令的参数解析
+// 阻塞命令的执行函数只做一次非阻塞的尝试, 取不到数据时返回空回复, 等待由 MultiDB.execBlocking 完成,
+// 所以在 MULTI 中执行时相当于立即超时
+type blockingSpec struct {
+	// timeout 解析超时时间, block 为 false 时按普通命令执行
+	timeout func(args [][]byte) (timeout time.Duration, block bool, errReply reply.ErrorReply)
+	// resolve 可选, 在开始等待前改写参数, 例如将 XREAD 的 $ 替换为当前的最后一个 ID
+	resolve func(db *DB, args [][]byte) [][]byte
+}
+
+// blockingCommands 阻塞命令 -> 参数解析
+var blockingCommands = make(map[string]*blockingSpec)
+
+// registerBlocking 将已注册的命令标记为阻塞命令
+func registerBlocking(name string, spec *blockingSpec) {
+	blockingCommands[strings.ToLower(name)] = spec
+}
+
+// timeoutAt 以秒为单位的超时时间位于参数的固定位置, 负数表示从末尾倒数
+func timeoutAt(index int) func(args [][]byte) (time.Duration, bool, reply.ErrorReply) {
+	return func(args [][]byte) (time.Duration, bool, reply.ErrorReply) {
+		i := index
+		if i < 0 {
+			i += len(args)
+		}
+		timeout, errReply := parseBlockingTimeout(args[i])
+		return timeout, true, errReply
+	}
+}
+
+// parseBlockingTimeout 解析以秒为单位的超时时间, 0 表示一直阻塞
+func parseBlockingTimeout(arg []byte) (time.Duration, reply.ErrorReply) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, reply.MakeErrReply("ERR timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, reply.MakeErrReply("ERR timeout is negative")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// isBlockingMiss 阻塞命令没有取到数据
+func isBlockingMiss(result redis.Reply) bool {
+	switch result.(type) {
+	case *reply.NullBulkReply, *reply.NullMultiBulkReply:
+		return true
+	}
+	return false
+}
+
+// blockedClients 所有库中阻塞的客户端数量
+var blockedClients int64
+
+// waiter 一个阻塞中的客户端
+type waiter struct {
+	conn     redis.Connection
+	elements map[string]*list.Element
+	ready    chan struct{} // 等待的 key 有数据写入时收到通知
+}
+
+// blockingQueue 按 key 排队的阻塞客户端, 先阻塞的客户端先被唤醒
+type blockingQueue struct {
+	mu      sync.Mutex
+	size    int32                 // 阻塞的客户端数量, 为 0 时写命令跳过唤醒
+	waiters map[string]*list.List // key -> *waiter
+	clients map[redis.Connection]*waiter
+}
+
+func makeBlockingQueue() *blockingQueue {
+	return &blockingQueue{
+		waiters: make(map[string]*list.List),
+		clients: make(map[redis.Connection]*waiter),
+	}
+}
+
+// add 将客户端加入所有 key 的等待队列末尾
+func (q *blockingQueue) add(c redis.Connection, keys []string) *waiter {
+	w := &waiter{
+		conn:     c,
+		elements: make(map[string]*list.Element, len(keys)),
+		ready:    make(chan struct{}, 1),
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, key := range keys {
+		if _, ok := w.elements[key]; ok {
+			continue
+		}
+		waiters, ok := q.waiters[key]
+		if !ok {
+			waiters = list.New()
+			q.waiters[key] = waiters
+		}
+		w.elements[key] = waiters.PushBack(w)
+	}
+	q.clients[c] = w
+	atomic.AddInt32(&q.size, 1)
+	atomic.AddInt64(&blockedClients, 1)
+	return w
+}
+
+// remove 将客户端移出等待队列, 可以重复调用
+func (q *blockingQueue) remove(w *waiter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if w.elements == nil {
+		return
+	}
+	for key, element := range w.elements {
+		waiters := q.waiters[key]
+		waiters.Remove(element)
+		if waiters.Len() == 0 {
+			delete(q.waiters, key)
+		}
+	}
+	w.elements = nil
+	if q.clients[w.conn] == w {
+		delete(q.clients, w.conn)
+	}
+	atomic.AddInt32(&q.size, -1)
+	atomic.AddInt64(&blockedClients, -1)
+}
+
+// removeClient 客户端断开时清理等待队列
+func (q *blockingQueue) removeClient(c redis.Connection) {
+	q.mu.Lock()
+	w, ok := q.clients[c]
+	q.mu.Unlock()
+	if ok {
+		q.remove(w)
+	}
+}
+
+// signal 唤醒每个 key 等待最久的客户端, 被唤醒的客户端退出时会继续唤醒下一个
+func (q *blockingQueue) signal(keys ...string) {
+	if atomic.LoadInt32(&q.size) == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, key := range keys {
+		waiters, ok := q.waiters[key]
+		if !ok {
+			continue
+		}
+		w := waiters.Front().Value.(*waiter)
+		select {
+		case w.ready <- struct{}{}:
+		default: // 已经有未处理的通知
+		}
+	}
+}
+
+// execBlocking 执行阻塞命令, 等待期间不持有任何锁, 等待的 key 有写入时重新尝试
+func (mdb *MultiDB) execBlocking(c redis.Connection, db *DB, cmdLine CmdLine, spec *blockingSpec) redis.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	command := cmdTable[cmdName]
+	if !validateArity(command.arity, cmdLine) {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	timeout, block, errReply := spec.timeout(cmdLine[1:])
+	if errReply != nil {
+		return errReply
+	}
+	if !block {
+		mdb.pausing.RLock()
+		defer mdb.pausing.RUnlock()
+		return db.Exec(c, cmdLine)
+	}
+
+	write, read := command.prepare(cmdLine[1:])
+	keys := make([]string, 0, len(write)+len(read))
+	keys = append(keys, write...)
+	keys = append(keys, read...)
+	if spec.resolve != nil {
+		mdb.pausing.RLock()
+		db.RWLocks(nil, keys)
+		args := spec.resolve(db, cmdLine[1:])
+		db.RWUnLocks(nil, keys)
+		mdb.pausing.RUnlock()
+		cmdLine = append(CmdLine{cmdLine[0]}, args...)
+	}
+	w := db.blocking.add(c, keys)
+	defer func() {
+		db.blocking.remove(w)
+		db.blocking.signal(keys...) // 把可能错过的通知传给下一个客户端
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		mdb.pausing.RLock()
+		result := db.Exec(c, cmdLine)
+		mdb.pausing.RUnlock()
+		if !isBlockingMiss(result) {
+			return result
+		}
+		select {
+		case <-w.ready:
+		case <-expired:
+			return result
+		case <-c.Done():
+			return result
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package database
+
+import (
+	"gedis/pkg/utils"
+	"gedis/types/pubsub"
+	"gedis/types/redis"
+	"gedis/types/redis/connection"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestMain(m *testing.M) {
+	// MultiDB.Exec 会读取配置, 测试在 database 目录下执行, 从上级目录读取
+	viper.AddConfigPath("../config")
+	os.Exit(m.Run())
+}
+
+func makeBlockingMultiDB() *MultiDB {
+	mdb := &MultiDB{dbSet: []*DB{makeDB()}}
+	mdb.hub = pubsub.MakeHub()
+	mdb.repl = makeReplication(0)
+	return mdb
+}
+
+// execAsync 在另一个 goroutine 中执行阻塞命令
+func execAsync(mdb *MultiDB, c redis.Connection, args ...string) <-chan redis.Reply {
+	ch := make(chan redis.Reply, 1)
+	go func() {
+		ch <- mdb.Exec(c, utils.ToCmdLine(args...))
+	}()
+	return ch
+}
+
+// waitBlocked 等待库中阻塞的客户端数量达到 n
+func waitBlocked(t *testing.T, db *DB, n int32) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&db.blocking.size) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect %d blocked clients, actual %d", n, atomic.LoadInt32(&db.blocking.size))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func waitReply(t *testing.T, ch <-chan redis.Reply, expect string) {
+	t.Helper()
+	select {
+	case result := <-ch:
+		if actual := string(result.ToBytes()); actual != expect {
+			t.Errorf("expect %q, actual %q", expect, actual)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocking command was not woken up")
+	}
+}
+
+func TestBlockingListWakeUp(t *testing.T) {
+	cases := []struct {
+		block  []string
+		push   []string
+		expect string
+	}{
+		{[]string{"BLPOP", "l1", "l2", "0"}, []string{"RPUSH", "l2", "a", "b"}, "*2\r\n$2\r\nl2\r\n$1\r\na\r\n"},
+		{[]string{"BRPOP", "l1", "0"}, []string{"RPUSH", "l1", "a", "b"}, "*2\r\n$2\r\nl1\r\n$1\r\nb\r\n"},
+		{[]string{"BLMOVE", "src", "dst", "LEFT", "RIGHT", "0"}, []string{"LPUSH", "src", "a"}, "$1\r\na\r\n"},
+	}
+	for _, tc := range cases {
+		mdb := makeBlockingMultiDB()
+		db := mdb.dbSet[0]
+		ch := execAsync(mdb, &connection.FakeConn{}, tc.block...)
+		waitBlocked(t, db, 1)
+		mdb.Exec(&connection.FakeConn{}, utils.ToCmdLine(tc.push...))
+		waitReply(t, ch, tc.expect)
+		waitBlocked(t, db, 0)
+	}
+
+	// BLMOVE 的结果写入目标列表
+	mdb := makeBlockingMultiDB()
+	ch := execAsync(mdb, &connection.FakeConn{}, "BLMOVE", "src", "dst", "RIGHT", "LEFT", "0")
+	waitBlocked(t, mdb.dbSet[0], 1)
+	mdb.Exec(&connection.FakeConn{}, utils.ToCmdLine("RPUSH", "src", "a", "b"))
+	waitReply(t, ch, "$1\r\nb\r\n")
+	result := mdb.Exec(&connection.FakeConn{}, utils.ToCmdLine("LRANGE", "dst", "0", "-1"))
+	if actual := string(result.ToBytes()); actual != "*1\r\n$1\r\nb\r\n" {
+		t.Errorf("expect dst [b], actual %q", actual)
+	}
+}
+
+func TestBlockingListMultipleClients(t *testing.T) {
+	mdb := makeBlockingMultiDB()
+	db := mdb.dbSet[0]
+	first := execAsync(mdb, &connection.FakeConn{}, "BLPOP", "l", "0")
+	second := execAsync(mdb, &connection.FakeConn{}, "BLPOP", "l", "0")
+	waitBlocked(t, db, 2)
+	mdb.Exec(&connection.FakeConn{}, utils.ToCmdLine("RPUSH", "l", "a", "b"))
+	// 每个客户端各取到一个元素
+	popped := make(map[string]bool)
+	for _, ch := range []<-chan redis.Reply{first, second} {
+		select {
+		case result := <-ch:
+			popped[string(result.ToBytes())] = true
+		case <-time.After(time.Second):
+			t.Fatal("blocking command was not woken up")
+		}
+	}
+	if !popped["*2\r\n$1\r\nl\r\n$1\r\na\r\n"] || !popped["*2\r\n$1\r\nl\r\n$1\r\nb\r\n"] {
+		t.Errorf("expect a and b popped by different clients, actual %v", popped)
+	}
+	waitBlocked(t, db, 0)
+}
+
+func TestBlockingListTimeout(t *testing.T) {
+	mdb := makeBlockingMultiDB()
+	db := mdb.dbSet[0]
+	cases := []cmdCase{
+		{[]string{"BLPOP", "l", "0.05"}, "*-1\r\n"},
+		{[]string{"BRPOP", "l", "0.05"}, "*-1\r\n"},
+		{[]string{"BLMOVE", "src", "dst", "LEFT", "LEFT", "0.05"}, "$-1\r\n"},
+		{[]string{"BLPOP", "l", "-1"}, "-ERR timeout is negative\r\n"},
+		{[]string{"BLPOP", "l", "abc"}, "-ERR timeout is not a float or out of range\r\n"},
+	}
+	for _, tc := range cases {
+		start := time.Now()
+		result := mdb.Exec(&connection.FakeConn{}, utils.ToCmdLine(tc.cmdLine...))
+		if actual := string(result.ToBytes()); actual != tc.expect {
+			t.Errorf("%v: expect %q, actual %q", tc.cmdLine, tc.expect, actual)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%v: timeout took %s", tc.cmdLine, elapsed)
+		}
+	}
+	if size := atomic.LoadInt32(&db.blocking.size); size != 0 {
+		t.Errorf("expect no blocked clients after timeout, actual %d", size)
+	}
+}
+
+func TestBlockingListDisconnect(t *testing.T) {
+	mdb := makeBlockingMultiDB()
+	db := mdb.dbSet[0]
+	_, server := net.Pipe()
+	c := connection.NewConn(server)
+	before := atomic.LoadInt64(&blockedClients)
+	ch := execAsync(mdb, c, "BLPOP", "l", "0")
+	waitBlocked(t, db, 1)
+	_ = c.Close()
+	mdb.AfterClientClose(c)
+	waitReply(t, ch, "*-1\r\n")
+	waitBlocked(t, db, 0)
+	db.blocking.mu.Lock()
+	waiters, clients := len(db.blocking.waiters), len(db.blocking.clients)
+	db.blocking.mu.Unlock()
+	if waiters != 0 || clients != 0 {
+		t.Errorf("expect waiter removed, actual %d keys and %d clients", waiters, clients)
+	}
+	if after := atomic.LoadInt64(&blockedClients); after != before {
+		t.Errorf("expect %d blocked clients, actual %d", before, after)
+	}
+
+	// 断开的客户端不会再消费之后写入的数据
+	mdb.Exec(&connection.FakeConn{}, utils.ToCmdLine("RPUSH", "l", "a"))
+	result := mdb.Exec(&connection.FakeConn{}, utils.ToCmdLine("LLEN", "l"))
+	if actual := string(result.ToBytes()); actual != ":1\r\n" {
+		t.Errorf("expect list untouched, actual %q", actual)
+	}
+}
+
+func TestBlockingQueueRemoveClient(t *testing.T) {
+	q := makeBlockingQueue()
+	c1, c2 := &connection.FakeConn{}, &connection.FakeConn{}
+	q.add(c1, []string{"a", "b", "a"})
+	w2 := q.add(c2, []string{"b"})
+	q.removeClient(c1)
+	if atomic.LoadInt32(&q.size) != 1 || len(q.clients) != 1 {
+		t.Fatalf("expect 1 waiter, actual %d", atomic.LoadInt32(&q.size))
+	}
+	if _, ok := q.waiters["a"]; ok {
+		t.Error("expect empty queue of key a removed")
+	}
+	// 剩下的客户端排到队首, 可以被唤醒
+	q.signal("b")
+	select {
+	case <-w2.ready:
+	default:
+		t.Error("expect remaining waiter signaled")
+	}
+	q.remove(w2)
+	q.remove(w2) // 可以重复调用
+	q.removeClient(c2)
+	if atomic.LoadInt32(&q.size) != 0 || len(q.waiters) != 0 || len(q.clients) != 0 {
+		t.Errorf("expect empty queue, actual size %d", atomic.LoadInt32(&q.size))
+	}
+}
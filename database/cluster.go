@@ -0,0 +1,485 @@
+package database
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"gedis/pkg/crc16"
+	"gedis/reply"
+	"gedis/types/redis"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	slotCount       = 16384
+	clusterPortIncr = 10000 // 集群总线端口偏移, 仅用于 CLUSTER NODES 输出
+)
+
+// clusterNode 集群中的一个节点, 节点 ID 由地址计算得到, 所有节点使用相同的配置即可得到一致的 ID
+type clusterNode struct {
+	id   string
+	host string
+	port int
+}
+
+func (node *clusterNode) addr() string {
+	return net.JoinHostPort(node.host, strconv.Itoa(node.port))
+}
+
+// clusterState 静态配置的集群拓扑, 槽位归属可通过 CLUSTER SETSLOT 调整
+type clusterState struct {
+	mu        sync.RWMutex
+	self      *clusterNode
+	nodes     []*clusterNode // 按配置顺序
+	slots     [slotCount]*clusterNode
+	migrating map[int]*clusterNode // 本节点正在迁出的槽位 -> 目标节点
+	importing map[int]*clusterNode // 本节点正在迁入的槽位 -> 源节点
+	asking    sync.Map             // 发送了 ASKING 的连接, 只对下一条命令有效
+}
+
+func nodeId(addr string) string {
+	sum := sha1.Sum([]byte(addr))
+	return hex.EncodeToString(sum[:])
+}
+
+func parseNodeAddr(addr string) (*clusterNode, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in %s", addr)
+	}
+	return &clusterNode{id: nodeId(addr), host: host, port: port}, nil
+}
+
+// parseSlotRange 解析 "1000" 或 "0-5460" 形式的槽位范围
+func parseSlotRange(s string) (int, int, error) {
+	parts := strings.SplitN(s, "-", 2)
+	start, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid slot range %s", s)
+	}
+	end := start
+	if len(parts) == 2 {
+		if end, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, 0, fmt.Errorf("invalid slot range %s", s)
+		}
+	}
+	if start < 0 || end >= slotCount || start > end {
+		return 0, 0, fmt.Errorf("invalid slot range %s", s)
+	}
+	return start, end, nil
+}
+
+// makeClusterState 根据配置构建集群拓扑
+// self 为本节点对外地址, nodes 每项格式为 "host:port 槽位范围...", 例如 "127.0.0.1:7000 0-5460"
+func makeClusterState(self string, nodes []string) (*clusterState, error) {
+	cluster := &clusterState{
+		migrating: make(map[int]*clusterNode),
+		importing: make(map[int]*clusterNode),
+	}
+	for _, line := range nodes {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		node, err := parseNodeAddr(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields[1:] {
+			start, end, err := parseSlotRange(field)
+			if err != nil {
+				return nil, err
+			}
+			for slot := start; slot <= end; slot++ {
+				cluster.slots[slot] = node
+			}
+		}
+		cluster.nodes = append(cluster.nodes, node)
+		if fields[0] == self {
+			cluster.self = node
+		}
+	}
+	if cluster.self == nil {
+		node, err := parseNodeAddr(self)
+		if err != nil {
+			return nil, err
+		}
+		cluster.self = node
+		cluster.nodes = append(cluster.nodes, node)
+	}
+	return cluster, nil
+}
+
+// keySlot 计算 key 所属的槽位, key 中包含非空的 {...} 时只对花括号内的部分计算
+func keySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16.Checksum([]byte(key)) % slotCount)
+}
+
+func (cluster *clusterState) findNode(id string) *clusterNode {
+	for _, node := range cluster.nodes {
+		if node.id == id {
+			return node
+		}
+	}
+	return nil
+}
+
+// commandKeys 通过命令的 PreFunc 获取涉及的 key, 参数数量不正确时交给命令本身报错
+func commandKeys(cmdLine [][]byte) []string {
+	cmd, ok := cmdTable[strings.ToLower(string(cmdLine[0]))]
+	if !ok || cmd.prepare == nil || !validateArity(cmd.arity, cmdLine) {
+		return nil
+	}
+	write, read := cmd.prepare(cmdLine[1:])
+	return append(write, read...)
+}
+
+// redirect 检查命令涉及的 key 是否由本节点负责, 不是时返回 MOVED/ASK 等重定向错误
+func (cluster *clusterState) redirect(db *DB, c redis.Connection, cmdLine [][]byte) redis.Reply {
+	_, asking := cluster.asking.LoadAndDelete(c)
+	keys := commandKeys(cmdLine)
+	if len(keys) == 0 {
+		return nil
+	}
+	slot := keySlot(keys[0])
+	for _, key := range keys[1:] {
+		if keySlot(key) != slot {
+			return reply.MakeErrReply("CROSSSLOT Keys in request don't hash to the same slot")
+		}
+	}
+
+	cluster.mu.RLock()
+	defer cluster.mu.RUnlock()
+	owner := cluster.slots[slot]
+	if owner == nil {
+		return reply.MakeErrReply("CLUSTERDOWN Hash slot not served")
+	}
+	if owner != cluster.self {
+		if cluster.importing[slot] != nil && asking {
+			return nil
+		}
+		return reply.MakeErrReply("MOVED " + strconv.Itoa(slot) + " " + owner.addr())
+	}
+	target := cluster.migrating[slot]
+	if target == nil {
+		return nil
+	}
+	// 迁移中的槽位: key 都在本节点时直接执行, 都不在时转到目标节点, 部分存在时让客户端重试
+	// 此时还没有持有 key 的锁, 只能只读地检查 key 是否存在
+	missing := 0
+	for _, key := range keys {
+		if _, exists := db.lookupEntity(key); !exists {
+			missing++
+		}
+	}
+	if missing == 0 {
+		return nil
+	}
+	if missing == len(keys) {
+		return reply.MakeErrReply("ASK " + strconv.Itoa(slot) + " " + target.addr())
+	}
+	return reply.MakeErrReply("TRYAGAIN Multiple keys request during rehashing of slot")
+}
+
+func (cluster *clusterState) assignedSlots() int {
+	n := 0
+	for _, node := range cluster.slots {
+		if node != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// slotRanges 返回节点负责的连续槽位区间
+func (cluster *clusterState) slotRanges(node *clusterNode) [][2]int {
+	var ranges [][2]int
+	for slot := 0; slot < slotCount; slot++ {
+		if cluster.slots[slot] != node {
+			continue
+		}
+		if n := len(ranges); n > 0 && ranges[n-1][1] == slot-1 {
+			ranges[n-1][1] = slot
+		} else {
+			ranges = append(ranges, [2]int{slot, slot})
+		}
+	}
+	return ranges
+}
+
+func (cluster *clusterState) info() string {
+	state := "ok"
+	assigned := cluster.assignedSlots()
+	if assigned < slotCount {
+		state = "fail"
+	}
+	size := 0
+	for _, node := range cluster.nodes {
+		if len(cluster.slotRanges(node)) > 0 {
+			size++
+		}
+	}
+	lines := []string{
+		"cluster_enabled:1",
+		"cluster_state:" + state,
+		"cluster_slots_assigned:" + strconv.Itoa(assigned),
+		"cluster_slots_ok:" + strconv.Itoa(assigned),
+		"cluster_slots_pfail:0",
+		"cluster_slots_fail:0",
+		"cluster_known_nodes:" + strconv.Itoa(len(cluster.nodes)),
+		"cluster_size:" + strconv.Itoa(size),
+		"cluster_current_epoch:0",
+		"cluster_my_epoch:0",
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func (cluster *clusterState) nodesInfo() string {
+	var buf strings.Builder
+	for _, node := range cluster.nodes {
+		flags := "master"
+		if node == cluster.self {
+			flags = "myself,master"
+		}
+		buf.WriteString(fmt.Sprintf("%s %s:%d@%d %s - 0 0 0 connected",
+			node.id, node.host, node.port, node.port+clusterPortIncr, flags))
+		for _, r := range cluster.slotRanges(node) {
+			if r[0] == r[1] {
+				buf.WriteString(" " + strconv.Itoa(r[0]))
+			} else {
+				buf.WriteString(" " + strconv.Itoa(r[0]) + "-" + strconv.Itoa(r[1]))
+			}
+		}
+		if node == cluster.self {
+			buf.WriteString(slotStates(cluster.migrating, "->-"))
+			buf.WriteString(slotStates(cluster.importing, "-<-"))
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+func slotStates(states map[int]*clusterNode, arrow string) string {
+	slots := make([]int, 0, len(states))
+	for slot := range states {
+		slots = append(slots, slot)
+	}
+	sort.Ints(slots)
+	var buf strings.Builder
+	for _, slot := range slots {
+		buf.WriteString(" [" + strconv.Itoa(slot) + arrow + states[slot].id + "]")
+	}
+	return buf.String()
+}
+
+func (cluster *clusterState) slotsReply() redis.Reply {
+	var replies []redis.Reply
+	for _, node := range cluster.nodes {
+		for _, r := range cluster.slotRanges(node) {
+			replies = append(replies, reply.MakeMultiRawReply([]redis.Reply{
+				reply.MakeIntReply(int64(r[0])),
+				reply.MakeIntReply(int64(r[1])),
+				reply.MakeMultiRawReply([]redis.Reply{
+					reply.MakeBulkReply([]byte(node.host)),
+					reply.MakeIntReply(int64(node.port)),
+					reply.MakeBulkReply([]byte(node.id)),
+				}),
+			}))
+		}
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+// setSlot 处理 CLUSTER SETSLOT <slot> MIGRATING|IMPORTING|NODE <node-id> 及 STABLE
+func (cluster *clusterState) setSlot(args [][]byte) redis.Reply {
+	slot, err := strconv.Atoi(string(args[0]))
+	if err != nil || slot < 0 || slot >= slotCount {
+		return reply.MakeErrReply("ERR Invalid or out of range slot")
+	}
+	action := strings.ToLower(string(args[1]))
+	if action == "stable" {
+		if len(args) != 2 {
+			return reply.MakeSyntaxErrReply()
+		}
+		delete(cluster.migrating, slot)
+		delete(cluster.importing, slot)
+		return reply.MakeOkReply()
+	}
+	if len(args) != 3 {
+		return reply.MakeSyntaxErrReply()
+	}
+	node := cluster.findNode(string(args[2]))
+	if node == nil {
+		return reply.MakeErrReply("ERR I don't know about node " + string(args[2]))
+	}
+	switch action {
+	case "migrating":
+		if cluster.slots[slot] != cluster.self {
+			return reply.MakeErrReply("ERR I'm not the owner of hash slot " + strconv.Itoa(slot))
+		}
+		cluster.migrating[slot] = node
+	case "importing":
+		if cluster.slots[slot] == cluster.self {
+			return reply.MakeErrReply("ERR I'm already the owner of hash slot " + strconv.Itoa(slot))
+		}
+		cluster.importing[slot] = node
+	case "node":
+		cluster.slots[slot] = node
+		if node == cluster.self {
+			delete(cluster.importing, slot)
+		} else {
+			delete(cluster.migrating, slot)
+		}
+	default:
+		return reply.MakeErrReply("ERR Invalid CLUSTER SETSLOT action or number of arguments")
+	}
+	return reply.MakeOkReply()
+}
+
+// updateSlots 处理 CLUSTER ADDSLOTS/DELSLOTS
+func (cluster *clusterState) updateSlots(args [][]byte, add bool) redis.Reply {
+	slots := make([]int, len(args))
+	for i, arg := range args {
+		slot, err := strconv.Atoi(string(arg))
+		if err != nil || slot < 0 || slot >= slotCount {
+			return reply.MakeErrReply("ERR Invalid or out of range slot")
+		}
+		if add && cluster.slots[slot] != nil {
+			return reply.MakeErrReply("ERR Slot " + strconv.Itoa(slot) + " is already busy")
+		}
+		if !add && cluster.slots[slot] == nil {
+			return reply.MakeErrReply("ERR Slot " + strconv.Itoa(slot) + " is already unassigned")
+		}
+		slots[i] = slot
+	}
+	for _, slot := range slots {
+		if add {
+			cluster.slots[slot] = cluster.self
+		} else {
+			cluster.slots[slot] = nil
+			delete(cluster.migrating, slot)
+			delete(cluster.importing, slot)
+		}
+	}
+	return reply.MakeOkReply()
+}
+
+// keysInSlot 返回 0 号库中属于 slot 的 key, count < 0 表示不限数量
+func keysInSlot(db *DB, slot int, count int) []string {
+	var keys []string
+	for _, key := range db.keys() {
+		if count >= 0 && len(keys) >= count {
+			break
+		}
+		if keySlot(key) == slot {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func parseSlot(arg []byte) (int, bool) {
+	slot, err := strconv.Atoi(string(arg))
+	return slot, err == nil && slot >= 0 && slot < slotCount
+}
+
+// Cluster 集群管理命令
+func Cluster(mdb *MultiDB, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("cluster")
+	}
+	cluster := mdb.cluster
+	if cluster == nil {
+		return reply.MakeErrReply("ERR This instance has cluster support disabled")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch subCmd {
+	case "keyslot":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("cluster|keyslot")
+		}
+		return reply.MakeIntReply(int64(keySlot(string(args[0]))))
+	case "countkeysinslot":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("cluster|countkeysinslot")
+		}
+		slot, ok := parseSlot(args[0])
+		if !ok {
+			return reply.MakeErrReply("ERR Invalid slot")
+		}
+		return reply.MakeIntReply(int64(len(keysInSlot(mdb.dbSet[c.GetDBIndex()], slot, -1))))
+	case "getkeysinslot":
+		if len(args) != 2 {
+			return reply.MakeArgNumErrReply("cluster|getkeysinslot")
+		}
+		slot, ok := parseSlot(args[0])
+		if !ok {
+			return reply.MakeErrReply("ERR Invalid slot")
+		}
+		count, err := strconv.Atoi(string(args[1]))
+		if err != nil || count < 0 {
+			return reply.MakeErrReply("ERR Invalid number of keys")
+		}
+		keys := keysInSlot(mdb.dbSet[c.GetDBIndex()], slot, count)
+		result := make([][]byte, len(keys))
+		for i, key := range keys {
+			result[i] = []byte(key)
+		}
+		return reply.MakeMultiBulkReply(result)
+	}
+
+	if subCmd == "setslot" || subCmd == "addslots" || subCmd == "delslots" {
+		cluster.mu.Lock()
+		defer cluster.mu.Unlock()
+	} else {
+		cluster.mu.RLock()
+		defer cluster.mu.RUnlock()
+	}
+	switch subCmd {
+	case "info":
+		return reply.MakeBulkReply([]byte(cluster.info()))
+	case "nodes":
+		return reply.MakeBulkReply([]byte(cluster.nodesInfo()))
+	case "slots":
+		return cluster.slotsReply()
+	case "myid":
+		return reply.MakeBulkReply([]byte(cluster.self.id))
+	case "setslot":
+		if len(args) < 2 {
+			return reply.MakeArgNumErrReply("cluster|setslot")
+		}
+		return cluster.setSlot(args)
+	case "addslots", "delslots":
+		if len(args) == 0 {
+			return reply.MakeArgNumErrReply("cluster|" + subCmd)
+		}
+		return cluster.updateSlots(args, subCmd == "addslots")
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try CLUSTER HELP.")
+}
+
+// Asking 允许下一条命令访问本节点正在迁入的槽位
+func Asking(mdb *MultiDB, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("asking")
+	}
+	if mdb.cluster == nil {
+		return reply.MakeErrReply("ERR This instance has cluster support disabled")
+	}
+	mdb.cluster.asking.Store(c, struct{}{})
+	return reply.MakeOkReply()
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"gedis/pkg/utils"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestKeySlot(t *testing.T) {
+	if slot := keySlot("foo"); slot != 12182 {
+		t.Errorf("slot of foo: %d", slot)
+	}
+	if keySlot("{user1}.a") != keySlot("{user1}.b") || keySlot("{user1}.a") != keySlot("user1") {
+		t.Error("keys with the same hash tag should be in the same slot")
+	}
+	if keySlot("{}.a") == keySlot("{}.b") { // 空的花括号不作为 hash tag
+		t.Error("empty hash tag should be ignored")
+	}
+}
+
+func TestClusterRedirect(t *testing.T) {
+	cluster, err := makeClusterState("127.0.0.1:7000", []string{"127.0.0.1:7000 0-8191", "127.0.0.1:7001 8192-16383"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := makeDB()
+	if result := cluster.redirect(db, nil, utils.ToCmdLine("GET", "foo")); result == nil || string(result.ToBytes()) != "-MOVED 12182 127.0.0.1:7001\r\n" {
+		t.Errorf("GET foo: %v", result)
+	}
+	if result := cluster.redirect(db, nil, utils.ToCmdLine("GET", "{user1}.a")); result != nil {
+		t.Errorf("GET {user1}.a: %s", result.ToBytes())
+	}
+	if result := cluster.redirect(db, nil, utils.ToCmdLine("MSET", "a", "1", "b", "2")); result == nil {
+		t.Error("expect CROSSSLOT")
+	}
+}
+
+func TestClusterRedirectMigrating(t *testing.T) {
+	cluster, err := makeClusterState("127.0.0.1:7000", []string{"127.0.0.1:7000 0-16383", "127.0.0.1:7001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot := keySlot("{user1}.a")
+	cluster.migrating[slot] = cluster.nodes[1]
+	db := makeDB()
+	db.Exec(nil, utils.ToCmdLine("SET", "{user1}.a", "1"))
+	db.Exec(nil, utils.ToCmdLine("SET", "{user1}.b", "1"))
+	db.Expire("{user1}.b", time.Now().Add(-time.Second))
+
+	if result := cluster.redirect(db, nil, utils.ToCmdLine("GET", "{user1}.a")); result != nil {
+		t.Errorf("GET {user1}.a: %s", result.ToBytes())
+	}
+	expect := "-ASK " + strconv.Itoa(slot) + " 127.0.0.1:7001\r\n"
+	if result := cluster.redirect(db, nil, utils.ToCmdLine("GET", "{user1}.b")); result == nil || string(result.ToBytes()) != expect {
+		t.Errorf("GET {user1}.b: %v", result)
+	}
+	if result := cluster.redirect(db, nil, utils.ToCmdLine("MGET", "{user1}.a", "{user1}.b")); result == nil {
+		t.Error("expect TRYAGAIN")
+	}
+	// 重定向检查不持有锁, 不能删除过期的 key
+	if _, ok := db.data.Get("{user1}.b"); !ok {
+		t.Error("redirect should not remove expired keys")
+	}
+}
@@ -1,8 +1,6 @@
 package database
 
 import (
-	"fmt"
-	"gedis/pkg/timewheel"
 	"gedis/reply"
 	"gedis/types/cmd"
 	"gedis/types/dict"
@@ -10,6 +8,7 @@ import (
 	"gedis/types/redis"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,6 +26,12 @@ type DB struct {
 	stopWorld  sync.WaitGroup // WaitGroup, Flush 时加锁保护
 	locker     *lock.Locks    // 命令执行锁
 	addAof     func(CmdLine)  // 添加到Aof log函数
+	storage    *LevelDb       // 磁盘存储引擎, 为 nil 时只使用内存
+	maxHotKeys int            // 常驻内存的最大 key 数量, 0 表示全部常驻
+	blocking   *blockingQueue // 阻塞在本库 key 上的客户端
+
+	expireCursor uint64 // 主动过期清理遍历 ttlMap 的游标
+	usedMemory   int64  // 库中数据的估算内存占用, 用于 maxmemory 淘汰
 }
 
 // ExecFunc Redis Execute function
@@ -41,8 +46,8 @@ type CmdLine = [][]byte
 // UndoFunc 指定命令行的撤消日志函数, 撤消时从头到尾执行
 type UndoFunc func(db *DB, args [][]byte) [][][]byte
 
-func genExpireTask(key string) string {
-	return "expire:" + key
+func genFieldExpireTask(key string) string {
+	return "hexpire:" + key
 }
 
 func makeDB() *DB {
@@ -52,6 +57,7 @@ func makeDB() *DB {
 		versionMap: dict.MakeConcurrent(dataDictSize),
 		locker:     lock.Make(lockerSize),
 		addAof:     func(line CmdLine) {},
+		blocking:   makeBlockingQueue(),
 	}
 	return db
 }
@@ -63,6 +69,7 @@ func makeBasicDB() *DB {
 		versionMap: dict.MakeSimple(),
 		locker:     lock.Make(1),
 		addAof:     func(line CmdLine) {},
+		blocking:   makeBlockingQueue(),
 	}
 	return db
 }
@@ -84,7 +91,9 @@ func (db *DB) Exec(c redis.Connection, cmdLine [][]byte) redis.Reply {
 		if len(cmdLine) != 1 {
 			return reply.MakeArgNumErrReply(cmdName)
 		}
-		return execMulti(db, c)
+		result := execMulti(db, c)
+		db.evictColdKeys()
+		return result
 	} else if cmdName == cmd.Watch {
 		if !validateArity(-2, cmdLine) {
 			return reply.MakeArgNumErrReply(cmdName)
@@ -96,7 +105,9 @@ func (db *DB) Exec(c redis.Connection, cmdLine [][]byte) redis.Reply {
 		return reply.MakeQueuedReply()
 	}
 
-	return db.execNormalCommand(cmdLine)
+	result := db.execNormalCommand(cmdLine)
+	db.evictColdKeys()
+	return result
 }
 
 func (db *DB) execNormalCommand(cmdLine [][]byte) redis.Reply {
@@ -115,7 +126,11 @@ func (db *DB) execNormalCommand(cmdLine [][]byte) redis.Reply {
 	db.RWLocks(write, read)
 	defer db.RWUnLocks(write, read)
 	fun := cmd.executor
-	return fun(db, cmdLine[1:])
+	result := fun(db, cmdLine[1:])
+	db.updateMemory(write...)
+	db.persist(write...)
+	db.blocking.signal(write...)
+	return result
 }
 
 // validateArity 验证参数数量
@@ -133,40 +148,92 @@ func (db *DB) GetEntity(key string) (*redis.DataEntity, bool) {
 
 	raw, ok := db.data.Get(key)
 	if !ok {
+		if db.storage != nil && db.maxHotKeys > 0 {
+			return db.loadFromStorage(key)
+		}
 		return nil, false
 	}
 	if db.IsExpired(key) {
 		return nil, false
 	}
 	entity, _ := raw.(*redis.DataEntity)
+	if isHollowEntity(entity) {
+		return nil, false
+	}
+	touchEntity(entity)
 	return entity, true
 }
 
+// isHollowEntity hash 的 field 都已过期但还没有被清理时, 视为 key 不存在
+func isHollowEntity(entity *redis.DataEntity) bool {
+	hash, ok := entity.Data.(dict.Expirable)
+	return ok && hash.Len() == 0
+}
+
 // PutEntity a DataEntity into DB
 func (db *DB) PutEntity(key string, entity *redis.DataEntity) int {
 	db.stopWorld.Wait()
+	if hash, ok := entity.Data.(dict.Expirable); ok {
+		db.scheduleFieldExpire(key, hash)
+	}
+	old, _ := db.data.Get(key)
+	db.trackEntity(key, old, entity)
 	return db.data.Put(key, entity)
 }
 
+// resolveKey 条件写入前整理 key 的状态, 使 db.data 中是否存在 key 与读命令看到的一致
+// 已过期但还没有被 activeExpireCycle 清理的 key 与 GetEntity 一样惰性删除,
+// 冷数据模式下只在 LevelDB 中的 key 先读回内存, field 都已过期的 hash 直接删除
+func (db *DB) resolveKey(key string) {
+	if db.IsExpired(key) {
+		return
+	}
+	raw, ok := db.data.Get(key)
+	if !ok {
+		if db.storage != nil && db.maxHotKeys > 0 {
+			db.loadFromStorage(key)
+		}
+		return
+	}
+	if entity, _ := raw.(*redis.DataEntity); isHollowEntity(entity) {
+		db.Remove(key)
+	}
+}
+
 // PutIfExists edit an existing DataEntity
 func (db *DB) PutIfExists(key string, entity *redis.DataEntity) int {
 	db.stopWorld.Wait()
+	db.resolveKey(key)
+	old, exists := db.data.Get(key)
+	if !exists {
+		return 0
+	}
+	db.trackEntity(key, old, entity)
 	return db.data.PutIfExists(key, entity)
 }
 
 // PutIfAbsent insert an DataEntity only if the key not exists
 func (db *DB) PutIfAbsent(key string, entity *redis.DataEntity) int {
 	db.stopWorld.Wait()
+	db.resolveKey(key)
+	if db.data.Exists(key) {
+		return 0
+	}
+	db.trackEntity(key, nil, entity)
 	return db.data.PutIfAbsent(key, entity)
 }
 
 // Remove remove key from db
 func (db *DB) Remove(key string) {
 	db.stopWorld.Wait()
+	if raw, ok := db.data.Get(key); ok {
+		db.untrackEntity(raw)
+	}
 	db.data.Remove(key)
 	db.ttlMap.Remove(key)
-	taskKey := genExpireTask(key)
-	timewheel.Cancel(taskKey)
+	if db.storage != nil {
+		_ = db.storage.Delete(db.storageKey(key))
+	}
 }
 
 // Removes remove keys from db
@@ -174,7 +241,7 @@ func (db *DB) Removes(keys ...string) (deleted int) {
 	db.stopWorld.Wait()
 	deleted = 0
 	for _, key := range keys {
-		_, exists := db.data.Get(key)
+		_, exists := db.GetEntity(key)
 		if exists {
 			db.Remove(key)
 			deleted++
@@ -190,7 +257,11 @@ func (db *DB) Flush() {
 
 	db.data.Clear()
 	db.ttlMap.Clear()
+	atomic.StoreInt64(&db.usedMemory, 0)
 	db.locker = lock.Make(lockerSize)
+	if db.storage != nil {
+		_ = db.storage.DeletePrefix(db.storagePrefix())
+	}
 }
 
 // RWLocks lock keys for writing and reading
@@ -203,38 +274,19 @@ func (db *DB) RWUnLocks(writeKeys []string, readKeys []string) {
 	db.locker.RWUnLocks(writeKeys, readKeys)
 }
 
-// Expire sets ttlCmd of key
+// Expire sets ttlCmd of key, 过期的 key 由 IsExpired 及 activeExpireCycle 删除
 func (db *DB) Expire(key string, expireTime time.Time) {
 	db.stopWorld.Wait()
 	db.ttlMap.Put(key, expireTime)
-	taskKey := genExpireTask(key)
-	timewheel.At(expireTime, taskKey, func() {
-		keys := []string{key}
-		db.RWLocks(keys, nil)
-		defer db.RWUnLocks(keys, nil)
-
-		rawExpireTime, ok := db.ttlMap.Get(key)
-		if !ok {
-			return
-		}
-		expireTime, _ := rawExpireTime.(time.Time)
-		expired := time.Now().After(expireTime)
-		if expired {
-			fmt.Printf("Key过期, 删除key: %s", key)
-			db.Remove(key)
-		}
-	})
 }
 
 // Persist cancel ttlCmd of key
 func (db *DB) Persist(key string) {
 	db.stopWorld.Wait()
 	db.ttlMap.Remove(key)
-	taskKey := genExpireTask(key)
-	timewheel.Cancel(taskKey)
 }
 
-// IsExpired check whether a key is expired
+// IsExpired check whether a key is expired, 已过期时删除 key
 func (db *DB) IsExpired(key string) bool {
 	rawExpireTime, ok := db.ttlMap.Get(key)
 	if !ok {
@@ -244,6 +296,7 @@ func (db *DB) IsExpired(key string) bool {
 	expired := time.Now().After(expireTime)
 	if expired {
 		db.Remove(key)
+		atomic.AddInt64(&expiredKeys, 1)
 	}
 	return expired
 }
@@ -267,6 +320,9 @@ func (db *DB) GetVersion(key string) uint32 {
 func (db *DB) ForEach(cb func(key string, data *redis.DataEntity, expiration *time.Time) bool) {
 	db.data.ForEach(func(key string, raw interface{}) bool {
 		entity, _ := raw.(*redis.DataEntity)
+		if isHollowEntity(entity) {
+			return true
+		}
 		var expiration *time.Time
 		rawExpireTime, ok := db.ttlMap.Get(key)
 		if ok {
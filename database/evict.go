@@ -0,0 +1,374 @@
+package database
+
+import (
+	"gedis/config"
+	"gedis/pkg/utils"
+	"gedis/reply"
+	"gedis/types/cmd"
+	"gedis/types/dict"
+	"gedis/types/list"
+	"gedis/types/redis"
+	HashSet "gedis/types/set"
+	"gedis/types/stream"
+	SortedSet "gedis/types/zset"
+	"math"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 与 redis 一致, 数据占用的内存超过 maxmemory 时, 在执行命令前按 maxmemory-policy 淘汰 key,
+// 无法淘汰时拒绝会增加内存占用的写命令. 内存占用由每个 DataEntity 的估算大小累加得到, 并不是进程的实际内存
+
+const (
+	policyNoEviction     = "noeviction"
+	policyAllKeysLRU     = "allkeys-lru"
+	policyVolatileLRU    = "volatile-lru"
+	policyAllKeysLFU     = "allkeys-lfu"
+	policyVolatileLFU    = "volatile-lfu"
+	policyAllKeysRandom  = "allkeys-random"
+	policyVolatileRandom = "volatile-random"
+	policyVolatileTTL    = "volatile-ttl"
+)
+
+const (
+	lfuInitValue = 5  // 新 key 的访问计数, 避免刚写入就被淘汰
+	lfuLogFactor = 10 // 计数增长的对数因子, 计数越大增长越慢
+	lfuDecayTime = 1  // 每经过多少分钟访问计数减 1
+
+	entityOverhead  = 64 // 每个 key 的固定开销: DataEntity, 字典节点及 key 字符串头
+	elementOverhead = 16 // 集合类型中每个元素的额外开销
+	sizeSamples     = 5  // 与 redis MEMORY USAGE 一致, 集合类型只采样前 5 个元素估算大小
+)
+
+const oomErr = "OOM command not allowed when used memory > 'maxmemory'."
+
+var (
+	maxMemory        int64 // 数据占用的内存上限(字节), 0 表示不限制
+	maxMemoryPolicy  = policyNoEviction
+	maxMemorySamples = 5
+
+	evictedKeys int64  // 启动以来淘汰的 key 数量
+	nextEvictDB uint32 // random 策略轮流从各个库淘汰
+)
+
+// applyMemoryConfig 设置 maxmemory 及淘汰策略, 在加载数据之后调用, 加载过程中不会淘汰 key
+func applyMemoryConfig() {
+	server := config.Get().Server
+	switch server.MaxMemoryPolicy {
+	case policyNoEviction, policyAllKeysLRU, policyVolatileLRU, policyAllKeysLFU, policyVolatileLFU,
+		policyAllKeysRandom, policyVolatileRandom, policyVolatileTTL:
+	default:
+		panic("invalid MaxMemoryPolicy: " + server.MaxMemoryPolicy)
+	}
+	maxMemoryPolicy = server.MaxMemoryPolicy
+	maxMemory = server.MaxMemory
+	if server.MaxMemorySamples > 0 {
+		maxMemorySamples = server.MaxMemorySamples
+	}
+}
+
+func isLFUPolicy() bool {
+	return maxMemoryPolicy == policyAllKeysLFU || maxMemoryPolicy == policyVolatileLFU
+}
+
+// lfuMinutes 当前时间的分钟数, 只保留 16 位
+func lfuMinutes() uint32 {
+	return uint32(time.Now().Unix()/60) & 0xffff
+}
+
+// lfuDecr 返回按上次衰减后经过的时间衰减后的访问计数
+func lfuDecr(access uint32) uint32 {
+	ldt, counter := access>>8, access&0xff
+	now := lfuMinutes()
+	elapsed := now - ldt
+	if now < ldt { // 16 位分钟数已回绕
+		elapsed = 0xffff - ldt + now
+	}
+	if periods := elapsed / lfuDecayTime; periods > 0 {
+		if periods > counter {
+			return 0
+		}
+		return counter - periods
+	}
+	return counter
+}
+
+// lfuIncr 以对数概率增加访问计数, 最大为 255
+func lfuIncr(counter uint32) uint32 {
+	if counter == 255 {
+		return counter
+	}
+	base := float64(counter) - lfuInitValue
+	if base < 0 {
+		base = 0
+	}
+	if rand.Float64() < 1/(base*lfuLogFactor+1) {
+		counter++
+	}
+	return counter
+}
+
+// initAccess 设置新写入的 key 的访问信息
+func initAccess(entity *redis.DataEntity) {
+	if isLFUPolicy() {
+		atomic.StoreUint32(&entity.Access, lfuMinutes()<<8|lfuInitValue)
+	} else {
+		atomic.StoreUint32(&entity.Access, uint32(time.Now().Unix()))
+	}
+}
+
+// touchEntity 记录一次访问, LFU 策略下更新访问计数, 其它策略下更新访问时间
+func touchEntity(entity *redis.DataEntity) {
+	if isLFUPolicy() {
+		counter := lfuIncr(lfuDecr(atomic.LoadUint32(&entity.Access)))
+		atomic.StoreUint32(&entity.Access, lfuMinutes()<<8|counter)
+	} else {
+		atomic.StoreUint32(&entity.Access, uint32(time.Now().Unix()))
+	}
+}
+
+// estimateSize 估算 key 及其数据占用的内存
+func estimateSize(key string, data interface{}) int64 {
+	size := int64(entityOverhead + len(key))
+	switch val := data.(type) {
+	case []byte:
+		size += int64(len(val))
+	case list.List:
+		size += sampleSize(val.Len(), func(visit func(int) bool) {
+			val.ForEach(func(_ int, v interface{}) bool {
+				b, _ := v.([]byte)
+				return visit(len(b))
+			})
+		})
+	case dict.Dict:
+		size += sampleSize(val.Len(), func(visit func(int) bool) {
+			val.Scan(0, sizeSamples, func(field string, v interface{}) bool {
+				b, _ := v.([]byte)
+				return visit(len(field) + len(b))
+			})
+		})
+	case *HashSet.Set:
+		size += sampleSize(val.Len(), func(visit func(int) bool) {
+			val.Scan(0, sizeSamples, func(member string) bool {
+				return visit(len(member))
+			})
+		})
+	case *SortedSet.SortedSet:
+		n := val.Len()
+		stop := n
+		if stop > sizeSamples {
+			stop = sizeSamples
+		}
+		size += sampleSize(int(n), func(visit func(int) bool) {
+			if n > 0 {
+				val.ForEach(0, stop, false, func(element *SortedSet.Element) bool {
+					return visit(len(element.Member) + 8) // score
+				})
+			}
+		})
+	case *stream.Stream:
+		size += sampleSize(val.Len(), func(visit func(int) bool) {
+			val.ForEach(func(entry *stream.Entry) bool {
+				fieldsSize := 16 // ID
+				for _, field := range entry.Fields {
+					fieldsSize += len(field)
+				}
+				return visit(fieldsSize)
+			})
+		})
+	}
+	return size
+}
+
+// sampleSize 以前 sizeSamples 个元素的平均大小估算 n 个元素的总大小
+func sampleSize(n int, each func(visit func(int) bool)) int64 {
+	var total, count int
+	each(func(size int) bool {
+		total += size
+		count++
+		return count < sizeSamples
+	})
+	if count == 0 {
+		return 0
+	}
+	return int64(n) * (int64(total)/int64(count) + elementOverhead)
+}
+
+// trackEntity 记录新写入的 entity 的内存占用, old 为被替换的 entity, 调用方需持有 key 的锁
+func (db *DB) trackEntity(key string, old interface{}, entity *redis.DataEntity) {
+	if oldEntity, ok := old.(*redis.DataEntity); ok {
+		if oldEntity == entity {
+			return
+		}
+		atomic.AddInt64(&db.usedMemory, -oldEntity.Size)
+		// 与 redis 一致, 覆盖写入时保留原来的访问信息
+		atomic.StoreUint32(&entity.Access, atomic.LoadUint32(&oldEntity.Access))
+		touchEntity(entity)
+	} else {
+		initAccess(entity)
+	}
+	entity.Size = estimateSize(key, entity.Data)
+	atomic.AddInt64(&db.usedMemory, entity.Size)
+}
+
+// untrackEntity 释放 entity 的内存占用
+func (db *DB) untrackEntity(raw interface{}) {
+	if entity, ok := raw.(*redis.DataEntity); ok {
+		atomic.AddInt64(&db.usedMemory, -entity.Size)
+	}
+}
+
+// updateMemory 命令执行后重新估算被修改的 key 的内存占用, 调用方需持有 key 的锁
+func (db *DB) updateMemory(keys ...string) {
+	for _, key := range keys {
+		raw, ok := db.data.Get(key)
+		if !ok {
+			continue
+		}
+		entity, _ := raw.(*redis.DataEntity)
+		size := estimateSize(key, entity.Data)
+		atomic.AddInt64(&db.usedMemory, size-entity.Size)
+		entity.Size = size
+	}
+}
+
+// usedMemory 所有库中数据的估算内存占用
+func (mdb *MultiDB) usedMemory() int64 {
+	var used int64
+	for _, db := range mdb.dbSet {
+		used += atomic.LoadInt64(&db.usedMemory)
+	}
+	return used
+}
+
+// checkMemory 超出 maxmemory 时淘汰 key, 无法释放足够的内存且命令会增加内存占用时返回 OOM 错误
+func (mdb *MultiDB) checkMemory(c redis.Connection, cmdName string) redis.Reply {
+	if maxMemory <= 0 || mdb.repl.readOnly.Get() { // 与 redis 一致, 副本不主动淘汰, 由主节点同步删除
+		return nil
+	}
+	mdb.pausing.RLock()
+	freed := mdb.freeMemoryIfNeeded()
+	mdb.pausing.RUnlock()
+	if freed {
+		return nil
+	}
+	denyOOM := isDenyOOMCommand(cmdName)
+	if cmdName == cmd.Exec && c != nil && c.InMultiState() {
+		for _, cmdLine := range c.GetQueuedCmdLine() {
+			denyOOM = denyOOM || isDenyOOMCommand(strings.ToLower(string(cmdLine[0])))
+		}
+	}
+	if denyOOM {
+		return reply.MakeErrReply(oomErr)
+	}
+	return nil
+}
+
+// freeMemoryIfNeeded 按淘汰策略删除 key 直到内存占用不超过 maxmemory, 没有可淘汰的 key 时返回 false
+func (mdb *MultiDB) freeMemoryIfNeeded() bool {
+	for mdb.usedMemory() > maxMemory {
+		if maxMemoryPolicy == policyNoEviction {
+			return false
+		}
+		db, key := mdb.evictionCandidate()
+		if db == nil {
+			return false
+		}
+		db.evict(key)
+	}
+	return true
+}
+
+// evictionCandidate 按淘汰策略选出一个 key: random 策略轮流从各个库随机选择,
+// 其它策略从每个库采样 maxMemorySamples 个 key, 选出空闲时间最长/访问频率最低/最先过期的 key
+func (mdb *MultiDB) evictionCandidate() (*DB, string) {
+	volatile := maxMemoryPolicy == policyVolatileLRU || maxMemoryPolicy == policyVolatileLFU ||
+		maxMemoryPolicy == policyVolatileRandom || maxMemoryPolicy == policyVolatileTTL
+	keyDict := func(db *DB) (dict.Dict, int) { // 采样的字典及其分片数量
+		if volatile {
+			return db.ttlMap, ttlDictSize
+		}
+		return db.data, dataDictSize
+	}
+
+	if maxMemoryPolicy == policyAllKeysRandom || maxMemoryPolicy == policyVolatileRandom {
+		for i := 0; i < len(mdb.dbSet); i++ {
+			db := mdb.dbSet[atomic.AddUint32(&nextEvictDB, 1)%uint32(len(mdb.dbSet))]
+			d, shards := keyDict(db)
+			if keys := sampleKeys(d, shards, 1); len(keys) > 0 {
+				return db, keys[0]
+			}
+		}
+		return nil, ""
+	}
+
+	var bestDB *DB
+	var bestKey string
+	var bestScore int64 = -1
+	now := time.Now()
+	for _, db := range mdb.dbSet {
+		d, shards := keyDict(db)
+		for _, key := range sampleKeys(d, shards, maxMemorySamples) {
+			var score int64
+			if maxMemoryPolicy == policyVolatileTTL {
+				rawExpireTime, ok := db.ttlMap.Get(key)
+				if !ok {
+					continue
+				}
+				expireTime, _ := rawExpireTime.(time.Time)
+				score = math.MaxInt64 - expireTime.UnixNano()/int64(time.Millisecond)
+			} else {
+				raw, ok := db.data.Get(key)
+				if !ok {
+					continue
+				}
+				entity, _ := raw.(*redis.DataEntity)
+				access := atomic.LoadUint32(&entity.Access)
+				if isLFUPolicy() {
+					score = 255 - int64(lfuDecr(access))
+				} else {
+					score = now.Unix() - int64(access)
+				}
+			}
+			if score > bestScore {
+				bestDB, bestKey, bestScore = db, key, score
+			}
+		}
+	}
+	return bestDB, bestKey
+}
+
+// sampleKeys 从随机的分片开始遍历字典, 返回至多 count 个 key
+func sampleKeys(d dict.Dict, shards int, count int) []string {
+	if d.Len() == 0 {
+		return nil
+	}
+	keys := make([]string, 0, count)
+	collect := func(key string, _ interface{}) bool {
+		keys = append(keys, key)
+		return len(keys) < count
+	}
+	if next := d.Scan(uint64(rand.Intn(shards)), count, collect); next == 0 && len(keys) < count {
+		d.Scan(0, count-len(keys), collect)
+	}
+	if len(keys) > count {
+		keys = keys[:count]
+	}
+	return keys
+}
+
+// evict 删除被淘汰的 key, 并同步给 Aof 及副本
+func (db *DB) evict(key string) {
+	keys := []string{key}
+	db.RWLocks(keys, nil)
+	defer db.RWUnLocks(keys, nil)
+	if _, ok := db.data.Get(key); !ok {
+		return
+	}
+	db.Remove(key)
+	db.addAof(utils.ToCmdLine("DEL", key))
+	db.addVersion(key)
+	atomic.AddInt64(&evictedKeys, 1)
+}
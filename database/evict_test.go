@@ -0,0 +1,167 @@
+package database
+
+import (
+	"gedis/pkg/utils"
+	"gedis/reply"
+	"gedis/types/redis"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setMaxMemory 修改淘汰配置, 测试结束后恢复, 采样数量足够大时淘汰结果是确定的
+func setMaxMemory(t *testing.T, max int64, policy string) {
+	oldMax, oldPolicy, oldSamples := maxMemory, maxMemoryPolicy, maxMemorySamples
+	maxMemory, maxMemoryPolicy, maxMemorySamples = max, policy, 1000
+	t.Cleanup(func() {
+		maxMemory, maxMemoryPolicy, maxMemorySamples = oldMax, oldPolicy, oldSamples
+	})
+}
+
+func makeEvictMultiDB() *MultiDB {
+	mdb := &MultiDB{dbSet: []*DB{makeDB(), makeDB()}}
+	mdb.repl = makeReplication(0)
+	return mdb
+}
+
+func TestUsedMemory(t *testing.T) {
+	db := makeDB()
+	db.Exec(nil, utils.ToCmdLine("SET", "str", "value"))
+	if used := atomic.LoadInt64(&db.usedMemory); used != estimateSize("str", []byte("value")) {
+		t.Errorf("expect %d, actual %d", estimateSize("str", []byte("value")), used)
+	}
+	db.Exec(nil, utils.ToCmdLine("RPUSH", "list", "a", "b", "c"))
+	before := atomic.LoadInt64(&db.usedMemory)
+	db.Exec(nil, utils.ToCmdLine("RPUSH", "list", "d", "e", "f"))
+	if after := atomic.LoadInt64(&db.usedMemory); after <= before {
+		t.Errorf("expect used memory to grow after RPUSH, before %d, after %d", before, after)
+	}
+	db.Exec(nil, utils.ToCmdLine("SET", "str", "a much longer value"))
+	db.Exec(nil, utils.ToCmdLine("DEL", "str", "list"))
+	if used := atomic.LoadInt64(&db.usedMemory); used != 0 {
+		t.Errorf("expect 0 after DEL, actual %d", used)
+	}
+	db.Exec(nil, utils.ToCmdLine("HSET", "hash", "f", "v"))
+	db.Exec(nil, utils.ToCmdLine("FLUSHDB"))
+	if used := atomic.LoadInt64(&db.usedMemory); used != 0 {
+		t.Errorf("expect 0 after FLUSHDB, actual %d", used)
+	}
+}
+
+func TestEvictAllKeysLRU(t *testing.T) {
+	mdb := makeEvictMultiDB()
+	for i, db := range mdb.dbSet {
+		for j := 0; j < 50; j++ {
+			db.Exec(nil, utils.ToCmdLine("SET", "k"+strconv.Itoa(i*50+j), "value"))
+		}
+	}
+	// 前 20 个 key 最近被访问过
+	for i, db := range mdb.dbSet {
+		db.ForEach(func(key string, entity *redis.DataEntity, _ *time.Time) bool {
+			n, _ := strconv.Atoi(key[1:])
+			if n >= 20 {
+				atomic.StoreUint32(&entity.Access, uint32(time.Now().Unix())-100-uint32(i))
+			}
+			return true
+		})
+	}
+	setMaxMemory(t, mdb.usedMemory()/2, policyAllKeysLRU)
+	if !mdb.freeMemoryIfNeeded() {
+		t.Fatal("expect eviction succeeded")
+	}
+	if mdb.usedMemory() > maxMemory {
+		t.Errorf("expect used memory <= %d, actual %d", maxMemory, mdb.usedMemory())
+	}
+	for i := 0; i < 20; i++ {
+		key := "k" + strconv.Itoa(i)
+		if _, ok := mdb.dbSet[i/50].GetEntity(key); !ok {
+			t.Errorf("recently accessed key %s should not be evicted", key)
+		}
+	}
+}
+
+func TestEvictAllKeysLFU(t *testing.T) {
+	setMaxMemory(t, 0, policyAllKeysLFU)
+	mdb := makeEvictMultiDB()
+	db := mdb.dbSet[0]
+	for i := 0; i < 100; i++ {
+		db.Exec(nil, utils.ToCmdLine("SET", "k"+strconv.Itoa(i), "value"))
+	}
+	for i := 0; i < 200; i++ {
+		for j := 0; j < 10; j++ {
+			db.Exec(nil, utils.ToCmdLine("GET", "k"+strconv.Itoa(j)))
+		}
+	}
+	result := db.Exec(nil, utils.ToCmdLine("OBJECT", "FREQ", "k0"))
+	if intResult, ok := result.(*reply.IntReply); !ok || intResult.Code <= lfuInitValue {
+		t.Errorf("expect frequency > %d, actual %s", lfuInitValue, string(result.ToBytes()))
+	}
+	maxMemory = mdb.usedMemory() / 2
+	if !mdb.freeMemoryIfNeeded() {
+		t.Fatal("expect eviction succeeded")
+	}
+	for j := 0; j < 10; j++ {
+		if _, ok := db.GetEntity("k" + strconv.Itoa(j)); !ok {
+			t.Errorf("frequently accessed key k%d should not be evicted", j)
+		}
+	}
+	if evicted := 100 - db.data.Len(); evicted != 50 {
+		t.Errorf("expect 50 evicted keys, actual %d", evicted)
+	}
+}
+
+func TestEvictVolatileTTL(t *testing.T) {
+	mdb := makeEvictMultiDB()
+	db := mdb.dbSet[1]
+	for i := 0; i < 10; i++ {
+		db.Exec(nil, utils.ToCmdLine("SET", "persist"+strconv.Itoa(i), "value"))
+		db.Exec(nil, utils.ToCmdLine("SET", "ttl"+strconv.Itoa(i), "value", "EX", strconv.Itoa(100+i)))
+	}
+	setMaxMemory(t, mdb.usedMemory()-1, policyVolatileTTL)
+	if !mdb.freeMemoryIfNeeded() {
+		t.Fatal("expect eviction succeeded")
+	}
+	if _, ok := db.GetEntity("ttl0"); ok {
+		t.Error("expect the key closest to expiration to be evicted")
+	}
+	if db.data.Len() != 19 {
+		t.Errorf("expect 19 keys, actual %d", db.data.Len())
+	}
+
+	// 没有设置过期时间的 key 不会被淘汰, 只允许不增加内存占用的命令
+	maxMemory = 1
+	if mdb.freeMemoryIfNeeded() {
+		t.Error("expect eviction failed")
+	}
+	if db.ttlMap.Len() != 0 || db.data.Len() != 10 {
+		t.Errorf("expect only persistent keys left, actual %d keys and %d ttl", db.data.Len(), db.ttlMap.Len())
+	}
+	if result := mdb.checkMemory(nil, "set"); result == nil || string(result.ToBytes()) != "-"+oomErr+"\r\n" {
+		t.Errorf("expect OOM error for SET")
+	}
+	for _, cmdName := range []string{"get", "del", "lpop", "expire"} {
+		if result := mdb.checkMemory(nil, cmdName); result != nil {
+			t.Errorf("expect %s allowed, actual %s", cmdName, string(result.ToBytes()))
+		}
+	}
+}
+
+func TestNoEviction(t *testing.T) {
+	mdb := makeEvictMultiDB()
+	mdb.dbSet[0].Exec(nil, utils.ToCmdLine("SET", "k", "v"))
+	setMaxMemory(t, 1, policyNoEviction)
+	if result := mdb.checkMemory(nil, "set"); result == nil {
+		t.Error("expect OOM error for SET")
+	}
+	if result := mdb.checkMemory(nil, "get"); result != nil {
+		t.Errorf("expect GET allowed, actual %s", string(result.ToBytes()))
+	}
+	if mdb.dbSet[0].data.Len() != 1 {
+		t.Error("expect no key evicted")
+	}
+	maxMemory = 0
+	if result := mdb.checkMemory(nil, "set"); result != nil {
+		t.Errorf("expect no limit, actual %s", string(result.ToBytes()))
+	}
+}
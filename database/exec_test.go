@@ -0,0 +1,23 @@
+package database
+
+import (
+	"gedis/pkg/utils"
+	"testing"
+)
+
+// cmdCase 一条命令及其期望的回复
+type cmdCase struct {
+	cmdLine []string
+	expect  string
+}
+
+// runCases 按顺序执行命令, 比较回复与期望是否一致
+func runCases(t *testing.T, db *DB, cases []cmdCase) {
+	t.Helper()
+	for _, c := range cases {
+		result := db.Exec(nil, utils.ToCmdLine(c.cmdLine...))
+		if string(result.ToBytes()) != c.expect {
+			t.Errorf("%v: expect %q, actual %q", c.cmdLine, c.expect, result.ToBytes())
+		}
+	}
+}
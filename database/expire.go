@@ -0,0 +1,100 @@
+package database
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// 过期 key 的清理与 redis 一致分为两种: 访问时由 IsExpired 惰性删除,
+// 以及 serverCron 每秒执行 hz 次的 activeExpireCycle, 逐个库遍历 ttlMap 删除已过期的 key
+
+const (
+	activeExpireKeysPerLoop     = 20 // 每轮检查的 key 数量
+	activeExpireAcceptableStale = 10 // 一轮中过期 key 的百分比不超过该值时结束本库的清理
+	activeExpireCyclePercent    = 25 // 清理最多占用的时间百分比
+	activeExpireMaxLoops        = 16 // 每个库每次清理的最大轮数, 避免 ttlMap 很小时反复遍历
+)
+
+var (
+	expiredKeys            int64  // 启动以来过期删除的 key 数量
+	expiredTimeCapReached  int64  // 因超出时间限制提前结束的清理次数
+	expiredStalePercentage uint64 // 估算的已过期但未删除的 key 的比例, math.Float64bits
+)
+
+// activeExpire 从游标处继续遍历 ttlMap, 删除已过期的 key, 返回检查及删除的数量
+func (db *DB) activeExpire(count int) (checked int, expired int) {
+	var keys []string
+	db.expireCursor = db.ttlMap.Scan(db.expireCursor, count, func(key string, _ interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	now := time.Now()
+	for _, key := range keys {
+		checked++
+		rawExpireTime, ok := db.ttlMap.Get(key)
+		if !ok {
+			continue
+		}
+		if expireTime, _ := rawExpireTime.(time.Time); !now.After(expireTime) {
+			continue
+		}
+		lockKeys := []string{key}
+		db.RWLocks(lockKeys, nil)
+		if db.IsExpired(key) {
+			expired++
+		}
+		db.RWUnLocks(lockKeys, nil)
+	}
+	return checked, expired
+}
+
+// activeExpireCycle 依次清理每个库, 过期 key 比例较高时在同一个库上继续清理,
+// 超出时间限制时结束, 下一次从未完成的库开始
+func (mdb *MultiDB) activeExpireCycle(hz int) {
+	start := time.Now()
+	timeLimit := time.Second * activeExpireCyclePercent / 100 / time.Duration(hz)
+	var totalChecked, totalExpired int
+	for i := 0; i < len(mdb.dbSet); i++ {
+		db := mdb.dbSet[mdb.expireDB]
+		for loop := 0; loop < activeExpireMaxLoops && db.ttlMap.Len() > 0; loop++ {
+			checked, expired := db.activeExpire(activeExpireKeysPerLoop)
+			totalChecked += checked
+			totalExpired += expired
+			if time.Since(start) > timeLimit {
+				atomic.AddInt64(&expiredTimeCapReached, 1)
+				updateStalePercentage(totalChecked, totalExpired)
+				return
+			}
+			if checked == 0 || expired*100 <= checked*activeExpireAcceptableStale {
+				break
+			}
+		}
+		mdb.expireDB = (mdb.expireDB + 1) % len(mdb.dbSet)
+	}
+	updateStalePercentage(totalChecked, totalExpired)
+}
+
+// updateStalePercentage 与 redis 一致, 以指数移动平均估算过期 key 的比例
+func updateStalePercentage(checked, expired int) {
+	current := 0.0
+	if checked > 0 {
+		current = float64(expired) / float64(checked)
+	}
+	prev := math.Float64frombits(atomic.LoadUint64(&expiredStalePercentage))
+	atomic.StoreUint64(&expiredStalePercentage, math.Float64bits(current*0.05+prev*0.95))
+}
+
+// serverCron 每秒执行 hz 次的后台任务, Close 时结束
+func (mdb *MultiDB) serverCron(hz int) {
+	ticker := time.NewTicker(time.Second / time.Duration(hz))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-mdb.cronDone:
+			return
+		case <-ticker.C:
+			mdb.activeExpireCycle(hz)
+		}
+	}
+}
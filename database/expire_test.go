@@ -0,0 +1,58 @@
+package database
+
+import (
+	"gedis/pkg/utils"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestActiveExpireCycle(t *testing.T) {
+	mdb := &MultiDB{dbSet: []*DB{makeDB(), makeDB()}}
+	before := atomic.LoadInt64(&expiredKeys)
+	for i, db := range mdb.dbSet {
+		for j := 0; j < 500; j++ {
+			key := strconv.Itoa(j)
+			db.Exec(nil, utils.ToCmdLine("SET", key, "v"))
+			if j%5 == 0 {
+				db.Expire(key, time.Now().Add(time.Hour))
+			} else if i == 0 || j%2 == 0 {
+				db.Expire(key, time.Now().Add(-time.Second))
+			}
+		}
+	}
+	// 过期 key 比例较高时每次会在同一个库上清理多轮, 多次执行后全部清理完成
+	for i := 0; i < 100 && atomic.LoadInt64(&expiredKeys)-before < 600; i++ {
+		mdb.activeExpireCycle(10)
+	}
+	if expired := atomic.LoadInt64(&expiredKeys) - before; expired != 600 {
+		t.Errorf("expect 600 expired keys, actual %d", expired)
+	}
+	for i, expect := range []int{100, 300} {
+		db := mdb.dbSet[i]
+		if db.data.Len() != expect || db.ttlMap.Len() != 100 {
+			t.Errorf("db%d: expect %d keys and 100 ttl, actual %d keys and %d ttl", i, expect, db.data.Len(), db.ttlMap.Len())
+		}
+	}
+}
+
+func TestConditionalSetAfterExpire(t *testing.T) {
+	db := makeDB()
+	runCases(t, db, []cmdCase{
+		{[]string{"SET", "k", "v", "PX", "10"}, "+OK\r\n"},
+		{[]string{"SET", "k2", "v", "PX", "10"}, "+OK\r\n"},
+		{[]string{"SET", "k3", "v", "PX", "10"}, "+OK\r\n"},
+	})
+	time.Sleep(20 * time.Millisecond)
+	// 过期的 key 还没有被 activeExpireCycle 清理, 条件写入时视为不存在
+	runCases(t, db, []cmdCase{
+		{[]string{"SETNX", "k", "x"}, ":1\r\n"},
+		{[]string{"GET", "k"}, "$1\r\nx\r\n"},
+		{[]string{"TTL", "k"}, ":-1\r\n"},
+		{[]string{"SET", "k2", "y", "XX"}, "$-1\r\n"},
+		{[]string{"GET", "k2"}, "$-1\r\n"},
+		{[]string{"SET", "k3", "z", "NX"}, "+OK\r\n"},
+		{[]string{"GET", "k3"}, "$1\r\nz\r\n"},
+	})
+}
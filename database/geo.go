@@ -0,0 +1,487 @@
+package database
+
+import (
+	"fmt"
+	"gedis/pkg/utils"
+	"gedis/reply"
+	"gedis/types/cmd"
+	"gedis/types/geo"
+	"gedis/types/redis"
+	SortedSet "gedis/types/zset"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 地理位置保存在 sorted set 中, 分数为 52 位的 geohash, 可以直接使用 ZRANGE/ZREM 等命令操作
+
+// parseGeoUnit 返回单位对应的米数
+func parseGeoUnit(arg []byte) (float64, reply.ErrorReply) {
+	switch strings.ToLower(string(arg)) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, reply.MakeErrReply("ERR unsupported unit provided. please use M, KM, FT, MI")
+}
+
+func parseLonLat(lonArg, latArg []byte) (float64, float64, reply.ErrorReply) {
+	longitude, err := strconv.ParseFloat(string(lonArg), 64)
+	if err != nil {
+		return 0, 0, reply.MakeErrReply("ERR value is not a valid float")
+	}
+	latitude, err := strconv.ParseFloat(string(latArg), 64)
+	if err != nil {
+		return 0, 0, reply.MakeErrReply("ERR value is not a valid float")
+	}
+	if !geo.Valid(longitude, latitude) {
+		return 0, 0, reply.MakeErrReply(fmt.Sprintf("ERR invalid longitude,latitude pair %f,%f", longitude, latitude))
+	}
+	return longitude, latitude, nil
+}
+
+// parseGeoAddOptions 返回 NX, XX, CH 选项以及第一个坐标的下标
+func parseGeoAddOptions(args [][]byte) (nx, xx, ch bool, i int) {
+	for i = 1; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "CH":
+			ch = true
+		default:
+			return
+		}
+	}
+	return
+}
+
+// execGeoAdd GEOADD key [NX | XX] [CH] longitude latitude member [longitude latitude member ...]
+func execGeoAdd(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	nx, xx, ch, start := parseGeoAddOptions(args)
+	if (nx && xx) || start == len(args) || (len(args)-start)%3 != 0 {
+		return reply.MakeSyntaxErrReply()
+	}
+	elements := make([]*SortedSet.Element, 0, (len(args)-start)/3)
+	for i := start; i < len(args); i += 3 {
+		longitude, latitude, errReply := parseLonLat(args[i], args[i+1])
+		if errReply != nil {
+			return errReply
+		}
+		elements = append(elements, &SortedSet.Element{
+			Member: string(args[i+2]),
+			Score:  geo.Score(longitude, latitude),
+		})
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	added, changed := 0, 0
+	aofLine := utils.ToCmdLine("zadd", key)
+	for _, e := range elements {
+		var exists bool
+		if sortedSet != nil {
+			var old *SortedSet.Element
+			old, exists = sortedSet.Get(e.Member)
+			if exists && old.Score == e.Score {
+				continue
+			}
+		}
+		if (nx && exists) || (xx && !exists) {
+			continue
+		}
+		if sortedSet == nil {
+			sortedSet = SortedSet.Make()
+			db.PutEntity(key, &redis.DataEntity{
+				Data: sortedSet,
+			})
+		}
+		sortedSet.Add(e.Member, e.Score)
+		if exists {
+			changed++
+		} else {
+			added++
+		}
+		aofLine = append(aofLine, []byte(strconv.FormatFloat(e.Score, 'f', -1, 64)), []byte(e.Member))
+	}
+	if len(aofLine) > 2 {
+		db.addAof(aofLine)
+	}
+	if ch {
+		return reply.MakeIntReply(int64(added + changed))
+	}
+	return reply.MakeIntReply(int64(added))
+}
+
+func undoGeoAdd(db *DB, args [][]byte) [][][]byte {
+	key := string(args[0])
+	_, _, _, start := parseGeoAddOptions(args)
+	var members []string
+	for i := start + 2; i < len(args); i += 3 {
+		members = append(members, string(args[i]))
+	}
+	return rollbackZSetFields(db, key, members...)
+}
+
+// geoCoordReply 坐标以 [longitude, latitude] 的形式返回
+func geoCoordReply(longitude, latitude float64) redis.Reply {
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeDoubleReply(longitude),
+		reply.MakeDoubleReply(latitude),
+	})
+}
+
+// execGeoPos GEOPOS key [member [member ...]]
+func execGeoPos(db *DB, args [][]byte) redis.Reply {
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		result[i] = reply.MakeNullMultiBulkReply()
+		if sortedSet == nil {
+			continue
+		}
+		if element, ok := sortedSet.Get(string(member)); ok {
+			result[i] = geoCoordReply(geo.FromScore(element.Score))
+		}
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// execGeoDist GEODIST key member1 member2 [M | KM | FT | MI]
+func execGeoDist(db *DB, args [][]byte) redis.Reply {
+	if len(args) > 4 {
+		return reply.MakeSyntaxErrReply()
+	}
+	unit := 1.0
+	if len(args) == 4 {
+		var errReply reply.ErrorReply
+		if unit, errReply = parseGeoUnit(args[3]); errReply != nil {
+			return errReply
+		}
+	}
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeNullBulkReply()
+	}
+	e1, ok1 := sortedSet.Get(string(args[1]))
+	e2, ok2 := sortedSet.Get(string(args[2]))
+	if !ok1 || !ok2 {
+		return reply.MakeNullBulkReply()
+	}
+	lon1, lat1 := geo.FromScore(e1.Score)
+	lon2, lat2 := geo.FromScore(e2.Score)
+	dist := geo.Distance(lon1, lat1, lon2, lat2) / unit
+	return reply.MakeBulkReply([]byte(strconv.FormatFloat(dist, 'f', 4, 64)))
+}
+
+// execGeoHash GEOHASH key [member [member ...]]
+func execGeoHash(db *DB, args [][]byte) redis.Reply {
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		result[i] = reply.MakeNullBulkReply()
+		if sortedSet == nil {
+			continue
+		}
+		if element, ok := sortedSet.Get(string(member)); ok {
+			result[i] = reply.MakeBulkReply([]byte(geo.String(element.Score)))
+		}
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// geoSearchSpec GEOSEARCH 及 GEOSEARCHSTORE 的参数
+type geoSearchSpec struct {
+	fromMember string
+	fromLonLat bool
+	shape      geo.Shape
+	byRadius   bool
+	byBox      bool
+	unit       float64
+	desc       bool
+	sorted     bool
+	count      int // 0 表示不限制
+	any        bool
+	withCoord  bool
+	withDist   bool
+	withHash   bool
+	storeDist  bool
+}
+
+// parseGeoSearch 解析 GEOSEARCH 的参数, store 为 true 时按 GEOSEARCHSTORE 解析
+func parseGeoSearch(cmdName string, args [][]byte, store bool) (*geoSearchSpec, reply.ErrorReply) {
+	spec := &geoSearchSpec{}
+	var err error
+	for i := 0; i < len(args); i++ {
+		remain := len(args) - i - 1
+		switch strings.ToUpper(string(args[i])) {
+		case "FROMMEMBER":
+			if remain < 1 {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			spec.fromMember = string(args[i+1])
+			if spec.fromLonLat {
+				return nil, reply.MakeErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + cmdName)
+			}
+			i++
+		case "FROMLONLAT":
+			if remain < 2 {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			longitude, latitude, errReply := parseLonLat(args[i+1], args[i+2])
+			if errReply != nil {
+				return nil, errReply
+			}
+			if spec.fromMember != "" {
+				return nil, reply.MakeErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + cmdName)
+			}
+			spec.fromLonLat = true
+			spec.shape.Longitude, spec.shape.Latitude = longitude, latitude
+			i += 2
+		case "BYRADIUS":
+			if remain < 2 {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			if spec.shape.Radius, err = strconv.ParseFloat(string(args[i+1]), 64); err != nil {
+				return nil, reply.MakeErrReply("ERR need numeric radius")
+			}
+			if spec.shape.Radius < 0 {
+				return nil, reply.MakeErrReply("ERR radius cannot be negative")
+			}
+			var errReply reply.ErrorReply
+			if spec.unit, errReply = parseGeoUnit(args[i+2]); errReply != nil {
+				return nil, errReply
+			}
+			if spec.byBox {
+				return nil, reply.MakeErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for " + cmdName)
+			}
+			spec.byRadius = true
+			i += 2
+		case "BYBOX":
+			if remain < 3 {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			if spec.shape.Width, err = strconv.ParseFloat(string(args[i+1]), 64); err != nil {
+				return nil, reply.MakeErrReply("ERR need numeric width")
+			}
+			if spec.shape.Height, err = strconv.ParseFloat(string(args[i+2]), 64); err != nil {
+				return nil, reply.MakeErrReply("ERR need numeric height")
+			}
+			if spec.shape.Width < 0 || spec.shape.Height < 0 {
+				return nil, reply.MakeErrReply("ERR height or width cannot be negative")
+			}
+			var errReply reply.ErrorReply
+			if spec.unit, errReply = parseGeoUnit(args[i+3]); errReply != nil {
+				return nil, errReply
+			}
+			if spec.byRadius {
+				return nil, reply.MakeErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for " + cmdName)
+			}
+			spec.byBox = true
+			spec.shape.Box = true
+			i += 3
+		case "ASC":
+			spec.sorted, spec.desc = true, false
+		case "DESC":
+			spec.sorted, spec.desc = true, true
+		case "COUNT":
+			if remain < 1 {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			count, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if count <= 0 {
+				return nil, reply.MakeErrReply("ERR COUNT must be > 0")
+			}
+			spec.count = count
+			i++
+			if remain > 1 && strings.ToUpper(string(args[i+1])) == "ANY" {
+				spec.any = true
+				i++
+			}
+		case "WITHCOORD":
+			spec.withCoord = true
+		case "WITHDIST":
+			spec.withDist = true
+		case "WITHHASH":
+			spec.withHash = true
+		case "STOREDIST":
+			if !store {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			spec.storeDist = true
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	if spec.fromMember == "" && !spec.fromLonLat {
+		return nil, reply.MakeErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + cmdName)
+	}
+	if !spec.byRadius && !spec.byBox {
+		return nil, reply.MakeErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for " + cmdName)
+	}
+	if store && (spec.withCoord || spec.withDist || spec.withHash) {
+		return nil, reply.MakeErrReply("ERR STORE option in " + cmdName + " is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+	}
+	spec.shape.Radius *= spec.unit
+	spec.shape.Width *= spec.unit
+	spec.shape.Height *= spec.unit
+	// 限制数量且不是 ANY 时, 需要按距离排序后取最近的结果
+	if spec.count > 0 && !spec.any && !spec.sorted {
+		spec.sorted = true
+	}
+	return spec, nil
+}
+
+type geoPoint struct {
+	element   *SortedSet.Element
+	dist      float64
+	longitude float64
+	latitude  float64
+}
+
+// geoSearch 返回范围内的成员, key 不存在时返回 nil
+func (db *DB) geoSearch(key string, spec *geoSearchSpec) ([]*geoPoint, reply.ErrorReply) {
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil || sortedSet == nil {
+		return nil, errReply
+	}
+	if spec.fromMember != "" {
+		element, ok := sortedSet.Get(spec.fromMember)
+		if !ok {
+			return nil, reply.MakeErrReply("ERR could not decode requested zset member")
+		}
+		spec.shape.Longitude, spec.shape.Latitude = geo.FromScore(element.Score)
+	}
+
+	var points []*geoPoint
+	for _, r := range spec.shape.Ranges() {
+		min := &SortedSet.ScoreBorder{Value: float64(r[0])}
+		max := &SortedSet.ScoreBorder{Value: float64(r[1]), Exclude: true}
+		sortedSet.ForEachByScore(min, max, 0, -1, false, func(element *SortedSet.Element) bool {
+			longitude, latitude := geo.FromScore(element.Score)
+			dist, ok := spec.shape.Contains(longitude, latitude)
+			if ok {
+				points = append(points, &geoPoint{
+					element:   element,
+					dist:      dist,
+					longitude: longitude,
+					latitude:  latitude,
+				})
+			}
+			// ANY 时找到足够的结果即可停止
+			return !spec.any || len(points) < spec.count
+		})
+		if spec.any && len(points) >= spec.count {
+			break
+		}
+	}
+	if spec.sorted {
+		sort.SliceStable(points, func(i, j int) bool {
+			if spec.desc {
+				return points[i].dist > points[j].dist
+			}
+			return points[i].dist < points[j].dist
+		})
+	}
+	if spec.count > 0 && len(points) > spec.count {
+		points = points[:spec.count]
+	}
+	return points, nil
+}
+
+// execGeoSearch GEOSEARCH key <FROMMEMBER member | FROMLONLAT longitude latitude>
+// <BYRADIUS radius <M | KM | FT | MI> | BYBOX width height <M | KM | FT | MI>>
+// [ASC | DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+func execGeoSearch(db *DB, args [][]byte) redis.Reply {
+	spec, errReply := parseGeoSearch("GEOSEARCH", args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	points, errReply := db.geoSearch(string(args[0]), spec)
+	if errReply != nil {
+		return errReply
+	}
+	if !spec.withCoord && !spec.withDist && !spec.withHash {
+		members := make([][]byte, len(points))
+		for i, point := range points {
+			members[i] = []byte(point.element.Member)
+		}
+		return reply.MakeMultiBulkReply(members)
+	}
+	result := make([]redis.Reply, len(points))
+	for i, point := range points {
+		item := []redis.Reply{reply.MakeBulkReply([]byte(point.element.Member))}
+		if spec.withDist {
+			dist := strconv.FormatFloat(point.dist/spec.unit, 'f', 4, 64)
+			item = append(item, reply.MakeBulkReply([]byte(dist)))
+		}
+		if spec.withHash {
+			item = append(item, reply.MakeIntReply(int64(point.element.Score)))
+		}
+		if spec.withCoord {
+			item = append(item, geoCoordReply(point.longitude, point.latitude))
+		}
+		result[i] = reply.MakeMultiRawReply(item)
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// execGeoSearchStore GEOSEARCHSTORE destination source ... [STOREDIST],
+// 保存 geohash 分数或者与中心点的距离, 结果为空时删除 destination
+func execGeoSearchStore(db *DB, args [][]byte) redis.Reply {
+	dest := string(args[0])
+	spec, errReply := parseGeoSearch("GEOSEARCHSTORE", args[2:], true)
+	if errReply != nil {
+		return errReply
+	}
+	points, errReply := db.geoSearch(string(args[1]), spec)
+	if errReply != nil {
+		return errReply
+	}
+	db.Remove(dest) // clean ttl and old value
+	if len(points) > 0 {
+		result := SortedSet.Make()
+		for _, point := range points {
+			score := point.element.Score
+			if spec.storeDist {
+				score = point.dist / spec.unit
+			}
+			result.Add(point.element.Member, score)
+		}
+		db.PutEntity(dest, &redis.DataEntity{
+			Data: result,
+		})
+	}
+	db.addAof(utils.ToCmdLine3("geosearchstore", args...))
+	return reply.MakeIntReply(int64(len(points)))
+}
+
+func init() {
+	RegisterCommand(cmd.GeoAdd, execGeoAdd, writeFirstKey, undoGeoAdd, -5)
+	RegisterCommand(cmd.GeoPos, execGeoPos, readFirstKey, nil, -2)
+	RegisterCommand(cmd.GeoDist, execGeoDist, readFirstKey, nil, -4)
+	RegisterCommand(cmd.GeoHash, execGeoHash, readFirstKey, nil, -2)
+	RegisterCommand(cmd.GeoSearch, execGeoSearch, readFirstKey, nil, -7)
+	RegisterCommand(cmd.GeoSearchStore, execGeoSearchStore, prepareZRangeStore, rollbackFirstKey, -8)
+}
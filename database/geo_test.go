@@ -0,0 +1,42 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestGeoCommands(t *testing.T) {
+	db := makeDB()
+	cases := []cmdCase{
+		{[]string{"GEOADD", "Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"}, ":2\r\n"},
+		{[]string{"GEOADD", "Sicily", "NX", "CH", "13.361389", "38.115556", "Palermo"}, ":0\r\n"},
+		{[]string{"GEOADD", "Sicily", "XX", "CH", "13.361389", "38.2", "Palermo"}, ":1\r\n"},
+		{[]string{"GEOADD", "Sicily", "13.361389", "38.115556", "Palermo"}, ":0\r\n"},
+		{[]string{"GEOADD", "Sicily", "NX", "XX", "13.361389", "38.115556", "Palermo"}, "-Err syntax error\r\n"},
+		{[]string{"GEOADD", "Sicily", "200", "100", "x"}, "-ERR invalid longitude,latitude pair 200.000000,100.000000\r\n"},
+		{[]string{"GEOADD", "none", "XX", "13.361389", "38.115556", "Palermo"}, ":0\r\n"},
+		{[]string{"EXISTS", "none"}, ":0\r\n"},
+		{[]string{"ZSCORE", "Sicily", "Palermo"}, "$16\r\n3479099956230698\r\n"},
+		{[]string{"GEODIST", "Sicily", "Palermo", "Catania"}, "$11\r\n166274.1516\r\n"},
+		{[]string{"GEODIST", "Sicily", "Palermo", "Catania", "km"}, "$8\r\n166.2742\r\n"},
+		{[]string{"GEODIST", "Sicily", "Palermo", "Catania", "yd"}, "-ERR unsupported unit provided. please use M, KM, FT, MI\r\n"},
+		{[]string{"GEODIST", "Sicily", "Palermo", "none"}, "$-1\r\n"},
+		{[]string{"GEOHASH", "Sicily", "Palermo", "Catania", "none"}, "*3\r\n$11\r\nsqc8b49rny0\r\n$11\r\nsqdtr74hyu0\r\n$-1\r\n"},
+		{[]string{"GEOPOS", "Sicily", "Palermo", "none"}, "*2\r\n*2\r\n$18\r\n13.361389338970184\r\n$16\r\n38.1155563954963\r\n*-1\r\n"},
+		{[]string{"GEOADD", "Sicily", "12.758489", "38.788135", "edge1", "17.241510", "38.788135", "edge2"}, ":2\r\n"},
+		{[]string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ASC"}, "*2\r\n$7\r\nCatania\r\n$7\r\nPalermo\r\n"},
+		{[]string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "DESC", "WITHDIST"},
+			"*4\r\n*2\r\n$5\r\nedge1\r\n$8\r\n279.7405\r\n*2\r\n$5\r\nedge2\r\n$8\r\n279.7403\r\n*2\r\n$7\r\nPalermo\r\n$8\r\n190.4424\r\n*2\r\n$7\r\nCatania\r\n$7\r\n56.4413\r\n"},
+		{[]string{"GEOSEARCH", "Sicily", "FROMMEMBER", "Palermo", "BYRADIUS", "100", "km", "COUNT", "1", "WITHHASH"}, "*1\r\n*2\r\n$7\r\nPalermo\r\n:3479099956230698\r\n"},
+		{[]string{"GEOSEARCH", "Sicily", "FROMMEMBER", "none", "BYRADIUS", "100", "km"}, "-ERR could not decode requested zset member\r\n"},
+		{[]string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "100", "km", "BYBOX", "1", "1", "km"}, "-ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH\r\n"},
+		{[]string{"GEOSEARCH", "Sicily", "BYRADIUS", "100", "km", "ASC", "WITHDIST"}, "-ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH\r\n"},
+		{[]string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "100", "km", "COUNT", "0"}, "-ERR COUNT must be > 0\r\n"},
+		{[]string{"GEOSEARCH", "none", "FROMLONLAT", "15", "37", "BYRADIUS", "100", "km"}, "*0\r\n"},
+		{[]string{"GEOSEARCHSTORE", "dst", "Sicily", "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "COUNT", "2", "STOREDIST"}, ":2\r\n"},
+		{[]string{"ZRANGE", "dst", "0", "-1"}, "*2\r\n$7\r\nCatania\r\n$7\r\nPalermo\r\n"},
+		{[]string{"GEOSEARCHSTORE", "dst", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "m", "WITHDIST"}, "-ERR STORE option in GEOSEARCHSTORE is not compatible with WITHDIST, WITHHASH and WITHCOORD options\r\n"},
+		{[]string{"GEOSEARCHSTORE", "dst", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "m"}, ":0\r\n"},
+		{[]string{"EXISTS", "dst"}, ":0\r\n"},
+	}
+	runCases(t, db, cases)
+}
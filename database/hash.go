@@ -2,11 +2,14 @@ package database
 
 import (
 	"gedis/pkg/utils"
+	"gedis/pkg/wildcard"
 	"gedis/reply"
 	"gedis/types/cmd"
 	Dict "gedis/types/dict"
 	"gedis/types/redis"
+	"math"
 	"strconv"
+	"strings"
 )
 
 func (db *DB) getAsDict(key string) (Dict.Dict, reply.ErrorReply) {
@@ -28,7 +31,7 @@ func (db *DB) getOrInitDict(key string) (dict Dict.Dict, inited bool, errReply r
 	}
 	inited = false
 	if dict == nil {
-		dict = Dict.MakeSimple()
+		dict = Dict.MakeListpack()
 		db.PutEntity(key, &redis.DataEntity{
 			Data: dict,
 		})
@@ -37,6 +40,13 @@ func (db *DB) getOrInitDict(key string) (dict Dict.Dict, inited bool, errReply r
 	return dict, inited, nil
 }
 
+// persistField 覆盖 field 的值时清除其过期时间
+func persistField(dict Dict.Dict, field string) {
+	if hash, ok := dict.(Dict.Expirable); ok {
+		hash.Persist(field)
+	}
+}
+
 // execHSet sets field in hash table
 func execHSet(db *DB, args [][]byte) redis.Reply {
 	// parse args
@@ -51,6 +61,7 @@ func execHSet(db *DB, args [][]byte) redis.Reply {
 	}
 
 	result := dict.Put(field, value)
+	persistField(dict, field)
 	db.addAof(utils.ToCmdLine3("hset", args...))
 	return reply.MakeIntReply(int64(result))
 }
@@ -210,6 +221,7 @@ func execHMSet(db *DB, args [][]byte) redis.Reply {
 	for i, field := range fields {
 		value := values[i]
 		dict.Put(field, value)
+		persistField(dict, field)
 	}
 	db.addAof(utils.ToCmdLine3("hmset", args...))
 	return &reply.OkReply{}
@@ -311,7 +323,7 @@ func execHGetAll(db *DB, args [][]byte) redis.Reply {
 		return errReply
 	}
 	if dict == nil {
-		return &reply.EmptyMultiBulkReply{}
+		return reply.MakeMapReply(nil)
 	}
 
 	size := dict.Len()
@@ -324,7 +336,7 @@ func execHGetAll(db *DB, args [][]byte) redis.Reply {
 		i++
 		return true
 	})
-	return reply.MakeMultiBulkReply(result[:i])
+	return reply.MakeBulkMapReply(result[:i])
 }
 
 // execHIncrBy increments the integer value of a hash field by the given number
@@ -366,36 +378,212 @@ func undoHIncr(db *DB, args [][]byte) [][][]byte {
 }
 
 // execHIncrByFloat increments the float value of a hash field by the given number
-//func execHIncrByFloat(db *DB, args [][]byte) redis.Reply {
-//	key := string(args[0])
-//	field := string(args[1])
-//	rawDelta := string(args[2])
-//	delta, err := decimal.NewFromString(rawDelta)
-//	if err != nil {
-//		return reply.MakeErrReply("ERR value is not a valid float")
-//	}
-//
-//	// get or init entity
-//	dict, _, errReply := db.getOrInitDict(key)
-//	if errReply != nil {
-//		return errReply
-//	}
-//
-//	value, exists := dict.Get(field)
-//	if !exists {
-//		dict.Put(field, args[2])
-//		return reply.MakeBulkReply(args[2])
-//	}
-//	val, err := decimal.NewFromString(string(value.([]byte)))
-//	if err != nil {
-//		return reply.MakeErrReply("ERR hash value is not a float")
-//	}
-//	result := val.Add(delta)
-//	resultBytes := []byte(result.String())
-//	dict.Put(field, resultBytes)
-//	db.addAof(utils.ToCmdLine3("hincrbyfloat", args...))
-//	return reply.MakeBulkReply(resultBytes)
-//}
+func execHIncrByFloat(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	delta, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return reply.MakeErrReply("ERR value is not a valid float")
+	}
+
+	dict, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	val := float64(0)
+	if dict != nil {
+		if value, exists := dict.Get(field); exists {
+			val, err = strconv.ParseFloat(string(value.([]byte)), 64)
+			if err != nil {
+				return reply.MakeErrReply("ERR hash value is not a float")
+			}
+		}
+	}
+	val += delta
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return reply.MakeErrReply("ERR increment would produce NaN or Infinity")
+	}
+	if dict == nil {
+		dict, _, _ = db.getOrInitDict(key)
+	}
+	bytes := []byte(strconv.FormatFloat(val, 'f', -1, 64))
+	dict.Put(field, bytes)
+	// 以 hset 写入 AOF, 避免重放时浮点运算的误差
+	db.addAof(utils.ToCmdLine3("hset", args[0], args[1], bytes))
+	return reply.MakeBulkReply(bytes)
+}
+
+// execHStrLen returns the string length of the value of a hash field
+func execHStrLen(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	field := string(args[1])
+
+	dict, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		return reply.MakeIntReply(0)
+	}
+	value, exists := dict.Get(field)
+	if !exists {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(len(value.([]byte))))
+}
+
+// scanArgs SCAN 类命令的参数
+type scanArgs struct {
+	cursor   uint64
+	pattern  *wildcard.Pattern // 为 nil 时不过滤
+	count    int
+	noValues bool   // HSCAN NOVALUES
+	typ      string // SCAN TYPE
+}
+
+// parseScanArgs 解析 cursor [MATCH pattern] [COUNT count], options 为命令额外支持的 NOVALUES 或 TYPE 选项
+func parseScanArgs(args [][]byte, options ...string) (*scanArgs, reply.ErrorReply) {
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		return nil, reply.MakeErrReply("ERR invalid cursor")
+	}
+	scan := &scanArgs{cursor: cursor, count: 10}
+	allowed := func(option string) bool {
+		for _, o := range options {
+			if o == option {
+				return true
+			}
+		}
+		return false
+	}
+	for i := 1; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		if option == "NOVALUES" && allowed(option) {
+			scan.noValues = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		switch {
+		case option == "MATCH":
+			scan.pattern = wildcard.CompilePattern(string(args[i+1]))
+		case option == "COUNT":
+			scan.count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if scan.count < 1 {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+		case option == "TYPE" && allowed(option):
+			scan.typ = strings.ToLower(string(args[i+1]))
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		i++
+	}
+	return scan, nil
+}
+
+// isMatch 成员是否满足 MATCH 条件
+func (scan *scanArgs) isMatch(member string) bool {
+	return scan.pattern == nil || scan.pattern.IsMatch(member)
+}
+
+// execHScan HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]
+func execHScan(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	scan, errReply := parseScanArgs(args[1:], "NOVALUES")
+	if errReply != nil {
+		return errReply
+	}
+
+	dict, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		return reply.MakeScanBulkReply(0, nil)
+	}
+	result := make([][]byte, 0, scan.count*2)
+	next := dict.Scan(scan.cursor, scan.count, func(field string, val interface{}) bool {
+		if !scan.isMatch(field) {
+			return true
+		}
+		result = append(result, []byte(field))
+		if !scan.noValues {
+			value, _ := val.([]byte)
+			result = append(result, value)
+		}
+		return true
+	})
+	return reply.MakeScanBulkReply(int(next), result)
+}
+
+// execHRandField HRANDFIELD key [count [WITHVALUES]], count 为负数时可能返回重复的 field
+func execHRandField(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	if len(args) > 3 || (len(args) == 3 && !strings.EqualFold(string(args[2]), "WITHVALUES")) {
+		return reply.MakeSyntaxErrReply()
+	}
+	withCount := len(args) >= 2
+	withValues := len(args) == 3
+	count := int64(1)
+	if withCount {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		// 与 redis 一致, 取反以及 WITHVALUES 翻倍后的数量不能溢出
+		if count == math.MinInt64 || (withValues && count < -math.MaxInt64/2) {
+			return reply.MakeErrReply("ERR value is out of range")
+		}
+	}
+
+	dict, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		if !withCount {
+			return &reply.NullBulkReply{}
+		}
+		return &reply.EmptyMultiBulkReply{}
+	}
+	if !withCount {
+		fields := dict.RandomKeys(1)
+		if len(fields) == 0 { // 剩下的 field 刚好全部过期
+			return &reply.NullBulkReply{}
+		}
+		return reply.MakeBulkReply([]byte(fields[0]))
+	}
+	if count == 0 {
+		return &reply.EmptyMultiBulkReply{}
+	}
+
+	var fields []string
+	if count > 0 {
+		fields = dict.RandomDistinctKeys(int(count))
+	} else {
+		fields = dict.RandomKeys(int(-count))
+	}
+	if !withValues {
+		result := make([][]byte, len(fields))
+		for i, field := range fields {
+			result[i] = []byte(field)
+		}
+		return reply.MakeMultiBulkReply(result)
+	}
+	result := make([][]byte, 0, len(fields)*2)
+	for _, field := range fields {
+		value, _ := dict.Get(field)
+		bytes, _ := value.([]byte)
+		result = append(result, []byte(field), bytes)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
 
 func init() {
 	RegisterCommand(cmd.HSet, execHSet, writeFirstKey, undoHSet, 4)
@@ -411,5 +599,9 @@ func init() {
 	RegisterCommand(cmd.HVals, execHVals, readFirstKey, nil, 2)
 	RegisterCommand(cmd.HGetAll, execHGetAll, readFirstKey, nil, 2)
 	RegisterCommand(cmd.HIncrBy, execHIncrBy, writeFirstKey, undoHIncr, 4)
-	//RegisterCommand("HIncrByFloat", execHIncrByFloat, writeFirstKey, undoHIncr, 4)
+	RegisterCommand(cmd.HIncrByFloat, execHIncrByFloat, writeFirstKey, undoHIncr, 4)
+	RegisterCommand(cmd.HStrLen, execHStrLen, readFirstKey, nil, 3)
+	RegisterCommand(cmd.HScan, execHScan, readFirstKey, nil, -3)
+	RegisterCommand(cmd.HRandField, execHRandField, readFirstKey, nil, -2)
+	markAllowOOM(cmd.HDel)
 }
@@ -0,0 +1,309 @@
+package database
+
+import (
+	"gedis/pkg/timewheel"
+	"gedis/pkg/utils"
+	"gedis/reply"
+	"gedis/types/cmd"
+	Dict "gedis/types/dict"
+	"gedis/types/redis"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// field 级过期: 过期时间保存在 hash 的 Dict 中, 过期的 field 对读命令不可见,
+// 每个 key 在时间轮中只保留一个任务, 到期时清理已过期的 field 并以 HDEL 写入 AOF
+
+// 设置 field 过期时间的返回值
+const (
+	fieldNotExists    = -2
+	fieldConditionNot = 0
+	fieldExpireSet    = 1
+	fieldDeleted      = 2
+)
+
+// scheduleFieldExpire 按最早的 field 过期时间安排清理任务
+func (db *DB) scheduleFieldExpire(key string, hash Dict.Expirable) {
+	next, ok := hash.NextExpireTime()
+	if !ok {
+		return
+	}
+	taskKey := genFieldExpireTask(key)
+	timewheel.Cancel(taskKey)
+	delay := time.Until(next)
+	if delay < 0 {
+		delay = 0
+	}
+	timewheel.Delay(delay, taskKey, func() {
+		keys := []string{key}
+		db.RWLocks(keys, nil)
+		defer db.RWUnLocks(keys, nil)
+
+		raw, ok := db.data.Get(key)
+		if !ok {
+			return
+		}
+		entity, _ := raw.(*redis.DataEntity)
+		if current, ok := entity.Data.(Dict.Expirable); !ok || current != hash {
+			return // key 已被删除或覆盖
+		}
+		if removed := hash.RemoveExpired(); len(removed) > 0 {
+			db.addAof(utils.ToCmdLine2("hdel", append([]string{key}, removed...)...))
+		}
+		if hash.Len() == 0 {
+			db.Remove(key)
+			return
+		}
+		db.scheduleFieldExpire(key, hash)
+	})
+}
+
+func (db *DB) getAsExpirableDict(key string) (Dict.Expirable, reply.ErrorReply) {
+	dict, errReply := db.getAsDict(key)
+	if errReply != nil || dict == nil {
+		return nil, errReply
+	}
+	hash, ok := dict.(Dict.Expirable)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return hash, nil
+}
+
+// parseFieldsArg 解析 FIELDS numfields field [field ...], 必须位于参数末尾
+func parseFieldsArg(args [][]byte) ([]string, reply.ErrorReply) {
+	if len(args) < 2 || !strings.EqualFold(string(args[0]), "FIELDS") {
+		return nil, reply.MakeErrReply("ERR Mandatory argument FIELDS is missing or not at the right position")
+	}
+	numFields, err := strconv.Atoi(string(args[1]))
+	if err != nil || numFields <= 0 {
+		return nil, reply.MakeErrReply("ERR Parameter `numFields` should be greater than 0")
+	}
+	if numFields != len(args)-2 {
+		return nil, reply.MakeErrReply("ERR The `numfields` parameter must match the number of arguments")
+	}
+	fields := make([]string, numFields)
+	for i, arg := range args[2:] {
+		fields[i] = string(arg)
+	}
+	return fields, nil
+}
+
+func makeFieldResultsReply(results []int64) redis.Reply {
+	replies := make([]redis.Reply, len(results))
+	for i, result := range results {
+		replies[i] = reply.MakeIntReply(result)
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+// execFieldExpire HEXPIRE key seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+// unit 为时间参数的单位, absolute 为 true 时时间参数为 unix 时间戳
+func execFieldExpire(db *DB, args [][]byte, cmdName string, unit time.Duration, absolute bool) redis.Reply {
+	key := string(args[0])
+	raw, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	// 与 redis 一致, 换算为纳秒及加上当前时间后溢出的时间视为无效
+	if raw < 0 || raw > math.MaxInt64/int64(unit) {
+		return reply.MakeErrReply("ERR invalid expire time in '" + cmdName + "' command")
+	}
+	duration := time.Duration(raw) * unit
+	var expireAt time.Time
+	if absolute {
+		expireAt = time.Unix(0, int64(duration))
+	} else {
+		now := time.Now()
+		if int64(duration) > math.MaxInt64-now.UnixNano() {
+			return reply.MakeErrReply("ERR invalid expire time in '" + cmdName + "' command")
+		}
+		expireAt = now.Add(duration)
+	}
+
+	condition := ""
+	rest := args[2:]
+	if len(rest) > 0 {
+		switch flag := strings.ToUpper(string(rest[0])); flag {
+		case "NX", "XX", "GT", "LT":
+			condition = flag
+			rest = rest[1:]
+		}
+	}
+	fields, errReply := parseFieldsArg(rest)
+	if errReply != nil {
+		return errReply
+	}
+
+	hash, errReply := db.getAsExpirableDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	results := make([]int64, len(fields))
+	if hash == nil {
+		for i := range results {
+			results[i] = fieldNotExists
+		}
+		return makeFieldResultsReply(results)
+	}
+
+	now := time.Now()
+	var updated, deleted []string
+	for i, field := range fields {
+		if !hash.Exists(field) {
+			results[i] = fieldNotExists
+			continue
+		}
+		current, hasTTL := hash.ExpireTime(field)
+		// 没有过期时间视为永不过期
+		if (condition == "NX" && hasTTL) ||
+			(condition == "XX" && !hasTTL) ||
+			(condition == "GT" && (!hasTTL || !expireAt.After(current))) ||
+			(condition == "LT" && hasTTL && !expireAt.Before(current)) {
+			results[i] = fieldConditionNot
+			continue
+		}
+		if !expireAt.After(now) {
+			hash.Remove(field)
+			deleted = append(deleted, field)
+			results[i] = fieldDeleted
+			continue
+		}
+		hash.Expire(field, expireAt)
+		updated = append(updated, field)
+		results[i] = fieldExpireSet
+	}
+
+	if len(updated) > 0 {
+		ms := strconv.FormatInt(expireAt.UnixNano()/1e6, 10)
+		line := utils.ToCmdLine("hpexpireat", key, ms, "FIELDS", strconv.Itoa(len(updated)))
+		db.addAof(append(line, utils.ToCmdLine(updated...)...))
+		db.scheduleFieldExpire(key, hash)
+	}
+	if len(deleted) > 0 {
+		db.addAof(utils.ToCmdLine2("hdel", append([]string{key}, deleted...)...))
+		if hash.Len() == 0 {
+			db.Remove(key)
+		}
+	}
+	return makeFieldResultsReply(results)
+}
+
+func undoFieldExpire(db *DB, args [][]byte) [][][]byte {
+	key := string(args[0])
+	rest := args[2:]
+	if len(rest) > 0 {
+		switch strings.ToUpper(string(rest[0])) {
+		case "NX", "XX", "GT", "LT":
+			rest = rest[1:]
+		}
+	}
+	fields, errReply := parseFieldsArg(rest)
+	if errReply != nil {
+		return nil
+	}
+	return rollbackHashFields(db, key, fields...)
+}
+
+func execHExpire(db *DB, args [][]byte) redis.Reply {
+	return execFieldExpire(db, args, "hexpire", time.Second, false)
+}
+
+func execHPExpire(db *DB, args [][]byte) redis.Reply {
+	return execFieldExpire(db, args, "hpexpire", time.Millisecond, false)
+}
+
+func execHExpireAt(db *DB, args [][]byte) redis.Reply {
+	return execFieldExpire(db, args, "hexpireat", time.Second, true)
+}
+
+func execHPExpireAt(db *DB, args [][]byte) redis.Reply {
+	return execFieldExpire(db, args, "hpexpireat", time.Millisecond, true)
+}
+
+// execFieldTTL HTTL key FIELDS numfields field [field ...]
+func execFieldTTL(db *DB, args [][]byte, unit time.Duration) redis.Reply {
+	key := string(args[0])
+	fields, errReply := parseFieldsArg(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	hash, errReply := db.getAsExpirableDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	results := make([]int64, len(fields))
+	for i, field := range fields {
+		if hash == nil || !hash.Exists(field) {
+			results[i] = -2
+			continue
+		}
+		expireTime, ok := hash.ExpireTime(field)
+		if !ok {
+			results[i] = -1
+			continue
+		}
+		results[i] = int64(time.Until(expireTime) / unit)
+	}
+	return makeFieldResultsReply(results)
+}
+
+func execHTTL(db *DB, args [][]byte) redis.Reply {
+	return execFieldTTL(db, args, time.Second)
+}
+
+func execHPTTL(db *DB, args [][]byte) redis.Reply {
+	return execFieldTTL(db, args, time.Millisecond)
+}
+
+// execHPersist HPERSIST key FIELDS numfields field [field ...]
+func execHPersist(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	fields, errReply := parseFieldsArg(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	hash, errReply := db.getAsExpirableDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	results := make([]int64, len(fields))
+	var persisted []string
+	for i, field := range fields {
+		if hash == nil || !hash.Exists(field) {
+			results[i] = -2
+		} else if hash.Persist(field) {
+			persisted = append(persisted, field)
+			results[i] = 1
+		} else {
+			results[i] = -1
+		}
+	}
+	if len(persisted) > 0 {
+		line := utils.ToCmdLine("hpersist", key, "FIELDS", strconv.Itoa(len(persisted)))
+		db.addAof(append(line, utils.ToCmdLine(persisted...)...))
+	}
+	return makeFieldResultsReply(results)
+}
+
+func undoHPersist(db *DB, args [][]byte) [][][]byte {
+	key := string(args[0])
+	fields, errReply := parseFieldsArg(args[1:])
+	if errReply != nil {
+		return nil
+	}
+	return rollbackHashFields(db, key, fields...)
+}
+
+func init() {
+	RegisterCommand(cmd.HExpire, execHExpire, writeFirstKey, undoFieldExpire, -6)
+	RegisterCommand(cmd.HPExpire, execHPExpire, writeFirstKey, undoFieldExpire, -6)
+	RegisterCommand(cmd.HExpireAt, execHExpireAt, writeFirstKey, undoFieldExpire, -6)
+	RegisterCommand(cmd.HPExpireAt, execHPExpireAt, writeFirstKey, undoFieldExpire, -6)
+	RegisterCommand(cmd.HTTL, execHTTL, readFirstKey, nil, -5)
+	RegisterCommand(cmd.HPTTL, execHPTTL, readFirstKey, nil, -5)
+	RegisterCommand(cmd.HPersist, execHPersist, writeFirstKey, undoHPersist, -5)
+	markAllowOOM(cmd.HExpire, cmd.HPExpire, cmd.HExpireAt, cmd.HPExpireAt, cmd.HPersist)
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"gedis/pkg/utils"
+	"testing"
+	"time"
+)
+
+func TestHashFieldExpire(t *testing.T) {
+	db := makeDB()
+	cases := []cmdCase{
+		{[]string{"HMSET", "h", "a", "1", "b", "2"}, "+OK\r\n"},
+		{[]string{"HEXPIRE", "h", "100", "FIELDS", "2", "a", "c"}, "*2\r\n:1\r\n:-2\r\n"},
+		{[]string{"HEXPIRE", "h", "200", "NX", "FIELDS", "1", "a"}, "*1\r\n:0\r\n"},
+		{[]string{"HTTL", "h", "FIELDS", "2", "a", "b"}, "*2\r\n:99\r\n:-1\r\n"},
+		{[]string{"HPERSIST", "h", "FIELDS", "2", "a", "b"}, "*2\r\n:1\r\n:-1\r\n"},
+		{[]string{"HPEXPIRE", "h", "20", "FIELDS", "1", "b"}, "*1\r\n:1\r\n"},
+		{[]string{"HEXPIRE", "h", "0", "FIELDS", "1", "a"}, "*1\r\n:2\r\n"},
+	}
+	runCases(t, db, cases)
+	time.Sleep(30 * time.Millisecond)
+	if result := db.Exec(nil, utils.ToCmdLine("EXISTS", "h")); string(result.ToBytes()) != ":0\r\n" {
+		t.Errorf("hash with all fields expired should not exist, got %q", result.ToBytes())
+	}
+}
+
+func TestHashFieldExpireOverflow(t *testing.T) {
+	db := makeDB()
+	runCases(t, db, []cmdCase{
+		{[]string{"HSET", "h", "f", "v"}, ":1\r\n"},
+		{[]string{"HEXPIRE", "h", "9223372036854775807", "FIELDS", "1", "f"}, "-ERR invalid expire time in 'hexpire' command\r\n"},
+		{[]string{"HPEXPIRE", "h", "9223372036854775", "FIELDS", "1", "f"}, "-ERR invalid expire time in 'hpexpire' command\r\n"},
+		{[]string{"HEXPIREAT", "h", "9223372036854775807", "FIELDS", "1", "f"}, "-ERR invalid expire time in 'hexpireat' command\r\n"},
+		{[]string{"HPEXPIREAT", "h", "9223372036854775807", "FIELDS", "1", "f"}, "-ERR invalid expire time in 'hpexpireat' command\r\n"},
+		{[]string{"HEXPIRE", "h", "-1", "FIELDS", "1", "f"}, "-ERR invalid expire time in 'hexpire' command\r\n"},
+		{[]string{"HTTL", "h", "FIELDS", "1", "f"}, "*1\r\n:-1\r\n"},
+		{[]string{"HGET", "h", "f"}, "$1\r\nv\r\n"},
+		{[]string{"HEXPIREAT", "h", "9000000000", "FIELDS", "1", "f"}, "*1\r\n:1\r\n"},
+	})
+}
+
+func TestHollowHashConditionalSet(t *testing.T) {
+	db := makeDB()
+	runCases(t, db, []cmdCase{
+		{[]string{"HSET", "h", "f", "v"}, ":1\r\n"},
+		{[]string{"HSET", "g", "f", "v"}, ":1\r\n"},
+		{[]string{"HPEXPIRE", "h", "10", "FIELDS", "1", "f"}, "*1\r\n:1\r\n"},
+		{[]string{"HPEXPIRE", "g", "10", "FIELDS", "1", "f"}, "*1\r\n:1\r\n"},
+	})
+	time.Sleep(20 * time.Millisecond)
+	// field 都已过期但还没有被清理的 hash 视为不存在
+	runCases(t, db, []cmdCase{
+		{[]string{"GET", "h"}, "$-1\r\n"},
+		{[]string{"SET", "g", "y", "XX"}, "$-1\r\n"},
+		{[]string{"EXISTS", "g"}, ":0\r\n"},
+		{[]string{"SETNX", "h", "x"}, ":1\r\n"},
+		{[]string{"GET", "h"}, "$1\r\nx\r\n"},
+	})
+}
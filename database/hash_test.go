@@ -0,0 +1,39 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestHRandField(t *testing.T) {
+	db := makeDB()
+	runCases(t, db, []cmdCase{
+		{[]string{"HSET", "h", "a", "1"}, ":1\r\n"},
+		{[]string{"HRANDFIELD", "h"}, "$1\r\na\r\n"},
+		{[]string{"HRANDFIELD", "h", "2"}, "*1\r\n$1\r\na\r\n"},
+		{[]string{"HRANDFIELD", "h", "-2"}, "*2\r\n$1\r\na\r\n$1\r\na\r\n"},
+		{[]string{"HRANDFIELD", "h", "-2", "WITHVALUES"}, "*4\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\na\r\n$1\r\n1\r\n"},
+		{[]string{"HRANDFIELD", "h", "0"}, "*0\r\n"},
+		{[]string{"HRANDFIELD", "missing"}, "$-1\r\n"},
+		{[]string{"HRANDFIELD", "missing", "-3"}, "*0\r\n"},
+		{[]string{"HRANDFIELD", "h", "-9223372036854775808"}, "-ERR value is out of range\r\n"},
+		{[]string{"HRANDFIELD", "h", "-9223372036854775807", "WITHVALUES"}, "-ERR value is out of range\r\n"},
+		{[]string{"HRANDFIELD", "h", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"HRANDFIELD", "h", "1", "FOO"}, "-Err syntax error\r\n"},
+	})
+}
+
+func TestHScan(t *testing.T) {
+	db := makeDB()
+	runCases(t, db, []cmdCase{
+		{[]string{"HMSET", "h", "a", "1", "b", "2"}, "+OK\r\n"},
+		{[]string{"HSCAN", "h", "0", "MATCH", "a"}, "*2\r\n$1\r\n0\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n"},
+		{[]string{"HSCAN", "h", "0", "NOVALUES", "MATCH", "b"}, "*2\r\n$1\r\n0\r\n*1\r\n$1\r\nb\r\n"},
+		{[]string{"HSCAN", "missing", "0"}, "*2\r\n$1\r\n0\r\n*0\r\n"},
+		{[]string{"HSCAN", "h", "x"}, "-ERR invalid cursor\r\n"},
+		{[]string{"HSCAN", "h", "0", "COUNT", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"HSCAN", "h", "0", "COUNT"}, "-Err syntax error\r\n"},
+		{[]string{"HSCAN", "h", "0", "TYPE", "hash"}, "-Err syntax error\r\n"},
+		{[]string{"SADD", "s", "a"}, ":1\r\n"},
+		{[]string{"SSCAN", "s", "0", "NOVALUES"}, "-Err syntax error\r\n"},
+	})
+}
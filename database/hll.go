@@ -0,0 +1,127 @@
+package database
+
+import (
+	"gedis/pkg/utils"
+	"gedis/reply"
+	"gedis/types/cmd"
+	"gedis/types/hll"
+	"gedis/types/redis"
+)
+
+// HyperLogLog 保存为字符串, 格式与 redis 一致, GET/SET 可以直接读写
+
+func (db *DB) getAsHLL(key string) ([]byte, reply.ErrorReply) {
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil || bytes == nil {
+		return nil, errReply
+	}
+	if !hll.IsValid(bytes) {
+		return nil, reply.MakeErrReply("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	}
+	return bytes, nil
+}
+
+// execPFAdd PFADD key [element [element ...]], 有寄存器变化或新建 key 时返回 1
+func execPFAdd(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	bytes, errReply := db.getAsHLL(key)
+	if errReply != nil {
+		return errReply
+	}
+	created := bytes == nil
+	if created {
+		bytes = hll.New()
+	}
+	bytes, updated, err := hll.Add(bytes, args[1:]...)
+	if err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+	if !created && !updated {
+		return reply.MakeIntReply(0)
+	}
+	db.PutEntity(key, &redis.DataEntity{
+		Data: bytes,
+	})
+	db.addAof(utils.ToCmdLine3("pfadd", args...))
+	return reply.MakeIntReply(1)
+}
+
+// execPFCount PFCOUNT key [key ...], 多个 key 时返回并集的基数
+func execPFCount(db *DB, args [][]byte) redis.Reply {
+	if len(args) == 1 {
+		bytes, errReply := db.getAsHLL(string(args[0]))
+		if errReply != nil {
+			return errReply
+		}
+		if bytes == nil {
+			return reply.MakeIntReply(0)
+		}
+		card, err := hll.Count(bytes)
+		if err != nil {
+			return reply.MakeErrReply(err.Error())
+		}
+		return reply.MakeIntReply(int64(card))
+	}
+
+	var regs hll.Registers
+	for _, arg := range args {
+		bytes, errReply := db.getAsHLL(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if bytes == nil {
+			continue
+		}
+		if err := regs.Merge(bytes); err != nil {
+			return reply.MakeErrReply(err.Error())
+		}
+	}
+	return reply.MakeIntReply(int64(regs.Count()))
+}
+
+// preparePFCount 单个 key 时会原地更新基数缓存, 需要加写锁
+func preparePFCount(args [][]byte) ([]string, []string) {
+	if len(args) == 1 {
+		return []string{string(args[0])}, nil
+	}
+	return readAllKeys(args)
+}
+
+// execPFMerge PFMERGE destkey [sourcekey [sourcekey ...]], destkey 已存在时也参与合并
+func execPFMerge(db *DB, args [][]byte) redis.Reply {
+	dest := string(args[0])
+	var regs hll.Registers
+	dense := false
+	for _, arg := range args {
+		bytes, errReply := db.getAsHLL(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if bytes == nil {
+			continue
+		}
+		if err := regs.Merge(bytes); err != nil {
+			return reply.MakeErrReply(err.Error())
+		}
+		dense = dense || hll.IsDense(bytes)
+	}
+	db.PutEntity(dest, &redis.DataEntity{
+		Data: regs.Encode(dense),
+	})
+	db.addAof(utils.ToCmdLine3("pfmerge", args...))
+	return reply.MakeOkReply()
+}
+
+func preparePFMerge(args [][]byte) ([]string, []string) {
+	sources := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		sources[i] = string(arg)
+	}
+	return []string{string(args[0])}, sources
+}
+
+func init() {
+	RegisterCommand(cmd.PFAdd, execPFAdd, writeFirstKey, rollbackBits, -2)
+	RegisterCommand(cmd.PFCount, execPFCount, preparePFCount, nil, -2)
+	RegisterCommand(cmd.PFMerge, execPFMerge, preparePFMerge, rollbackFirstKey, -2)
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"gedis/pkg/utils"
+	"gedis/reply"
+	"testing"
+)
+
+func TestHyperLogLogCommands(t *testing.T) {
+	db := makeDB()
+	cases := []cmdCase{
+		{[]string{"PFADD", "h1", "a", "b", "c", "d", "e", "f", "g"}, ":1\r\n"},
+		{[]string{"PFADD", "h1", "a", "b"}, ":0\r\n"},
+		{[]string{"PFCOUNT", "h1"}, ":7\r\n"},
+		{[]string{"PFADD", "h2"}, ":1\r\n"},
+		{[]string{"PFADD", "h2"}, ":0\r\n"},
+		{[]string{"PFCOUNT", "h2"}, ":0\r\n"},
+		{[]string{"PFADD", "h2", "f", "g", "h", "i"}, ":1\r\n"},
+		{[]string{"PFCOUNT", "h1", "h2", "none"}, ":9\r\n"},
+		{[]string{"PFCOUNT", "none"}, ":0\r\n"},
+		{[]string{"PFMERGE", "h3", "h1", "h2"}, "+OK\r\n"},
+		{[]string{"PFCOUNT", "h3"}, ":9\r\n"},
+		{[]string{"PFMERGE", "h3"}, "+OK\r\n"},
+		{[]string{"PFCOUNT", "h3"}, ":9\r\n"},
+		{[]string{"TYPE", "h3"}, "+string\r\n"},
+		{[]string{"SET", "s", "foo"}, "+OK\r\n"},
+		{[]string{"PFADD", "s", "a"}, "-WRONGTYPE Key is not a valid HyperLogLog string value.\r\n"},
+		{[]string{"PFCOUNT", "h1", "s"}, "-WRONGTYPE Key is not a valid HyperLogLog string value.\r\n"},
+		{[]string{"PFMERGE", "h1", "s"}, "-WRONGTYPE Key is not a valid HyperLogLog string value.\r\n"},
+		{[]string{"LPUSH", "l", "a"}, ":1\r\n"},
+		{[]string{"PFADD", "l", "a"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	}
+	runCases(t, db, cases)
+
+	// 通过 GET/SET 迁移后仍然可用
+	value := db.Exec(nil, utils.ToCmdLine("GET", "h3")).(*reply.BulkReply).Arg
+	db.Exec(nil, [][]byte{[]byte("SET"), []byte("h4"), value})
+	result := db.Exec(nil, utils.ToCmdLine("PFCOUNT", "h4"))
+	if string(result.ToBytes()) != ":9\r\n" {
+		t.Errorf("expect 9 after SET, actual %q", result.ToBytes())
+	}
+}
@@ -0,0 +1,239 @@
+package database
+
+import (
+	"fmt"
+	"gedis/config"
+	"gedis/reply"
+	"gedis/server/status"
+	"gedis/types/redis"
+	"math"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// infoSection INFO 命令的一个分组
+type infoSection struct {
+	name     string
+	generate func(mdb *MultiDB) []string
+}
+
+// infoSections 默认输出的分组, 按输出顺序排列
+var infoSections = []infoSection{
+	{"server", serverInfo},
+	{"clients", clientsInfo},
+	{"memory", memoryInfo},
+	{"persistence", persistenceInfo},
+	{"stats", statsInfo},
+	{"replication", replicationInfo},
+	{"cluster", clusterInfo},
+	{"keyspace", keyspaceInfo},
+}
+
+func serverInfo(mdb *MultiDB) []string {
+	mode := "standalone"
+	if mdb.cluster != nil {
+		mode = "cluster"
+	}
+	uptime := int64(time.Since(status.StartTime()).Seconds())
+	executable, _ := os.Executable()
+	return []string{
+		"redis_version:" + status.Version,
+		"redis_mode:" + mode,
+		"os:" + runtime.GOOS + " " + runtime.GOARCH,
+		"arch_bits:" + strconv.Itoa(strconv.IntSize),
+		"go_version:" + runtime.Version(),
+		"process_id:" + strconv.Itoa(os.Getpid()),
+		"tcp_port:" + config.Get().Server.Port,
+		"uptime_in_seconds:" + strconv.FormatInt(uptime, 10),
+		"uptime_in_days:" + strconv.FormatInt(uptime/86400, 10),
+		"executable:" + executable,
+		"hz:" + strconv.Itoa(config.Get().Server.Hz),
+	}
+}
+
+func clientsInfo(mdb *MultiDB) []string {
+	return []string{
+		"connected_clients:" + strconv.FormatInt(status.ConnectedClients(), 10),
+		"blocked_clients:" + strconv.FormatInt(atomic.LoadInt64(&blockedClients), 10),
+	}
+}
+
+// bytesToHuman 按 Redis 的格式输出内存大小, 例如 1.50M
+func bytesToHuman(n uint64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	value := float64(n)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatUint(n, 10) + units[0]
+	}
+	return fmt.Sprintf("%.2f%s", value, units[i])
+}
+
+func memoryInfo(mdb *MultiDB) []string {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return []string{
+		"used_memory:" + strconv.FormatUint(stats.HeapAlloc, 10),
+		"used_memory_human:" + bytesToHuman(stats.HeapAlloc),
+		"used_memory_rss:" + strconv.FormatUint(stats.Sys, 10),
+		"used_memory_rss_human:" + bytesToHuman(stats.Sys),
+		"total_heap_objects:" + strconv.FormatUint(stats.HeapObjects, 10),
+		"gc_cycles:" + strconv.FormatUint(uint64(stats.NumGC), 10),
+		"number_of_cached_scripts:" + strconv.Itoa(scriptCount()),
+		"used_memory_dataset:" + strconv.FormatInt(mdb.usedMemory(), 10),
+		"maxmemory:" + strconv.FormatInt(maxMemory, 10),
+		"maxmemory_human:" + bytesToHuman(uint64(maxMemory)),
+		"maxmemory_policy:" + maxMemoryPolicy,
+	}
+}
+
+func boolToInfo(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func persistenceInfo(mdb *MultiDB) []string {
+	storageMode := config.Get().Server.StorageMode
+	if storageMode == "" {
+		storageMode = "memory"
+	}
+	return []string{
+		"loading:0",
+		"rdb_bgsave_in_progress:" + boolToInfo(mdb.saving.Get()),
+		"rdb_last_save_time:" + strconv.FormatInt(atomic.LoadInt64(&mdb.lastSave), 10),
+		"aof_enabled:" + boolToInfo(mdb.aofHandler != nil),
+		"aof_rewrite_in_progress:" + boolToInfo(mdb.aofHandler != nil && mdb.aofHandler.Rewriting()),
+		"storage_mode:" + storageMode,
+	}
+}
+
+func statsInfo(mdb *MultiDB) []string {
+	return []string{
+		"total_connections_received:" + strconv.FormatInt(status.TotalConnectionsReceived(), 10),
+		"total_commands_processed:" + strconv.FormatInt(status.TotalCommandsProcessed(), 10),
+		"expired_keys:" + strconv.FormatInt(atomic.LoadInt64(&expiredKeys), 10),
+		fmt.Sprintf("expired_stale_perc:%.2f", math.Float64frombits(atomic.LoadUint64(&expiredStalePercentage))*100),
+		"expired_time_cap_reached_count:" + strconv.FormatInt(atomic.LoadInt64(&expiredTimeCapReached), 10),
+		"evicted_keys:" + strconv.FormatInt(atomic.LoadInt64(&evictedKeys), 10),
+	}
+}
+
+func replicationInfo(mdb *MultiDB) []string {
+	r := mdb.repl
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var lines []string
+	if link := r.master; link != nil {
+		linkStatus := "down"
+		if link.up.Get() {
+			linkStatus = "up"
+		}
+		lines = append(lines,
+			"role:slave",
+			"master_host:"+link.host,
+			"master_port:"+strconv.Itoa(link.port),
+			"master_link_status:"+linkStatus,
+			"master_sync_in_progress:0",
+			"slave_repl_offset:"+strconv.FormatInt(atomic.LoadInt64(&link.offset), 10),
+			"slave_read_only:1",
+		)
+	} else {
+		lines = append(lines, "role:master")
+	}
+
+	var synced []*replicaClient
+	for _, replica := range r.replicas {
+		if replica.ch != nil {
+			synced = append(synced, replica)
+		}
+	}
+	lines = append(lines, "connected_slaves:"+strconv.Itoa(len(synced)))
+	var offset int64
+	if r.backlog != nil {
+		offset = r.backlog.offset
+	}
+	for i, replica := range synced {
+		ip := replica.conn.RemoteAddr().String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		ackOffset := atomic.LoadInt64(&replica.ackOffset)
+		lines = append(lines, fmt.Sprintf("slave%d:ip=%s,port=%s,state=online,offset=%d,lag=%d",
+			i, ip, replica.listeningPort, ackOffset, offset-ackOffset))
+	}
+
+	lines = append(lines,
+		"master_replid:"+r.replId,
+		"master_repl_offset:"+strconv.FormatInt(offset, 10),
+		"repl_backlog_active:"+boolToInfo(r.backlog != nil),
+		"repl_backlog_size:"+strconv.Itoa(r.backlogSize),
+	)
+	if r.backlog != nil {
+		lines = append(lines,
+			"repl_backlog_first_byte_offset:"+strconv.FormatInt(r.backlog.offset-int64(r.backlog.length)+1, 10),
+			"repl_backlog_histlen:"+strconv.Itoa(r.backlog.length),
+		)
+	}
+	return lines
+}
+
+func clusterInfo(mdb *MultiDB) []string {
+	return []string{"cluster_enabled:" + boolToInfo(mdb.cluster != nil)}
+}
+
+func keyspaceInfo(mdb *MultiDB) []string {
+	var lines []string
+	for i, db := range mdb.dbSet {
+		keys := db.data.Len()
+		if db.storage != nil && db.maxHotKeys > 0 {
+			keys = len(db.keys())
+		}
+		if keys == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("db%d:keys=%d,expires=%d,avg_ttl=0", i, keys, db.ttlMap.Len()))
+	}
+	return lines
+}
+
+// Info 输出服务器信息, 可以指定一个或多个分组, all/everything 输出全部分组
+func Info(mdb *MultiDB, args [][]byte) redis.Reply {
+	selected := make(map[string]bool)
+	all := len(args) == 0
+	for _, arg := range args {
+		section := strings.ToLower(string(arg))
+		if section == "all" || section == "everything" || section == "default" {
+			all = true
+		}
+		selected[section] = true
+	}
+
+	var buf strings.Builder
+	for _, section := range infoSections {
+		if !all && !selected[section.name] {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString("# " + strings.ToUpper(section.name[:1]) + section.name[1:] + "\r\n")
+		for _, line := range section.generate(mdb) {
+			buf.WriteString(line + "\r\n")
+		}
+	}
+	if buf.Len() == 0 {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeBulkReply([]byte(buf.String()))
+}
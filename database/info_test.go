@@ -0,0 +1,100 @@
+package database
+
+import (
+	"gedis/pkg/utils"
+	"gedis/reply"
+	"gedis/types/redis/connection"
+	"strings"
+	"testing"
+)
+
+var allInfoHeaders = []string{"# Server", "# Clients", "# Memory", "# Persistence", "# Stats", "# Replication", "# Cluster", "# Keyspace"}
+
+func execInfo(t *testing.T, mdb *MultiDB, sections ...string) string {
+	t.Helper()
+	result := mdb.Exec(&connection.FakeConn{}, utils.ToCmdLine(append([]string{"INFO"}, sections...)...))
+	bulk, ok := result.(*reply.BulkReply)
+	if !ok {
+		t.Fatalf("INFO %v: expect bulk reply, actual %q", sections, result.ToBytes())
+	}
+	return string(bulk.Arg)
+}
+
+// assertHeaders 检查输出的分组及其顺序
+func assertHeaders(t *testing.T, info string, expect ...string) {
+	t.Helper()
+	var headers []string
+	for _, line := range strings.Split(info, "\r\n") {
+		if strings.HasPrefix(line, "# ") {
+			headers = append(headers, line)
+		}
+	}
+	if strings.Join(headers, ",") != strings.Join(expect, ",") {
+		t.Errorf("expect sections %v, actual %v", expect, headers)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	mdb := &MultiDB{dbSet: []*DB{makeDB(), makeDB()}}
+	mdb.repl = makeReplication(0)
+	mdb.lastSave = 1700000000
+	mdb.dbSet[1].Exec(nil, utils.ToCmdLine("SET", "k", "v", "EX", "100"))
+
+	info := execInfo(t, mdb)
+	assertHeaders(t, info, allInfoHeaders...)
+	for _, field := range []string{
+		"redis_mode:standalone\r\n",
+		"used_memory:",
+		"maxmemory_policy:",
+		"rdb_last_save_time:1700000000\r\n",
+		"aof_enabled:0\r\n",
+		"role:master\r\n",
+		"connected_slaves:0\r\n",
+		"master_replid:" + mdb.repl.replId + "\r\n",
+		"cluster_enabled:0\r\n",
+		"db1:keys=1,expires=1,avg_ttl=0\r\n",
+	} {
+		if !strings.Contains(info, field) {
+			t.Errorf("expect %q in INFO", field)
+		}
+	}
+	if strings.Contains(info, "db0:") {
+		t.Error("empty db should not be listed in keyspace")
+	}
+
+	for _, section := range []string{"all", "everything", "default", "ALL"} {
+		assertHeaders(t, execInfo(t, mdb, section), allInfoHeaders...)
+	}
+
+	info = execInfo(t, mdb, "memory")
+	assertHeaders(t, info, "# Memory")
+	if !strings.Contains(info, "used_memory:") || strings.Contains(info, "role:") {
+		t.Errorf("unexpected memory section %q", info)
+	}
+	// 多个分组按固定顺序输出
+	info = execInfo(t, mdb, "replication", "Persistence")
+	assertHeaders(t, info, "# Persistence", "# Replication")
+	if !strings.Contains(info, "role:master\r\n") || !strings.Contains(info, "rdb_last_save_time:1700000000\r\n") {
+		t.Errorf("unexpected sections %q", info)
+	}
+
+	result := mdb.Exec(&connection.FakeConn{}, utils.ToCmdLine("INFO", "foo"))
+	if actual := string(result.ToBytes()); actual != "$-1\r\n" {
+		t.Errorf("expect null reply for unknown section, actual %q", actual)
+	}
+}
+
+func TestBytesToHuman(t *testing.T) {
+	for n, expect := range map[uint64]string{
+		0:                "0B",
+		1023:             "1023B",
+		1536:             "1.50K",
+		3 * 1024 * 1024:  "3.00M",
+		5 << 40:          "5.00T",
+		1024 * (5 << 40): "5120.00T",
+	} {
+		if actual := bytesToHuman(n); actual != expect {
+			t.Errorf("%d: expect %s, actual %s", n, expect, actual)
+		}
+	}
+}
@@ -10,7 +10,11 @@ import (
 	"gedis/types/list"
 	"gedis/types/redis"
 	"gedis/types/set"
+	"gedis/types/stream"
+	SortedSet "gedis/types/zset"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -56,26 +60,126 @@ func execFlushDB(db *DB, args [][]byte) redis.Reply {
 	return &reply.OkReply{}
 }
 
-// execType returns the type of entity, including: string, list, hash, set and zset
+// execType returns the type of entity, including: string, list, hash, set, zset and stream
 func execType(db *DB, args [][]byte) redis.Reply {
 	key := string(args[0])
 	entity, exists := db.GetEntity(key)
 	if !exists {
 		return reply.MakeStatusReply("none")
 	}
-	switch entity.Data.(type) {
+	if name := typeName(entity.Data); name != "" {
+		return reply.MakeStatusReply(name)
+	}
+	return &reply.UnknownErrReply{}
+}
+
+// typeName returns the type name of data, same as redis TYPE
+func typeName(data interface{}) string {
+	switch data.(type) {
+	case []byte:
+		return "string"
+	case list.List:
+		return "list"
+	case dict.Dict:
+		return "hash"
+	case *set.Set:
+		return "set"
+	case *SortedSet.SortedSet:
+		return "zset"
+	case *stream.Stream:
+		return "stream"
+	}
+	return ""
+}
+
+// objectEncoding returns the name of the underlying encoding, same as redis OBJECT ENCODING
+func objectEncoding(data interface{}) string {
+	switch val := data.(type) {
 	case []byte:
-		return reply.MakeStatusReply("string")
+		if len(val) <= 20 {
+			if i, err := strconv.ParseInt(string(val), 10, 64); err == nil && strconv.FormatInt(i, 10) == string(val) {
+				return "int"
+			}
+		}
+		if len(val) <= 44 {
+			return "embstr"
+		}
+		return "raw"
+	case *list.QuickList:
+		return "quicklist"
 	case *list.LinkedList:
-		return reply.MakeStatusReply("list")
+		return "linkedlist"
+	case *dict.ListpackDict:
+		return val.Encoding()
 	case dict.Dict:
-		return reply.MakeStatusReply("hash")
+		return dict.EncodingHashtable
 	case *set.Set:
-		return reply.MakeStatusReply("set")
-		//case *sortedset.SortedSet:
-		//	return reply.MakeStatusReply("zset")
+		return val.Encoding()
+	case *SortedSet.SortedSet:
+		return val.Encoding()
+	case *stream.Stream:
+		return "stream"
 	}
-	return &reply.UnknownErrReply{}
+	return "unknown"
+}
+
+// execObject OBJECT ENCODING|FREQ|IDLETIME key
+func execObject(db *DB, args [][]byte) redis.Reply {
+	subCmd := strings.ToUpper(string(args[0]))
+	switch subCmd {
+	case "ENCODING":
+		if len(args) != 2 {
+			return reply.MakeErrReply("ERR wrong number of arguments for 'object|encoding' command")
+		}
+		entity, exists := db.GetEntity(string(args[1]))
+		if !exists {
+			return &reply.NullBulkReply{}
+		}
+		return reply.MakeBulkReply([]byte(objectEncoding(entity.Data)))
+	case "FREQ", "IDLETIME":
+		if len(args) != 2 {
+			return reply.MakeErrReply("ERR wrong number of arguments for 'object|" + strings.ToLower(subCmd) + "' command")
+		}
+		// 与 redis 一致, 查询访问信息本身不算一次访问
+		entity, _, exists := db.peekEntity(string(args[1]))
+		if !exists {
+			return &reply.NullBulkReply{}
+		}
+		access := atomic.LoadUint32(&entity.Access)
+		if subCmd == "FREQ" {
+			if !isLFUPolicy() {
+				return reply.MakeErrReply("ERR An LFU maxmemory policy is not selected, access frequency not tracked.")
+			}
+			return reply.MakeIntReply(int64(lfuDecr(access)))
+		}
+		if isLFUPolicy() {
+			return reply.MakeErrReply("ERR An LRU maxmemory policy is not selected, no access time data.")
+		}
+		return reply.MakeIntReply(time.Now().Unix() - int64(access))
+	case "HELP":
+		return reply.MakeMultiBulkReply(utils.ToCmdLine(
+			"OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"ENCODING <key>",
+			"    Return the kind of internal representation used in order to store the value",
+			"    associated with a <key>.",
+			"FREQ <key>",
+			"    Return the access frequency index of the <key>. The returned integer is",
+			"    proportional to the logarithm of the recent access frequency of the key.",
+			"IDLETIME <key>",
+			"    Return the idle time of the <key>, that is the approximated number of",
+			"    seconds elapsed since the last access to the key.",
+			"HELP",
+			"    Print this help.",
+		))
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try OBJECT HELP.")
+}
+
+func prepareObject(args [][]byte) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return nil, []string{string(args[1])}
 }
 
 func prepareRename(args [][]byte) ([]string, []string) {
@@ -281,30 +385,34 @@ func execPersist(db *DB, args [][]byte) redis.Reply {
 func execKeys(db *DB, args [][]byte) redis.Reply {
 	pattern := wildcard.CompilePattern(string(args[0]))
 	result := make([][]byte, 0)
-	db.data.ForEach(func(key string, val interface{}) bool {
+	for _, key := range db.keys() {
 		if pattern.IsMatch(key) {
 			result = append(result, []byte(key))
 		}
-		return true
-	})
+	}
 	return reply.MakeMultiBulkReply(result)
 }
 
+// execScan SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
 func execScan(db *DB, args [][]byte) redis.Reply {
-	//pattern := wildcard.CompilePattern(string("*"))
-	//result := make([][]byte, 0)
-	//db.data.ForEach(func(key string, val interface{}) bool {
-	//	if pattern.IsMatch(key) {
-	//		result = append(result, []byte(key))
-	//	}
-	//	return true
-	//})
-	start, _ := strconv.Atoi(string(args[0]))
-	count, _ := strconv.Atoi(string(args[4]))
-	result := db.data.ForScanKeys(func(key string, val interface{}) bool {
-		return true
-	}, start, count)
-	return reply.MakeScanBulkReply(100000, result)
+	scan, errReply := parseScanArgs(args, "TYPE")
+	if errReply != nil {
+		return errReply
+	}
+
+	keys, next := db.scanKeys(scan.cursor, scan.count)
+	result := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		if !scan.isMatch(key) {
+			continue
+		}
+		entity, ok := db.lookupEntity(key)
+		if !ok || (scan.typ != "" && typeName(entity.Data) != scan.typ) {
+			continue
+		}
+		result = append(result, []byte(key))
+	}
+	return reply.MakeScanBulkReply(int(next), result)
 }
 
 func toTTLCmd(db *DB, key string) *reply.MultiBulkReply {
@@ -336,9 +444,12 @@ func init() {
 	RegisterCommand(cmd.Persist, execPersist, writeFirstKey, undoExpire, 2)
 	RegisterCommand(cmd.Exists, execExists, readAllKeys, nil, -2)
 	RegisterCommand(cmd.Type, execType, readFirstKey, nil, 2)
+	RegisterCommand(cmd.Object, execObject, prepareObject, nil, -2)
 	RegisterCommand(cmd.Rename, execRename, prepareRename, undoRename, 3)
 	RegisterCommand(cmd.RenameNx, execRenameNx, prepareRename, undoRename, 3)
 	RegisterCommand(cmd.FlushDB, execFlushDB, noPrepare, nil, -1)
+	markWriteCommand(cmd.FlushDB)
 	RegisterCommand(cmd.Keys, execKeys, noPrepare, nil, 2)
-	RegisterCommand(cmd.Scan, execScan, noPrepare, nil, -1)
+	RegisterCommand(cmd.Scan, execScan, noPrepare, nil, -2)
+	markAllowOOM(cmd.Del, cmd.Expire, cmd.ExpireAt, cmd.PExpire, cmd.PExpireAt, cmd.Persist, cmd.FlushDB)
 }
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"gedis/pkg/utils"
+	"gedis/reply"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestObjectEncoding(t *testing.T) {
+	db := makeDB()
+	cases := []cmdCase{
+		{[]string{"SET", "str", "12"}, "+OK\r\n"},
+		{[]string{"OBJECT", "ENCODING", "str"}, "$3\r\nint\r\n"},
+		{[]string{"APPEND", "str", "a"}, ":3\r\n"},
+		{[]string{"OBJECT", "ENCODING", "str"}, "$6\r\nembstr\r\n"},
+		{[]string{"RPUSH", "list", "a"}, ":1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "list"}, "$9\r\nquicklist\r\n"},
+		{[]string{"SADD", "set", "1", "2"}, ":2\r\n"},
+		{[]string{"OBJECT", "ENCODING", "set"}, "$6\r\nintset\r\n"},
+		{[]string{"SADD", "set", "a"}, ":1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "set"}, "$8\r\nlistpack\r\n"},
+		{[]string{"HSET", "hash", "f", "v"}, ":1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "hash"}, "$8\r\nlistpack\r\n"},
+		{[]string{"HPEXPIRE", "hash", "100000", "FIELDS", "1", "f"}, "*1\r\n:1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "hash"}, "$9\r\nhashtable\r\n"},
+		{[]string{"ZADD", "zset", "1", "a"}, ":1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "zset"}, "$8\r\nlistpack\r\n"},
+		{[]string{"OBJECT", "ENCODING", "none"}, "$-1\r\n"},
+		{[]string{"OBJECT", "FOO", "str"}, "-ERR unknown subcommand 'FOO'. Try OBJECT HELP.\r\n"},
+	}
+	runCases(t, db, cases)
+
+	// 超过阈值后转换为完整编码
+	for i := 0; i < 200; i++ {
+		member := "m" + strconv.Itoa(i)
+		db.Exec(nil, utils.ToCmdLine("SADD", "set", member))
+		db.Exec(nil, utils.ToCmdLine("HSET", "hash2", member, "v"))
+		db.Exec(nil, utils.ToCmdLine("ZADD", "zset", strconv.Itoa(i), member))
+	}
+	for key, expect := range map[string]string{"set": "hashtable", "hash2": "hashtable", "zset": "skiplist"} {
+		result := db.Exec(nil, utils.ToCmdLine("OBJECT", "ENCODING", key))
+		if string(result.ToBytes()) != "$"+strconv.Itoa(len(expect))+"\r\n"+expect+"\r\n" {
+			t.Errorf("%s: expect %s, actual %q", key, expect, result.ToBytes())
+		}
+	}
+}
+
+// scanAll 反复执行 SCAN 直到游标为 0, 返回每个 key 被访问的次数
+func scanAll(t *testing.T, db *DB, args ...string) map[string]int {
+	visited := make(map[string]int)
+	cursor := "0"
+	for i := 0; ; i++ {
+		if i > 100000 {
+			t.Fatal("scan does not terminate")
+		}
+		result, ok := db.Exec(nil, utils.ToCmdLine(append([]string{"SCAN", cursor}, args...)...)).(*reply.ScanBulkReply)
+		if !ok {
+			t.Fatalf("SCAN %v: unexpected reply", args)
+		}
+		for _, key := range result.Args {
+			visited[string(key)]++
+		}
+		cursor = strconv.Itoa(result.Pos)
+		if cursor == "0" {
+			return visited
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	db := makeDB()
+	for i := 0; i < 1000; i++ {
+		db.Exec(nil, utils.ToCmdLine("SET", "str:"+strconv.Itoa(i), "v"))
+	}
+	for i := 0; i < 100; i++ {
+		db.Exec(nil, utils.ToCmdLine("ZADD", "zset:"+strconv.Itoa(i), "1", "a"))
+	}
+	db.Exec(nil, utils.ToCmdLine("SET", "expired", "v"))
+	db.Expire("expired", time.Now().Add(-time.Second))
+
+	visited := scanAll(t, db, "COUNT", "7")
+	if len(visited) != 1100 {
+		t.Errorf("expect 1100 keys, actual %d", len(visited))
+	}
+	for key, n := range visited {
+		if n != 1 {
+			t.Errorf("%s is visited %d times", key, n)
+		}
+	}
+	if visited = scanAll(t, db, "MATCH", "str:1*"); len(visited) != 111 {
+		t.Errorf("expect 111 keys match str:1*, actual %d", len(visited))
+	}
+	if visited = scanAll(t, db, "TYPE", "ZSET", "COUNT", "100"); len(visited) != 100 {
+		t.Errorf("expect 100 zset keys, actual %d", len(visited))
+	}
+	if visited = scanAll(t, db, "MATCH", "zset:1*", "TYPE", "string"); len(visited) != 0 {
+		t.Errorf("expect no keys, actual %d", len(visited))
+	}
+
+	// 遍历过程中删除和添加 key 不影响一直存在的 key
+	visited = make(map[string]int)
+	cursor := 0
+	for i := 0; ; i++ {
+		db.Exec(nil, utils.ToCmdLine("DEL", "zset:"+strconv.Itoa(i)))
+		db.Exec(nil, utils.ToCmdLine("SET", "new:"+strconv.Itoa(i), "v"))
+		result := db.Exec(nil, utils.ToCmdLine("SCAN", strconv.Itoa(cursor), "MATCH", "str:*")).(*reply.ScanBulkReply)
+		for _, key := range result.Args {
+			visited[string(key)]++
+		}
+		if cursor = result.Pos; cursor == 0 {
+			break
+		}
+	}
+	if len(visited) != 1000 {
+		t.Errorf("expect 1000 keys, actual %d", len(visited))
+	}
+
+	runCases(t, db, []cmdCase{
+		{[]string{"SCAN", "a"}, "-ERR invalid cursor\r\n"},
+		{[]string{"SCAN", "0", "COUNT", "0"}, "-Err syntax error\r\n"},
+		{[]string{"SCAN", "0", "MATCH"}, "-Err syntax error\r\n"},
+		{[]string{"SCAN", "0", "FOO", "bar"}, "-Err syntax error\r\n"},
+		{[]string{"TYPE", "zset:500"}, "+none\r\n"},
+		{[]string{"ZADD", "z", "1", "a"}, ":1\r\n"},
+		{[]string{"TYPE", "z"}, "+zset\r\n"},
+	})
+}
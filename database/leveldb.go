@@ -3,6 +3,7 @@ package database
 import (
 	"gedis/pkg/logger"
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 type EachKey func([]byte, []byte)
@@ -15,18 +16,30 @@ func NewLevelDb() *LevelDb {
 	return &LevelDb{}
 }
 
-func (ldb *LevelDb) Load(path string) {
+func (ldb *LevelDb) Load(path string) error {
 	db, err := leveldb.OpenFile(path, nil)
 	if err != nil {
 		logger.Error(err.Error())
+		return err
 	}
 	ldb.db = db
+	return nil
 }
 
 func (ldb *LevelDb) Put(key, value []byte) error {
 	return ldb.db.Put(key, value, nil)
 }
 
+// Get returns value of the key, leveldb.ErrNotFound if key not exists
+func (ldb *LevelDb) Get(key []byte) ([]byte, error) {
+	return ldb.db.Get(key, nil)
+}
+
+// Delete removes the key, deleting a missing key is not an error
+func (ldb *LevelDb) Delete(key []byte) error {
+	return ldb.db.Delete(key, nil)
+}
+
 func (ldb *LevelDb) EachKeys(fn EachKey) {
 	iter := ldb.db.NewIterator(nil, nil)
 	for iter.Next() {
@@ -37,6 +50,37 @@ func (ldb *LevelDb) EachKeys(fn EachKey) {
 	iter.Release()
 }
 
+// EachPrefix 遍历指定前缀的 key, 回调中的切片在下一次迭代后失效
+func (ldb *LevelDb) EachPrefix(prefix []byte, fn EachKey) {
+	iter := ldb.db.NewIterator(util.BytesPrefix(prefix), nil)
+	for iter.Next() {
+		fn(iter.Key(), iter.Value())
+	}
+	iter.Release()
+}
+
+// EachFrom 从 start 开始按顺序遍历指定前缀的 key, fn 返回 false 时停止
+func (ldb *LevelDb) EachFrom(prefix []byte, start []byte, fn func([]byte, []byte) bool) {
+	r := util.BytesPrefix(prefix)
+	r.Start = start
+	iter := ldb.db.NewIterator(r, nil)
+	for iter.Next() {
+		if !fn(iter.Key(), iter.Value()) {
+			break
+		}
+	}
+	iter.Release()
+}
+
+// DeletePrefix 批量删除指定前缀的 key
+func (ldb *LevelDb) DeletePrefix(prefix []byte) error {
+	batch := new(leveldb.Batch)
+	ldb.EachPrefix(prefix, func(key []byte, _ []byte) {
+		batch.Delete(append([]byte{}, key...))
+	})
+	return ldb.db.Write(batch, nil)
+}
+
 func (ldb *LevelDb) Close() {
 	ldb.db.Close()
 }
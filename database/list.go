@@ -6,29 +6,31 @@ import (
 	"gedis/types/cmd"
 	List "gedis/types/list"
 	"gedis/types/redis"
+	"math"
 	"strconv"
+	"strings"
 )
 
-func (db *DB) getAsList(key string) (*List.LinkedList, reply.ErrorReply) {
+func (db *DB) getAsList(key string) (List.List, reply.ErrorReply) {
 	entity, ok := db.GetEntity(key)
 	if !ok {
 		return nil, nil
 	}
-	bytes, ok := entity.Data.(*List.LinkedList)
+	bytes, ok := entity.Data.(List.List)
 	if !ok {
 		return nil, &reply.WrongTypeErrReply{}
 	}
 	return bytes, nil
 }
 
-func (db *DB) getOrInitList(key string) (list *List.LinkedList, isNew bool, errReply reply.ErrorReply) {
+func (db *DB) getOrInitList(key string) (list List.List, isNew bool, errReply reply.ErrorReply) {
 	list, errReply = db.getAsList(key)
 	if errReply != nil {
 		return nil, false, errReply
 	}
 	isNew = false
 	if list == nil {
-		list = &List.LinkedList{}
+		list = List.MakeQuickList()
 		db.PutEntity(key, &redis.DataEntity{
 			Data: list,
 		})
@@ -86,10 +88,27 @@ func execLLen(db *DB, args [][]byte) redis.Reply {
 	return reply.MakeIntReply(size)
 }
 
-// execLPop removes the first element of list, and return it
+// execLPop LPOP key [count], removes the first elements of list, and return them
 func execLPop(db *DB, args [][]byte) redis.Reply {
+	return execPop(db, args, "lpop", true)
+}
+
+// execPop 弹出列表一端的元素, 没有 count 参数时返回单个元素
+func execPop(db *DB, args [][]byte, cmdName string, left bool) redis.Reply {
 	// parse args
 	key := string(args[0])
+	count := 1
+	withCount := len(args) > 1
+	if withCount {
+		count64, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		if count64 < 0 {
+			return reply.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		count = int(count64)
+	}
 
 	// get data
 	list, errReply := db.getAsList(key)
@@ -97,20 +116,47 @@ func execLPop(db *DB, args [][]byte) redis.Reply {
 		return errReply
 	}
 	if list == nil {
+		if withCount {
+			return reply.MakeNullMultiBulkReply()
+		}
 		return &reply.NullBulkReply{}
 	}
 
-	val, _ := list.Remove(0).([]byte)
+	vals := db.popList(key, list, count, left)
+	if len(vals) > 0 {
+		db.addAof(utils.ToCmdLine3(cmdName, args...))
+	}
+	if !withCount {
+		return reply.MakeBulkReply(vals[0])
+	}
+	return reply.MakeMultiBulkReply(vals)
+}
+
+// popList 从列表的一端弹出至多 count 个元素, 列表为空时删除 key
+func (db *DB) popList(key string, list List.List, count int, left bool) [][]byte {
+	if count > list.Len() {
+		count = list.Len()
+	}
+	vals := make([][]byte, count)
+	for i := range vals {
+		if left {
+			vals[i], _ = list.Remove(0).([]byte)
+		} else {
+			vals[i], _ = list.RemoveLast().([]byte)
+		}
+	}
 	if list.Len() == 0 {
 		db.Remove(key)
 	}
-	db.addAof(utils.ToCmdLine3("lpop", args...))
-	return reply.MakeBulkReply(val)
+	return vals
 }
 
 var lPushCmd = []byte("LPUSH")
 
 func undoLPop(db *DB, args [][]byte) [][][]byte {
+	if len(args) > 1 {
+		return rollbackFirstKey(db, args)
+	}
 	key := string(args[0])
 	list, errReply := db.getAsList(key)
 	if errReply != nil {
@@ -185,16 +231,14 @@ func execLPushX(db *DB, args [][]byte) redis.Reply {
 func execLRange(db *DB, args [][]byte) redis.Reply {
 	// parse args
 	key := string(args[0])
-	start64, err := strconv.ParseInt(string(args[1]), 10, 64)
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
 	if err != nil {
 		return reply.MakeErrReply("ERR value is not an integer or out of range")
 	}
-	start := int(start64)
-	stop64, err := strconv.ParseInt(string(args[2]), 10, 64)
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
 	if err != nil {
 		return reply.MakeErrReply("ERR value is not an integer or out of range")
 	}
-	stop := int(stop64)
 
 	// get data
 	list, errReply := db.getAsList(key)
@@ -206,29 +250,11 @@ func execLRange(db *DB, args [][]byte) redis.Reply {
 	}
 
 	// compute index
-	size := list.Len() // assert: size > 0
-	if start < -1*size {
-		start = 0
-	} else if start < 0 {
-		start = size + start
-	} else if start >= size {
+	start, stop, ok := rankRange(int64(list.Len()), start, stop)
+	if !ok {
 		return &reply.EmptyMultiBulkReply{}
 	}
-	if stop < -1*size {
-		stop = 0
-	} else if stop < 0 {
-		stop = size + stop + 1
-	} else if stop < size {
-		stop = stop + 1
-	} else {
-		stop = size
-	}
-	if stop < start {
-		stop = start
-	}
-
-	// assert: start in [0, size - 1], stop in [start, size]
-	slice := list.Range(start, stop)
+	slice := list.Range(int(start), int(stop))
 	result := make([][]byte, len(slice))
 	for i, raw := range slice {
 		bytes, _ := raw.([]byte)
@@ -343,31 +369,17 @@ func undoLSet(db *DB, args [][]byte) [][][]byte {
 	}
 }
 
-// execRPop removes last element of list then return it
+// execRPop RPOP key [count], removes the last elements of list, and return them
 func execRPop(db *DB, args [][]byte) redis.Reply {
-	// parse args
-	key := string(args[0])
-
-	// get data
-	list, errReply := db.getAsList(key)
-	if errReply != nil {
-		return errReply
-	}
-	if list == nil {
-		return &reply.NullBulkReply{}
-	}
-
-	val, _ := list.RemoveLast().([]byte)
-	if list.Len() == 0 {
-		db.Remove(key)
-	}
-	db.addAof(utils.ToCmdLine3("rpop", args...))
-	return reply.MakeBulkReply(val)
+	return execPop(db, args, "rpop", false)
 }
 
 var rPushCmd = []byte("RPUSH")
 
 func undoRPop(db *DB, args [][]byte) [][][]byte {
+	if len(args) > 1 {
+		return rollbackFirstKey(db, args)
+	}
 	key := string(args[0])
 	list, errReply := db.getAsList(key)
 	if errReply != nil {
@@ -504,17 +516,378 @@ func execRPushX(db *DB, args [][]byte) redis.Reply {
 	return reply.MakeIntReply(int64(list.Len()))
 }
 
+// prepareBlockingPop 最后一个参数是超时时间, 其余都是 key
+func prepareBlockingPop(args [][]byte) ([]string, []string) {
+	return writeAllKeys(args[:len(args)-1])
+}
+
+func undoBlockingPop(db *DB, args [][]byte) [][][]byte {
+	keys, _ := prepareBlockingPop(args)
+	return rollbackGivenKeys(db, keys...)
+}
+
+// execBLPop 弹出第一个非空列表的头部元素, 所有列表都为空时返回空回复, 由 MultiDB 负责阻塞等待
+func execBLPop(db *DB, args [][]byte) redis.Reply {
+	return execBlockingPop(db, args, true)
+}
+
+// execBRPop 弹出第一个非空列表的尾部元素
+func execBRPop(db *DB, args [][]byte) redis.Reply {
+	return execBlockingPop(db, args, false)
+}
+
+func execBlockingPop(db *DB, args [][]byte, left bool) redis.Reply {
+	if _, errReply := parseBlockingTimeout(args[len(args)-1]); errReply != nil {
+		return errReply
+	}
+	for _, arg := range args[:len(args)-1] {
+		key := string(arg)
+		list, errReply := db.getAsList(key)
+		if errReply != nil {
+			return errReply
+		}
+		if list == nil {
+			continue
+		}
+		var val []byte
+		if left {
+			val, _ = list.Remove(0).([]byte)
+			db.addAof(utils.ToCmdLine3("lpop", arg))
+		} else {
+			val, _ = list.RemoveLast().([]byte)
+			db.addAof(utils.ToCmdLine3("rpop", arg))
+		}
+		if list.Len() == 0 {
+			db.Remove(key)
+		}
+		return reply.MakeMultiBulkReply([][]byte{arg, val})
+	}
+	return reply.MakeNullMultiBulkReply()
+}
+
+// execBRPopLPush 阻塞版本的 RPOPLPUSH
+func execBRPopLPush(db *DB, args [][]byte) redis.Reply {
+	if _, errReply := parseBlockingTimeout(args[2]); errReply != nil {
+		return errReply
+	}
+	return execRPopLPush(db, args[:2])
+}
+
+// parseListDirection 解析 LEFT|RIGHT, LEFT 返回 true
+func parseListDirection(arg []byte) (bool, reply.ErrorReply) {
+	switch strings.ToLower(string(arg)) {
+	case "left":
+		return true, nil
+	case "right":
+		return false, nil
+	}
+	return false, reply.MakeSyntaxErrReply()
+}
+
+// execLMove 从 source 的一端弹出元素并插入 destination 的一端: LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func execLMove(db *DB, args [][]byte) redis.Reply {
+	fromLeft, errReply := parseListDirection(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	toLeft, errReply := parseListDirection(args[3])
+	if errReply != nil {
+		return errReply
+	}
+
+	sourceKey, destKey := string(args[0]), string(args[1])
+	sourceList, errReply := db.getAsList(sourceKey)
+	if errReply != nil {
+		return errReply
+	}
+	if sourceList == nil {
+		return &reply.NullBulkReply{}
+	}
+	destList, _, errReply := db.getOrInitList(destKey)
+	if errReply != nil {
+		return errReply
+	}
+
+	var val []byte
+	if fromLeft {
+		val, _ = sourceList.Remove(0).([]byte)
+		db.addAof(utils.ToCmdLine3("lpop", args[0]))
+	} else {
+		val, _ = sourceList.RemoveLast().([]byte)
+		db.addAof(utils.ToCmdLine3("rpop", args[0]))
+	}
+	if toLeft {
+		destList.Insert(0, val)
+		db.addAof(utils.ToCmdLine3("lpush", args[1], val))
+	} else {
+		destList.Add(val)
+		db.addAof(utils.ToCmdLine3("rpush", args[1], val))
+	}
+	if sourceList.Len() == 0 {
+		db.Remove(sourceKey)
+	}
+	return reply.MakeBulkReply(val)
+}
+
+// execBLMove 阻塞版本的 LMOVE: BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+func execBLMove(db *DB, args [][]byte) redis.Reply {
+	if _, errReply := parseBlockingTimeout(args[4]); errReply != nil {
+		return errReply
+	}
+	return execLMove(db, args[:4])
+}
+
+func undoLMove(db *DB, args [][]byte) [][][]byte {
+	return rollbackGivenKeys(db, string(args[0]), string(args[1]))
+}
+
+// execLInsert LINSERT key BEFORE|AFTER pivot element, 返回插入后的长度, 找不到 pivot 时返回 -1
+func execLInsert(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	var after bool
+	switch strings.ToUpper(string(args[1])) {
+	case "BEFORE":
+	case "AFTER":
+		after = true
+	default:
+		return reply.MakeSyntaxErrReply()
+	}
+	pivot, value := args[2], args[3]
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	index := -1
+	list.ForEach(func(i int, v interface{}) bool {
+		if utils.Equals(v, pivot) {
+			index = i
+			return false
+		}
+		return true
+	})
+	if index < 0 {
+		return reply.MakeIntReply(-1)
+	}
+	if after {
+		index++
+	}
+	list.Insert(index, value)
+	db.addAof(utils.ToCmdLine3("linsert", args...))
+	return reply.MakeIntReply(int64(list.Len()))
+}
+
+// execLTrim LTRIM key start stop, 只保留指定范围内的元素
+func execLTrim(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return &reply.OkReply{}
+	}
+
+	size := list.Len()
+	start, stop, ok := rankRange(int64(size), start, stop)
+	if !ok || start == stop {
+		db.Remove(key)
+	} else {
+		list.Trim(int(start), int(stop))
+	}
+	if !ok || int(stop-start) != size {
+		db.addAof(utils.ToCmdLine3("ltrim", args...))
+	}
+	return &reply.OkReply{}
+}
+
+// execLPos LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func execLPos(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	element := args[1]
+	var rank int64 = 1
+	var count int64 = -1 // 没有 COUNT 参数时只返回第一个匹配的位置
+	var maxLen int64 = 0
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return reply.MakeSyntaxErrReply()
+		}
+		value, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "RANK":
+			if value == 0 {
+				return reply.MakeErrReply("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+			}
+			if value == math.MinInt64 {
+				return reply.MakeErrReply("ERR value is out of range")
+			}
+			rank = value
+		case "COUNT":
+			if value < 0 {
+				return reply.MakeErrReply("ERR COUNT can't be negative")
+			}
+			count = value
+		case "MAXLEN":
+			if value < 0 {
+				return reply.MakeErrReply("ERR MAXLEN can't be negative")
+			}
+			maxLen = value
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		if count < 0 {
+			return &reply.NullBulkReply{}
+		}
+		return &reply.EmptyMultiBulkReply{}
+	}
+
+	skip := rank - 1 // 跳过前 rank - 1 个匹配
+	if rank < 0 {
+		skip = -rank - 1
+	}
+	var matches []redis.Reply
+	var scanned int64 = 0
+	visit := func(i int, v interface{}) bool {
+		if maxLen > 0 && scanned >= maxLen {
+			return false
+		}
+		scanned++
+		if !utils.Equals(v, element) {
+			return true
+		}
+		if skip > 0 {
+			skip--
+			return true
+		}
+		matches = append(matches, reply.MakeIntReply(int64(i)))
+		if count < 0 {
+			return false // 只需要第一个匹配
+		}
+		// count 为 0 时返回所有匹配
+		return count == 0 || int64(len(matches)) < count
+	}
+	if rank > 0 {
+		list.ForEach(visit)
+	} else {
+		list.ReverseForEach(visit)
+	}
+
+	if count < 0 {
+		if len(matches) == 0 {
+			return &reply.NullBulkReply{}
+		}
+		return matches[0]
+	}
+	return reply.MakeMultiRawReply(matches)
+}
+
+// execLMPop LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func execLMPop(db *DB, args [][]byte) redis.Reply {
+	keys, left, count, errReply := parseMPop(args, parseListDirection)
+	if errReply != nil {
+		return errReply
+	}
+	for _, key := range keys {
+		list, errReply := db.getAsList(key)
+		if errReply != nil {
+			return errReply
+		}
+		if list == nil {
+			continue
+		}
+		vals := db.popList(key, list, count, left)
+		cmdName := "rpop"
+		if left {
+			cmdName = "lpop"
+		}
+		db.addAof(utils.ToCmdLine(cmdName, key, strconv.Itoa(len(vals))))
+		return reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeBulkReply([]byte(key)),
+			reply.MakeMultiBulkReply(vals),
+		})
+	}
+	return reply.MakeNullMultiBulkReply()
+}
+
+// execBLMPop BLMPOP timeout numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func execBLMPop(db *DB, args [][]byte) redis.Reply {
+	if _, errReply := parseBlockingTimeout(args[0]); errReply != nil {
+		return errReply
+	}
+	return execLMPop(db, args[1:])
+}
+
+func prepareLMPop(args [][]byte) ([]string, []string) {
+	keys, _, _, errReply := parseMPop(args, parseListDirection)
+	if errReply != nil {
+		return nil, nil
+	}
+	return keys, nil
+}
+
+func undoLMPop(db *DB, args [][]byte) [][][]byte {
+	keys, _ := prepareLMPop(args)
+	return rollbackGivenKeys(db, keys...)
+}
+
+func prepareBLMPop(args [][]byte) ([]string, []string) {
+	return prepareLMPop(args[1:])
+}
+
+func undoBLMPop(db *DB, args [][]byte) [][][]byte {
+	return undoLMPop(db, args[1:])
+}
+
 func init() {
 	RegisterCommand(cmd.LPush, execLPush, writeFirstKey, undoLPush, -3)
 	RegisterCommand(cmd.LPushX, execLPushX, writeFirstKey, undoLPush, -3)
 	RegisterCommand(cmd.RPush, execRPush, writeFirstKey, undoRPush, -3)
 	RegisterCommand(cmd.RPushX, execRPushX, writeFirstKey, undoRPush, -3)
-	RegisterCommand(cmd.LPop, execLPop, writeFirstKey, undoLPop, 2)
-	RegisterCommand(cmd.RPop, execRPop, writeFirstKey, undoRPop, 2)
+	RegisterCommand(cmd.LPop, execLPop, writeFirstKey, undoLPop, -2)
+	RegisterCommand(cmd.RPop, execRPop, writeFirstKey, undoRPop, -2)
 	RegisterCommand(cmd.RPopLPush, execRPopLPush, prepareRPopLPush, undoRPopLPush, 3)
 	RegisterCommand(cmd.LRem, execLRem, writeFirstKey, rollbackFirstKey, 4)
 	RegisterCommand(cmd.LLen, execLLen, readFirstKey, nil, 2)
 	RegisterCommand(cmd.LIndex, execLIndex, readFirstKey, nil, 3)
 	RegisterCommand(cmd.LSet, execLSet, writeFirstKey, undoLSet, 4)
 	RegisterCommand(cmd.LRange, execLRange, readFirstKey, nil, 4)
+	RegisterCommand(cmd.LInsert, execLInsert, writeFirstKey, rollbackFirstKey, 5)
+	RegisterCommand(cmd.LTrim, execLTrim, writeFirstKey, rollbackFirstKey, 4)
+	RegisterCommand(cmd.LPos, execLPos, readFirstKey, nil, -3)
+	RegisterCommand(cmd.LMove, execLMove, prepareRPopLPush, undoLMove, 5)
+	RegisterCommand(cmd.LMPop, execLMPop, prepareLMPop, undoLMPop, -4)
+	RegisterCommand(cmd.BLPop, execBLPop, prepareBlockingPop, undoBlockingPop, -3)
+	RegisterCommand(cmd.BRPop, execBRPop, prepareBlockingPop, undoBlockingPop, -3)
+	RegisterCommand(cmd.BRPopLPush, execBRPopLPush, prepareRPopLPush, undoRPopLPush, 4)
+	RegisterCommand(cmd.BLMove, execBLMove, prepareRPopLPush, undoLMove, 6)
+	RegisterCommand(cmd.BLMPop, execBLMPop, prepareBLMPop, undoBLMPop, -5)
+	registerBlocking(cmd.BLPop, &blockingSpec{timeout: timeoutAt(-1)})
+	registerBlocking(cmd.BRPop, &blockingSpec{timeout: timeoutAt(-1)})
+	registerBlocking(cmd.BRPopLPush, &blockingSpec{timeout: timeoutAt(-1)})
+	registerBlocking(cmd.BLMove, &blockingSpec{timeout: timeoutAt(-1)})
+	registerBlocking(cmd.BLMPop, &blockingSpec{timeout: timeoutAt(0)})
+	markAllowOOM(cmd.LPop, cmd.RPop, cmd.LRem, cmd.LTrim, cmd.LMPop, cmd.BLPop, cmd.BRPop, cmd.BLMPop)
 }
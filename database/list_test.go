@@ -0,0 +1,34 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestListCommands(t *testing.T) {
+	db := makeDB()
+	cases := []cmdCase{
+		{[]string{"RPUSH", "l", "a", "b", "c", "b", "d"}, ":5\r\n"},
+		{[]string{"LINSERT", "l", "BEFORE", "b", "x"}, ":6\r\n"},
+		{[]string{"LINSERT", "l", "AFTER", "d", "y"}, ":7\r\n"},
+		{[]string{"LINSERT", "l", "AFTER", "nil", "y"}, ":-1\r\n"},
+		{[]string{"LINSERT", "nil", "AFTER", "a", "y"}, ":0\r\n"},
+		{[]string{"LRANGE", "l", "0", "-1"}, "*7\r\n$1\r\na\r\n$1\r\nx\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nb\r\n$1\r\nd\r\n$1\r\ny\r\n"},
+		{[]string{"LPOS", "l", "b"}, ":2\r\n"},
+		{[]string{"LPOS", "l", "b", "RANK", "-1"}, ":4\r\n"},
+		{[]string{"LPOS", "l", "b", "COUNT", "0"}, "*2\r\n:2\r\n:4\r\n"},
+		{[]string{"LPOS", "l", "b", "RANK", "2", "COUNT", "1"}, "*1\r\n:4\r\n"},
+		{[]string{"LPOS", "l", "b", "MAXLEN", "2"}, "$-1\r\n"},
+		{[]string{"LPOS", "l", "b", "RANK", "0"}, "-ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list\r\n"},
+		{[]string{"LTRIM", "l", "1", "-2"}, "+OK\r\n"},
+		{[]string{"LRANGE", "l", "0", "-1"}, "*5\r\n$1\r\nx\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nb\r\n$1\r\nd\r\n"},
+		{[]string{"LPOP", "l", "2"}, "*2\r\n$1\r\nx\r\n$1\r\nb\r\n"},
+		{[]string{"RPOP", "l"}, "$1\r\nd\r\n"},
+		{[]string{"LMOVE", "l", "l2", "LEFT", "RIGHT"}, "$1\r\nc\r\n"},
+		{[]string{"LMPOP", "2", "nil", "l", "RIGHT", "COUNT", "5"}, "*2\r\n$1\r\nl\r\n*1\r\n$1\r\nb\r\n"},
+		{[]string{"LMPOP", "1", "l", "LEFT"}, "*-1\r\n"},
+		{[]string{"LPOP", "l", "1"}, "*-1\r\n"},
+		{[]string{"LTRIM", "l2", "1", "0"}, "+OK\r\n"},
+		{[]string{"EXISTS", "l2"}, ":0\r\n"},
+	}
+	runCases(t, db, cases)
+}
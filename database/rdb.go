@@ -0,0 +1,166 @@
+package database
+
+import (
+	"gedis/config"
+	"gedis/pkg/logger"
+	"gedis/rdb"
+	"gedis/reply"
+	"gedis/types/redis"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+func rdbFilename() string {
+	if filename := config.Get().Server.RdbFilename; filename != "" {
+		return filename
+	}
+	return rdb.DefaultFilename
+}
+
+// loadRdb 启动时从快照恢复数据, 已过期的 key 直接丢弃
+func (mdb *MultiDB) loadRdb(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	logger.Debug("Load Rdb file to memory start.")
+	if err = mdb.readRdb(file); err != nil {
+		return err
+	}
+	logger.Debug("Load Rdb file to memory success.")
+	return nil
+}
+
+// readRdb 解析快照数据并写入各个库
+func (mdb *MultiDB) readRdb(reader io.Reader) error {
+	now := time.Now()
+	return rdb.Parse(reader, func(dbIndex int, key string, entity *redis.DataEntity, expiration *time.Time) bool {
+		if dbIndex >= len(mdb.dbSet) {
+			return true
+		}
+		if expiration != nil && expiration.Before(now) {
+			return true
+		}
+		db := mdb.dbSet[dbIndex]
+		db.PutEntity(key, entity)
+		if expiration != nil {
+			db.Expire(key, *expiration)
+		}
+		db.persist(key)
+		return true
+	})
+}
+
+// saveRdb 将所有数据库写入临时文件, 完成后原子替换快照文件
+func (mdb *MultiDB) saveRdb(filename string) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filename), "*.rdb")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name()) // rename 成功后为空操作
+
+	err = mdb.writeRdb(tmpFile)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmpFile.Name(), filename); err != nil {
+		return err
+	}
+	atomic.StoreInt64(&mdb.lastSave, time.Now().Unix())
+	return nil
+}
+
+// writeRdb 将所有数据库以快照格式写入 w
+func (mdb *MultiDB) writeRdb(w io.Writer) error {
+	enc := rdb.NewEncoder(w)
+	if err := enc.WriteHeader(); err != nil {
+		return err
+	}
+	for i, db := range mdb.dbSet {
+		if db.data.Len() == 0 && db.storage == nil {
+			continue
+		}
+		if err := enc.WriteDB(i); err != nil {
+			return err
+		}
+		if err := db.dumpTo(enc); err != nil {
+			return err
+		}
+	}
+	return enc.WriteEnd()
+}
+
+// dumpTo 逐个 key 加读锁后写入快照, 避免与正在执行的写命令竞争
+func (db *DB) dumpTo(enc *rdb.Encoder) error {
+	for _, key := range db.keys() {
+		keys := []string{key}
+		var err error
+		db.RWLocks(nil, keys)
+		entity, expiration, ok := db.peekEntity(key)
+		if ok {
+			err = enc.WriteEntity(key, entity, expiration)
+		}
+		db.RWUnLocks(nil, keys)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save 同步生成快照
+func Save(mdb *MultiDB, args [][]byte) redis.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("save")
+	}
+	if !mdb.saving.CompareAndSet(false, true) {
+		return reply.MakeErrReply("ERR Background save already in progress")
+	}
+	defer mdb.saving.Set(false)
+
+	if err := mdb.saveRdb(rdbFilename()); err != nil {
+		logger.Error("save rdb failed: " + err.Error())
+		return reply.MakeErrReply("ERR " + err.Error())
+	}
+	return reply.MakeOkReply()
+}
+
+// BgSave 在后台生成快照
+func BgSave(mdb *MultiDB, args [][]byte) redis.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("bgsave")
+	}
+	if !mdb.saving.CompareAndSet(false, true) {
+		return reply.MakeErrReply("ERR Background save already in progress")
+	}
+	go func() {
+		defer mdb.saving.Set(false)
+		if err := mdb.saveRdb(rdbFilename()); err != nil {
+			logger.Error("background save rdb failed: " + err.Error())
+		}
+	}()
+	return reply.MakeStatusReply("Background saving started")
+}
+
+// LastSave 返回最近一次成功生成快照的 unix 时间
+func LastSave(mdb *MultiDB, args [][]byte) redis.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("lastsave")
+	}
+	return reply.MakeIntReply(atomic.LoadInt64(&mdb.lastSave))
+}
@@ -0,0 +1,338 @@
+package database
+
+import (
+	"bufio"
+	"errors"
+	"gedis/config"
+	"gedis/pkg/logger"
+	"gedis/pkg/utils"
+	"gedis/reply"
+	"gedis/server/parser"
+	"gedis/types/cmd"
+	"gedis/types/redis"
+	"gedis/types/redis/connection"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	replDialTimeout    = 5 * time.Second
+	replAckInterval    = time.Second
+	replMaxRetryPeriod = 30 * time.Second
+)
+
+// masterLink 副本到主节点的复制连接, 断开后使用缓存的复制 ID 和偏移量重连
+type masterLink struct {
+	host string
+	port int
+
+	mu     sync.Mutex
+	conn   net.Conn
+	stop   chan struct{}
+	closed bool
+	up     utils.Boolean // 是否已完成同步
+
+	replId string // 主节点的复制 ID, "?" 表示需要全量同步
+	offset int64  // 已处理的复制流偏移量
+	stream *connection.FakeConn
+}
+
+func (link *masterLink) addr() string {
+	return net.JoinHostPort(link.host, strconv.Itoa(link.port))
+}
+
+// setConn 记录当前连接, 已停止时返回 false
+func (link *masterLink) setConn(conn net.Conn) bool {
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	if link.closed {
+		return false
+	}
+	link.conn = conn
+	return true
+}
+
+func (link *masterLink) masterReplId() string {
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	return link.replId
+}
+
+func (link *masterLink) setMasterReplId(replId string) {
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	link.replId = replId
+}
+
+func (link *masterLink) close() {
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	if link.closed {
+		return
+	}
+	link.closed = true
+	close(link.stop)
+	if link.conn != nil {
+		_ = link.conn.Close()
+	}
+}
+
+// run 保持与主节点的复制连接, 直到 close 被调用
+func (link *masterLink) run(mdb *MultiDB) {
+	retry := time.Second
+	for {
+		err := link.syncWithMaster(mdb)
+		link.up.Set(false)
+		select {
+		case <-link.stop:
+			return
+		default:
+		}
+		logger.Warn("replication with master " + link.addr() + " broken: " + err.Error())
+		select {
+		case <-link.stop:
+			return
+		case <-time.After(retry):
+		}
+		if retry *= 2; retry > replMaxRetryPeriod {
+			retry = replMaxRetryPeriod
+		}
+	}
+}
+
+func (link *masterLink) syncWithMaster(mdb *MultiDB) error {
+	conn, err := net.DialTimeout("tcp", link.addr(), replDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if !link.setConn(conn) {
+		return errors.New("replication stopped")
+	}
+	reader := bufio.NewReader(conn)
+
+	if password := config.Get().Server.MasterAuth; password != "" {
+		if err = sendCommand(conn, reader, "AUTH", password); err != nil {
+			return err
+		}
+	}
+	if err = sendCommand(conn, reader, "REPLCONF", "listening-port", config.Get().Server.Port); err != nil {
+		return err
+	}
+
+	replId, offset := link.masterReplId(), atomic.LoadInt64(&link.offset)
+	psyncOffset := "-1"
+	if replId != "?" {
+		psyncOffset = strconv.FormatInt(offset+1, 10)
+	}
+	if _, err = conn.Write(reply.MakeMultiBulkReply(utils.ToCmdLine("PSYNC", replId, psyncOffset)).ToBytes()); err != nil {
+		return err
+	}
+	line, err := readLine(reader)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(line)
+	switch {
+	case len(fields) == 3 && fields[0] == "+FULLRESYNC":
+		offset, err = strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return errors.New("bad FULLRESYNC reply: " + line)
+		}
+		if err = link.loadSnapshot(mdb, reader); err != nil {
+			return err
+		}
+		link.setMasterReplId(fields[1])
+		atomic.StoreInt64(&link.offset, offset)
+		logger.Info("full sync with master " + link.addr() + " finished")
+	case len(fields) >= 1 && fields[0] == "+CONTINUE":
+		if len(fields) == 2 {
+			link.setMasterReplId(fields[1])
+		}
+		logger.Info("partial sync with master " + link.addr())
+	default:
+		return errors.New("PSYNC failed: " + line)
+	}
+	link.up.Set(true)
+
+	done := make(chan struct{})
+	defer close(done)
+	go link.sendAck(conn, done)
+	return link.receive(mdb, reader)
+}
+
+// loadSnapshot 清空所有库并加载主节点发送的快照
+func (link *masterLink) loadSnapshot(mdb *MultiDB, reader *bufio.Reader) error {
+	line, err := readLine(reader)
+	if err != nil {
+		return err
+	}
+	if len(line) < 2 || line[0] != '$' {
+		return errors.New("bad snapshot header: " + line)
+	}
+	size, err := strconv.ParseInt(line[1:], 10, 64)
+	if err != nil {
+		return errors.New("bad snapshot header: " + line)
+	}
+
+	mdb.pausing.Lock()
+	defer mdb.pausing.Unlock()
+	for _, db := range mdb.dbSet {
+		db.Flush()
+	}
+	link.stream.SelectDB(0)
+	limited := io.LimitReader(reader, size)
+	if err = mdb.readRdb(limited); err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, limited)
+	return err
+}
+
+// receive 执行主节点发来的写命令, 直到连接断开
+func (link *masterLink) receive(mdb *MultiDB, reader io.Reader) error {
+	ch := parser.ParseStream(reader)
+	for payload := range ch {
+		if payload.Err != nil {
+			return payload.Err
+		}
+		r, ok := payload.Data.(*reply.MultiBulkReply)
+		if !ok {
+			return errors.New("unexpected replication data")
+		}
+		mdb.execFromMaster(link.stream, r.Args)
+		atomic.AddInt64(&link.offset, int64(len(r.ToBytes())))
+	}
+	return io.EOF
+}
+
+// sendAck 定期向主节点上报复制偏移量
+func (link *masterLink) sendAck(conn net.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(replAckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			offset := strconv.FormatInt(atomic.LoadInt64(&link.offset), 10)
+			if _, err := conn.Write(reply.MakeMultiBulkReply(utils.ToCmdLine("REPLCONF", "ACK", offset)).ToBytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sendCommand 发送握手命令并检查回复
+func sendCommand(conn net.Conn, reader *bufio.Reader, args ...string) error {
+	if _, err := conn.Write(reply.MakeMultiBulkReply(utils.ToCmdLine(args...)).ToBytes()); err != nil {
+		return err
+	}
+	line, err := readLine(reader)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(line, "-") {
+		return errors.New(args[0] + " failed: " + line[1:])
+	}
+	return nil
+}
+
+func readLine(reader *bufio.Reader) (string, error) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" { // 忽略主节点的保活空行
+			return line, nil
+		}
+	}
+}
+
+// execFromMaster 执行复制流中的命令, 不检查密码和只读状态
+func (mdb *MultiDB) execFromMaster(c redis.Connection, cmdLine CmdLine) {
+	mdb.pausing.RLock()
+	defer mdb.pausing.RUnlock()
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	switch cmdName {
+	case cmd.Select:
+		if len(cmdLine) == 2 {
+			_ = execSelect(c, mdb, cmdLine[1:])
+		}
+	case cmd.FlushAll:
+		mdb.flushAll()
+	case cmd.Ping:
+	default:
+		if c.GetDBIndex() < len(mdb.dbSet) {
+			mdb.dbSet[c.GetDBIndex()].Exec(c, cmdLine)
+		}
+	}
+}
+
+// replicaOf 连接到新的主节点, 原有复制连接会被关闭
+func (mdb *MultiDB) replicaOf(host string, port int) {
+	r := mdb.repl
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.master != nil {
+		r.master.close()
+	}
+	link := &masterLink{
+		host:   host,
+		port:   port,
+		stop:   make(chan struct{}),
+		replId: "?",
+		offset: -1,
+		stream: &connection.FakeConn{},
+	}
+	r.master = link
+	r.readOnly.Set(true)
+	logger.Info("replicating from master " + link.addr())
+	go link.run(mdb)
+}
+
+// stopReplication 断开主节点并切换为主节点, 使用新的复制 ID 避免副本误用旧的复制流
+func (mdb *MultiDB) stopReplication() {
+	r := mdb.repl
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.master == nil {
+		return
+	}
+	r.master.close()
+	r.master = nil
+	r.readOnly.Set(false)
+	r.replId = genReplId()
+	r.lastDB = -1
+}
+
+// ReplicaOf 设置本节点为指定主节点的副本, REPLICAOF NO ONE 恢复为主节点
+func ReplicaOf(mdb *MultiDB, args [][]byte) redis.Reply {
+	if len(args) != 2 {
+		return reply.MakeArgNumErrReply("replicaof")
+	}
+	host := string(args[0])
+	if strings.EqualFold(host, "no") && strings.EqualFold(string(args[1]), "one") {
+		mdb.stopReplication()
+		return reply.MakeOkReply()
+	}
+	port, err := strconv.Atoi(string(args[1]))
+	if err != nil || port <= 0 || port > 65535 {
+		return reply.MakeErrReply("ERR Invalid master port")
+	}
+	mdb.repl.mu.Lock()
+	master := mdb.repl.master
+	mdb.repl.mu.Unlock()
+	if master != nil && master.host == host && master.port == port {
+		return reply.MakeStatusReply("OK Already connected to specified master")
+	}
+	mdb.replicaOf(host, port)
+	return reply.MakeOkReply()
+}
@@ -0,0 +1,305 @@
+package database
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"gedis/pkg/logger"
+	"gedis/pkg/utils"
+	"gedis/reply"
+	"gedis/types/redis"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	defaultReplBacklogSize = 1 << 20
+	replicaQueueSize       = 1 << 16
+)
+
+// replBacklog 环形复制积压缓冲区, 保存最近写入复制流的数据用于部分重同步
+// 复制流中的字节从 1 开始编号, offset 为最后一个字节的编号
+type replBacklog struct {
+	buf    []byte
+	offset int64 // 已写入复制流的总字节数, 即 master_repl_offset
+	length int   // 缓冲区中有效数据长度
+}
+
+func makeReplBacklog(size int, offset int64) *replBacklog {
+	return &replBacklog{
+		buf:    make([]byte, size),
+		offset: offset,
+	}
+}
+
+func (b *replBacklog) write(data []byte) {
+	size := int64(len(b.buf))
+	for len(data) > 0 {
+		n := copy(b.buf[b.offset%size:], data)
+		data = data[n:]
+		b.offset += int64(n)
+		b.length += n
+	}
+	if b.length > len(b.buf) {
+		b.length = len(b.buf)
+	}
+}
+
+// readFrom 返回从编号 offset 开始的数据, 缓冲区已不包含该位置时返回 false
+func (b *replBacklog) readFrom(offset int64) ([]byte, bool) {
+	if offset < b.offset-int64(b.length)+1 || offset > b.offset+1 {
+		return nil, false
+	}
+	size := int64(len(b.buf))
+	data := make([]byte, b.offset-offset+1)
+	n := copy(data, b.buf[(offset-1)%size:])
+	copy(data[n:], b.buf)
+	return data, true
+}
+
+// replicaClient 连接到本节点的副本
+type replicaClient struct {
+	conn          redis.Connection
+	ch            chan []byte // 待发送的复制流, 完成同步前为 nil
+	listeningPort string
+	ackOffset     int64 // 副本通过 REPLCONF ACK 上报的偏移量
+}
+
+// start 启动发送协程, 在快照或积压数据发出后调用
+func (replica *replicaClient) start() {
+	go func() {
+		var err error
+		for data := range replica.ch {
+			if err != nil {
+				continue
+			}
+			if err = replica.conn.Write(data); err != nil {
+				closeConn(replica.conn)
+			}
+		}
+	}()
+}
+
+func closeConn(c redis.Connection) {
+	if closer, ok := c.(io.Closer); ok {
+		_ = closer.Close()
+	}
+}
+
+// replication 主节点复制状态
+type replication struct {
+	mu          sync.Mutex
+	replId      string
+	backlogSize int
+	backlog     *replBacklog // 第一个副本开始同步时创建
+	lastDB      int          // 复制流中最后一次 SELECT 的库, -1 表示下一条命令前需要 SELECT
+	replicas    map[redis.Connection]*replicaClient
+	readOnly    utils.Boolean // 作为副本运行时拒绝客户端写命令
+	master      *masterLink   // 副本模式下到主节点的连接
+}
+
+func makeReplication(backlogSize int) *replication {
+	if backlogSize <= 0 {
+		backlogSize = defaultReplBacklogSize
+	}
+	return &replication{
+		replId:      genReplId(),
+		backlogSize: backlogSize,
+		lastDB:      -1,
+		replicas:    make(map[redis.Connection]*replicaClient),
+	}
+}
+
+// genReplId 生成 40 位十六进制复制 ID
+func genReplId() string {
+	buf := make([]byte, 20)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// feed 将写命令追加到复制流并发送给所有已同步的副本
+func (r *replication) feed(dbIndex int, line CmdLine) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.backlog == nil {
+		return
+	}
+	var data []byte
+	if dbIndex != r.lastDB {
+		data = reply.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(dbIndex))).ToBytes()
+		r.lastDB = dbIndex
+	}
+	data = append(data, reply.MakeMultiBulkReply(line).ToBytes()...)
+	r.backlog.write(data)
+	for c, replica := range r.replicas {
+		if replica.ch == nil {
+			continue
+		}
+		select {
+		case replica.ch <- data:
+		default: // 副本跟不上复制流, 断开后由副本重新同步
+			logger.Warn("replica output buffer overflow, disconnect " + c.RemoteAddr().String())
+			r.dropReplica(c)
+			closeConn(c)
+		}
+	}
+}
+
+// getReplica 返回连接对应的副本, 不存在时创建, 调用方需持有 mu
+func (r *replication) getReplica(c redis.Connection) *replicaClient {
+	replica, ok := r.replicas[c]
+	if !ok {
+		replica = &replicaClient{conn: c}
+		r.replicas[c] = replica
+	}
+	return replica
+}
+
+// attachReplica 开始向副本发送复制流, 调用方需持有 mu
+func (r *replication) attachReplica(c redis.Connection) *replicaClient {
+	if r.backlog == nil {
+		r.backlog = makeReplBacklog(r.backlogSize, 0)
+	}
+	replica := r.getReplica(c)
+	if replica.ch != nil { // 同一连接重复同步
+		close(replica.ch)
+	}
+	replica.ch = make(chan []byte, replicaQueueSize)
+	return replica
+}
+
+// dropReplica 移除副本并结束发送协程, 调用方需持有 mu
+func (r *replication) dropReplica(c redis.Connection) {
+	replica, ok := r.replicas[c]
+	if !ok {
+		return
+	}
+	if replica.ch != nil {
+		close(replica.ch)
+	}
+	delete(r.replicas, c)
+}
+
+func (r *replication) removeReplica(c redis.Connection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dropReplica(c)
+}
+
+// partialSync 复制 ID 一致且积压缓冲区包含 offset 时, 将缺失的数据排入副本的发送队列
+func (r *replication) partialSync(c redis.Connection, replId string, offset int64) (*replicaClient, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if replId != r.replId || r.backlog == nil {
+		return nil, false
+	}
+	data, ok := r.backlog.readFrom(offset)
+	if !ok {
+		return nil, false
+	}
+	replica := r.attachReplica(c)
+	if len(data) > 0 {
+		replica.ch <- data
+	}
+	return replica, true
+}
+
+// fullSync 生成快照发送给副本, 快照生成期间暂停所有命令以保证快照与复制偏移量一致
+func (mdb *MultiDB) fullSync(c redis.Connection, psync bool) redis.Reply {
+	var buf bytes.Buffer
+	r := mdb.repl
+	mdb.pausing.Lock()
+	r.mu.Lock()
+	replica := r.attachReplica(c)
+	replId, offset := r.replId, r.backlog.offset
+	r.lastDB = -1 // 副本从快照开始, 后续命令前需要重新 SELECT
+	r.mu.Unlock()
+	err := mdb.writeRdb(&buf)
+	mdb.pausing.Unlock()
+	if err != nil {
+		r.removeReplica(c)
+		logger.Error("full sync failed: " + err.Error())
+		return reply.MakeErrReply("ERR " + err.Error())
+	}
+
+	var header string
+	if psync {
+		header = "+FULLRESYNC " + replId + " " + strconv.FormatInt(offset, 10) + reply.CRLF
+	}
+	header += "$" + strconv.Itoa(buf.Len()) + reply.CRLF
+	if err = c.Write([]byte(header)); err == nil {
+		err = c.Write(buf.Bytes())
+	}
+	if err != nil {
+		r.removeReplica(c)
+		return &reply.NoReply{}
+	}
+	logger.Info("full sync with replica " + c.RemoteAddr().String() + " finished")
+	replica.start()
+	return &reply.NoReply{}
+}
+
+// Sync 旧版本副本的全量同步
+func Sync(mdb *MultiDB, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) != 0 {
+		return reply.MakeArgNumErrReply("sync")
+	}
+	return mdb.fullSync(c, false)
+}
+
+// PSync 副本请求从 offset 开始同步, 无法部分重同步时退化为全量同步
+func PSync(mdb *MultiDB, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) != 2 {
+		return reply.MakeArgNumErrReply("psync")
+	}
+	replId := string(args[0])
+	offset, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if replica, ok := mdb.repl.partialSync(c, replId, offset); ok {
+		if err = c.Write([]byte("+CONTINUE " + replId + reply.CRLF)); err != nil {
+			mdb.repl.removeReplica(c)
+			return &reply.NoReply{}
+		}
+		logger.Info("partial sync with replica " + c.RemoteAddr().String())
+		replica.start()
+		return &reply.NoReply{}
+	}
+	return mdb.fullSync(c, true)
+}
+
+// ReplConf 副本在同步前上报自身信息, 同步后定期上报复制偏移量
+func ReplConf(mdb *MultiDB, c redis.Connection, args [][]byte) redis.Reply {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return reply.MakeSyntaxErrReply()
+	}
+	r := mdb.repl
+	for i := 0; i < len(args); i += 2 {
+		option, value := strings.ToLower(string(args[i])), string(args[i+1])
+		switch option {
+		case "listening-port":
+			r.mu.Lock()
+			r.getReplica(c).listeningPort = value
+			r.mu.Unlock()
+		case "ack":
+			offset, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return &reply.NoReply{}
+			}
+			r.mu.Lock()
+			if replica, ok := r.replicas[c]; ok {
+				atomic.StoreInt64(&replica.ackOffset, offset)
+			}
+			r.mu.Unlock()
+			return &reply.NoReply{} // ACK 不需要回复
+		case "capa", "ip-address":
+		default:
+			return reply.MakeErrReply("ERR Unrecognized REPLCONF option: " + option)
+		}
+	}
+	return reply.MakeOkReply()
+}
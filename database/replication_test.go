@@ -0,0 +1,24 @@
+package database
+
+import "testing"
+
+func TestReplBacklog(t *testing.T) {
+	backlog := makeReplBacklog(8, 0)
+	backlog.write([]byte("abcde"))
+	if data, ok := backlog.readFrom(2); !ok || string(data) != "bcde" {
+		t.Errorf("readFrom(2): %q %v", data, ok)
+	}
+	backlog.write([]byte("fghij")) // 超出容量后覆盖最早的数据
+	if _, ok := backlog.readFrom(2); ok {
+		t.Error("offset 2 should be overwritten")
+	}
+	if data, ok := backlog.readFrom(3); !ok || string(data) != "cdefghij" {
+		t.Errorf("readFrom(3): %q %v", data, ok)
+	}
+	if data, ok := backlog.readFrom(11); !ok || len(data) != 0 {
+		t.Errorf("readFrom(11): %q %v", data, ok)
+	}
+	if _, ok := backlog.readFrom(12); ok {
+		t.Error("offset 12 is beyond the stream")
+	}
+}
@@ -5,6 +5,11 @@ import "strings"
 //全局命令表
 var cmdTable = make(map[string]*command)
 
+const (
+	flagWrite    = 1 << iota // 写命令, 只读副本拒绝执行
+	flagAllowOOM             // 不会增加内存占用的写命令, 超出 maxmemory 时仍然允许执行
+)
+
 type command struct {
 	executor ExecFunc
 	prepare  PreFunc // return related keys command
@@ -16,10 +21,39 @@ type command struct {
 // RegisterCommand registers a new command
 func RegisterCommand(name string, executor ExecFunc, prepare PreFunc, rollback UndoFunc, arity int) {
 	name = strings.ToLower(name)
+	flags := 0
+	if rollback != nil { // 可回滚的命令都会修改数据
+		flags |= flagWrite
+	}
 	cmdTable[name] = &command{
 		executor: executor,
 		prepare:  prepare,
 		undo:     rollback,
 		arity:    arity,
+		flags:    flags,
 	}
 }
+
+// markWriteCommand 标记没有回滚函数的写命令
+func markWriteCommand(name string) {
+	cmdTable[strings.ToLower(name)].flags |= flagWrite
+}
+
+// markAllowOOM 标记只会删除或缩减数据的写命令
+func markAllowOOM(names ...string) {
+	for _, name := range names {
+		cmdTable[strings.ToLower(name)].flags |= flagAllowOOM
+	}
+}
+
+// isDenyOOMCommand 判断命令在超出 maxmemory 且无法淘汰时是否需要拒绝执行
+func isDenyOOMCommand(cmdName string) bool {
+	cmd, ok := cmdTable[cmdName]
+	return ok && cmd.flags&flagWrite > 0 && cmd.flags&flagAllowOOM == 0
+}
+
+// isWriteCommand 判断命令是否会修改数据
+func isWriteCommand(cmdName string) bool {
+	cmd, ok := cmdTable[cmdName]
+	return ok && cmd.flags&flagWrite > 0
+}
@@ -0,0 +1,431 @@
+package database
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"gedis/reply"
+	"gedis/server/parser"
+	"gedis/types/cmd"
+	"gedis/types/redis"
+	"strconv"
+	"strings"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// 脚本以 EVAL 命令的形式执行, 执行期间持有 KEYS 中所有 key 的写锁,
+// 脚本中通过 redis.call 访问的 key 必须在 KEYS 中声明.
+// 脚本内执行的写命令各自写入 AOF 和复制流, 重放时不需要脚本缓存.
+
+const scriptChunkName = "@user_script"
+
+// scriptCache 已加载的脚本, sha1 -> 编译后的函数
+var scriptCache = struct {
+	sync.RWMutex
+	protos map[string]*lua.FunctionProto
+}{protos: make(map[string]*lua.FunctionProto)}
+
+// scriptDenied 脚本中不允许调用的命令
+var scriptDenied = map[string]bool{
+	strings.ToLower(cmd.Eval):    true,
+	strings.ToLower(cmd.EvalSha): true,
+	strings.ToLower(cmd.Script):  true,
+}
+
+func sha1hex(body []byte) string {
+	sum := sha1.Sum(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// loadScript 编译并缓存脚本, 返回脚本的 sha1
+func loadScript(body []byte) (string, *lua.FunctionProto, reply.ErrorReply) {
+	sha := sha1hex(body)
+	scriptCache.RLock()
+	proto, ok := scriptCache.protos[sha]
+	scriptCache.RUnlock()
+	if ok {
+		return sha, proto, nil
+	}
+
+	chunk, err := parse.Parse(strings.NewReader(string(body)), scriptChunkName)
+	if err == nil {
+		proto, err = lua.Compile(chunk, scriptChunkName)
+	}
+	if err != nil {
+		return "", nil, reply.MakeErrReply("ERR Error compiling script (new function): " + strings.TrimSpace(err.Error()))
+	}
+	scriptCache.Lock()
+	scriptCache.protos[sha] = proto
+	scriptCache.Unlock()
+	return sha, proto, nil
+}
+
+func scriptCount() int {
+	scriptCache.RLock()
+	defer scriptCache.RUnlock()
+	return len(scriptCache.protos)
+}
+
+// parseScriptKeys 解析 numkeys key [key ...] arg [arg ...]
+func parseScriptKeys(args [][]byte) (keys [][]byte, argv [][]byte, errReply reply.ErrorReply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if numKeys < 0 {
+		return nil, nil, reply.MakeErrReply("ERR Number of keys can't be negative")
+	}
+	if numKeys > len(args)-1 {
+		return nil, nil, reply.MakeErrReply("ERR Number of keys can't be greater than number of args")
+	}
+	return args[1 : numKeys+1], args[numKeys+1:], nil
+}
+
+// prepareEval 脚本可能修改 KEYS 中的任意 key, 全部加写锁
+func prepareEval(args [][]byte) ([]string, []string) {
+	keys, _, errReply := parseScriptKeys(args[1:])
+	if errReply != nil {
+		return nil, nil
+	}
+	return writeAllKeys(keys)
+}
+
+func undoEval(db *DB, args [][]byte) [][][]byte {
+	keys, _ := prepareEval(args)
+	return rollbackGivenKeys(db, keys...)
+}
+
+// execEval EVAL script numkeys key [key ...] arg [arg ...]
+func execEval(db *DB, args [][]byte) redis.Reply {
+	keys, argv, errReply := parseScriptKeys(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	sha, proto, errReply := loadScript(args[0])
+	if errReply != nil {
+		return errReply
+	}
+	return runScript(db, sha, proto, keys, argv)
+}
+
+// execEvalSha EVALSHA sha1 numkeys key [key ...] arg [arg ...]
+func execEvalSha(db *DB, args [][]byte) redis.Reply {
+	keys, argv, errReply := parseScriptKeys(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	sha := strings.ToLower(string(args[0]))
+	scriptCache.RLock()
+	proto, ok := scriptCache.protos[sha]
+	scriptCache.RUnlock()
+	if !ok {
+		return reply.MakeErrReply("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	return runScript(db, sha, proto, keys, argv)
+}
+
+// execScript SCRIPT LOAD|EXISTS|FLUSH
+func execScript(db *DB, args [][]byte) redis.Reply {
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "load":
+		if len(args) != 2 {
+			return reply.MakeErrReply("ERR wrong number of arguments for 'script|load' command")
+		}
+		sha, _, errReply := loadScript(args[1])
+		if errReply != nil {
+			return errReply
+		}
+		return reply.MakeBulkReply([]byte(sha))
+	case "exists":
+		if len(args) < 2 {
+			return reply.MakeErrReply("ERR wrong number of arguments for 'script|exists' command")
+		}
+		scriptCache.RLock()
+		defer scriptCache.RUnlock()
+		results := make([]redis.Reply, len(args)-1)
+		for i, sha := range args[1:] {
+			if _, ok := scriptCache.protos[strings.ToLower(string(sha))]; ok {
+				results[i] = reply.MakeIntReply(1)
+			} else {
+				results[i] = reply.MakeIntReply(0)
+			}
+		}
+		return reply.MakeMultiRawReply(results)
+	case "flush":
+		if len(args) > 2 {
+			return reply.MakeErrReply("ERR wrong number of arguments for 'script|flush' command")
+		}
+		if len(args) == 2 {
+			mode := strings.ToLower(string(args[1]))
+			if mode != "sync" && mode != "async" {
+				return reply.MakeErrReply("ERR SCRIPT FLUSH only support SYNC|ASYNC option")
+			}
+		}
+		scriptCache.Lock()
+		scriptCache.protos = make(map[string]*lua.FunctionProto)
+		scriptCache.Unlock()
+		return reply.MakeOkReply()
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try SCRIPT HELP.")
+}
+
+// newScriptState 创建脚本的执行环境, 只开放 base, table, string, math 库
+func newScriptState(db *DB, keys map[string]struct{}) *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "require", "module"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	lib := L.NewTable()
+	L.SetFuncs(lib, map[string]lua.LGFunction{
+		"call":  scriptCall(db, keys, true),
+		"pcall": scriptCall(db, keys, false),
+		"sha1hex": func(L *lua.LState) int {
+			L.Push(lua.LString(sha1hex([]byte(L.CheckString(1)))))
+			return 1
+		},
+		"status_reply": func(L *lua.LState) int {
+			L.Push(statusTable(L, L.CheckString(1)))
+			return 1
+		},
+		"error_reply": func(L *lua.LState) int {
+			L.Push(errorTable(L, L.CheckString(1)))
+			return 1
+		},
+	})
+	L.SetGlobal("redis", lib)
+	return L
+}
+
+// runScript 在新的 Lua 虚拟机中执行脚本, 调用方已经锁定 KEYS
+func runScript(db *DB, sha string, proto *lua.FunctionProto, keys [][]byte, argv [][]byte) redis.Reply {
+	declared := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		declared[string(key)] = struct{}{}
+	}
+	L := newScriptState(db, declared)
+	defer L.Close()
+	L.SetGlobal("KEYS", bytesToTable(L, keys))
+	L.SetGlobal("ARGV", bytesToTable(L, argv))
+
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := L.PCall(0, 1, nil); err != nil {
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			if t, ok := apiErr.Object.(*lua.LTable); ok {
+				if msg, ok := t.RawGetString("err").(lua.LString); ok { // redis.call 返回的错误
+					return reply.MakeErrReply(string(msg))
+				}
+			}
+			return reply.MakeErrReply("ERR Error running script (call to f_" + sha + "): " + apiErr.Object.String())
+		}
+		return reply.MakeErrReply("ERR Error running script (call to f_" + sha + "): " + err.Error())
+	}
+	return luaToReply(L.Get(-1))
+}
+
+// scriptCall 实现 redis.call 和 redis.pcall, raise 为 true 时命令出错会终止脚本
+func scriptCall(db *DB, keys map[string]struct{}, raise bool) lua.LGFunction {
+	return func(L *lua.LState) int {
+		n := L.GetTop()
+		if n == 0 {
+			L.RaiseError("Please specify at least one argument for this redis lib call")
+		}
+		cmdLine := make([][]byte, n)
+		for i := 1; i <= n; i++ {
+			switch v := L.Get(i).(type) {
+			case lua.LString:
+				cmdLine[i-1] = []byte(v)
+			case lua.LNumber:
+				cmdLine[i-1] = []byte(v.String())
+			default:
+				L.RaiseError("Lua redis lib command arguments must be strings or integers")
+			}
+		}
+
+		result := db.execFromScript(keys, cmdLine)
+		if errReply, ok := result.(reply.ErrorReply); ok && raise {
+			L.Error(errorTable(L, errReply.Error()), 1)
+		}
+		L.Push(replyToLua(L, result))
+		return 1
+	}
+}
+
+// execFromScript 执行脚本中的命令, EVAL 只锁定了 KEYS, 访问其它 key 的命令会被拒绝
+func (db *DB) execFromScript(keys map[string]struct{}, cmdLine [][]byte) redis.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if scriptDenied[cmdName] {
+		return reply.MakeErrReply("ERR This Redis command is not allowed from script")
+	}
+	command, ok := cmdTable[cmdName]
+	if !ok {
+		return reply.MakeErrReply("ERR Unknown Redis command called from script")
+	}
+	if !validateArity(command.arity, cmdLine) {
+		return reply.MakeErrReply("ERR Wrong number of args calling Redis command from script")
+	}
+	write, read := command.prepare(cmdLine[1:])
+	for _, group := range [][]string{write, read} {
+		for _, key := range group {
+			if _, ok := keys[key]; !ok {
+				return reply.MakeErrReply("ERR Script attempted to access key '" + key + "' which is not declared in KEYS")
+			}
+		}
+	}
+	db.addVersion(write...)
+	result := command.executor(db, cmdLine[1:])
+	db.updateMemory(write...)
+	db.persist(write...)
+	db.blocking.signal(write...)
+	return result
+}
+
+func statusTable(L *lua.LState, status string) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("ok", lua.LString(status))
+	return t
+}
+
+func errorTable(L *lua.LState, msg string) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("err", lua.LString(msg))
+	return t
+}
+
+func bytesToTable(L *lua.LState, args [][]byte) *lua.LTable {
+	t := L.CreateTable(len(args), 0)
+	for _, arg := range args {
+		t.Append(lua.LString(arg))
+	}
+	return t
+}
+
+// replyToLua 按 RESP2 的规则将命令回复转换为 Lua 值, 空值转换为 false
+func replyToLua(L *lua.LState, r redis.Reply) lua.LValue {
+	switch v := r.(type) {
+	case *reply.IntReply:
+		return lua.LNumber(v.Code)
+	case *reply.BulkReply:
+		if v.Arg == nil {
+			return lua.LFalse
+		}
+		return lua.LString(v.Arg)
+	case *reply.NullBulkReply, *reply.NullMultiBulkReply, *reply.NullReply:
+		return lua.LFalse
+	case *reply.StatusReply:
+		return statusTable(L, v.Status)
+	case *reply.OkReply:
+		return statusTable(L, "OK")
+	case *reply.PongReply:
+		return statusTable(L, "PONG")
+	case reply.ErrorReply:
+		return errorTable(L, v.Error())
+	case *reply.EmptyMultiBulkReply:
+		return L.NewTable()
+	case *reply.MultiBulkReply:
+		t := L.CreateTable(len(v.Args), 0)
+		for _, arg := range v.Args {
+			if arg == nil {
+				t.Append(lua.LFalse)
+			} else {
+				t.Append(lua.LString(arg))
+			}
+		}
+		return t
+	case *reply.SetReply:
+		return bytesToTable(L, v.Args)
+	case *reply.MultiRawReply:
+		return repliesToTable(L, v.Replies)
+	case *reply.MapReply:
+		return repliesToTable(L, v.Pairs)
+	case *reply.PushReply:
+		return repliesToTable(L, v.Replies)
+	case *reply.ScanBulkReply:
+		t := L.CreateTable(2, 0)
+		t.Append(lua.LString(strconv.Itoa(v.Pos)))
+		t.Append(bytesToTable(L, v.Args))
+		return t
+	case *reply.DoubleReply:
+		return lua.LString(v.String())
+	case *reply.BooleanReply:
+		if v.Value {
+			return lua.LNumber(1)
+		}
+		return lua.LNumber(0)
+	case *reply.BigNumberReply:
+		return lua.LString(v.Value)
+	case *reply.VerbatimReply:
+		return lua.LString(v.Text)
+	}
+	// 其它回复类型按协议重新解析
+	parsed, err := parser.ParseOne(r.ToBytes())
+	if err != nil || parsed == nil {
+		return lua.LFalse
+	}
+	return replyToLua(L, parsed)
+}
+
+func repliesToTable(L *lua.LState, replies []redis.Reply) *lua.LTable {
+	t := L.CreateTable(len(replies), 0)
+	for _, r := range replies {
+		t.Append(replyToLua(L, r))
+	}
+	return t
+}
+
+// luaToReply 将脚本的返回值转换为命令回复, 数组在第一个 nil 处截断, 小数截断为整数
+func luaToReply(lv lua.LValue) redis.Reply {
+	switch v := lv.(type) {
+	case lua.LString:
+		return reply.MakeBulkReply([]byte(v))
+	case lua.LNumber:
+		return reply.MakeIntReply(int64(v))
+	case lua.LBool:
+		if v {
+			return reply.MakeIntReply(1)
+		}
+		return reply.MakeNullBulkReply()
+	case *lua.LTable:
+		if status, ok := v.RawGetString("ok").(lua.LString); ok {
+			return reply.MakeStatusReply(string(status))
+		}
+		if msg, ok := v.RawGetString("err").(lua.LString); ok {
+			return reply.MakeErrReply(string(msg))
+		}
+		var replies []redis.Reply
+		for i := 1; ; i++ {
+			item := v.RawGetInt(i)
+			if item == lua.LNil {
+				break
+			}
+			replies = append(replies, luaToReply(item))
+		}
+		if len(replies) == 0 {
+			return reply.MakeEmptyMultiBulkReply()
+		}
+		return reply.MakeMultiRawReply(replies)
+	}
+	return reply.MakeNullBulkReply()
+}
+
+func init() {
+	RegisterCommand(cmd.Eval, execEval, prepareEval, undoEval, -3)
+	RegisterCommand(cmd.EvalSha, execEvalSha, prepareEval, undoEval, -3)
+	RegisterCommand(cmd.Script, execScript, noPrepare, nil, -2)
+}
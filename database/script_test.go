@@ -0,0 +1,25 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	db := makeDB()
+	cases := []cmdCase{
+		{[]string{"EVAL", "return redis.call('SET', KEYS[1], ARGV[1])", "1", "k", "v"}, "+OK\r\n"},
+		{[]string{"EVAL", "return redis.call('GET', KEYS[1])", "1", "k"}, "$1\r\nv\r\n"},
+		{[]string{"EVAL", "return {1, 'a', {2}, nil, 3}", "0"}, "*3\r\n:1\r\n$1\r\na\r\n*1\r\n:2\r\n"},
+		{[]string{"EVAL", "return redis.call('GET', KEYS[1])", "1", "missing"}, "$-1\r\n"},
+		{[]string{"EVAL", "return redis.call('GET', 'k')", "0"}, "-ERR Script attempted to access key 'k' which is not declared in KEYS\r\n"},
+		{[]string{"EVAL", "return redis.call('RENAME', KEYS[1], 'other')", "1", "k"}, "-ERR Script attempted to access key 'other' which is not declared in KEYS\r\n"},
+		{[]string{"EVAL", "return redis.pcall('SET', 'other', 'v')['err']", "0"}, "$72\r\nERR Script attempted to access key 'other' which is not declared in KEYS\r\n"},
+		{[]string{"EVAL", "return redis.call('LPUSH', KEYS[1], 'x')", "1", "k"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"EVAL", "return redis.pcall('LPUSH', KEYS[1], 'x')['err']", "1", "k"}, "$65\r\nWRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"EVAL", "return redis.status_reply('DONE')", "0"}, "+DONE\r\n"},
+		{[]string{"EVAL", "return 1", "2", "k"}, "-ERR Number of keys can't be greater than number of args\r\n"},
+		{[]string{"EVALSHA", sha1hex([]byte("return redis.call('GET', KEYS[1])")), "1", "k"}, "$1\r\nv\r\n"},
+		{[]string{"EVALSHA", "ffffffffffffffffffffffffffffffffffffffff", "0"}, "-NOSCRIPT No matching script. Please use EVAL.\r\n"},
+	}
+	runCases(t, db, cases)
+}
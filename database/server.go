@@ -8,11 +8,16 @@ import (
 	"gedis/pkg/utils"
 	"gedis/reply"
 	"gedis/types/cmd"
+	Dict "gedis/types/dict"
+	"gedis/types/hll"
 	"gedis/types/pubsub"
 	"gedis/types/redis"
+	HashSet "gedis/types/set"
+	SortedSet "gedis/types/zset"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -24,6 +29,14 @@ type MultiDB struct {
 	dbSet      []*DB
 	hub        *pubsub.Hub //public/subscribe handle
 	aofHandler *aof.Handler
+	storage    *LevelDb      // leveldb 存储模式下的磁盘引擎
+	saving     utils.Boolean // 是否正在生成快照
+	lastSave   int64         // 最近一次成功生成快照的 unix 时间
+	repl       *replication  // 主从复制状态
+	pausing    sync.RWMutex  // 全量同步生成快照时暂停命令执行
+	cluster    *clusterState // 集群模式下的槽位分配, 为 nil 时为单机模式
+	cronDone   chan struct{} // 关闭后结束 serverCron
+	expireDB   int           // 下一次主动过期清理开始的库
 }
 
 func MakeBasicMultiDB() *MultiDB {
@@ -32,11 +45,26 @@ func MakeBasicMultiDB() *MultiDB {
 	for i := range mdb.dbSet {
 		mdb.dbSet[i] = makeBasicDB()
 	}
+	mdb.repl = makeReplication(0)
 	return mdb
 }
 
+// applyEncodingConfig 设置紧凑编码的阈值, 需要在加载数据之前调用
+func applyEncodingConfig() {
+	server := config.Get().Server
+	Dict.MaxListpackEntries = server.HashMaxListpackEntries
+	Dict.MaxListpackValue = server.HashMaxListpackValue
+	HashSet.MaxIntsetEntries = server.SetMaxIntsetEntries
+	HashSet.MaxListpackEntries = server.SetMaxListpackEntries
+	HashSet.MaxListpackValue = server.SetMaxListpackValue
+	SortedSet.MaxListpackEntries = server.ZSetMaxListpackEntries
+	SortedSet.MaxListpackValue = server.ZSetMaxListpackValue
+	hll.SparseMaxBytes = server.HllSparseMaxBytes
+}
+
 // NewStandaloneServer 构造一个单实例服务器
 func NewStandaloneServer() *MultiDB {
+	applyEncodingConfig()
 	mdb := &MultiDB{}
 	mdb.dbSet = make([]*DB, DbSize)
 	for i := range mdb.dbSet {
@@ -45,7 +73,18 @@ func NewStandaloneServer() *MultiDB {
 		mdb.dbSet[i] = singleDB
 	}
 	mdb.hub = pubsub.MakeHub()
-	if config.Get().Server.EnableAof {
+	mdb.lastSave = time.Now().Unix()
+	mdb.repl = makeReplication(config.Get().Server.ReplBacklogSize)
+	if config.Get().Server.ClusterEnabled {
+		cluster, err := makeClusterState(config.Get().Server.ClusterAnnounce, config.Get().Server.ClusterNodes)
+		if err != nil {
+			panic(err)
+		}
+		mdb.cluster = cluster
+	}
+	if config.Get().Server.StorageMode == storageLevelDb {
+		mdb.openStorage()
+	} else if config.Get().Server.EnableAof {
 		aofHandler, err := aof.NewAOFHandler(mdb, func() redis.EmbedDB {
 			return MakeBasicMultiDB()
 		})
@@ -53,17 +92,37 @@ func NewStandaloneServer() *MultiDB {
 			panic(err)
 		}
 		mdb.aofHandler = aofHandler
+	} else if err := mdb.loadRdb(rdbFilename()); err != nil { // 未开启Aof时从快照恢复
+		panic(err)
 	}
 
 	for _, db := range mdb.dbSet {
 		singleDB := db
-		singleDB.addAof = func(line CmdLine) { //注册Aof写入函数
-			mdb.aofHandler.AddAof(int(singleDB.index), line)
+		singleDB.addAof = func(line CmdLine) { //注册Aof及复制流写入函数
+			mdb.addAof(int(singleDB.index), line)
 		}
 	}
+	if masterAddr := strings.Fields(config.Get().Server.ReplicaOf); len(masterAddr) == 2 {
+		port, err := strconv.Atoi(masterAddr[1])
+		if err != nil {
+			panic("invalid ReplicaOf: " + config.Get().Server.ReplicaOf)
+		}
+		mdb.replicaOf(masterAddr[0], port)
+	}
+	applyMemoryConfig()
+	mdb.cronDone = make(chan struct{})
+	go mdb.serverCron(config.Get().Server.Hz)
 	return mdb
 }
 
+// addAof 将写命令记录到Aof并发送给副本
+func (mdb *MultiDB) addAof(dbIndex int, line CmdLine) {
+	if mdb.aofHandler != nil {
+		mdb.aofHandler.AddAof(dbIndex, line)
+	}
+	mdb.repl.feed(dbIndex, line)
+}
+
 func (mdb *MultiDB) Exec(c redis.Connection, cmdLine [][]byte) (result redis.Reply) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -76,12 +135,30 @@ func (mdb *MultiDB) Exec(c redis.Connection, cmdLine [][]byte) (result redis.Rep
 
 	if cmdName == cmd.Auth { // authenticate 密码
 		return Auth(c, cmdLine[1:])
+	} else if cmdName == cmd.Hello {
+		return Hello(mdb, c, cmdLine[1:])
 	}
 
 	if !isAuthenticated(c) { //authenticate 是否通过
 		return reply.MakeErrReply("NOAUTH Authentication required")
 	}
 
+	if mdb.repl.readOnly.Get() && (cmdName == cmd.FlushAll || isWriteCommand(cmdName)) {
+		return reply.MakeErrReply("READONLY You can't write against a read only replica.")
+	}
+
+	if cmdName == cmd.Cluster {
+		return Cluster(mdb, c, cmdLine[1:])
+	} else if cmdName == cmd.Asking {
+		return Asking(mdb, c, cmdLine[1:])
+	}
+
+	if mdb.cluster != nil { // 集群模式下检查 key 所属的槽位
+		if result := mdb.cluster.redirect(mdb.dbSet[c.GetDBIndex()], c, cmdLine); result != nil {
+			return result
+		}
+	}
+
 	if cmdName == cmd.Subscribe { // scribe commands handle
 		if len(cmdLine) < 2 {
 			return reply.MakeArgNumErrReply("subscribe")
@@ -91,12 +168,39 @@ func (mdb *MultiDB) Exec(c redis.Connection, cmdLine [][]byte) (result redis.Rep
 		return pubsub.Publish(mdb.hub, cmdLine[1:])
 	} else if cmdName == cmd.UnSubscribe {
 		return pubsub.UnSubscribe(mdb.hub, c, cmdLine[1:])
+	} else if cmdName == cmd.PSubscribe {
+		if len(cmdLine) < 2 {
+			return reply.MakeArgNumErrReply("psubscribe")
+		}
+		return pubsub.PSubscribe(mdb.hub, c, cmdLine[1:])
+	} else if cmdName == cmd.PUnSubscribe {
+		return pubsub.PUnSubscribe(mdb.hub, c, cmdLine[1:])
+	} else if cmdName == cmd.PubSub {
+		return pubsub.PubSub(mdb.hub, cmdLine[1:])
 	} else if cmdName == cmd.BgRewriteAof {
 		// aof.go imports router.go, router.go cannot import BGRewriteAOF from aof.go
 		return BGRewriteAOF(mdb, cmdLine[1:])
 	} else if cmdName == cmd.RewriteAof {
 		return RewriteAOF(mdb, cmdLine[1:])
+	} else if cmdName == cmd.Save {
+		return Save(mdb, cmdLine[1:])
+	} else if cmdName == cmd.BgSave {
+		return BgSave(mdb, cmdLine[1:])
+	} else if cmdName == cmd.Info {
+		return Info(mdb, cmdLine[1:])
+	} else if cmdName == cmd.LastSave {
+		return LastSave(mdb, cmdLine[1:])
+	} else if cmdName == cmd.ReplicaOf || cmdName == cmd.SlaveOf {
+		return ReplicaOf(mdb, cmdLine[1:])
+	} else if cmdName == cmd.Sync {
+		return Sync(mdb, c, cmdLine[1:])
+	} else if cmdName == cmd.PSync {
+		return PSync(mdb, c, cmdLine[1:])
+	} else if cmdName == cmd.ReplConf {
+		return ReplConf(mdb, c, cmdLine[1:])
 	} else if cmdName == cmd.FlushAll {
+		mdb.pausing.RLock()
+		defer mdb.pausing.RUnlock()
 		return mdb.flushAll()
 	} else if cmdName == cmd.Select {
 		if c != nil && c.InMultiState() { //multi指令不能切换数据库
@@ -105,6 +209,9 @@ func (mdb *MultiDB) Exec(c redis.Connection, cmdLine [][]byte) (result redis.Rep
 		if len(cmdLine) != 2 {
 			return reply.MakeArgNumErrReply("select")
 		}
+		if mdb.cluster != nil && string(cmdLine[1]) != "0" {
+			return reply.MakeErrReply("ERR SELECT is not allowed in cluster mode")
+		}
 		return execSelect(c, mdb, cmdLine[1:])
 	}
 
@@ -114,19 +221,62 @@ func (mdb *MultiDB) Exec(c redis.Connection, cmdLine [][]byte) (result redis.Rep
 		return reply.MakeErrReply("ERR DB index is out of range")
 	}
 	selectedDB := mdb.dbSet[dbIndex]
+	if result := mdb.checkMemory(c, cmdName); result != nil {
+		return result
+	}
+	if spec, ok := blockingCommands[cmdName]; ok && !c.InMultiState() {
+		return mdb.execBlocking(c, selectedDB, cmdLine, spec)
+	}
+	mdb.pausing.RLock()
+	defer mdb.pausing.RUnlock()
 	return selectedDB.Exec(c, cmdLine)
 }
 
 // AfterClientClose does some clean after client close connection
 func (mdb *MultiDB) AfterClientClose(c redis.Connection) {
 	pubsub.UnsubscribeAll(mdb.hub, c)
+	mdb.repl.removeReplica(c)
+	for _, db := range mdb.dbSet {
+		db.blocking.removeClient(c)
+	}
+	if mdb.cluster != nil {
+		mdb.cluster.asking.Delete(c)
+	}
 }
 
 // Close graceful shutdown database
 func (mdb *MultiDB) Close() {
+	if mdb.cronDone != nil {
+		close(mdb.cronDone)
+	}
+	mdb.stopReplication()
 	if mdb.aofHandler != nil {
 		mdb.aofHandler.Close()
 	}
+	if mdb.storage != nil {
+		mdb.storage.Close()
+	}
+}
+
+// openStorage 打开 LevelDB 并加载数据, 此模式下 LevelDB 是唯一的数据来源, 不再回放 Aof 和快照
+func (mdb *MultiDB) openStorage() {
+	if config.Get().Server.EnableAof {
+		logger.Warn("EnableAof is ignored in leveldb storage mode")
+	}
+	path := config.Get().Server.LevelDbPath
+	if path == "" {
+		path = defaultLevelDbPath
+	}
+	storage := NewLevelDb()
+	if err := storage.Load(path); err != nil {
+		panic(err)
+	}
+	mdb.storage = storage
+	for _, db := range mdb.dbSet {
+		db.storage = storage
+		db.maxHotKeys = config.Get().Server.MaxHotKeys
+		db.loadStorage()
+	}
 }
 
 func execSelect(c redis.Connection, mdb *MultiDB, args [][]byte) redis.Reply {
@@ -145,9 +295,7 @@ func (mdb *MultiDB) flushAll() redis.Reply {
 	for _, db := range mdb.dbSet {
 		db.Flush()
 	}
-	if mdb.aofHandler != nil {
-		mdb.aofHandler.AddAof(0, utils.ToCmdLine("FlushAll"))
-	}
+	mdb.addAof(0, utils.ToCmdLine("FlushAll"))
 	return &reply.OkReply{}
 }
 
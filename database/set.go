@@ -6,7 +6,9 @@ import (
 	"gedis/types/cmd"
 	"gedis/types/redis"
 	HashSet "gedis/types/set"
+	"math"
 	"strconv"
+	"strings"
 )
 
 func (db *DB) getAsSet(key string) (*HashSet.Set, reply.ErrorReply) {
@@ -126,7 +128,7 @@ func execSMembers(db *DB, args [][]byte) redis.Reply {
 		return errReply
 	}
 	if set == nil {
-		return &reply.EmptyMultiBulkReply{}
+		return reply.MakeSetReply(nil)
 	}
 
 	arr := make([][]byte, set.Len())
@@ -136,7 +138,7 @@ func execSMembers(db *DB, args [][]byte) redis.Reply {
 		i++
 		return true
 	})
-	return reply.MakeMultiBulkReply(arr)
+	return reply.MakeSetReply(arr)
 }
 
 // execSInter intersect multiple sets
@@ -395,12 +397,24 @@ func execSDiffStore(db *DB, args [][]byte) redis.Reply {
 	return reply.MakeIntReply(int64(set.Len()))
 }
 
-// execSRandMember gets random members from set
+// execSRandMember SRANDMEMBER key [count], count 为负数时返回 |count| 个可能重复的成员
 func execSRandMember(db *DB, args [][]byte) redis.Reply {
 	if len(args) != 1 && len(args) != 2 {
 		return reply.MakeErrReply("ERR wrong number of arguments for 'srandmember' command")
 	}
 	key := string(args[0])
+	withCount := len(args) == 2
+	var count int64 = 1
+	if withCount {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		if count == math.MinInt64 {
+			return reply.MakeErrReply("ERR value is out of range")
+		}
+	}
 
 	// get or init entity
 	set, errReply := db.getAsSet(key)
@@ -408,34 +422,242 @@ func execSRandMember(db *DB, args [][]byte) redis.Reply {
 		return errReply
 	}
 	if set == nil {
+		if withCount {
+			return &reply.EmptyMultiBulkReply{}
+		}
 		return &reply.NullBulkReply{}
 	}
-	if len(args) == 1 {
+	if !withCount {
 		// get a random member
 		members := set.RandomMembers(1)
 		return reply.MakeBulkReply([]byte(members[0]))
 	}
-	count64, err := strconv.ParseInt(string(args[1]), 10, 64)
+	var members []string
+	if count > 0 {
+		members = set.RandomDistinctMembers(int(count))
+	} else if count < 0 {
+		members = set.RandomMembers(int(-count))
+	}
+	result := make([][]byte, len(members))
+	for i, v := range members {
+		result[i] = []byte(v)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execSPop SPOP key [count], 随机删除并返回成员
+func execSPop(db *DB, args [][]byte) redis.Reply {
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	key := string(args[0])
+	withCount := len(args) == 2
+	count := 1
+	if withCount {
+		count64, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		if count64 < 0 {
+			return reply.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		count = int(count64)
+	}
+
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		if withCount {
+			return &reply.EmptyMultiBulkReply{}
+		}
+		return &reply.NullBulkReply{}
+	}
+
+	members := set.RandomDistinctMembers(count)
+	for _, member := range members {
+		set.Remove(member)
+	}
+	if set.Len() == 0 {
+		db.Remove(key)
+	}
+	if len(members) > 0 {
+		// 随机结果不能重放, 以 SREM 写入 AOF
+		db.addAof(utils.ToCmdLine2("srem", append([]string{key}, members...)...))
+	}
+	if !withCount {
+		return reply.MakeBulkReply([]byte(members[0]))
+	}
+	result := make([][]byte, len(members))
+	for i, v := range members {
+		result[i] = []byte(v)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execSMove SMOVE source destination member
+func execSMove(db *DB, args [][]byte) redis.Reply {
+	source, dest := string(args[0]), string(args[1])
+	member := string(args[2])
+
+	sourceSet, errReply := db.getAsSet(source)
+	if errReply != nil {
+		return errReply
+	}
+	destSet, errReply := db.getAsSet(dest)
+	if errReply != nil {
+		return errReply
+	}
+	if sourceSet == nil || !sourceSet.Has(member) {
+		return reply.MakeIntReply(0)
+	}
+	if source == dest {
+		return reply.MakeIntReply(1)
+	}
+
+	sourceSet.Remove(member)
+	if sourceSet.Len() == 0 {
+		db.Remove(source)
+	}
+	if destSet == nil {
+		destSet = HashSet.Make()
+		db.PutEntity(dest, &redis.DataEntity{
+			Data: destSet,
+		})
+	}
+	destSet.Add(member)
+	db.addAof(utils.ToCmdLine3("smove", args...))
+	return reply.MakeIntReply(1)
+}
+
+func undoSMove(db *DB, args [][]byte) [][][]byte {
+	member := string(args[2])
+	undoCmdLines := rollbackSetMembers(db, string(args[0]), member)
+	return append(undoCmdLines, rollbackSetMembers(db, string(args[1]), member)...)
+}
+
+// execSMIsMember SMISMEMBER key member [member ...]
+func execSMIsMember(db *DB, args [][]byte) redis.Reply {
+	set, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		if set != nil && set.Has(string(member)) {
+			result[i] = reply.MakeIntReply(1)
+		} else {
+			result[i] = reply.MakeIntReply(0)
+		}
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// parseSInterCard 解析 numkeys key [key ...] [LIMIT limit], limit 为 0 表示不限制
+func parseSInterCard(args [][]byte) (keys []string, limit int, errReply reply.ErrorReply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
 	if err != nil {
-		return reply.MakeErrReply("ERR value is not an integer or out of range")
+		return nil, 0, reply.MakeErrReply("ERR value is not an integer or out of range")
 	}
-	count := int(count64)
-	if count > 0 {
-		members := set.RandomDistinctMembers(count)
-		result := make([][]byte, len(members))
-		for i, v := range members {
-			result[i] = []byte(v)
+	if numKeys <= 0 {
+		return nil, 0, reply.MakeErrReply("ERR numkeys should be greater than 0")
+	}
+	if numKeys > len(args)-1 {
+		return nil, 0, reply.MakeErrReply("ERR Number of keys can't be greater than number of args")
+	}
+	keys = make([]string, numKeys)
+	for i := range keys {
+		keys[i] = string(args[i+1])
+	}
+	rest := args[numKeys+1:]
+	if len(rest) > 0 {
+		if len(rest) != 2 || !strings.EqualFold(string(rest[0]), "LIMIT") {
+			return nil, 0, reply.MakeSyntaxErrReply()
 		}
-		return reply.MakeMultiBulkReply(result)
-	} else if count < 0 {
-		members := set.RandomMembers(-count)
-		result := make([][]byte, len(members))
-		for i, v := range members {
-			result[i] = []byte(v)
+		limit, err = strconv.Atoi(string(rest[1]))
+		if err != nil {
+			return nil, 0, reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		if limit < 0 {
+			return nil, 0, reply.MakeErrReply("ERR LIMIT can't be negative")
+		}
+	}
+	return keys, limit, nil
+}
+
+// execSInterCard SINTERCARD numkeys key [key ...] [LIMIT limit], 返回交集的大小, 达到 limit 时提前结束
+func execSInterCard(db *DB, args [][]byte) redis.Reply {
+	keys, limit, errReply := parseSInterCard(args)
+	if errReply != nil {
+		return errReply
+	}
+	sets := make([]*HashSet.Set, len(keys))
+	empty := false
+	for i, key := range keys {
+		set, errReply := db.getAsSet(key)
+		if errReply != nil {
+			return errReply
+		}
+		if set == nil {
+			empty = true // 继续检查其余 key 的类型
 		}
-		return reply.MakeMultiBulkReply(result)
+		sets[i] = set
 	}
-	return &reply.EmptyMultiBulkReply{}
+	if empty {
+		return reply.MakeIntReply(0)
+	}
+	// 遍历最小的集合
+	smallest := 0
+	for i, set := range sets {
+		if set.Len() < sets[smallest].Len() {
+			smallest = i
+		}
+	}
+	var count int64 = 0
+	sets[smallest].ForEach(func(member string) bool {
+		for _, set := range sets {
+			if !set.Has(member) {
+				return true
+			}
+		}
+		count++
+		return limit == 0 || count < int64(limit)
+	})
+	return reply.MakeIntReply(count)
+}
+
+func prepareSInterCard(args [][]byte) ([]string, []string) {
+	keys, _, errReply := parseSInterCard(args)
+	if errReply != nil {
+		return nil, nil
+	}
+	return nil, keys
+}
+
+// execSScan SSCAN key cursor [MATCH pattern] [COUNT count]
+func execSScan(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	scan, errReply := parseScanArgs(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeScanBulkReply(0, nil)
+	}
+	result := make([][]byte, 0, scan.count)
+	next := set.Scan(scan.cursor, scan.count, func(member string) bool {
+		if scan.isMatch(member) {
+			result = append(result, []byte(member))
+		}
+		return true
+	})
+	return reply.MakeScanBulkReply(int(next), result)
 }
 
 func init() {
@@ -451,4 +673,10 @@ func init() {
 	RegisterCommand(cmd.SDiff, execSDiff, prepareSetCalculate, nil, -2)
 	RegisterCommand(cmd.SDiffStore, execSDiffStore, prepareSetCalculateStore, rollbackFirstKey, -3)
 	RegisterCommand(cmd.SRandMember, execSRandMember, readFirstKey, nil, -2)
+	RegisterCommand(cmd.SPop, execSPop, writeFirstKey, rollbackFirstKey, -2)
+	RegisterCommand(cmd.SMove, execSMove, prepareRPopLPush, undoSMove, 4)
+	RegisterCommand(cmd.SMIsMember, execSMIsMember, readFirstKey, nil, -3)
+	RegisterCommand(cmd.SInterCard, execSInterCard, prepareSInterCard, nil, -3)
+	RegisterCommand(cmd.SScan, execSScan, readFirstKey, nil, -3)
+	markAllowOOM(cmd.SRem, cmd.SPop)
 }
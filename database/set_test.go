@@ -0,0 +1,35 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestSetCommands(t *testing.T) {
+	db := makeDB()
+	cases := []cmdCase{
+		{[]string{"SADD", "s1", "a", "b", "c"}, ":3\r\n"},
+		{[]string{"SADD", "s2", "b", "c", "d"}, ":3\r\n"},
+		{[]string{"SMISMEMBER", "s1", "a", "d"}, "*2\r\n:1\r\n:0\r\n"},
+		{[]string{"SINTERCARD", "2", "s1", "s2"}, ":2\r\n"},
+		{[]string{"SINTERCARD", "2", "s1", "s2", "LIMIT", "1"}, ":1\r\n"},
+		{[]string{"SINTERCARD", "2", "s1", "none"}, ":0\r\n"},
+		{[]string{"SINTERCARD", "3", "s1", "s2"}, "-ERR Number of keys can't be greater than number of args\r\n"},
+		{[]string{"SINTERCARD", "2", "s1", "s2", "LIMIT", "-1"}, "-ERR LIMIT can't be negative\r\n"},
+		{[]string{"SMOVE", "s1", "s2", "a"}, ":1\r\n"},
+		{[]string{"SMOVE", "s1", "s2", "a"}, ":0\r\n"},
+		{[]string{"SMOVE", "s2", "s2", "a"}, ":1\r\n"},
+		{[]string{"SCARD", "s2"}, ":4\r\n"},
+		{[]string{"SRANDMEMBER", "none", "3"}, "*0\r\n"},
+		{[]string{"SRANDMEMBER", "none"}, "$-1\r\n"},
+		{[]string{"SADD", "one", "x"}, ":1\r\n"},
+		{[]string{"SRANDMEMBER", "one", "-3"}, "*3\r\n$1\r\nx\r\n$1\r\nx\r\n$1\r\nx\r\n"},
+		{[]string{"SRANDMEMBER", "one", "3"}, "*1\r\n$1\r\nx\r\n"},
+		{[]string{"SSCAN", "one", "0", "MATCH", "x*"}, "*2\r\n$1\r\n0\r\n*1\r\n$1\r\nx\r\n"},
+		{[]string{"SPOP", "one", "-1"}, "-ERR value is out of range, must be positive\r\n"},
+		{[]string{"SPOP", "one", "5"}, "*1\r\n$1\r\nx\r\n"},
+		{[]string{"EXISTS", "one"}, ":0\r\n"},
+		{[]string{"SPOP", "one"}, "$-1\r\n"},
+		{[]string{"SPOP", "one", "1"}, "*0\r\n"},
+	}
+	runCases(t, db, cases)
+}
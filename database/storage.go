@@ -0,0 +1,230 @@
+package database
+
+import (
+	"gedis/pkg/logger"
+	"gedis/rdb"
+	"gedis/types/redis"
+	"time"
+)
+
+const (
+	storageLevelDb     = "leveldb"
+	defaultLevelDbPath = "data"
+)
+
+// storageHeaderLen 存储 key 的前缀长度: 1 字节库序号 + 2 字节槽位
+const storageHeaderLen = 3
+
+// storageKey 在 key 前加上库序号及槽位, 所有库共用一个 LevelDB, 同一个库的 key 按槽位排列
+func (db *DB) storageKey(key string) []byte {
+	return append(db.slotPrefix(keySlot(key)), key...)
+}
+
+func (db *DB) storagePrefix() []byte {
+	return []byte{byte(db.index)}
+}
+
+// slotPrefix 库中一个槽位的 key 的公共前缀
+func (db *DB) slotPrefix(slot int) []byte {
+	return []byte{byte(db.index), byte(slot >> 8), byte(slot)}
+}
+
+// parseStorageKey 从存储 key 中取出原始的 key 及槽位
+func parseStorageKey(rawKey []byte) (string, int) {
+	return string(rawKey[storageHeaderLen:]), int(rawKey[1])<<8 | int(rawKey[2])
+}
+
+// persist 将内存中的 key 写回 LevelDB, 调用方需持有 key 的锁
+// 不在内存中的 key 跳过, 删除由 Remove 负责
+func (db *DB) persist(keys ...string) {
+	if db.storage == nil {
+		return
+	}
+	for _, key := range keys {
+		raw, ok := db.data.Get(key)
+		if !ok {
+			continue
+		}
+		entity, _ := raw.(*redis.DataEntity)
+		var expiration *time.Time
+		if rawExpireTime, exists := db.ttlMap.Get(key); exists {
+			expireTime, _ := rawExpireTime.(time.Time)
+			expiration = &expireTime
+		}
+		value, err := rdb.EncodeEntity(entity, expiration)
+		if err != nil {
+			logger.Warn("encode entity failed: " + err.Error())
+			continue
+		}
+		if err = db.storage.Put(db.storageKey(key), value); err != nil {
+			logger.Warn("leveldb put failed: " + err.Error())
+		}
+	}
+}
+
+// loadFromStorage 将冷数据从 LevelDB 读回内存, 调用方需持有 key 的锁
+func (db *DB) loadFromStorage(key string) (*redis.DataEntity, bool) {
+	value, err := db.storage.Get(db.storageKey(key))
+	if err != nil {
+		return nil, false
+	}
+	entity, expiration, err := rdb.DecodeEntity(value)
+	if err != nil {
+		logger.Warn("decode entity failed: " + err.Error())
+		return nil, false
+	}
+	if expiration != nil && time.Now().After(*expiration) {
+		_ = db.storage.Delete(db.storageKey(key))
+		return nil, false
+	}
+	db.trackEntity(key, nil, entity)
+	db.data.Put(key, entity)
+	if expiration != nil {
+		db.Expire(key, *expiration)
+	}
+	return entity, true
+}
+
+// peekEntity 读取 key 及其过期时间, 冷数据直接从 LevelDB 解码而不放回内存
+func (db *DB) peekEntity(key string) (*redis.DataEntity, *time.Time, bool) {
+	if raw, ok := db.data.Get(key); ok {
+		if db.IsExpired(key) {
+			return nil, nil, false
+		}
+		entity, _ := raw.(*redis.DataEntity)
+		var expiration *time.Time
+		if rawExpireTime, exists := db.ttlMap.Get(key); exists {
+			expireTime, _ := rawExpireTime.(time.Time)
+			expiration = &expireTime
+		}
+		return entity, expiration, true
+	}
+	if db.storage == nil || db.maxHotKeys <= 0 {
+		return nil, nil, false
+	}
+	value, err := db.storage.Get(db.storageKey(key))
+	if err != nil {
+		return nil, nil, false
+	}
+	entity, expiration, err := rdb.DecodeEntity(value)
+	if err != nil || (expiration != nil && time.Now().After(*expiration)) {
+		return nil, nil, false
+	}
+	return entity, expiration, true
+}
+
+// loadStorage 启动时加载 LevelDB 中的数据, maxHotKeys > 0 时只预热前 maxHotKeys 个 key
+func (db *DB) loadStorage() {
+	now := time.Now()
+	db.storage.EachPrefix(db.storagePrefix(), func(rawKey []byte, value []byte) {
+		if db.maxHotKeys > 0 && db.data.Len() >= db.maxHotKeys {
+			return
+		}
+		entity, expiration, err := rdb.DecodeEntity(value)
+		if err != nil {
+			logger.Warn("decode entity failed: " + err.Error())
+			return
+		}
+		if expiration != nil && now.After(*expiration) {
+			return
+		}
+		key, _ := parseStorageKey(rawKey)
+		db.trackEntity(key, nil, entity)
+		db.data.Put(key, entity)
+		if expiration != nil {
+			db.Expire(key, *expiration)
+		}
+	})
+}
+
+// evictColdKeys 内存中的 key 超过 maxHotKeys 时随机淘汰, 数据已写入 LevelDB 不会丢失
+// 需在不持有任何 key 锁时调用
+func (db *DB) evictColdKeys() {
+	if db.storage == nil || db.maxHotKeys <= 0 {
+		return
+	}
+	overflow := db.data.Len() - db.maxHotKeys
+	if overflow <= 0 {
+		return
+	}
+	for _, key := range db.data.RandomDistinctKeys(overflow) {
+		keys := []string{key}
+		db.RWLocks(keys, nil)
+		if raw, ok := db.data.Get(key); ok {
+			db.untrackEntity(raw)
+		}
+		db.data.Remove(key)
+		db.ttlMap.Remove(key)
+		db.RWUnLocks(keys, nil)
+	}
+}
+
+// keys 返回库中所有的 key, 冷数据模式下包含只在 LevelDB 中的 key
+func (db *DB) keys() []string {
+	if db.storage == nil || db.maxHotKeys <= 0 {
+		return db.data.Keys()
+	}
+	keys := make([]string, 0, db.data.Len())
+	db.storage.EachPrefix(db.storagePrefix(), func(rawKey []byte, _ []byte) {
+		key, _ := parseStorageKey(rawKey)
+		keys = append(keys, key)
+	})
+	return keys
+}
+
+// scanKeys 从 cursor 开始遍历至少 count 个 key, 返回访问到的 key 及下一次的游标, 遍历结束时游标为 0.
+// 内存模式以数据分片为游标; 冷数据模式下 key 可能只在 LevelDB 中, LevelDB 中的 key 按槽位排列, 以槽位为游标从该槽位开始读取.
+// 每次都返回完整的槽位, 所以在整个遍历过程中一直存在的 key 一定会被访问到
+func (db *DB) scanKeys(cursor uint64, count int) ([]string, uint64) {
+	keys := make([]string, 0, count)
+	if db.storage == nil || db.maxHotKeys <= 0 {
+		next := db.data.Scan(cursor, count, func(key string, _ interface{}) bool {
+			keys = append(keys, key)
+			return true
+		})
+		return keys, next
+	}
+	if cursor >= slotCount {
+		return keys, 0
+	}
+	var next uint64
+	lastSlot := -1
+	db.storage.EachFrom(db.storagePrefix(), db.slotPrefix(int(cursor)), func(rawKey []byte, _ []byte) bool {
+		key, slot := parseStorageKey(rawKey)
+		if len(keys) >= count && slot != lastSlot {
+			next = uint64(slot)
+			return false
+		}
+		lastSlot = slot
+		keys = append(keys, key)
+		return true
+	})
+	return keys, next
+}
+
+// lookupEntity 在不持有 key 的锁时读取 key, 用于 SCAN 及集群重定向检查.
+// 与 peekEntity 不同, 不清理过期的 key, 冷数据也只解码不放回内存, 不会修改库中的数据
+func (db *DB) lookupEntity(key string) (*redis.DataEntity, bool) {
+	now := time.Now()
+	if raw, ok := db.data.Get(key); ok {
+		if rawExpireTime, exists := db.ttlMap.Get(key); exists {
+			if expireTime, _ := rawExpireTime.(time.Time); now.After(expireTime) {
+				return nil, false
+			}
+		}
+		entity, _ := raw.(*redis.DataEntity)
+		return entity, !isHollowEntity(entity)
+	}
+	if db.storage == nil || db.maxHotKeys <= 0 {
+		return nil, false
+	}
+	value, err := db.storage.Get(db.storageKey(key))
+	if err != nil {
+		return nil, false
+	}
+	entity, expiration, err := rdb.DecodeEntity(value)
+	if err != nil || (expiration != nil && now.After(*expiration)) {
+		return nil, false
+	}
+	return entity, true
+}
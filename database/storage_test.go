@@ -0,0 +1,109 @@
+package database
+
+import (
+	"fmt"
+	"gedis/pkg/utils"
+	"gedis/reply"
+	"testing"
+)
+
+func makeStorageDB(t *testing.T, path string, maxHotKeys int) (*DB, *LevelDb) {
+	storage := NewLevelDb()
+	if err := storage.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	db := makeDB()
+	db.storage = storage
+	db.maxHotKeys = maxHotKeys
+	db.loadStorage()
+	return db, storage
+}
+
+func TestLevelDbStorage(t *testing.T) {
+	path := t.TempDir()
+	db, storage := makeStorageDB(t, path, 2)
+	for i := 0; i < 10; i++ {
+		db.Exec(nil, utils.ToCmdLine("SET", fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i)))
+	}
+	db.Exec(nil, utils.ToCmdLine("RPUSH", "list", "a", "b", "c"))
+	db.Exec(nil, utils.ToCmdLine("DEL", "k9"))
+	if db.data.Len() > 2 {
+		t.Errorf("expect at most 2 hot keys, got %d", db.data.Len())
+	}
+	if n := len(db.keys()); n != 10 {
+		t.Errorf("expect 10 keys, got %d", n)
+	}
+
+	// 冷数据访问时从 LevelDB 加载
+	result := db.Exec(nil, utils.ToCmdLine("GET", "k3"))
+	if string(result.ToBytes()) != string(reply.MakeBulkReply([]byte("v3")).ToBytes()) {
+		t.Errorf("GET k3: %s", result.ToBytes())
+	}
+	storage.Close()
+
+	// 重新打开后数据仍然存在
+	db, storage = makeStorageDB(t, path, 0)
+	defer storage.Close()
+	if db.data.Len() != 10 {
+		t.Errorf("expect 10 keys after reopen, got %d", db.data.Len())
+	}
+	result = db.Exec(nil, utils.ToCmdLine("LRANGE", "list", "0", "-1"))
+	if string(result.ToBytes()) != string(reply.MakeMultiBulkReply(utils.ToCmdLine("a", "b", "c")).ToBytes()) {
+		t.Errorf("LRANGE list: %s", result.ToBytes())
+	}
+	if _, ok := db.GetEntity("k9"); ok {
+		t.Error("deleted key k9 should not be loaded")
+	}
+}
+
+func TestLevelDbScan(t *testing.T) {
+	db, storage := makeStorageDB(t, t.TempDir(), 10)
+	defer storage.Close()
+	for i := 0; i < 100; i++ {
+		db.Exec(nil, utils.ToCmdLine("SET", fmt.Sprintf("k%d", i), "v"))
+	}
+	db.Exec(nil, utils.ToCmdLine("RPUSH", "list", "a"))
+	if visited := scanAll(t, db, "COUNT", "3"); len(visited) != 101 {
+		t.Errorf("expect 101 keys, actual %d", len(visited))
+	}
+	if visited := scanAll(t, db, "TYPE", "list"); len(visited) != 1 || visited["list"] != 1 {
+		t.Errorf("expect list only, actual %v", visited)
+	}
+
+	// 从游标所在的槽位开始读取, 每次返回完整的槽位
+	slot := keySlot("k1")
+	keys, next := db.scanKeys(uint64(slot), 1)
+	if len(keys) == 0 || next <= uint64(slot) {
+		t.Fatalf("expect keys from slot %d and a later cursor, actual %v %d", slot, keys, next)
+	}
+	for _, key := range keys {
+		if keySlot(key) != slot {
+			t.Errorf("%s is not in slot %d", key, slot)
+		}
+	}
+}
+
+func TestLevelDbConditionalSet(t *testing.T) {
+	db, storage := makeStorageDB(t, t.TempDir(), 1)
+	defer storage.Close()
+	var cold []string
+	for _, key := range []string{"a", "b", "c"} {
+		db.Exec(nil, utils.ToCmdLine("SET", key, key))
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if !db.data.Exists(key) {
+			cold = append(cold, key)
+		}
+	}
+	if len(cold) < 2 {
+		t.Fatalf("expect at least 2 cold keys, actual %v", cold)
+	}
+	// 只在 LevelDB 中的 key 也视为存在
+	runCases(t, db, []cmdCase{
+		{[]string{"SETNX", cold[0], "x"}, ":0\r\n"},
+		{[]string{"SET", cold[0], "x", "NX"}, "$-1\r\n"},
+		{[]string{"GET", cold[0]}, "$1\r\n" + cold[0] + "\r\n"},
+		{[]string{"SET", cold[1], "y", "XX"}, "+OK\r\n"},
+		{[]string{"GET", cold[1]}, "$1\r\ny\r\n"},
+	})
+}
@@ -0,0 +1,1060 @@
+package database
+
+import (
+	"gedis/pkg/utils"
+	"gedis/reply"
+	"gedis/types/cmd"
+	"gedis/types/redis"
+	"gedis/types/stream"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 消费组的状态变化以 XCLAIM/XGROUP/XACK 的形式写入 AOF, 重放结果不依赖执行时间
+
+func (db *DB) getAsStream(key string) (*stream.Stream, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	s, ok := entity.Data.(*stream.Stream)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	return s, nil
+}
+
+// getStreamGroup 返回 key 对应的 stream 和消费组, 不存在时返回 nil
+func (db *DB) getStreamGroup(key string, groupName string) (*stream.Stream, *stream.Group, reply.ErrorReply) {
+	s, errReply := db.getAsStream(key)
+	if errReply != nil || s == nil {
+		return nil, nil, errReply
+	}
+	group, _ := s.Group(groupName)
+	return s, group, nil
+}
+
+func nowMs() int64 {
+	return time.Now().UnixNano() / 1e6
+}
+
+func makeInvalidStreamIDErr() reply.ErrorReply {
+	return reply.MakeErrReply(stream.ErrInvalidID.Error())
+}
+
+func makeNoGroupErr(key string, group string) reply.ErrorReply {
+	return reply.MakeErrReply("NOGROUP No such key '" + key + "' or consumer group '" + group + "'")
+}
+
+// parseRangeID 解析范围的边界, - 和 + 表示最小和最大 ID, ( 前缀表示不包含该 ID
+func parseRangeID(arg []byte, isStart bool) (stream.ID, reply.ErrorReply) {
+	s := string(arg)
+	if s == "-" {
+		return stream.MinID, nil
+	} else if s == "+" {
+		return stream.MaxID, nil
+	}
+	exclusive := strings.HasPrefix(s, "(")
+	if exclusive {
+		s = s[1:]
+	}
+	defaultSeq := uint64(0)
+	if !isStart {
+		defaultSeq = math.MaxUint64
+	}
+	id, err := stream.ParseID(s, defaultSeq)
+	if err != nil {
+		return id, makeInvalidStreamIDErr()
+	}
+	if !exclusive {
+		return id, nil
+	}
+	var ok bool
+	if isStart {
+		id, ok = id.Next()
+		if !ok {
+			return id, reply.MakeErrReply("ERR invalid start ID for the interval")
+		}
+	} else {
+		id, ok = id.Prev()
+		if !ok {
+			return id, reply.MakeErrReply("ERR invalid end ID for the interval")
+		}
+	}
+	return id, nil
+}
+
+func streamEntryReply(entry *stream.Entry) redis.Reply {
+	return reply.MakeMultiRawReply([]redis.Reply{
+		reply.MakeBulkReply([]byte(entry.ID.String())),
+		reply.MakeMultiBulkReply(entry.Fields),
+	})
+}
+
+func streamEntriesReply(entries []*stream.Entry) redis.Reply {
+	replies := make([]redis.Reply, len(entries))
+	for i, entry := range entries {
+		replies[i] = streamEntryReply(entry)
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+/* ---- XADD / XTRIM ---- */
+
+// streamTrim MAXLEN|MINID [=|~] threshold [LIMIT count], 近似裁剪(~)也按精确裁剪执行
+type streamTrim struct {
+	byMinID bool
+	maxLen  int
+	minID   stream.ID
+	limit   int
+	args    [][]byte // 原始参数, 写入 AOF
+}
+
+// parseStreamTrim 从 args[0] 开始解析裁剪参数, 返回消耗的参数数量
+func parseStreamTrim(args [][]byte) (*streamTrim, int, reply.ErrorReply) {
+	trim := &streamTrim{
+		byMinID: strings.EqualFold(string(args[0]), "MINID"),
+	}
+	i := 1
+	approx := false
+	if i < len(args) && (string(args[i]) == "=" || string(args[i]) == "~") {
+		approx = string(args[i]) == "~"
+		i++
+	}
+	if i >= len(args) {
+		return nil, 0, reply.MakeSyntaxErrReply()
+	}
+	if trim.byMinID {
+		id, err := stream.ParseID(string(args[i]), 0)
+		if err != nil {
+			return nil, 0, makeInvalidStreamIDErr()
+		}
+		trim.minID = id
+	} else {
+		maxLen, err := strconv.Atoi(string(args[i]))
+		if err != nil {
+			return nil, 0, reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		if maxLen < 0 {
+			return nil, 0, reply.MakeErrReply("ERR The MAXLEN argument must be >= 0.")
+		}
+		trim.maxLen = maxLen
+	}
+	i++
+	if i+1 < len(args) && strings.EqualFold(string(args[i]), "LIMIT") {
+		if !approx {
+			return nil, 0, reply.MakeErrReply("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		limit, err := strconv.Atoi(string(args[i+1]))
+		if err != nil || limit < 0 {
+			return nil, 0, reply.MakeErrReply("ERR The LIMIT argument must be >= 0.")
+		}
+		trim.limit = limit
+		i += 2
+	}
+	trim.args = args[:i]
+	return trim, i, nil
+}
+
+func (trim *streamTrim) apply(s *stream.Stream) int {
+	if trim.byMinID {
+		return s.TrimMinID(trim.minID, trim.limit)
+	}
+	return s.TrimMaxLen(trim.maxLen, trim.limit)
+}
+
+// nextStreamID 解析 XADD 的 ID 参数, 支持 *, <ms>-* 和完整的 ID
+func nextStreamID(s *stream.Stream, arg []byte) (stream.ID, reply.ErrorReply) {
+	smallerErr := reply.MakeErrReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	lastID := s.LastID()
+	idArg := string(arg)
+	if idArg == "*" {
+		id, ok := s.NextID(uint64(nowMs()))
+		if !ok {
+			return id, reply.MakeErrReply("ERR The stream has exhausted the last possible ID, unable to add more items")
+		}
+		return id, nil
+	}
+	if strings.HasSuffix(idArg, "-*") {
+		ms, err := strconv.ParseUint(strings.TrimSuffix(idArg, "-*"), 10, 64)
+		if err != nil {
+			return stream.ID{}, makeInvalidStreamIDErr()
+		}
+		if ms < lastID.Ms || (ms == lastID.Ms && lastID.Seq == math.MaxUint64) {
+			return stream.ID{}, smallerErr
+		}
+		if ms == lastID.Ms {
+			return stream.ID{Ms: ms, Seq: lastID.Seq + 1}, nil
+		}
+		return stream.ID{Ms: ms}, nil
+	}
+	id, err := stream.ParseID(idArg, 0)
+	if err != nil {
+		return id, makeInvalidStreamIDErr()
+	}
+	if id == stream.MinID {
+		return id, reply.MakeErrReply("ERR The ID specified in XADD must be greater than 0-0")
+	}
+	if !lastID.Less(id) {
+		return id, smallerErr
+	}
+	return id, nil
+}
+
+// execXAdd XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+func execXAdd(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	noMkStream := false
+	var trim *streamTrim
+	i := 1
+	for i < len(args) {
+		arg := strings.ToUpper(string(args[i]))
+		if arg == "NOMKSTREAM" {
+			noMkStream = true
+			i++
+		} else if arg == "MAXLEN" || arg == "MINID" {
+			t, n, errReply := parseStreamTrim(args[i:])
+			if errReply != nil {
+				return errReply
+			}
+			trim = t
+			i += n
+		} else {
+			break
+		}
+	}
+	if i >= len(args) {
+		return reply.MakeArgNumErrReply("xadd")
+	}
+	fields := args[i+1:]
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return reply.MakeArgNumErrReply("xadd")
+	}
+
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	isNew := s == nil
+	if isNew {
+		if noMkStream {
+			return reply.MakeNullBulkReply()
+		}
+		s = stream.Make()
+	}
+	id, errReply := nextStreamID(s, args[i])
+	if errReply != nil {
+		return errReply
+	}
+	s.Add(id, fields)
+	if isNew {
+		db.PutEntity(key, &redis.DataEntity{Data: s})
+	}
+
+	line := utils.ToCmdLine3("xadd", args[0], []byte(id.String()))
+	db.addAof(append(line, fields...))
+	if trim != nil && trim.apply(s) > 0 {
+		db.addAof(append(utils.ToCmdLine3("xtrim", args[0]), trim.args...))
+	}
+	return reply.MakeBulkReply([]byte(id.String()))
+}
+
+// execXTrim XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func execXTrim(db *DB, args [][]byte) redis.Reply {
+	arg := strings.ToUpper(string(args[1]))
+	if arg != "MAXLEN" && arg != "MINID" {
+		return reply.MakeSyntaxErrReply()
+	}
+	trim, n, errReply := parseStreamTrim(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	if 1+n != len(args) {
+		return reply.MakeSyntaxErrReply()
+	}
+	s, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeIntReply(0)
+	}
+	removed := trim.apply(s)
+	if removed > 0 {
+		db.addAof(utils.ToCmdLine3("xtrim", args...))
+	}
+	return reply.MakeIntReply(int64(removed))
+}
+
+// execXDel removes entries of given ids
+func execXDel(db *DB, args [][]byte) redis.Reply {
+	ids := make([]stream.ID, len(args)-1)
+	for i, arg := range args[1:] {
+		id, err := stream.ParseID(string(arg), 0)
+		if err != nil {
+			return makeInvalidStreamIDErr()
+		}
+		ids[i] = id
+	}
+	s, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeIntReply(0)
+	}
+	deleted := 0
+	for _, id := range ids {
+		if s.Delete(id) {
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		db.addAof(utils.ToCmdLine3("xdel", args...))
+	}
+	return reply.MakeIntReply(int64(deleted))
+}
+
+// execXSetId XSETID key last-id
+func execXSetId(db *DB, args [][]byte) redis.Reply {
+	id, err := stream.ParseID(string(args[1]), 0)
+	if err != nil {
+		return makeInvalidStreamIDErr()
+	}
+	s, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeErrReply("ERR no such key")
+	}
+	if !s.SetLastID(id) {
+		return reply.MakeErrReply("ERR The ID specified in XSETID is smaller than the target stream top item")
+	}
+	db.addAof(utils.ToCmdLine3("xsetid", args...))
+	return reply.MakeOkReply()
+}
+
+/* ---- XLEN / XRANGE ---- */
+
+func execXLen(db *DB, args [][]byte) redis.Reply {
+	s, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(s.Len()))
+}
+
+// execXRange XRANGE key start end [COUNT count]
+func execXRange(db *DB, args [][]byte) redis.Reply {
+	return execStreamRange(db, args[0], args[1], args[2], args[3:], false)
+}
+
+// execXRevRange XREVRANGE key end start [COUNT count]
+func execXRevRange(db *DB, args [][]byte) redis.Reply {
+	return execStreamRange(db, args[0], args[2], args[1], args[3:], true)
+}
+
+func execStreamRange(db *DB, key, startArg, endArg []byte, options [][]byte, reverse bool) redis.Reply {
+	start, errReply := parseRangeID(startArg, true)
+	if errReply != nil {
+		return errReply
+	}
+	end, errReply := parseRangeID(endArg, false)
+	if errReply != nil {
+		return errReply
+	}
+	count := -1
+	if len(options) > 0 {
+		if len(options) != 2 || !strings.EqualFold(string(options[0]), "COUNT") {
+			return reply.MakeSyntaxErrReply()
+		}
+		n, err := strconv.Atoi(string(options[1]))
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		if n <= 0 {
+			return reply.MakeEmptyMultiBulkReply()
+		}
+		count = n
+	}
+	s, errReply := db.getAsStream(string(key))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	return streamEntriesReply(s.Range(start, end, count, reverse))
+}
+
+/* ---- XREAD / XREADGROUP ---- */
+
+type streamReadArgs struct {
+	group    string
+	consumer string
+	count    int
+	noAck    bool
+	keys     [][]byte
+	ids      [][]byte
+}
+
+// parseStreamBlock 解析以毫秒为单位的 BLOCK 参数, 0 表示一直阻塞
+func parseStreamBlock(arg []byte) (time.Duration, reply.ErrorReply) {
+	ms, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, reply.MakeErrReply("ERR timeout is not an integer or out of range")
+	}
+	if ms < 0 {
+		return 0, reply.MakeErrReply("ERR timeout is negative")
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// parseStreamRead [GROUP group consumer] [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func parseStreamRead(args [][]byte, withGroup bool) (*streamReadArgs, reply.ErrorReply) {
+	cmdName := "xread"
+	r := &streamReadArgs{}
+	i := 0
+	if withGroup {
+		cmdName = "xreadgroup"
+		if len(args) < 3 || !strings.EqualFold(string(args[0]), "GROUP") {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		r.group, r.consumer = string(args[1]), string(args[2])
+		i = 3
+	}
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "COUNT":
+			if i+1 >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			count, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if count < 0 {
+				count = 0
+			}
+			r.count = count
+			i++
+		case "BLOCK":
+			if i+1 >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			if _, errReply := parseStreamBlock(args[i+1]); errReply != nil {
+				return nil, errReply
+			}
+			i++
+		case "NOACK":
+			if !withGroup {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			r.noAck = true
+		case "STREAMS":
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return nil, reply.MakeErrReply("ERR Unbalanced '" + cmdName +
+					"' list of streams: for each stream key an ID or '$' must be specified.")
+			}
+			r.keys, r.ids = rest[:len(rest)/2], rest[len(rest)/2:]
+			return r, nil
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	return nil, reply.MakeSyntaxErrReply()
+}
+
+func prepareXRead(args [][]byte) ([]string, []string) {
+	r, errReply := parseStreamRead(args, false)
+	if errReply != nil {
+		return nil, nil
+	}
+	return readAllKeys(r.keys)
+}
+
+func prepareXReadGroup(args [][]byte) ([]string, []string) {
+	r, errReply := parseStreamRead(args, true)
+	if errReply != nil {
+		return nil, nil
+	}
+	return writeAllKeys(r.keys)
+}
+
+func undoXReadGroup(db *DB, args [][]byte) [][][]byte {
+	keys, _ := prepareXReadGroup(args)
+	return rollbackGivenKeys(db, keys...)
+}
+
+// streamReadTimeout 从 args[start] 开始查找 BLOCK 参数, 没有 BLOCK 时不阻塞
+func streamReadTimeout(start int) func(args [][]byte) (time.Duration, bool, reply.ErrorReply) {
+	return func(args [][]byte) (time.Duration, bool, reply.ErrorReply) {
+		for i := start; i+1 < len(args); i++ {
+			arg := strings.ToUpper(string(args[i]))
+			if arg == "STREAMS" {
+				break
+			}
+			if arg == "BLOCK" {
+				timeout, errReply := parseStreamBlock(args[i+1])
+				return timeout, errReply == nil, errReply
+			}
+		}
+		return 0, false, nil
+	}
+}
+
+// resolveXRead 阻塞前将 $ 替换为当前的最后一个 ID, 避免重试时错过等待期间添加的条目
+func resolveXRead(db *DB, args [][]byte) [][]byte {
+	r, errReply := parseStreamRead(args, false)
+	if errReply != nil {
+		return args
+	}
+	resolved := make([][]byte, len(args))
+	copy(resolved, args)
+	offset := len(args) - len(r.ids)
+	for i, id := range r.ids {
+		if string(id) != "$" {
+			continue
+		}
+		lastID := stream.MinID
+		if s, _ := db.getAsStream(string(r.keys[i])); s != nil {
+			lastID = s.LastID()
+		}
+		resolved[offset+i] = []byte(lastID.String())
+	}
+	return resolved
+}
+
+// execXRead 读取每个 stream 中大于指定 ID 的条目, 都没有新条目时返回空回复
+func execXRead(db *DB, args [][]byte) redis.Reply {
+	r, errReply := parseStreamRead(args, false)
+	if errReply != nil {
+		return errReply
+	}
+	var results []redis.Reply
+	for i, key := range r.keys {
+		s, errReply := db.getAsStream(string(key))
+		if errReply != nil {
+			return errReply
+		}
+		if string(r.ids[i]) == "$" {
+			continue // 非阻塞执行时不会有比当前更新的条目
+		}
+		after, err := stream.ParseID(string(r.ids[i]), 0)
+		if err != nil {
+			return makeInvalidStreamIDErr()
+		}
+		if s == nil {
+			continue
+		}
+		start, ok := after.Next()
+		if !ok {
+			continue
+		}
+		entries := s.Range(start, stream.MaxID, r.count, false)
+		if len(entries) == 0 {
+			continue
+		}
+		results = append(results, reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeBulkReply(key),
+			streamEntriesReply(entries),
+		}))
+	}
+	if len(results) == 0 {
+		return reply.MakeNullMultiBulkReply()
+	}
+	return reply.MakeMultiRawReply(results)
+}
+
+// execXReadGroup 以消费者身份读取, ID 为 > 时读取新条目并加入待确认列表, 否则读取该消费者的待确认条目
+func execXReadGroup(db *DB, args [][]byte) redis.Reply {
+	r, errReply := parseStreamRead(args, true)
+	if errReply != nil {
+		return errReply
+	}
+	streams := make([]*stream.Stream, len(r.keys))
+	groups := make([]*stream.Group, len(r.keys))
+	for i, key := range r.keys {
+		s, group, errReply := db.getStreamGroup(string(key), r.group)
+		if errReply != nil {
+			return errReply
+		}
+		if group == nil {
+			return reply.MakeErrReply("NOGROUP No such key '" + string(key) + "' or consumer group '" +
+				r.group + "' in XREADGROUP with GROUP option")
+		}
+		if string(r.ids[i]) != ">" {
+			if _, err := stream.ParseID(string(r.ids[i]), 0); err != nil {
+				return makeInvalidStreamIDErr()
+			}
+		}
+		streams[i], groups[i] = s, group
+	}
+
+	now := nowMs()
+	var results []redis.Reply
+	for i, key := range r.keys {
+		s, group := streams[i], groups[i]
+		consumer, created := group.CreateConsumer(r.consumer, now)
+		consumer.SeenTime = now
+		if created {
+			db.addAof(utils.ToCmdLine("xgroup", "createconsumer", string(key), r.group, r.consumer))
+		}
+
+		if string(r.ids[i]) != ">" { // 历史消息不改变待确认列表
+			after, _ := stream.ParseID(string(r.ids[i]), 0)
+			var replies []redis.Reply
+			if start, ok := after.Next(); ok {
+				pending := group.PendingRange(start, stream.MaxID, r.count, func(pe *stream.PendingEntry) bool {
+					return pe.Consumer == r.consumer
+				})
+				for _, pe := range pending {
+					if entry, ok := s.Get(pe.ID); ok {
+						replies = append(replies, streamEntryReply(entry))
+					} else { // 条目已被删除
+						replies = append(replies, reply.MakeMultiRawReply([]redis.Reply{
+							reply.MakeBulkReply([]byte(pe.ID.String())),
+							reply.MakeNullMultiBulkReply(),
+						}))
+					}
+				}
+			}
+			results = append(results, reply.MakeMultiRawReply([]redis.Reply{
+				reply.MakeBulkReply(key),
+				reply.MakeMultiRawReply(replies),
+			}))
+			continue
+		}
+
+		start, ok := group.LastID.Next()
+		if !ok {
+			continue
+		}
+		entries := s.Range(start, stream.MaxID, r.count, false)
+		if len(entries) == 0 {
+			continue
+		}
+		claimLine := utils.ToCmdLine("xclaim", string(key), r.group, r.consumer, "0")
+		for _, entry := range entries {
+			group.LastID = entry.ID
+			if !r.noAck {
+				group.AddPending(&stream.PendingEntry{
+					ID:            entry.ID,
+					Consumer:      r.consumer,
+					DeliveryTime:  now,
+					DeliveryCount: 1,
+				})
+				claimLine = append(claimLine, []byte(entry.ID.String()))
+			}
+		}
+		if r.noAck {
+			db.addAof(utils.ToCmdLine("xgroup", "setid", string(key), r.group, group.LastID.String()))
+		} else {
+			db.addAof(append(claimLine, utils.ToCmdLine("TIME", strconv.FormatInt(now, 10),
+				"RETRYCOUNT", "1", "FORCE", "JUSTID", "LASTID", group.LastID.String())...))
+		}
+		results = append(results, reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeBulkReply(key),
+			streamEntriesReply(entries),
+		}))
+	}
+	if len(results) == 0 {
+		return reply.MakeNullMultiBulkReply()
+	}
+	return reply.MakeMultiRawReply(results)
+}
+
+/* ---- consumer groups ---- */
+
+// execXAck XACK key group id [id ...]
+func execXAck(db *DB, args [][]byte) redis.Reply {
+	ids := make([]stream.ID, len(args)-2)
+	for i, arg := range args[2:] {
+		id, err := stream.ParseID(string(arg), 0)
+		if err != nil {
+			return makeInvalidStreamIDErr()
+		}
+		ids[i] = id
+	}
+	_, group, errReply := db.getStreamGroup(string(args[0]), string(args[1]))
+	if errReply != nil {
+		return errReply
+	}
+	if group == nil {
+		return reply.MakeIntReply(0)
+	}
+	acked := 0
+	for _, id := range ids {
+		if group.Ack(id) {
+			acked++
+		}
+	}
+	if acked > 0 {
+		db.addAof(utils.ToCmdLine3("xack", args...))
+	}
+	return reply.MakeIntReply(int64(acked))
+}
+
+// execXPending XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func execXPending(db *DB, args [][]byte) redis.Reply {
+	key, groupName := string(args[0]), string(args[1])
+	minIdle := int64(0)
+	options := args[2:]
+	if len(options) > 0 && strings.EqualFold(string(options[0]), "IDLE") {
+		if len(options) < 2 {
+			return reply.MakeSyntaxErrReply()
+		}
+		idle, err := strconv.ParseInt(string(options[1]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		minIdle = idle
+		options = options[2:]
+		if len(options) == 0 {
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	if len(options) != 0 && len(options) != 3 && len(options) != 4 {
+		return reply.MakeSyntaxErrReply()
+	}
+
+	_, group, errReply := db.getStreamGroup(key, groupName)
+	if errReply != nil {
+		return errReply
+	}
+	if group == nil {
+		return makeNoGroupErr(key, groupName)
+	}
+
+	if len(options) == 0 { // 汇总信息
+		pending := group.PendingRange(stream.MinID, stream.MaxID, 0, nil)
+		if len(pending) == 0 {
+			return reply.MakeMultiRawReply([]redis.Reply{
+				reply.MakeIntReply(0),
+				reply.MakeNullBulkReply(),
+				reply.MakeNullBulkReply(),
+				reply.MakeNullMultiBulkReply(),
+			})
+		}
+		counts := make(map[string]int)
+		for _, pe := range pending {
+			counts[pe.Consumer]++
+		}
+		var consumers []redis.Reply
+		for _, consumer := range group.Consumers() {
+			if n := counts[consumer.Name]; n > 0 {
+				consumers = append(consumers, reply.MakeMultiBulkReply([][]byte{
+					[]byte(consumer.Name),
+					[]byte(strconv.Itoa(n)),
+				}))
+			}
+		}
+		return reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeIntReply(int64(len(pending))),
+			reply.MakeBulkReply([]byte(pending[0].ID.String())),
+			reply.MakeBulkReply([]byte(pending[len(pending)-1].ID.String())),
+			reply.MakeMultiRawReply(consumers),
+		})
+	}
+
+	start, errReply := parseRangeID(options[0], true)
+	if errReply != nil {
+		return errReply
+	}
+	end, errReply := parseRangeID(options[1], false)
+	if errReply != nil {
+		return errReply
+	}
+	count, err := strconv.Atoi(string(options[2]))
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if count <= 0 {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	consumerName := ""
+	if len(options) == 4 {
+		consumerName = string(options[3])
+	}
+	now := nowMs()
+	pending := group.PendingRange(start, end, count, func(pe *stream.PendingEntry) bool {
+		return (consumerName == "" || pe.Consumer == consumerName) && now-pe.DeliveryTime >= minIdle
+	})
+	replies := make([]redis.Reply, len(pending))
+	for i, pe := range pending {
+		replies[i] = reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeBulkReply([]byte(pe.ID.String())),
+			reply.MakeBulkReply([]byte(pe.Consumer)),
+			reply.MakeIntReply(now - pe.DeliveryTime),
+			reply.MakeIntReply(pe.DeliveryCount),
+		})
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+// execXClaim XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds]
+// [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+func execXClaim(db *DB, args [][]byte) redis.Reply {
+	key, groupName, consumerName := string(args[0]), string(args[1]), string(args[2])
+	minIdle, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+	var ids []stream.ID
+	i := 4
+	for ; i < len(args); i++ {
+		id, err := stream.ParseID(string(args[i]), 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return makeInvalidStreamIDErr()
+	}
+
+	now := nowMs()
+	deliveryTime := now
+	retryCount := int64(-1)
+	force, justID := false, false
+	var lastID *stream.ID
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch option {
+		case "FORCE":
+			force = true
+		case "JUSTID":
+			justID = true
+		case "IDLE", "TIME", "RETRYCOUNT", "LASTID":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			i++
+			if option == "LASTID" {
+				id, err := stream.ParseID(string(args[i]), 0)
+				if err != nil {
+					return makeInvalidStreamIDErr()
+				}
+				lastID = &id
+				continue
+			}
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return reply.MakeErrReply("ERR Invalid " + option + " option argument for XCLAIM")
+			}
+			switch option {
+			case "IDLE":
+				deliveryTime = now - n
+			case "TIME":
+				deliveryTime = n
+			case "RETRYCOUNT":
+				retryCount = n
+			}
+		default:
+			return reply.MakeErrReply("ERR Unrecognized XCLAIM option '" + string(args[i]) + "'")
+		}
+	}
+
+	s, group, errReply := db.getStreamGroup(key, groupName)
+	if errReply != nil {
+		return errReply
+	}
+	if group == nil {
+		return makeNoGroupErr(key, groupName)
+	}
+	if lastID != nil && group.LastID.Less(*lastID) {
+		group.LastID = *lastID
+		db.addAof(utils.ToCmdLine("xgroup", "setid", key, groupName, lastID.String()))
+	}
+
+	var claimed []*stream.Entry
+	for _, id := range ids {
+		pe, ok := group.Pending(id)
+		entry, exists := s.Get(id)
+		if !exists { // 条目已被删除, 同时从待确认列表中移除
+			if ok {
+				group.Ack(id)
+				db.addAof(utils.ToCmdLine("xack", key, groupName, id.String()))
+			}
+			continue
+		}
+		if !ok {
+			if !force {
+				continue
+			}
+			pe = &stream.PendingEntry{ID: id}
+			group.AddPending(pe)
+		} else if minIdle > 0 && now-pe.DeliveryTime < minIdle {
+			continue
+		}
+		if consumer, created := group.CreateConsumer(consumerName, now); created {
+			db.addAof(utils.ToCmdLine("xgroup", "createconsumer", key, groupName, consumerName))
+		} else {
+			consumer.SeenTime = now
+		}
+		pe.Consumer = consumerName
+		pe.DeliveryTime = deliveryTime
+		if retryCount >= 0 {
+			pe.DeliveryCount = retryCount
+		} else if !justID {
+			pe.DeliveryCount++
+		}
+		claimed = append(claimed, entry)
+		db.addAof(utils.ToCmdLine("xclaim", key, groupName, consumerName, "0", id.String(),
+			"TIME", strconv.FormatInt(pe.DeliveryTime, 10),
+			"RETRYCOUNT", strconv.FormatInt(pe.DeliveryCount, 10), "FORCE", "JUSTID"))
+	}
+
+	if justID {
+		result := make([][]byte, len(claimed))
+		for i, entry := range claimed {
+			result[i] = []byte(entry.ID.String())
+		}
+		return reply.MakeMultiBulkReply(result)
+	}
+	return streamEntriesReply(claimed)
+}
+
+func prepareXGroup(args [][]byte) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return []string{string(args[1])}, nil
+}
+
+func undoXGroup(db *DB, args [][]byte) [][][]byte {
+	keys, _ := prepareXGroup(args)
+	return rollbackGivenKeys(db, keys...)
+}
+
+// execXGroup XGROUP CREATE|SETID|DESTROY|CREATECONSUMER|DELCONSUMER key group ...
+func execXGroup(db *DB, args [][]byte) redis.Reply {
+	subCmd := strings.ToLower(string(args[0]))
+	arity := map[string]int{"create": 4, "setid": 4, "destroy": 3, "createconsumer": 4, "delconsumer": 4}
+	n, ok := arity[subCmd]
+	if !ok {
+		return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try XGROUP HELP.")
+	}
+	if len(args) != n && !(subCmd == "create" && len(args) == n+1) {
+		return reply.MakeErrReply("ERR wrong number of arguments for 'xgroup|" + subCmd + "' command")
+	}
+	key, groupName := string(args[1]), string(args[2])
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	if subCmd == "create" {
+		mkStream := false
+		if len(args) == n+1 {
+			if !strings.EqualFold(string(args[4]), "MKSTREAM") {
+				return reply.MakeSyntaxErrReply()
+			}
+			mkStream = true
+		}
+		isNew := s == nil
+		if isNew {
+			if !mkStream {
+				return reply.MakeErrReply("ERR The XGROUP subcommand requires the key to exist. " +
+					"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+			}
+			s = stream.Make()
+		}
+		id, errReply := parseGroupID(s, args[3])
+		if errReply != nil {
+			return errReply
+		}
+		if _, ok := s.CreateGroup(groupName, id); !ok {
+			return reply.MakeErrReply("BUSYGROUP Consumer Group name already exists")
+		}
+		if isNew {
+			db.PutEntity(key, &redis.DataEntity{Data: s})
+		}
+		line := utils.ToCmdLine("xgroup", "create", key, groupName, id.String())
+		if isNew {
+			line = append(line, []byte("MKSTREAM"))
+		}
+		db.addAof(line)
+		return reply.MakeOkReply()
+	}
+
+	if s == nil {
+		if subCmd == "destroy" {
+			return reply.MakeIntReply(0)
+		}
+		return reply.MakeErrReply("ERR The XGROUP subcommand requires the key to exist. " +
+			"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	}
+	group, ok := s.Group(groupName)
+	if !ok {
+		if subCmd == "destroy" {
+			return reply.MakeIntReply(0)
+		}
+		return reply.MakeErrReply("NOGROUP No such consumer group '" + groupName + "' for key name '" + key + "'")
+	}
+	switch subCmd {
+	case "setid":
+		id, errReply := parseGroupID(s, args[3])
+		if errReply != nil {
+			return errReply
+		}
+		group.LastID = id
+		db.addAof(utils.ToCmdLine("xgroup", "setid", key, groupName, id.String()))
+		return reply.MakeOkReply()
+	case "destroy":
+		s.DestroyGroup(groupName)
+		db.addAof(utils.ToCmdLine3("xgroup", args...))
+		return reply.MakeIntReply(1)
+	case "createconsumer":
+		if _, created := group.CreateConsumer(string(args[3]), nowMs()); !created {
+			return reply.MakeIntReply(0)
+		}
+		db.addAof(utils.ToCmdLine3("xgroup", args...))
+		return reply.MakeIntReply(1)
+	}
+	// delconsumer
+	if _, ok := group.Consumer(string(args[3])); !ok {
+		return reply.MakeIntReply(0)
+	}
+	pending := group.DeleteConsumer(string(args[3]))
+	db.addAof(utils.ToCmdLine3("xgroup", args...))
+	return reply.MakeIntReply(int64(pending))
+}
+
+// parseGroupID 解析消费组的起始 ID, $ 表示 stream 当前的最后一个 ID
+func parseGroupID(s *stream.Stream, arg []byte) (stream.ID, reply.ErrorReply) {
+	if string(arg) == "$" {
+		return s.LastID(), nil
+	}
+	id, err := stream.ParseID(string(arg), 0)
+	if err != nil {
+		return id, makeInvalidStreamIDErr()
+	}
+	return id, nil
+}
+
+func init() {
+	RegisterCommand(cmd.XAdd, execXAdd, writeFirstKey, rollbackFirstKey, -5)
+	RegisterCommand(cmd.XLen, execXLen, readFirstKey, nil, 2)
+	RegisterCommand(cmd.XRange, execXRange, readFirstKey, nil, -4)
+	RegisterCommand(cmd.XRevRange, execXRevRange, readFirstKey, nil, -4)
+	RegisterCommand(cmd.XDel, execXDel, writeFirstKey, rollbackFirstKey, -3)
+	RegisterCommand(cmd.XTrim, execXTrim, writeFirstKey, rollbackFirstKey, -4)
+	RegisterCommand(cmd.XSetId, execXSetId, writeFirstKey, rollbackFirstKey, 3)
+	RegisterCommand(cmd.XRead, execXRead, prepareXRead, nil, -4)
+	RegisterCommand(cmd.XGroup, execXGroup, prepareXGroup, undoXGroup, -2)
+	RegisterCommand(cmd.XReadGroup, execXReadGroup, prepareXReadGroup, undoXReadGroup, -7)
+	RegisterCommand(cmd.XAck, execXAck, writeFirstKey, rollbackFirstKey, -4)
+	RegisterCommand(cmd.XPending, execXPending, readFirstKey, nil, -3)
+	RegisterCommand(cmd.XClaim, execXClaim, writeFirstKey, rollbackFirstKey, -6)
+	registerBlocking(cmd.XRead, &blockingSpec{timeout: streamReadTimeout(0), resolve: resolveXRead})
+	registerBlocking(cmd.XReadGroup, &blockingSpec{timeout: streamReadTimeout(3)})
+	markAllowOOM(cmd.XDel, cmd.XTrim, cmd.XAck)
+}
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestStreamGroup(t *testing.T) {
+	db := makeDB()
+	cases := []cmdCase{
+		{[]string{"XADD", "s", "1-1", "a", "1"}, "$3\r\n1-1\r\n"},
+		{[]string{"XADD", "s", "1-*", "b", "2"}, "$3\r\n1-2\r\n"},
+		{[]string{"XADD", "s", "1-2", "c", "3"}, "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n"},
+		{[]string{"XRANGE", "s", "(1-1", "+"}, "*1\r\n*2\r\n$3\r\n1-2\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n"},
+		{[]string{"XREAD", "STREAMS", "s", "$"}, "*-1\r\n"},
+		{[]string{"XGROUP", "CREATE", "s", "g", "0"}, "+OK\r\n"},
+		{[]string{"XREADGROUP", "GROUP", "g", "c1", "COUNT", "1", "STREAMS", "s", ">"}, "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n"},
+		{[]string{"XPENDING", "s", "g"}, "*4\r\n:1\r\n$3\r\n1-1\r\n$3\r\n1-1\r\n*1\r\n*2\r\n$2\r\nc1\r\n$1\r\n1\r\n"},
+		{[]string{"XCLAIM", "s", "g", "c2", "0", "1-1", "JUSTID"}, "*1\r\n$3\r\n1-1\r\n"},
+		{[]string{"XACK", "s", "g", "1-1", "1-2"}, ":1\r\n"},
+		{[]string{"XREADGROUP", "GROUP", "g", "c1", "STREAMS", "s", "0"}, "*1\r\n*2\r\n$1\r\ns\r\n*0\r\n"},
+		{[]string{"XTRIM", "s", "MAXLEN", "0"}, ":2\r\n"},
+		{[]string{"XREADGROUP", "GROUP", "g", "c1", "STREAMS", "s", ">"}, "*-1\r\n"},
+		{[]string{"TYPE", "s"}, "+stream\r\n"},
+	}
+	runCases(t, db, cases)
+}
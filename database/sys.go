@@ -3,8 +3,11 @@ package database
 import (
 	"gedis/config"
 	"gedis/reply"
+	"gedis/server/status"
 	"gedis/types/cmd"
 	"gedis/types/redis"
+	"strconv"
+	"strings"
 )
 
 // Ping the server
@@ -18,11 +21,6 @@ func Ping(db *DB, args [][]byte) redis.Reply {
 	}
 }
 
-// Info 服务器信息输出
-func Info(db *DB, args [][]byte) redis.Reply {
-	return &reply.OkReply{}
-}
-
 // Auth validate client's password
 func Auth(c redis.Connection, args [][]byte) redis.Reply {
 	if len(args) != 1 {
@@ -39,6 +37,56 @@ func Auth(c redis.Connection, args [][]byte) redis.Reply {
 	return &reply.OkReply{}
 }
 
+// Hello 协商 RESP 协议版本, 可同时完成认证, 返回服务器信息
+func Hello(mdb *MultiDB, c redis.Connection, args [][]byte) redis.Reply {
+	protocol := c.GetProtocol()
+	if len(args) > 0 {
+		version, err := strconv.Atoi(string(args[0]))
+		if err != nil {
+			return reply.MakeErrReply("ERR Protocol version is not an integer or out of range")
+		}
+		if version != reply.Resp2 && version != reply.Resp3 {
+			return reply.MakeErrReply("NOPROTO unsupported protocol version")
+		}
+		protocol = version
+		for i := 1; i < len(args); i++ {
+			option := strings.ToLower(string(args[i]))
+			if option == "auth" && i+2 < len(args) {
+				if result := Auth(c, args[i+2:i+3]); reply.IsErrorReply(result) {
+					return result
+				}
+				i += 2
+			} else if option == "setname" && i+1 < len(args) {
+				i++
+			} else {
+				return reply.MakeErrReply("ERR Syntax error in HELLO option '" + string(args[i]) + "'")
+			}
+		}
+	}
+	if !isAuthenticated(c) {
+		return reply.MakeErrReply("NOAUTH HELLO must be called with the client already authenticated, " +
+			"otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and " +
+			"select the RESP protocol version at the same time")
+	}
+	c.SetProtocol(protocol)
+
+	mode, role := "standalone", "master"
+	if mdb.cluster != nil {
+		mode = "cluster"
+	}
+	if mdb.repl.readOnly.Get() {
+		role = "replica"
+	}
+	return reply.MakeMapReply([]redis.Reply{
+		reply.MakeBulkReply([]byte("server")), reply.MakeBulkReply([]byte("redis")),
+		reply.MakeBulkReply([]byte("version")), reply.MakeBulkReply([]byte(status.Version)),
+		reply.MakeBulkReply([]byte("proto")), reply.MakeIntReply(int64(protocol)),
+		reply.MakeBulkReply([]byte("mode")), reply.MakeBulkReply([]byte(mode)),
+		reply.MakeBulkReply([]byte("role")), reply.MakeBulkReply([]byte(role)),
+		reply.MakeBulkReply([]byte("modules")), reply.MakeEmptyMultiBulkReply(),
+	})
+}
+
 func isAuthenticated(c redis.Connection) bool {
 	if config.Get().Server.Password == "" {
 		return true
@@ -48,5 +96,4 @@ func isAuthenticated(c redis.Connection) bool {
 
 func init() {
 	RegisterCommand(cmd.Ping, Ping, noPrepare, nil, -1)
-	RegisterCommand(cmd.Info, Info, noPrepare, nil, -1)
 }
@@ -124,6 +124,9 @@ func (db *DB) ExecMulti(conn redis.Connection, watching map[string]uint32, cmdLi
 	}
 	if !aborted { //success
 		db.addVersion(writeKeys...)
+		db.updateMemory(writeKeys...)
+		db.persist(writeKeys...)
+		db.blocking.signal(writeKeys...)
 		return reply.MakeMultiRawReply(results)
 	}
 	// undo if aborted
@@ -137,6 +140,8 @@ func (db *DB) ExecMulti(conn redis.Connection, watching map[string]uint32, cmdLi
 			db.execWithLock(cmdLine)
 		}
 	}
+	db.updateMemory(writeKeys...)
+	db.persist(writeKeys...)
 	return reply.MakeErrReply("EXECABORT Transaction discarded because of previous errors.")
 }
 
@@ -3,7 +3,10 @@ package database
 import (
 	"gedis/aof"
 	"gedis/pkg/utils"
+	"gedis/reply"
+	Dict "gedis/types/dict"
 	"strconv"
+	"strings"
 )
 
 func readFirstKey(args [][]byte) ([]string, []string) {
@@ -53,7 +56,11 @@ func rollbackGivenKeys(db *DB, keys ...string) [][][]byte {
 		} else {
 			undoCmdLines = append(undoCmdLines,
 				utils.ToCmdLine("DEL", key), // clean existed first
-				aof.EntityToCmd(key, entity).Args,
+			)
+			for _, cmd := range aof.EntityToCmds(key, entity) {
+				undoCmdLines = append(undoCmdLines, cmd.Args)
+			}
+			undoCmdLines = append(undoCmdLines,
 				toTTLCmd(db, key).Args,
 			)
 		}
@@ -84,6 +91,11 @@ func rollbackHashFields(db *DB, key string, fields ...string) [][][]byte {
 			undoCmdLines = append(undoCmdLines,
 				utils.ToCmdLine("HSET", key, field, string(value)),
 			)
+			if hash, ok := dict.(Dict.Expirable); ok { // HSET 会清除过期时间, 需要单独恢复
+				if expireTime, ok := hash.ExpireTime(field); ok {
+					undoCmdLines = append(undoCmdLines, aof.MakeFieldExpireCmd(key, field, expireTime).Args)
+				}
+			}
 		}
 	}
 	return undoCmdLines
@@ -172,3 +184,62 @@ func rollbackZSetFields(db *DB, key string, fields ...string) [][][]byte {
 	}
 	return undoCmdLines
 }
+
+// rankRange 将包含 stop 且允许负数的排名转换为 [start, stop), 范围为空时 ok 为 false
+func rankRange(size int64, start int64, stop int64) (int64, int64, bool) {
+	if start < -1*size {
+		start = 0
+	} else if start < 0 {
+		start = size + start
+	} else if start >= size {
+		return 0, 0, false
+	}
+	if stop < -1*size {
+		stop = 0
+	} else if stop < 0 {
+		stop = size + stop + 1
+	} else if stop < size {
+		stop = stop + 1
+	} else {
+		stop = size
+	}
+	if stop < start {
+		stop = start
+	}
+	// assert: start in [0, size - 1], stop in [start, size]
+	return start, stop, true
+}
+
+// parseMPop 解析 LMPOP/ZMPOP 的参数: numkeys key [key ...] <where> [COUNT count], where 由 parseWhere 解析
+func parseMPop(args [][]byte, parseWhere func(arg []byte) (bool, reply.ErrorReply)) (keys []string, where bool, count int, errReply reply.ErrorReply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, false, 0, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if numKeys <= 0 {
+		return nil, false, 0, reply.MakeErrReply("ERR numkeys should be greater than 0")
+	}
+	if numKeys+2 > len(args) {
+		return nil, false, 0, reply.MakeSyntaxErrReply()
+	}
+	keys = make([]string, numKeys)
+	for i := range keys {
+		keys[i] = string(args[i+1])
+	}
+	where, errReply = parseWhere(args[numKeys+1])
+	if errReply != nil {
+		return nil, false, 0, errReply
+	}
+	count = 1
+	rest := args[numKeys+2:]
+	if len(rest) > 0 {
+		if len(rest) != 2 || !strings.EqualFold(string(rest[0]), "COUNT") {
+			return nil, false, 0, reply.MakeSyntaxErrReply()
+		}
+		count, err = strconv.Atoi(string(rest[1]))
+		if err != nil || count <= 0 {
+			return nil, false, 0, reply.MakeErrReply("ERR count should be greater than 0")
+		}
+	}
+	return keys, where, count, nil
+}
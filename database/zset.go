@@ -5,7 +5,9 @@ import (
 	"gedis/reply"
 	"gedis/types/cmd"
 	"gedis/types/redis"
+	HashSet "gedis/types/set"
 	SortedSet "gedis/types/zset"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -105,8 +107,7 @@ func execZScore(db *DB, args [][]byte) redis.Reply {
 	if !exists {
 		return &reply.NullBulkReply{}
 	}
-	value := strconv.FormatFloat(element.Score, 'f', -1, 64)
-	return reply.MakeBulkReply([]byte(value))
+	return reply.MakeDoubleReply(element.Score)
 }
 
 // execZRank gets index of a member in sortedset, ascending order, start from 0
@@ -170,29 +171,158 @@ func execZCard(db *DB, args [][]byte) redis.Reply {
 	return reply.MakeIntReply(sortedSet.Len())
 }
 
-// execZRange gets members in range, sort by score in ascending order
-func execZRange(db *DB, args [][]byte) redis.Reply {
-	// parse args
-	if len(args) != 3 && len(args) != 4 {
-		return reply.MakeErrReply("ERR wrong number of arguments for 'zrange' command")
+// zrangeSpec ZRANGE 的查询参数: start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+type zrangeSpec struct {
+	by         string // 为空时按排名查询
+	rev        bool
+	start      string
+	stop       string
+	offset     int64
+	limit      int64 // limit < 0 means no limit
+	withScores bool
+}
+
+func parseZRangeSpec(args [][]byte, allowWithScores bool) (*zrangeSpec, reply.ErrorReply) {
+	spec := &zrangeSpec{
+		start: string(args[0]),
+		stop:  string(args[1]),
+		limit: -1,
+	}
+	hasLimit := false
+	for i := 2; i < len(args); i++ {
+		switch arg := strings.ToUpper(string(args[i])); {
+		case arg == "BYSCORE" || arg == "BYLEX":
+			spec.by = arg
+		case arg == "REV":
+			spec.rev = true
+		case arg == "WITHSCORES" && allowWithScores:
+			spec.withScores = true
+		case arg == "LIMIT":
+			if i+2 >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			var err error
+			spec.offset, err = strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			spec.limit, err = strconv.ParseInt(string(args[i+2]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			hasLimit = true
+			i += 2
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
 	}
-	withScores := false
-	if len(args) == 4 {
-		if strings.ToUpper(string(args[3])) != "WITHSCORES" {
-			return reply.MakeErrReply("syntax error")
+	if hasLimit && spec.by == "" {
+		return nil, reply.MakeErrReply("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if spec.withScores && spec.by == "BYLEX" {
+		return nil, reply.MakeErrReply("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	return spec, nil
+}
+
+// rangeSortedSet 按 spec 查询 key 中的成员, key 不存在时返回 nil
+func (db *DB) rangeSortedSet(key string, spec *zrangeSpec) ([]*SortedSet.Element, reply.ErrorReply) {
+	// BYSCORE 与 BYLEX 在 REV 模式下参数顺序为 max min
+	minArg, maxArg := spec.start, spec.stop
+	if spec.rev {
+		minArg, maxArg = maxArg, minArg
+	}
+	var rangeFn func(sortedSet *SortedSet.SortedSet) []*SortedSet.Element
+	switch spec.by {
+	case "BYSCORE":
+		min, err := SortedSet.ParseScoreBorder(minArg)
+		if err != nil {
+			return nil, reply.MakeErrReply(err.Error())
+		}
+		max, err := SortedSet.ParseScoreBorder(maxArg)
+		if err != nil {
+			return nil, reply.MakeErrReply(err.Error())
+		}
+		rangeFn = func(sortedSet *SortedSet.SortedSet) []*SortedSet.Element {
+			return sortedSet.RangeByScore(min, max, spec.offset, spec.limit, spec.rev)
+		}
+	case "BYLEX":
+		min, err := SortedSet.ParseLexBorder(minArg)
+		if err != nil {
+			return nil, reply.MakeErrReply(err.Error())
+		}
+		max, err := SortedSet.ParseLexBorder(maxArg)
+		if err != nil {
+			return nil, reply.MakeErrReply(err.Error())
+		}
+		rangeFn = func(sortedSet *SortedSet.SortedSet) []*SortedSet.Element {
+			return sortedSet.RangeByLex(min, max, spec.offset, spec.limit, spec.rev)
+		}
+	default:
+		start, err := strconv.ParseInt(spec.start, 10, 64)
+		if err != nil {
+			return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		stop, err := strconv.ParseInt(spec.stop, 10, 64)
+		if err != nil {
+			return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		rangeFn = func(sortedSet *SortedSet.SortedSet) []*SortedSet.Element {
+			start, stop, ok := rankRange(sortedSet.Len(), start, stop)
+			if !ok {
+				return nil
+			}
+			return sortedSet.Range(start, stop, spec.rev)
 		}
-		withScores = true
 	}
-	key := string(args[0])
-	start, err := strconv.ParseInt(string(args[1]), 10, 64)
-	if err != nil {
-		return reply.MakeErrReply("ERR value is not an integer or out of range")
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil || sortedSet == nil {
+		return nil, errReply
 	}
-	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
-	if err != nil {
-		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	return rangeFn(sortedSet), nil
+}
+
+// execZRange ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func execZRange(db *DB, args [][]byte) redis.Reply {
+	spec, errReply := parseZRangeSpec(args[1:], true)
+	if errReply != nil {
+		return errReply
+	}
+	elements, errReply := db.rangeSortedSet(string(args[0]), spec)
+	if errReply != nil {
+		return errReply
 	}
-	return range0(db, key, start, stop, withScores, false)
+	return zsetElementsReply(elements, spec.withScores)
+}
+
+// execZRangeStore ZRANGESTORE dst src min max [BYSCORE | BYLEX] [REV] [LIMIT offset count]
+func execZRangeStore(db *DB, args [][]byte) redis.Reply {
+	dest := string(args[0])
+	spec, errReply := parseZRangeSpec(args[2:], false)
+	if errReply != nil {
+		return errReply
+	}
+	elements, errReply := db.rangeSortedSet(string(args[1]), spec)
+	if errReply != nil {
+		return errReply
+	}
+	db.Remove(dest) // clean ttl and old value
+	if len(elements) > 0 {
+		result := SortedSet.Make()
+		for _, element := range elements {
+			result.Add(element.Member, element.Score)
+		}
+		db.PutEntity(dest, &redis.DataEntity{
+			Data: result,
+		})
+	}
+	db.addAof(utils.ToCmdLine3("zrangestore", args...))
+	return reply.MakeIntReply(int64(len(elements)))
+}
+
+func prepareZRangeStore(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, []string{string(args[1])}
 }
 
 // execZRevRange gets members in range, sort by score in descending order
@@ -231,28 +361,10 @@ func range0(db *DB, key string, start int64, stop int64, withScores bool, desc b
 	}
 
 	// compute index
-	size := sortedSet.Len() // assert: size > 0
-	if start < -1*size {
-		start = 0
-	} else if start < 0 {
-		start = size + start
-	} else if start >= size {
+	start, stop, ok := rankRange(sortedSet.Len(), start, stop)
+	if !ok {
 		return &reply.EmptyMultiBulkReply{}
 	}
-	if stop < -1*size {
-		stop = 0
-	} else if stop < 0 {
-		stop = size + stop + 1
-	} else if stop < size {
-		stop = stop + 1
-	} else {
-		stop = size
-	}
-	if stop < start {
-		stop = start
-	}
-
-	// assert: start in [0, size - 1], stop in [start, size]
 	slice := sortedSet.Range(start, stop, desc)
 	if withScores {
 		result := make([][]byte, len(slice)*2)
@@ -485,28 +597,10 @@ func execZRemRangeByRank(db *DB, args [][]byte) redis.Reply {
 	}
 
 	// compute index
-	size := sortedSet.Len() // assert: size > 0
-	if start < -1*size {
-		start = 0
-	} else if start < 0 {
-		start = size + start
-	} else if start >= size {
+	start, stop, ok := rankRange(sortedSet.Len(), start, stop)
+	if !ok {
 		return reply.MakeIntReply(0)
 	}
-	if stop < -1*size {
-		stop = 0
-	} else if stop < 0 {
-		stop = size + stop + 1
-	} else if stop < size {
-		stop = stop + 1
-	} else {
-		stop = size
-	}
-	if stop < start {
-		stop = start
-	}
-
-	// assert: start in [0, size - 1], stop in [start, size]
 	removed := sortedSet.RemoveByRank(start, stop)
 	if removed > 0 {
 		db.addAof(utils.ToCmdLine3("zremrangebyrank", args...))
@@ -590,6 +684,646 @@ func undoZIncr(db *DB, args [][]byte) [][][]byte {
 	return rollbackZSetFields(db, key, field)
 }
 
+func zsetElementsReply(elements []*SortedSet.Element, withScores bool) redis.Reply {
+	if withScores {
+		result := make([][]byte, 0, len(elements)*2)
+		for _, element := range elements {
+			score := reply.MakeDoubleReply(element.Score).String()
+			result = append(result, []byte(element.Member), []byte(score))
+		}
+		return reply.MakeMultiBulkReply(result)
+	}
+	result := make([][]byte, len(elements))
+	for i, element := range elements {
+		result[i] = []byte(element.Member)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// parseLexRange 解析 min max [LIMIT offset count]
+func parseLexRange(args [][]byte) (min, max *SortedSet.LexBorder, offset, limit int64, errReply reply.ErrorReply) {
+	min, err := SortedSet.ParseLexBorder(string(args[0]))
+	if err != nil {
+		return nil, nil, 0, 0, reply.MakeErrReply(err.Error())
+	}
+	max, err = SortedSet.ParseLexBorder(string(args[1]))
+	if err != nil {
+		return nil, nil, 0, 0, reply.MakeErrReply(err.Error())
+	}
+	limit = -1
+	if len(args) == 2 {
+		return min, max, offset, limit, nil
+	}
+	if len(args) != 5 || strings.ToUpper(string(args[2])) != "LIMIT" {
+		return nil, nil, 0, 0, reply.MakeSyntaxErrReply()
+	}
+	offset, err = strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return nil, nil, 0, 0, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	limit, err = strconv.ParseInt(string(args[4]), 10, 64)
+	if err != nil {
+		return nil, nil, 0, 0, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	return min, max, offset, limit, nil
+}
+
+func rangeByLex0(db *DB, key string, min *SortedSet.LexBorder, max *SortedSet.LexBorder, offset int64, limit int64, desc bool) redis.Reply {
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return &reply.EmptyMultiBulkReply{}
+	}
+	return zsetElementsReply(sortedSet.RangeByLex(min, max, offset, limit, desc), false)
+}
+
+// execZRangeByLex ZRANGEBYLEX key min max [LIMIT offset count]
+func execZRangeByLex(db *DB, args [][]byte) redis.Reply {
+	min, max, offset, limit, errReply := parseLexRange(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	return rangeByLex0(db, string(args[0]), min, max, offset, limit, false)
+}
+
+// execZRevRangeByLex ZREVRANGEBYLEX key max min [LIMIT offset count]
+func execZRevRangeByLex(db *DB, args [][]byte) redis.Reply {
+	rangeArgs := append([][]byte{args[2], args[1]}, args[3:]...)
+	min, max, offset, limit, errReply := parseLexRange(rangeArgs)
+	if errReply != nil {
+		return errReply
+	}
+	return rangeByLex0(db, string(args[0]), min, max, offset, limit, true)
+}
+
+// execZLexCount gets number of members within given lex range
+func execZLexCount(db *DB, args [][]byte) redis.Reply {
+	min, max, _, _, errReply := parseLexRange(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(sortedSet.CountByLex(min, max))
+}
+
+// execZRemRangeByLex removes members within given lex range
+func execZRemRangeByLex(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	min, max, _, _, errReply := parseLexRange(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+	removed := sortedSet.RemoveByLex(min, max)
+	if removed > 0 {
+		if sortedSet.Len() == 0 {
+			db.Remove(key)
+		}
+		db.addAof(utils.ToCmdLine3("zremrangebylex", args...))
+	}
+	return reply.MakeIntReply(removed)
+}
+
+// zsetOperation ZUNION/ZINTER/ZDIFF 的参数
+type zsetOperation struct {
+	keys       []string
+	weights    []float64
+	aggregate  string
+	withScores bool
+}
+
+// parseZSetOperation 解析 numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+// ZDIFF 不支持 WEIGHTS 和 AGGREGATE, 存储结果的命令不支持 WITHSCORES
+func parseZSetOperation(cmdName string, args [][]byte, withWeights bool, withScores bool) (*zsetOperation, reply.ErrorReply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if numKeys <= 0 {
+		return nil, reply.MakeErrReply("ERR at least 1 input key is needed for '" + cmdName + "' command")
+	}
+	if numKeys > len(args)-1 {
+		return nil, reply.MakeSyntaxErrReply()
+	}
+	op := &zsetOperation{
+		keys:      make([]string, numKeys),
+		weights:   make([]float64, numKeys),
+		aggregate: "SUM",
+	}
+	for i := 0; i < numKeys; i++ {
+		op.keys[i] = string(args[i+1])
+		op.weights[i] = 1
+	}
+	for i := numKeys + 1; i < len(args); i++ {
+		switch arg := strings.ToUpper(string(args[i])); {
+		case arg == "WEIGHTS" && withWeights:
+			if i+numKeys >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			for j := 0; j < numKeys; j++ {
+				weight, err := strconv.ParseFloat(string(args[i+1+j]), 64)
+				if err != nil || math.IsNaN(weight) {
+					return nil, reply.MakeErrReply("ERR weight value is not a float")
+				}
+				op.weights[j] = weight
+			}
+			i += numKeys
+		case arg == "AGGREGATE" && withWeights:
+			if i+1 >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			op.aggregate = strings.ToUpper(string(args[i+1]))
+			if op.aggregate != "SUM" && op.aggregate != "MIN" && op.aggregate != "MAX" {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			i++
+		case arg == "WITHSCORES" && withScores:
+			op.withScores = true
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	return op, nil
+}
+
+// getAsZSetSource 读取集合运算的输入, 普通 set 的成员 score 视为 1
+func (db *DB) getAsZSetSource(key string) (*SortedSet.SortedSet, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	switch data := entity.Data.(type) {
+	case *SortedSet.SortedSet:
+		return data, nil
+	case *HashSet.Set:
+		sortedSet := SortedSet.Make()
+		data.ForEach(func(member string) bool {
+			sortedSet.Add(member, 1)
+			return true
+		})
+		return sortedSet, nil
+	}
+	return nil, &reply.WrongTypeErrReply{}
+}
+
+func (op *zsetOperation) aggregateScore(acc float64, score float64) float64 {
+	switch op.aggregate {
+	case "MIN":
+		return math.Min(acc, score)
+	case "MAX":
+		return math.Max(acc, score)
+	}
+	sum := acc + score
+	if math.IsNaN(sum) { // inf + -inf
+		return 0
+	}
+	return sum
+}
+
+func weightedScore(score float64, weight float64) float64 {
+	result := score * weight
+	if math.IsNaN(result) { // inf * 0
+		return 0
+	}
+	return result
+}
+
+func (db *DB) zsetUnion(op *zsetOperation) (*SortedSet.SortedSet, reply.ErrorReply) {
+	result := SortedSet.Make()
+	for i, key := range op.keys {
+		sortedSet, errReply := db.getAsZSetSource(key)
+		if errReply != nil {
+			return nil, errReply
+		}
+		if sortedSet == nil {
+			continue
+		}
+		weight := op.weights[i]
+		sortedSet.ForEach(0, sortedSet.Len(), false, func(element *SortedSet.Element) bool {
+			score := weightedScore(element.Score, weight)
+			if current, ok := result.Get(element.Member); ok {
+				score = op.aggregateScore(current.Score, score)
+			}
+			result.Add(element.Member, score)
+			return true
+		})
+	}
+	return result, nil
+}
+
+func (db *DB) zsetInter(op *zsetOperation) (*SortedSet.SortedSet, reply.ErrorReply) {
+	sources := make([]*SortedSet.SortedSet, len(op.keys))
+	empty := false
+	for i, key := range op.keys {
+		sortedSet, errReply := db.getAsZSetSource(key)
+		if errReply != nil {
+			return nil, errReply
+		}
+		if sortedSet == nil {
+			empty = true // 继续检查其余 key 的类型
+		}
+		sources[i] = sortedSet
+	}
+	result := SortedSet.Make()
+	if empty {
+		return result, nil
+	}
+	first := sources[0]
+	first.ForEach(0, first.Len(), false, func(element *SortedSet.Element) bool {
+		score := weightedScore(element.Score, op.weights[0])
+		for i := 1; i < len(sources); i++ {
+			other, ok := sources[i].Get(element.Member)
+			if !ok {
+				return true
+			}
+			score = op.aggregateScore(score, weightedScore(other.Score, op.weights[i]))
+		}
+		result.Add(element.Member, score)
+		return true
+	})
+	return result, nil
+}
+
+func (db *DB) zsetDiff(op *zsetOperation) (*SortedSet.SortedSet, reply.ErrorReply) {
+	sources := make([]*SortedSet.SortedSet, len(op.keys))
+	for i, key := range op.keys {
+		sortedSet, errReply := db.getAsZSetSource(key)
+		if errReply != nil {
+			return nil, errReply
+		}
+		sources[i] = sortedSet
+	}
+	result := SortedSet.Make()
+	first := sources[0]
+	if first == nil {
+		return result, nil
+	}
+	first.ForEach(0, first.Len(), false, func(element *SortedSet.Element) bool {
+		for _, other := range sources[1:] {
+			if other == nil {
+				continue
+			}
+			if _, ok := other.Get(element.Member); ok {
+				return true
+			}
+		}
+		result.Add(element.Member, element.Score)
+		return true
+	})
+	return result, nil
+}
+
+type zsetCalculator func(db *DB, op *zsetOperation) (*SortedSet.SortedSet, reply.ErrorReply)
+
+func zsetCalculate(db *DB, args [][]byte, cmdName string, calculate zsetCalculator, withWeights bool) redis.Reply {
+	op, errReply := parseZSetOperation(cmdName, args, withWeights, true)
+	if errReply != nil {
+		return errReply
+	}
+	result, errReply := calculate(db, op)
+	if errReply != nil {
+		return errReply
+	}
+	return zsetElementsReply(result.Range(0, result.Len(), false), op.withScores)
+}
+
+func zsetCalculateStore(db *DB, args [][]byte, cmdName string, calculate zsetCalculator, withWeights bool) redis.Reply {
+	dest := string(args[0])
+	op, errReply := parseZSetOperation(cmdName, args[1:], withWeights, false)
+	if errReply != nil {
+		return errReply
+	}
+	result, errReply := calculate(db, op)
+	if errReply != nil {
+		return errReply
+	}
+	db.Remove(dest) // clean ttl and old value
+	if result.Len() > 0 {
+		db.PutEntity(dest, &redis.DataEntity{
+			Data: result,
+		})
+	}
+	db.addAof(utils.ToCmdLine3(cmdName, args...))
+	return reply.MakeIntReply(result.Len())
+}
+
+// execZUnion ZUNION numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func execZUnion(db *DB, args [][]byte) redis.Reply {
+	return zsetCalculate(db, args, "zunion", (*DB).zsetUnion, true)
+}
+
+// execZUnionStore ZUNIONSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]
+func execZUnionStore(db *DB, args [][]byte) redis.Reply {
+	return zsetCalculateStore(db, args, "zunionstore", (*DB).zsetUnion, true)
+}
+
+// execZInter ZINTER numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func execZInter(db *DB, args [][]byte) redis.Reply {
+	return zsetCalculate(db, args, "zinter", (*DB).zsetInter, true)
+}
+
+// execZInterStore ZINTERSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]
+func execZInterStore(db *DB, args [][]byte) redis.Reply {
+	return zsetCalculateStore(db, args, "zinterstore", (*DB).zsetInter, true)
+}
+
+// execZDiff ZDIFF numkeys key [key ...] [WITHSCORES]
+func execZDiff(db *DB, args [][]byte) redis.Reply {
+	return zsetCalculate(db, args, "zdiff", (*DB).zsetDiff, false)
+}
+
+// execZDiffStore ZDIFFSTORE destination numkeys key [key ...]
+func execZDiffStore(db *DB, args [][]byte) redis.Reply {
+	return zsetCalculateStore(db, args, "zdiffstore", (*DB).zsetDiff, false)
+}
+
+// prepareZSetCalculate numkeys key [key ...] ...
+func prepareZSetCalculate(args [][]byte) ([]string, []string) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 || numKeys > len(args)-1 {
+		return nil, nil
+	}
+	keys := make([]string, numKeys)
+	for i := range keys {
+		keys[i] = string(args[i+1])
+	}
+	return nil, keys
+}
+
+// prepareZSetCalculateStore destination numkeys key [key ...] ...
+func prepareZSetCalculateStore(args [][]byte) ([]string, []string) {
+	_, keys := prepareZSetCalculate(args[1:])
+	return []string{string(args[0])}, keys
+}
+
+// popSortedSet 弹出 score 最小或最大的 count 个成员, 并以 ZREM 写入 AOF
+func (db *DB) popSortedSet(key string, count int, max bool) ([]*SortedSet.Element, reply.ErrorReply) {
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil || sortedSet == nil {
+		return nil, errReply
+	}
+	var popped []*SortedSet.Element
+	if max {
+		popped = sortedSet.PopMax(count)
+	} else {
+		popped = sortedSet.PopMin(count)
+	}
+	if len(popped) == 0 {
+		return nil, nil
+	}
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+	}
+	members := make([]string, len(popped))
+	for i, element := range popped {
+		members[i] = element.Member
+	}
+	db.addAof(utils.ToCmdLine2("zrem", append([]string{key}, members...)...))
+	return popped, nil
+}
+
+// execZPop ZPOPMIN/ZPOPMAX key [count]
+func execZPop(db *DB, args [][]byte, max bool) redis.Reply {
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	count := 1
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.Atoi(string(args[1]))
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		if count < 0 {
+			return reply.MakeErrReply("ERR value is out of range, must be positive")
+		}
+	}
+	popped, errReply := db.popSortedSet(string(args[0]), count, max)
+	if errReply != nil {
+		return errReply
+	}
+	return zsetElementsReply(popped, true)
+}
+
+func execZPopMin(db *DB, args [][]byte) redis.Reply {
+	return execZPop(db, args, false)
+}
+
+func execZPopMax(db *DB, args [][]byte) redis.Reply {
+	return execZPop(db, args, true)
+}
+
+// execBZPop BZPOPMIN/BZPOPMAX key [key ...] timeout
+// 弹出第一个非空有序集合的成员, 所有 key 都为空时返回空回复, 由 MultiDB 负责阻塞等待
+func execBZPop(db *DB, args [][]byte, max bool) redis.Reply {
+	if _, errReply := parseBlockingTimeout(args[len(args)-1]); errReply != nil {
+		return errReply
+	}
+	for _, arg := range args[:len(args)-1] {
+		popped, errReply := db.popSortedSet(string(arg), 1, max)
+		if errReply != nil {
+			return errReply
+		}
+		if len(popped) == 0 {
+			continue
+		}
+		return reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeBulkReply(arg),
+			reply.MakeBulkReply([]byte(popped[0].Member)),
+			reply.MakeDoubleReply(popped[0].Score),
+		})
+	}
+	return reply.MakeNullMultiBulkReply()
+}
+
+func execBZPopMin(db *DB, args [][]byte) redis.Reply {
+	return execBZPop(db, args, false)
+}
+
+func execBZPopMax(db *DB, args [][]byte) redis.Reply {
+	return execBZPop(db, args, true)
+}
+
+func prepareBZPop(args [][]byte) ([]string, []string) {
+	return writeAllKeys(args[:len(args)-1])
+}
+
+func undoBZPop(db *DB, args [][]byte) [][][]byte {
+	keys, _ := prepareBZPop(args)
+	return rollbackGivenKeys(db, keys...)
+}
+
+// parseZSetWhere 解析 MIN|MAX, MAX 返回 true
+func parseZSetWhere(arg []byte) (bool, reply.ErrorReply) {
+	switch strings.ToUpper(string(arg)) {
+	case "MIN":
+		return false, nil
+	case "MAX":
+		return true, nil
+	}
+	return false, reply.MakeSyntaxErrReply()
+}
+
+// execZMPop ZMPOP numkeys key [key ...] MIN | MAX [COUNT count]
+func execZMPop(db *DB, args [][]byte) redis.Reply {
+	keys, max, count, errReply := parseMPop(args, parseZSetWhere)
+	if errReply != nil {
+		return errReply
+	}
+	for _, key := range keys {
+		popped, errReply := db.popSortedSet(key, count, max)
+		if errReply != nil {
+			return errReply
+		}
+		if len(popped) == 0 {
+			continue
+		}
+		elements := make([]redis.Reply, len(popped))
+		for i, element := range popped {
+			elements[i] = reply.MakeMultiRawReply([]redis.Reply{
+				reply.MakeBulkReply([]byte(element.Member)),
+				reply.MakeDoubleReply(element.Score),
+			})
+		}
+		return reply.MakeMultiRawReply([]redis.Reply{
+			reply.MakeBulkReply([]byte(key)),
+			reply.MakeMultiRawReply(elements),
+		})
+	}
+	return reply.MakeNullMultiBulkReply()
+}
+
+// execBZMPop BZMPOP timeout numkeys key [key ...] MIN | MAX [COUNT count]
+func execBZMPop(db *DB, args [][]byte) redis.Reply {
+	if _, errReply := parseBlockingTimeout(args[0]); errReply != nil {
+		return errReply
+	}
+	return execZMPop(db, args[1:])
+}
+
+func prepareZMPop(args [][]byte) ([]string, []string) {
+	keys, _, _, errReply := parseMPop(args, parseZSetWhere)
+	if errReply != nil {
+		return nil, nil
+	}
+	return keys, nil
+}
+
+func undoZMPop(db *DB, args [][]byte) [][][]byte {
+	keys, _ := prepareZMPop(args)
+	return rollbackGivenKeys(db, keys...)
+}
+
+func prepareBZMPop(args [][]byte) ([]string, []string) {
+	return prepareZMPop(args[1:])
+}
+
+func undoBZMPop(db *DB, args [][]byte) [][][]byte {
+	return undoZMPop(db, args[1:])
+}
+
+// execZMScore gets scores of members in sortedset
+func execZMScore(db *DB, args [][]byte) redis.Reply {
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]redis.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		result[i] = &reply.NullBulkReply{}
+		if sortedSet == nil {
+			continue
+		}
+		if element, exists := sortedSet.Get(string(member)); exists {
+			result[i] = reply.MakeDoubleReply(element.Score)
+		}
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// execZRandMember ZRANDMEMBER key [count [WITHSCORES]], count 为负数时可能返回重复的成员
+func execZRandMember(db *DB, args [][]byte) redis.Reply {
+	if len(args) > 3 || (len(args) == 3 && !strings.EqualFold(string(args[2]), "WITHSCORES")) {
+		return reply.MakeSyntaxErrReply()
+	}
+	withCount := len(args) >= 2
+	withScores := len(args) == 3
+	count := int64(1)
+	if withCount {
+		var err error
+		count, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		// 与 redis 一致, 取反以及 WITHSCORES 翻倍后的数量不能溢出
+		if count == math.MinInt64 || (withScores && count < -math.MaxInt64/2) {
+			return reply.MakeErrReply("ERR value is out of range")
+		}
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		if !withCount {
+			return &reply.NullBulkReply{}
+		}
+		return &reply.EmptyMultiBulkReply{}
+	}
+	if !withCount {
+		return reply.MakeBulkReply([]byte(sortedSet.RandomMembers(1)[0].Member))
+	}
+	if count == 0 {
+		return &reply.EmptyMultiBulkReply{}
+	}
+	if count > 0 {
+		return zsetElementsReply(sortedSet.RandomDistinctMembers(int(count)), withScores)
+	}
+	return zsetElementsReply(sortedSet.RandomMembers(int(-count)), withScores)
+}
+
+// execZScan ZSCAN key cursor [MATCH pattern] [COUNT count]
+func execZScan(db *DB, args [][]byte) redis.Reply {
+	key := string(args[0])
+	scan, errReply := parseScanArgs(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeScanBulkReply(0, nil)
+	}
+	result := make([][]byte, 0, scan.count*2)
+	next := sortedSet.Scan(scan.cursor, scan.count, func(element *SortedSet.Element) bool {
+		if !scan.isMatch(element.Member) {
+			return true
+		}
+		score := reply.MakeDoubleReply(element.Score).String()
+		result = append(result, []byte(element.Member), []byte(score))
+		return true
+	})
+	return reply.MakeScanBulkReply(int(next), result)
+}
+
 func init() {
 	RegisterCommand(cmd.ZAdd, execZAdd, writeFirstKey, undoZAdd, -4)
 	RegisterCommand(cmd.ZScore, execZScore, readFirstKey, nil, 3)
@@ -601,10 +1335,34 @@ func init() {
 	RegisterCommand(cmd.ZRange, execZRange, readFirstKey, nil, -4)
 	RegisterCommand(cmd.ZRangeByScore, execZRangeByScore, readFirstKey, nil, -4)
 	RegisterCommand(cmd.ZRange, execZRange, readFirstKey, nil, -4)
+	RegisterCommand(cmd.ZRangeStore, execZRangeStore, prepareZRangeStore, rollbackFirstKey, -5)
 	RegisterCommand(cmd.ZRevRange, execZRevRange, readFirstKey, nil, -4)
 	RegisterCommand(cmd.ZRangeByScore, execZRangeByScore, readFirstKey, nil, -4)
 	RegisterCommand(cmd.ZRevRangeByScore, execZRevRangeByScore, readFirstKey, nil, -4)
 	RegisterCommand(cmd.ZRem, execZRem, writeFirstKey, undoZRem, -3)
 	RegisterCommand(cmd.ZRemRangeByScore, execZRemRangeByScore, writeFirstKey, rollbackFirstKey, 4)
 	RegisterCommand(cmd.ZRemRangeByRank, execZRemRangeByRank, writeFirstKey, rollbackFirstKey, 4)
+	RegisterCommand(cmd.ZRemRangeByLex, execZRemRangeByLex, writeFirstKey, rollbackFirstKey, 4)
+	RegisterCommand(cmd.ZRangeByLex, execZRangeByLex, readFirstKey, nil, -4)
+	RegisterCommand(cmd.ZRevRangeByLex, execZRevRangeByLex, readFirstKey, nil, -4)
+	RegisterCommand(cmd.ZLexCount, execZLexCount, readFirstKey, nil, 4)
+	RegisterCommand(cmd.ZUnion, execZUnion, prepareZSetCalculate, nil, -3)
+	RegisterCommand(cmd.ZUnionStore, execZUnionStore, prepareZSetCalculateStore, rollbackFirstKey, -4)
+	RegisterCommand(cmd.ZInter, execZInter, prepareZSetCalculate, nil, -3)
+	RegisterCommand(cmd.ZInterStore, execZInterStore, prepareZSetCalculateStore, rollbackFirstKey, -4)
+	RegisterCommand(cmd.ZDiff, execZDiff, prepareZSetCalculate, nil, -3)
+	RegisterCommand(cmd.ZDiffStore, execZDiffStore, prepareZSetCalculateStore, rollbackFirstKey, -4)
+	RegisterCommand(cmd.ZPopMin, execZPopMin, writeFirstKey, rollbackFirstKey, -2)
+	RegisterCommand(cmd.ZPopMax, execZPopMax, writeFirstKey, rollbackFirstKey, -2)
+	RegisterCommand(cmd.ZMPop, execZMPop, prepareZMPop, undoZMPop, -4)
+	RegisterCommand(cmd.BZPopMin, execBZPopMin, prepareBZPop, undoBZPop, -3)
+	RegisterCommand(cmd.BZPopMax, execBZPopMax, prepareBZPop, undoBZPop, -3)
+	RegisterCommand(cmd.BZMPop, execBZMPop, prepareBZMPop, undoBZMPop, -5)
+	RegisterCommand(cmd.ZMScore, execZMScore, readFirstKey, nil, -3)
+	RegisterCommand(cmd.ZRandMember, execZRandMember, readFirstKey, nil, -2)
+	RegisterCommand(cmd.ZScan, execZScan, readFirstKey, nil, -3)
+	registerBlocking(cmd.BZPopMin, &blockingSpec{timeout: timeoutAt(-1)})
+	registerBlocking(cmd.BZPopMax, &blockingSpec{timeout: timeoutAt(-1)})
+	registerBlocking(cmd.BZMPop, &blockingSpec{timeout: timeoutAt(0)})
+	markAllowOOM(cmd.ZRem, cmd.ZRemRangeByScore, cmd.ZRemRangeByRank, cmd.ZRemRangeByLex, cmd.ZPopMin, cmd.ZPopMax, cmd.ZMPop, cmd.BZPopMin, cmd.BZPopMax, cmd.BZMPop)
 }
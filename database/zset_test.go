@@ -0,0 +1,106 @@
+package database
+
+import (
+	"gedis/pkg/utils"
+	"gedis/types/redis/connection"
+	"net"
+	"testing"
+)
+
+func TestZSetCommands(t *testing.T) {
+	db := makeDB()
+	cases := []cmdCase{
+		{[]string{"ZADD", "z1", "1", "a", "2", "b", "3", "c"}, ":3\r\n"},
+		{[]string{"ZADD", "z2", "10", "b", "20", "c", "30", "d"}, ":3\r\n"},
+		{[]string{"SADD", "s", "a", "d"}, ":2\r\n"},
+		{[]string{"ZUNION", "2", "z1", "z2", "WITHSCORES"}, "*8\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$2\r\n12\r\n$1\r\nc\r\n$2\r\n23\r\n$1\r\nd\r\n$2\r\n30\r\n"},
+		{[]string{"ZINTERSTORE", "dst", "2", "z1", "z2", "WEIGHTS", "2", "1", "AGGREGATE", "MAX"}, ":2\r\n"},
+		{[]string{"ZRANGE", "dst", "0", "-1", "WITHSCORES"}, "*4\r\n$1\r\nb\r\n$2\r\n10\r\n$1\r\nc\r\n$2\r\n20\r\n"},
+		{[]string{"ZINTER", "2", "z1", "s"}, "*1\r\n$1\r\na\r\n"},
+		{[]string{"ZDIFF", "3", "z1", "z2", "nil"}, "*1\r\n$1\r\na\r\n"},
+		{[]string{"ZDIFFSTORE", "dst", "2", "z1", "z1"}, ":0\r\n"},
+		{[]string{"EXISTS", "dst"}, ":0\r\n"},
+		{[]string{"ZUNION", "0", "z1"}, "-ERR at least 1 input key is needed for 'zunion' command\r\n"},
+		{[]string{"ZADD", "lex", "0", "a", "0", "b", "0", "c", "0", "d"}, ":4\r\n"},
+		{[]string{"ZRANGEBYLEX", "lex", "(a", "[c"}, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"ZREVRANGEBYLEX", "lex", "+", "-", "LIMIT", "1", "2"}, "*2\r\n$1\r\nc\r\n$1\r\nb\r\n"},
+		{[]string{"ZLEXCOUNT", "lex", "[b", "+"}, ":3\r\n"},
+		{[]string{"ZRANGEBYLEX", "lex", "b", "+"}, "-ERR min or max not valid string range item\r\n"},
+		{[]string{"ZREMRANGEBYLEX", "lex", "-", "(c"}, ":2\r\n"},
+		{[]string{"ZPOPMIN", "z1"}, "*2\r\n$1\r\na\r\n$1\r\n1\r\n"},
+		{[]string{"ZPOPMAX", "z1", "5"}, "*4\r\n$1\r\nc\r\n$1\r\n3\r\n$1\r\nb\r\n$1\r\n2\r\n"},
+		{[]string{"EXISTS", "z1"}, ":0\r\n"},
+		{[]string{"ZMSCORE", "z2", "b", "x"}, "*2\r\n$2\r\n10\r\n$-1\r\n"},
+		{[]string{"ZSCAN", "z2", "0", "MATCH", "c"}, "*2\r\n$1\r\n0\r\n*2\r\n$1\r\nc\r\n$2\r\n20\r\n"},
+		{[]string{"ZREMRANGEBYLEX", "lex", "[d", "+"}, ":1\r\n"},
+		{[]string{"ZRANDMEMBER", "lex", "-2"}, "*2\r\n$1\r\nc\r\n$1\r\nc\r\n"},
+		{[]string{"ZRANDMEMBER", "lex", "5", "WITHSCORES"}, "*2\r\n$1\r\nc\r\n$1\r\n0\r\n"},
+		{[]string{"ZRANDMEMBER", "lex", "-9223372036854775808"}, "-ERR value is out of range\r\n"},
+		{[]string{"ZRANDMEMBER", "lex", "-9223372036854775807", "WITHSCORES"}, "-ERR value is out of range\r\n"},
+		{[]string{"ZUNIONSTORE", "dst", "2", "z1", "z2", "WEIGHTS", "nan", "1"}, "-ERR weight value is not a float\r\n"},
+		{[]string{"ZMPOP", "2", "nil", "z2", "MAX", "COUNT", "2"}, "*2\r\n$2\r\nz2\r\n*2\r\n*2\r\n$1\r\nd\r\n$2\r\n30\r\n*2\r\n$1\r\nc\r\n$2\r\n20\r\n"},
+		{[]string{"BZPOPMIN", "nil", "z2", "0"}, "*3\r\n$2\r\nz2\r\n$1\r\nb\r\n$2\r\n10\r\n"},
+		{[]string{"BZMPOP", "0", "1", "z2", "MIN"}, "*-1\r\n"},
+		{[]string{"BZPOPMAX", "z2", "-1"}, "-ERR timeout is negative\r\n"},
+	}
+	runCases(t, db, cases)
+}
+
+func TestZRange(t *testing.T) {
+	db := makeDB()
+	cases := []cmdCase{
+		{[]string{"ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d"}, ":4\r\n"},
+		{[]string{"ZRANGE", "z", "-2", "-1"}, "*2\r\n$1\r\nc\r\n$1\r\nd\r\n"},
+		{[]string{"ZRANGE", "z", "0", "1", "REV", "WITHSCORES"}, "*4\r\n$1\r\nd\r\n$1\r\n4\r\n$1\r\nc\r\n$1\r\n3\r\n"},
+		{[]string{"ZRANGE", "z", "(1", "+inf", "BYSCORE", "LIMIT", "1", "2"}, "*2\r\n$1\r\nc\r\n$1\r\nd\r\n"},
+		{[]string{"ZRANGE", "z", "3", "-inf", "BYSCORE", "REV"}, "*3\r\n$1\r\nc\r\n$1\r\nb\r\n$1\r\na\r\n"},
+		{[]string{"ZRANGE", "z", "[b", "(d", "BYLEX"}, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"ZRANGE", "z", "+", "-", "BYLEX", "REV", "LIMIT", "0", "1"}, "*1\r\n$1\r\nd\r\n"},
+		{[]string{"ZRANGE", "z", "0", "1", "LIMIT", "0", "1"}, "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n"},
+		{[]string{"ZRANGE", "z", "-", "+", "BYLEX", "WITHSCORES"}, "-ERR syntax error, WITHSCORES not supported in combination with BYLEX\r\n"},
+		{[]string{"ZRANGESTORE", "dst", "z", "2", "3", "BYSCORE"}, ":2\r\n"},
+		{[]string{"ZRANGE", "dst", "0", "-1", "WITHSCORES"}, "*4\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$1\r\n3\r\n"},
+		{[]string{"ZRANGESTORE", "dst", "z", "5", "-1"}, ":0\r\n"},
+		{[]string{"EXISTS", "dst"}, ":0\r\n"},
+		{[]string{"ZRANGESTORE", "dst", "z", "0", "1", "WITHSCORES"}, "-Err syntax error\r\n"},
+	}
+	runCases(t, db, cases)
+}
+
+func TestBZPopMinWakeUp(t *testing.T) {
+	mdb := makeBlockingMultiDB()
+	db := mdb.dbSet[0]
+	ch := execAsync(mdb, &connection.FakeConn{}, "BZPOPMIN", "z1", "z2", "0")
+	waitBlocked(t, db, 1)
+	mdb.Exec(&connection.FakeConn{}, utils.ToCmdLine("ZADD", "z2", "2", "b", "1", "a"))
+	waitReply(t, ch, "*3\r\n$2\r\nz2\r\n$1\r\na\r\n$1\r\n1\r\n")
+	waitBlocked(t, db, 0)
+	result := mdb.Exec(&connection.FakeConn{}, utils.ToCmdLine("ZRANGE", "z2", "0", "-1"))
+	if actual := string(result.ToBytes()); actual != "*1\r\n$1\r\nb\r\n" {
+		t.Errorf("expect z2 [b], actual %q", actual)
+	}
+}
+
+func TestBZPopMinDisconnect(t *testing.T) {
+	mdb := makeBlockingMultiDB()
+	db := mdb.dbSet[0]
+	_, server := net.Pipe()
+	c := connection.NewConn(server)
+	ch := execAsync(mdb, c, "BZPOPMIN", "z", "0")
+	waitBlocked(t, db, 1)
+	_ = c.Close()
+	mdb.AfterClientClose(c)
+	waitReply(t, ch, "*-1\r\n")
+	waitBlocked(t, db, 0)
+	db.blocking.mu.Lock()
+	waiters, clients := len(db.blocking.waiters), len(db.blocking.clients)
+	db.blocking.mu.Unlock()
+	if waiters != 0 || clients != 0 {
+		t.Errorf("expect waiter removed, actual %d keys and %d clients", waiters, clients)
+	}
+	mdb.Exec(&connection.FakeConn{}, utils.ToCmdLine("ZADD", "z", "1", "a"))
+	result := mdb.Exec(&connection.FakeConn{}, utils.ToCmdLine("ZCARD", "z"))
+	if actual := string(result.ToBytes()); actual != ":1\r\n" {
+		t.Errorf("expect zset untouched, actual %q", actual)
+	}
+}
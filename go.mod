@@ -2,7 +2,13 @@ module gedis
 
 go 1.17
 
-require github.com/go-redis/redis/v8 v8.11.4
+require (
+	github.com/go-redis/redis/v8 v8.11.4
+	github.com/spf13/viper v1.10.1
+	github.com/syndtr/goleveldb v1.0.0
+	github.com/yuin/gopher-lua v1.1.1
+	go.uber.org/zap v1.19.1
+)
 
 require (
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
@@ -17,12 +23,9 @@ require (
 	github.com/spf13/cast v1.4.1 // indirect
 	github.com/spf13/jwalterweatherman v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	github.com/spf13/viper v1.10.1 // indirect
 	github.com/subosito/gotenv v1.2.0 // indirect
-	github.com/syndtr/goleveldb v1.0.0 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
 	go.uber.org/multierr v1.6.0 // indirect
-	go.uber.org/zap v1.19.1 // indirect
 	golang.org/x/sys v0.0.0-20211210111614-af8b64212486 // indirect
 	golang.org/x/text v0.3.7 // indirect
 	gopkg.in/ini.v1 v1.66.2 // indirect
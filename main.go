@@ -17,6 +17,7 @@ func init() {
 	flag.StringVar(&host, "host", "", "server listen host")
 	flag.StringVar(&port, "port", config.Get().Server.Port, "server listen port")
 	flag.Parse()
+	config.Get().Server.Port = port // 复制握手时向主节点上报实际监听端口
 }
 
 func main() {
@@ -0,0 +1,9 @@
+package crc16
+
+import "testing"
+
+func TestChecksum(t *testing.T) {
+	if crc := Checksum([]byte("123456789")); crc != 0x31C3 {
+		t.Errorf("expect 0x31C3, got %#x", crc)
+	}
+}
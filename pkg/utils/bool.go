@@ -17,3 +17,15 @@ func (b *Boolean) Set(v bool) {
 		atomic.StoreUint32((*uint32)(b), 0)
 	}
 }
+
+// CompareAndSet sets the value to new only if it currently equals old
+func (b *Boolean) CompareAndSet(old, new bool) bool {
+	var o, n uint32
+	if old {
+		o = 1
+	}
+	if new {
+		n = 1
+	}
+	return atomic.CompareAndSwapUint32((*uint32)(b), o, n)
+}
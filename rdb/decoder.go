@@ -0,0 +1,256 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"gedis/types/dict"
+	List "gedis/types/list"
+	"gedis/types/redis"
+	"gedis/types/set"
+	SortedSet "gedis/types/zset"
+	"hash/crc64"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// EachEntity 解码出一个 key 时的回调, 返回 false 停止解码
+type EachEntity func(dbIndex int, key string, entity *redis.DataEntity, expiration *time.Time) bool
+
+type decoder struct {
+	r   io.Reader
+	buf [8]byte
+}
+
+// ReadByte implements io.ByteReader for binary.ReadUvarint
+func (dec *decoder) ReadByte() (byte, error) {
+	_, err := io.ReadFull(dec.r, dec.buf[:1])
+	return dec.buf[0], err
+}
+
+// Parse 解码快照, 按文件顺序对每个 key 调用 cb
+func Parse(reader io.Reader, cb EachEntity) error {
+	crc := crc64.New(crcTable)
+	dec := &decoder{
+		r: io.TeeReader(bufio.NewReader(reader), crc),
+	}
+
+	header := make([]byte, len(magic)+len(version))
+	if _, err := io.ReadFull(dec.r, header); err != nil {
+		return err
+	}
+	if string(header) != magic+version {
+		return errBadMagic
+	}
+
+	dbIndex := 0
+	var expiration *time.Time
+	for {
+		op, err := dec.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case opEOF:
+			sum := crc.Sum64()
+			if _, err := io.ReadFull(dec.r, dec.buf[:8]); err != nil {
+				return err
+			}
+			if binary.LittleEndian.Uint64(dec.buf[:8]) != sum {
+				return errBadChecksum
+			}
+			return nil
+		case opSelectDB:
+			n, err := dec.readLen()
+			if err != nil {
+				return err
+			}
+			dbIndex = int(n)
+		case opExpireMs:
+			ms, err := dec.readInt64()
+			if err != nil {
+				return err
+			}
+			expireAt := time.Unix(0, ms*int64(time.Millisecond))
+			expiration = &expireAt
+		default:
+			key, err := dec.readString()
+			if err != nil {
+				return err
+			}
+			entity, err := dec.readValue(op)
+			if err != nil {
+				return err
+			}
+			if !cb(dbIndex, key, entity, expiration) {
+				return nil
+			}
+			expiration = nil
+		}
+	}
+}
+
+// DecodeEntity 解码 EncodeEntity 生成的数据
+func DecodeEntity(data []byte) (*redis.DataEntity, *time.Time, error) {
+	dec := &decoder{r: bytes.NewReader(data)}
+	typ, err := dec.ReadByte()
+	if err != nil {
+		return nil, nil, err
+	}
+	var expiration *time.Time
+	if typ == opExpireMs {
+		ms, err := dec.readInt64()
+		if err != nil {
+			return nil, nil, err
+		}
+		expireAt := time.Unix(0, ms*int64(time.Millisecond))
+		expiration = &expireAt
+		if typ, err = dec.ReadByte(); err != nil {
+			return nil, nil, err
+		}
+	}
+	entity, err := dec.readValue(typ)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entity, expiration, nil
+}
+
+func (dec *decoder) readValue(typ byte) (*redis.DataEntity, error) {
+	switch typ {
+	case typeString:
+		val, err := dec.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		return &redis.DataEntity{Data: val}, nil
+	case typeList:
+		size, err := dec.readLen()
+		if err != nil {
+			return nil, err
+		}
+		list := List.MakeQuickList()
+		for i := uint64(0); i < size; i++ {
+			val, err := dec.readBytes()
+			if err != nil {
+				return nil, err
+			}
+			list.Add(val)
+		}
+		return &redis.DataEntity{Data: list}, nil
+	case typeSet:
+		size, err := dec.readLen()
+		if err != nil {
+			return nil, err
+		}
+		s := set.Make()
+		for i := uint64(0); i < size; i++ {
+			member, err := dec.readString()
+			if err != nil {
+				return nil, err
+			}
+			s.Add(member)
+		}
+		return &redis.DataEntity{Data: s}, nil
+	case typeHash:
+		size, err := dec.readLen()
+		if err != nil {
+			return nil, err
+		}
+		hash := dict.MakeListpack()
+		for i := uint64(0); i < size; i++ {
+			field, err := dec.readString()
+			if err != nil {
+				return nil, err
+			}
+			val, err := dec.readBytes()
+			if err != nil {
+				return nil, err
+			}
+			hash.Put(field, val)
+		}
+		return &redis.DataEntity{Data: hash}, nil
+	case typeHashTTL:
+		hash, err := dec.readHashWithTTL()
+		if err != nil {
+			return nil, err
+		}
+		return &redis.DataEntity{Data: hash}, nil
+	case typeZSet:
+		size, err := dec.readLen()
+		if err != nil {
+			return nil, err
+		}
+		zset := SortedSet.Make()
+		for i := uint64(0); i < size; i++ {
+			member, err := dec.readString()
+			if err != nil {
+				return nil, err
+			}
+			score, err := dec.readFloat()
+			if err != nil {
+				return nil, err
+			}
+			zset.Add(member, score)
+		}
+		return &redis.DataEntity{Data: zset}, nil
+	case typeStream:
+		s, err := dec.readStream()
+		if err != nil {
+			return nil, err
+		}
+		return &redis.DataEntity{Data: s}, nil
+	}
+	return nil, errors.New("rdb: unknown value type " + strconv.Itoa(int(typ)))
+}
+
+func (dec *decoder) readInt64() (int64, error) {
+	if _, err := io.ReadFull(dec.r, dec.buf[:8]); err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(dec.buf[:8])), nil
+}
+
+func (dec *decoder) readFloat() (float64, error) {
+	n, err := dec.readInt64()
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(uint64(n)), nil
+}
+
+// readLen 读取长度或元素数量, 文件损坏时长度可能任意大, 超出范围时返回错误
+func (dec *decoder) readLen() (uint64, error) {
+	n, err := binary.ReadUvarint(dec)
+	if err != nil {
+		return 0, err
+	}
+	if n > maxLen {
+		return 0, errBadLength
+	}
+	return n, nil
+}
+
+// readBytes 不按长度预先分配内存, 数据被截断时只会分配实际读到的大小
+func (dec *decoder) readBytes() ([]byte, error) {
+	size, err := dec.readLen()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, dec.r, int64(size)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (dec *decoder) readString() (string, error) {
+	val, err := dec.readBytes()
+	return string(val), err
+}
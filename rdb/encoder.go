@@ -0,0 +1,213 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"gedis/types/dict"
+	List "gedis/types/list"
+	"gedis/types/redis"
+	"gedis/types/set"
+	"gedis/types/stream"
+	SortedSet "gedis/types/zset"
+	"hash"
+	"hash/crc64"
+	"io"
+	"math"
+	"time"
+)
+
+// Encoder 将数据库内容顺序写为快照
+type Encoder struct {
+	w   *bufio.Writer
+	crc hash.Hash64
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+// NewEncoder creates an Encoder writing to w
+func NewEncoder(w io.Writer) *Encoder {
+	crc := crc64.New(crcTable)
+	return &Encoder{
+		w:   bufio.NewWriter(io.MultiWriter(w, crc)),
+		crc: crc,
+	}
+}
+
+// WriteHeader 写入文件头
+func (enc *Encoder) WriteHeader() error {
+	enc.writeRaw([]byte(magic + version))
+	return enc.err
+}
+
+// WriteDB 写入切换数据库标记, 之后的数据属于该数据库
+func (enc *Encoder) WriteDB(dbIndex int) error {
+	enc.writeByte(opSelectDB)
+	enc.writeLen(uint64(dbIndex))
+	return enc.err
+}
+
+// WriteEntity 写入一个 key 及其过期时间
+func (enc *Encoder) WriteEntity(key string, entity *redis.DataEntity, expiration *time.Time) error {
+	typ, ok := typeOf(entity)
+	if !ok {
+		return errors.New("rdb: unsupported data type of key " + key)
+	}
+	if expiration != nil {
+		enc.writeByte(opExpireMs)
+		enc.writeInt64(expiration.UnixNano() / 1e6)
+	}
+	enc.writeByte(typ)
+	enc.writeString(key)
+	enc.writeValue(entity)
+	return enc.err
+}
+
+// EncodeEntity 编码单个值及其过期时间(不含 key), 供按 key 存储的引擎使用
+func EncodeEntity(entity *redis.DataEntity, expiration *time.Time) ([]byte, error) {
+	typ, ok := typeOf(entity)
+	if !ok {
+		return nil, errors.New("rdb: unsupported data type")
+	}
+	var buf bytes.Buffer
+	enc := &Encoder{w: bufio.NewWriter(&buf)}
+	if expiration != nil {
+		enc.writeByte(opExpireMs)
+		enc.writeInt64(expiration.UnixNano() / 1e6)
+	}
+	enc.writeByte(typ)
+	enc.writeValue(entity)
+	if enc.err != nil {
+		return nil, enc.err
+	}
+	if err := enc.w.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func typeOf(entity *redis.DataEntity) (byte, bool) {
+	switch entity.Data.(type) {
+	case []byte:
+		return typeString, true
+	case List.List:
+		return typeList, true
+	case *set.Set:
+		return typeSet, true
+	case dict.Dict:
+		if hasFieldExpire(entity.Data.(dict.Dict)) {
+			return typeHashTTL, true
+		}
+		return typeHash, true
+	case *SortedSet.SortedSet:
+		return typeZSet, true
+	case *stream.Stream:
+		return typeStream, true
+	}
+	return 0, false
+}
+
+func (enc *Encoder) writeValue(entity *redis.DataEntity) {
+	switch val := entity.Data.(type) {
+	case []byte:
+		enc.writeBytes(val)
+	case List.List:
+		enc.writeLen(uint64(val.Len()))
+		val.ForEach(func(i int, v interface{}) bool {
+			bytes, _ := v.([]byte)
+			enc.writeBytes(bytes)
+			return enc.err == nil
+		})
+	case *set.Set:
+		enc.writeLen(uint64(val.Len()))
+		val.ForEach(func(member string) bool {
+			enc.writeString(member)
+			return enc.err == nil
+		})
+	case dict.Dict:
+		if hasFieldExpire(val) {
+			enc.writeHashWithTTL(val.(dict.Expirable))
+			return
+		}
+		enc.writeLen(uint64(val.Len()))
+		val.ForEach(func(field string, v interface{}) bool {
+			bytes, _ := v.([]byte)
+			enc.writeString(field)
+			enc.writeBytes(bytes)
+			return enc.err == nil
+		})
+	case *SortedSet.SortedSet:
+		enc.writeLen(uint64(val.Len()))
+		if val.Len() > 0 {
+			val.ForEach(0, val.Len(), false, func(element *SortedSet.Element) bool {
+				enc.writeString(element.Member)
+				enc.writeFloat(element.Score)
+				return enc.err == nil
+			})
+		}
+	case *stream.Stream:
+		enc.writeStream(val)
+	}
+}
+
+// WriteEnd 写入结束标记和校验和, 并刷新缓冲
+func (enc *Encoder) WriteEnd() error {
+	enc.writeByte(opEOF)
+	if enc.err != nil {
+		return enc.err
+	}
+	if err := enc.w.Flush(); err != nil {
+		return err
+	}
+	// 先刷新缓冲, 保证校验和覆盖之前写入的全部数据
+	var sum [8]byte
+	binary.LittleEndian.PutUint64(sum[:], enc.crc.Sum64())
+	enc.writeRaw(sum[:])
+	if enc.err != nil {
+		return enc.err
+	}
+	return enc.w.Flush()
+}
+
+func (enc *Encoder) writeRaw(p []byte) {
+	if enc.err != nil {
+		return
+	}
+	_, enc.err = enc.w.Write(p)
+}
+
+func (enc *Encoder) writeByte(b byte) {
+	if enc.err != nil {
+		return
+	}
+	enc.err = enc.w.WriteByte(b)
+}
+
+func (enc *Encoder) writeLen(n uint64) {
+	size := binary.PutUvarint(enc.buf[:], n)
+	enc.writeRaw(enc.buf[:size])
+}
+
+func (enc *Encoder) writeInt64(n int64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(n))
+	enc.writeRaw(b[:])
+}
+
+func (enc *Encoder) writeFloat(f float64) {
+	enc.writeInt64(int64(math.Float64bits(f)))
+}
+
+func (enc *Encoder) writeBytes(p []byte) {
+	enc.writeLen(uint64(len(p)))
+	enc.writeRaw(p)
+}
+
+func (enc *Encoder) writeString(s string) {
+	enc.writeLen(uint64(len(s)))
+	if enc.err != nil {
+		return
+	}
+	_, enc.err = enc.w.WriteString(s)
+}
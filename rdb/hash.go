@@ -0,0 +1,66 @@
+package rdb
+
+import (
+	"gedis/types/dict"
+	"time"
+)
+
+// hasFieldExpire 判断 hash 是否有设置了过期时间的 field
+func hasFieldExpire(hash dict.Dict) bool {
+	expirable, ok := hash.(dict.Expirable)
+	if !ok {
+		return false
+	}
+	_, ok = expirable.NextExpireTime()
+	return ok
+}
+
+// writeHashWithTTL 每个 field 之后写入毫秒级过期时间, 0 表示不过期
+func (enc *Encoder) writeHashWithTTL(hash dict.Expirable) {
+	// 先收集 field, 避免写入长度后有 field 过期
+	var fields []string
+	var values [][]byte
+	hash.ForEach(func(field string, v interface{}) bool {
+		bytes, _ := v.([]byte)
+		fields = append(fields, field)
+		values = append(values, bytes)
+		return true
+	})
+	enc.writeLen(uint64(len(fields)))
+	for i, field := range fields {
+		enc.writeString(field)
+		enc.writeBytes(values[i])
+		ms := int64(0)
+		if expireTime, ok := hash.ExpireTime(field); ok {
+			ms = expireTime.UnixNano() / int64(time.Millisecond)
+		}
+		enc.writeInt64(ms)
+	}
+}
+
+func (dec *decoder) readHashWithTTL() (*dict.SimpleDict, error) {
+	size, err := dec.readLen()
+	if err != nil {
+		return nil, err
+	}
+	hash := dict.MakeSimple()
+	for i := uint64(0); i < size; i++ {
+		field, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		val, err := dec.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		ms, err := dec.readInt64()
+		if err != nil {
+			return nil, err
+		}
+		hash.Put(field, val)
+		if ms > 0 {
+			hash.Expire(field, time.Unix(0, ms*int64(time.Millisecond)))
+		}
+	}
+	return hash, nil
+}
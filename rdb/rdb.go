@@ -0,0 +1,44 @@
+// Package rdb 二进制快照(RDB)的编码与解码
+package rdb
+
+import (
+	"errors"
+	"hash/crc64"
+)
+
+const (
+	// DefaultFilename 默认快照文件名
+	DefaultFilename = "gedis.rdb"
+
+	magic   = "GEDIS"
+	version = "0001"
+)
+
+// 操作码, 与数据类型共用一个字节
+const (
+	opExpireMs byte = 0xFC // 毫秒级过期时间, 后跟 8 字节时间戳
+	opSelectDB byte = 0xFE // 切换数据库, 后跟 db index
+	opEOF      byte = 0xFF // 文件结束, 后跟 8 字节校验和
+)
+
+// 数据类型
+const (
+	typeString byte = iota
+	typeList
+	typeSet
+	typeHash
+	typeZSet
+	typeStream
+	typeHashTTL // 带 field 过期时间的 hash
+)
+
+// maxLen 字符串长度及集合元素数量的上限, 与 redis 的 proto-max-bulk-len 一致为 512MB
+const maxLen = 512 << 20
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+var (
+	errBadMagic    = errors.New("rdb: bad magic or unsupported version")
+	errBadChecksum = errors.New("rdb: checksum mismatch")
+	errBadLength   = errors.New("rdb: length out of range")
+)
@@ -0,0 +1,129 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"gedis/types/dict"
+	List "gedis/types/list"
+	"gedis/types/redis"
+	"gedis/types/set"
+	"gedis/types/stream"
+	SortedSet "gedis/types/zset"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	hash := dict.MakeSimple()
+	hash.Put("f1", []byte("v1"))
+	hash.Put("f2", []byte("v2"))
+	zset := SortedSet.Make()
+	zset.Add("m1", 1.5)
+	zset.Add("m2", -3)
+	s := stream.Make()
+	s.Add(stream.ID{Ms: 1, Seq: 1}, [][]byte{[]byte("f"), []byte("v")})
+	s.SetLastID(stream.ID{Ms: 5})
+	group, _ := s.CreateGroup("g", stream.ID{Ms: 1, Seq: 1})
+	group.CreateConsumer("alice", 100)
+	group.AddPending(&stream.PendingEntry{ID: stream.ID{Ms: 1, Seq: 1}, Consumer: "alice", DeliveryTime: 100, DeliveryCount: 2})
+	expireAt := time.Unix(0, time.Now().Add(time.Hour).UnixNano()/1e6*1e6)
+	hash.Expire("f2", expireAt)
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	_ = enc.WriteHeader()
+	_ = enc.WriteDB(0)
+	_ = enc.WriteEntity("str", &redis.DataEntity{Data: []byte("hello")}, &expireAt)
+	_ = enc.WriteEntity("list", &redis.DataEntity{Data: List.MakeQuickList([]byte("a"), []byte("b"))}, nil)
+	_ = enc.WriteDB(3)
+	_ = enc.WriteEntity("set", &redis.DataEntity{Data: set.Make("x", "y")}, nil)
+	_ = enc.WriteEntity("hash", &redis.DataEntity{Data: hash}, nil)
+	_ = enc.WriteEntity("zset", &redis.DataEntity{Data: zset}, nil)
+	_ = enc.WriteEntity("stream", &redis.DataEntity{Data: s}, nil)
+	if err := enc.WriteEnd(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]*redis.DataEntity)
+	err := Parse(bytes.NewReader(buf.Bytes()), func(dbIndex int, key string, entity *redis.DataEntity, expiration *time.Time) bool {
+		if key == "str" && (expiration == nil || !expiration.Equal(expireAt)) {
+			t.Errorf("expiration of str: %v", expiration)
+		}
+		if key != "str" && expiration != nil {
+			t.Errorf("unexpected expiration of %s", key)
+		}
+		if (key == "set" || key == "hash" || key == "zset" || key == "stream") != (dbIndex == 3) {
+			t.Errorf("key %s in db %d", key, dbIndex)
+		}
+		got[key] = entity
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got["str"].Data.([]byte)) != "hello" {
+		t.Error("string mismatch")
+	}
+	if l := got["list"].Data.(List.List); l.Len() != 2 || string(l.Get(1).([]byte)) != "b" {
+		t.Error("list mismatch")
+	}
+	if s := got["set"].Data.(*set.Set); s.Len() != 2 || !s.Has("y") {
+		t.Error("set mismatch")
+	}
+	if v, _ := got["hash"].Data.(dict.Dict).Get("f1"); string(v.([]byte)) != "v1" {
+		t.Error("hash mismatch")
+	}
+	if at, ok := got["hash"].Data.(dict.Expirable).ExpireTime("f2"); !ok || !at.Equal(expireAt) {
+		t.Error("hash field expire time mismatch")
+	}
+	if e, ok := got["zset"].Data.(*SortedSet.SortedSet).Get("m2"); !ok || e.Score != -3 {
+		t.Error("zset mismatch")
+	}
+	st := got["stream"].Data.(*stream.Stream)
+	if g, ok := st.Group("g"); st.Len() != 1 || st.LastID() != (stream.ID{Ms: 5}) || !ok {
+		t.Error("stream mismatch")
+	} else if pe, ok := g.Pending(stream.ID{Ms: 1, Seq: 1}); !ok || pe.Consumer != "alice" || pe.DeliveryCount != 2 {
+		t.Error("stream pending entries mismatch")
+	}
+
+	corrupted := append([]byte{}, buf.Bytes()...)
+	corrupted[len(corrupted)-10] ^= 0xFF
+	err = Parse(bytes.NewReader(corrupted), func(int, string, *redis.DataEntity, *time.Time) bool { return true })
+	if err == nil {
+		t.Error("expect checksum error")
+	}
+}
+
+func TestDecodeBadLength(t *testing.T) {
+	uvarint := func(n uint64) []byte {
+		var buf [binary.MaxVarintLen64]byte
+		return buf[:binary.PutUvarint(buf[:], n)]
+	}
+	// 截断的数据声明了很大的长度, 解码时不能按声明的长度分配内存
+	cases := map[string][]byte{
+		"huge string":     append([]byte{typeString}, uvarint(maxLen+1)...),
+		"truncated":       append(append([]byte{typeString}, uvarint(maxLen)...), 'a'),
+		"huge list":       append([]byte{typeList}, uvarint(1<<62)...),
+		"huge stream":     append(append([]byte{typeStream, 1, 0, 0}, uvarint(1<<40)...), 0),
+		"truncated list":  append([]byte{typeList}, uvarint(1<<20)...),
+		"truncated value": {typeHash, 1, 1, 'f', 0x80},
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for name, data := range cases {
+		if _, _, err := DecodeEntity(data); err == nil {
+			t.Errorf("%s: expect error", name)
+		}
+		// 快照中 key 位于类型和值之间
+		dump := append([]byte(magic+version), data[0], 1, 'k')
+		dump = append(dump, data[1:]...)
+		if err := Parse(bytes.NewReader(dump), func(int, string, *redis.DataEntity, *time.Time) bool { return true }); err == nil {
+			t.Errorf("%s: expect error from Parse", name)
+		}
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("expect bounded allocation, actual %d bytes", allocated)
+	}
+}
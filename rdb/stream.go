@@ -0,0 +1,145 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"gedis/types/stream"
+)
+
+// writeStream 依次写入条目, 最大 ID 和消费组
+func (enc *Encoder) writeStream(s *stream.Stream) {
+	enc.writeLen(uint64(s.Len()))
+	s.ForEach(func(entry *stream.Entry) bool {
+		enc.writeID(entry.ID)
+		enc.writeLen(uint64(len(entry.Fields)))
+		for _, field := range entry.Fields {
+			enc.writeBytes(field)
+		}
+		return enc.err == nil
+	})
+	enc.writeID(s.LastID())
+
+	groups := s.Groups()
+	enc.writeLen(uint64(len(groups)))
+	for _, group := range groups {
+		enc.writeString(group.Name)
+		enc.writeID(group.LastID)
+		consumers := group.Consumers()
+		enc.writeLen(uint64(len(consumers)))
+		for _, consumer := range consumers {
+			enc.writeString(consumer.Name)
+			enc.writeInt64(consumer.SeenTime)
+		}
+		pending := group.PendingRange(stream.MinID, stream.MaxID, 0, nil)
+		enc.writeLen(uint64(len(pending)))
+		for _, pe := range pending {
+			enc.writeID(pe.ID)
+			enc.writeString(pe.Consumer)
+			enc.writeInt64(pe.DeliveryTime)
+			enc.writeInt64(pe.DeliveryCount)
+		}
+	}
+}
+
+func (enc *Encoder) writeID(id stream.ID) {
+	enc.writeLen(id.Ms)
+	enc.writeLen(id.Seq)
+}
+
+func (dec *decoder) readStream() (*stream.Stream, error) {
+	s := stream.Make()
+	size, err := dec.readLen()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < size; i++ {
+		id, err := dec.readID()
+		if err != nil {
+			return nil, err
+		}
+		n, err := dec.readLen()
+		if err != nil {
+			return nil, err
+		}
+		var fields [][]byte
+		for j := uint64(0); j < n; j++ {
+			field, err := dec.readBytes()
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field)
+		}
+		if !s.Add(id, fields) {
+			return nil, errors.New("rdb: stream ids out of order")
+		}
+	}
+	lastID, err := dec.readID()
+	if err != nil {
+		return nil, err
+	}
+	s.SetLastID(lastID)
+
+	groupCount, err := dec.readLen()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < groupCount; i++ {
+		name, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		groupLastID, err := dec.readID()
+		if err != nil {
+			return nil, err
+		}
+		group, _ := s.CreateGroup(name, groupLastID)
+		consumerCount, err := dec.readLen()
+		if err != nil {
+			return nil, err
+		}
+		for j := uint64(0); j < consumerCount; j++ {
+			consumerName, err := dec.readString()
+			if err != nil {
+				return nil, err
+			}
+			seenTime, err := dec.readInt64()
+			if err != nil {
+				return nil, err
+			}
+			group.CreateConsumer(consumerName, seenTime)
+		}
+		pendingCount, err := dec.readLen()
+		if err != nil {
+			return nil, err
+		}
+		for j := uint64(0); j < pendingCount; j++ {
+			pe := &stream.PendingEntry{}
+			if pe.ID, err = dec.readID(); err != nil {
+				return nil, err
+			}
+			if pe.Consumer, err = dec.readString(); err != nil {
+				return nil, err
+			}
+			if pe.DeliveryTime, err = dec.readInt64(); err != nil {
+				return nil, err
+			}
+			if pe.DeliveryCount, err = dec.readInt64(); err != nil {
+				return nil, err
+			}
+			group.AddPending(pe)
+		}
+	}
+	return s, nil
+}
+
+func (dec *decoder) readID() (stream.ID, error) {
+	ms, err := binary.ReadUvarint(dec)
+	if err != nil {
+		return stream.ID{}, err
+	}
+	seq, err := binary.ReadUvarint(dec)
+	if err != nil {
+		return stream.ID{}, err
+	}
+	return stream.ID{Ms: ms, Seq: seq}, nil
+}
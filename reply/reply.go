@@ -8,7 +8,7 @@ import (
 )
 
 var (
-	nullBulkReplyBytes = []byte("$-1")
+	nullBulkReplyBytes = []byte("$-1" + CRLF)
 
 	// CRLF is the line separator of redis serialization protocol
 	CRLF = "\r\n"
@@ -30,7 +30,7 @@ func MakeBulkReply(arg []byte) *BulkReply {
 
 // ToBytes marshal redis.Reply
 func (r *BulkReply) ToBytes() []byte {
-	if len(r.Arg) == 0 {
+	if r.Arg == nil {
 		return nullBulkReplyBytes
 	}
 	return []byte("$" + strconv.Itoa(len(r.Arg)) + CRLF + string(r.Arg) + CRLF)
@@ -187,24 +187,18 @@ func MakeScanBulkReply(pos int, args [][]byte) *ScanBulkReply {
 
 // ToBytes marshal redis.Reply
 func (r *ScanBulkReply) ToBytes() []byte {
-	argLen := len(r.Args)
 	var buf bytes.Buffer
 	buf.WriteString("*2" + CRLF)
-	if argLen == 0 {
-		buf.WriteString("$1" + CRLF)
-		buf.WriteString("0" + CRLF)
-		buf.WriteString("*0" + CRLF)
-	} else {
-		l := len(strconv.Itoa(r.Pos))
-		buf.WriteString("$" + strconv.Itoa(l) + CRLF)
-		buf.WriteString(strconv.Itoa(r.Pos) + CRLF)
-		buf.WriteString("*" + strconv.Itoa(argLen) + CRLF)
-		for _, arg := range r.Args {
-			if arg == nil {
-				buf.WriteString("$-1" + CRLF)
-			} else {
-				buf.WriteString("$" + strconv.Itoa(len(arg)) + CRLF + string(arg) + CRLF)
-			}
+	pos := strconv.Itoa(r.Pos)
+	buf.WriteString("$" + strconv.Itoa(len(pos)) + CRLF)
+	buf.WriteString(pos + CRLF)
+	// 游标不为 0 时即使本次没有匹配的元素也要返回游标, 否则客户端会提前结束遍历
+	buf.WriteString("*" + strconv.Itoa(len(r.Args)) + CRLF)
+	for _, arg := range r.Args {
+		if arg == nil {
+			buf.WriteString("$-1" + CRLF)
+		} else {
+			buf.WriteString("$" + strconv.Itoa(len(arg)) + CRLF + string(arg) + CRLF)
 		}
 	}
 	return buf.Bytes()
@@ -0,0 +1,254 @@
+package reply
+
+import (
+	"bytes"
+	"gedis/types/redis"
+	"math"
+	"strconv"
+)
+
+// RESP3 新增的回复类型, ToBytes 输出兼容 RESP2 的编码, 使用 RESP3 的连接通过 Encode 输出原生编码
+
+const (
+	// Resp2 默认协议版本
+	Resp2 = 2
+	// Resp3 通过 HELLO 3 协商的协议版本
+	Resp3 = 3
+)
+
+var (
+	resp3NullBytes  = []byte("_" + CRLF)
+	resp3TrueBytes  = []byte("#t" + CRLF)
+	resp3FalseBytes = []byte("#f" + CRLF)
+)
+
+/* ---- Map Reply ---- */
+
+// MapReply 键值对, RESP2 下输出为 key value 交替排列的数组
+type MapReply struct {
+	Pairs []redis.Reply // k1, v1, k2, v2 ...
+}
+
+// MakeMapReply creates MapReply
+func MakeMapReply(pairs []redis.Reply) *MapReply {
+	return &MapReply{
+		Pairs: pairs,
+	}
+}
+
+// MakeBulkMapReply creates MapReply whose keys and values are all bulk strings
+func MakeBulkMapReply(args [][]byte) *MapReply {
+	pairs := make([]redis.Reply, len(args))
+	for i, arg := range args {
+		pairs[i] = MakeBulkReply(arg)
+	}
+	return MakeMapReply(pairs)
+}
+
+// ToBytes marshal redis.Reply
+func (r *MapReply) ToBytes() []byte {
+	return encodeAggregate('*', len(r.Pairs), r.Pairs, Resp2)
+}
+
+/* ---- Set Reply ---- */
+
+// SetReply 无序集合, RESP2 下输出为数组
+type SetReply struct {
+	Args [][]byte
+}
+
+// MakeSetReply creates SetReply
+func MakeSetReply(args [][]byte) *SetReply {
+	return &SetReply{
+		Args: args,
+	}
+}
+
+// ToBytes marshal redis.Reply
+func (r *SetReply) ToBytes() []byte {
+	return MakeMultiBulkReply(r.Args).ToBytes()
+}
+
+/* ---- Push Reply ---- */
+
+// PushReply 服务端主动推送的消息, 例如发布订阅消息, RESP2 下输出为数组
+type PushReply struct {
+	Replies []redis.Reply
+}
+
+// MakePushReply creates PushReply
+func MakePushReply(replies []redis.Reply) *PushReply {
+	return &PushReply{
+		Replies: replies,
+	}
+}
+
+// ToBytes marshal redis.Reply
+func (r *PushReply) ToBytes() []byte {
+	return encodeAggregate('*', len(r.Replies), r.Replies, Resp2)
+}
+
+/* ---- Double Reply ---- */
+
+// DoubleReply 浮点数, RESP2 下输出为字符串
+type DoubleReply struct {
+	Value float64
+}
+
+// MakeDoubleReply creates DoubleReply
+func MakeDoubleReply(value float64) *DoubleReply {
+	return &DoubleReply{
+		Value: value,
+	}
+}
+
+func (r *DoubleReply) String() string {
+	if math.IsInf(r.Value, 1) {
+		return "inf"
+	} else if math.IsInf(r.Value, -1) {
+		return "-inf"
+	}
+	return strconv.FormatFloat(r.Value, 'f', -1, 64)
+}
+
+// ToBytes marshal redis.Reply
+func (r *DoubleReply) ToBytes() []byte {
+	return MakeBulkReply([]byte(r.String())).ToBytes()
+}
+
+/* ---- Boolean Reply ---- */
+
+// BooleanReply 布尔值, RESP2 下输出为 1 或 0
+type BooleanReply struct {
+	Value bool
+}
+
+// MakeBooleanReply creates BooleanReply
+func MakeBooleanReply(value bool) *BooleanReply {
+	return &BooleanReply{
+		Value: value,
+	}
+}
+
+// ToBytes marshal redis.Reply
+func (r *BooleanReply) ToBytes() []byte {
+	if r.Value {
+		return MakeIntReply(1).ToBytes()
+	}
+	return MakeIntReply(0).ToBytes()
+}
+
+/* ---- Null Reply ---- */
+
+// NullReply 空值, RESP2 下输出为空的 bulk string
+type NullReply struct{}
+
+// MakeNullReply creates NullReply
+func MakeNullReply() *NullReply {
+	return &NullReply{}
+}
+
+// ToBytes marshal redis.Reply
+func (r *NullReply) ToBytes() []byte {
+	return nullBulkBytes
+}
+
+/* ---- Big Number Reply ---- */
+
+// BigNumberReply 大整数, RESP2 下输出为字符串
+type BigNumberReply struct {
+	Value string
+}
+
+// MakeBigNumberReply creates BigNumberReply
+func MakeBigNumberReply(value string) *BigNumberReply {
+	return &BigNumberReply{
+		Value: value,
+	}
+}
+
+// ToBytes marshal redis.Reply
+func (r *BigNumberReply) ToBytes() []byte {
+	return MakeBulkReply([]byte(r.Value)).ToBytes()
+}
+
+/* ---- Verbatim String Reply ---- */
+
+// VerbatimReply 带格式的文本, Format 为 3 个字符例如 txt, mkd, RESP2 下输出为字符串
+type VerbatimReply struct {
+	Format string
+	Text   []byte
+}
+
+// MakeVerbatimReply creates VerbatimReply
+func MakeVerbatimReply(format string, text []byte) *VerbatimReply {
+	return &VerbatimReply{
+		Format: format,
+		Text:   text,
+	}
+}
+
+// ToBytes marshal redis.Reply
+func (r *VerbatimReply) ToBytes() []byte {
+	return MakeBulkReply(r.Text).ToBytes()
+}
+
+// Encode 按客户端协商的协议版本序列化回复
+func Encode(r redis.Reply, protocol int) []byte {
+	if protocol < Resp3 {
+		return r.ToBytes()
+	}
+	switch v := r.(type) {
+	case *NullBulkReply, *NullMultiBulkReply, *NullReply:
+		return resp3NullBytes
+	case *BulkReply:
+		if v.Arg == nil {
+			return resp3NullBytes
+		}
+	case *MultiBulkReply:
+		var buf bytes.Buffer
+		buf.WriteString("*" + strconv.Itoa(len(v.Args)) + CRLF)
+		for _, arg := range v.Args {
+			if arg == nil {
+				buf.Write(resp3NullBytes)
+			} else {
+				buf.WriteString("$" + strconv.Itoa(len(arg)) + CRLF + string(arg) + CRLF)
+			}
+		}
+		return buf.Bytes()
+	case *MultiRawReply:
+		return encodeAggregate('*', len(v.Replies), v.Replies, protocol)
+	case *MapReply:
+		return encodeAggregate('%', len(v.Pairs)/2, v.Pairs, protocol)
+	case *PushReply:
+		return encodeAggregate('>', len(v.Replies), v.Replies, protocol)
+	case *SetReply:
+		var buf bytes.Buffer
+		buf.WriteString("~" + strconv.Itoa(len(v.Args)) + CRLF)
+		for _, arg := range v.Args {
+			buf.WriteString("$" + strconv.Itoa(len(arg)) + CRLF + string(arg) + CRLF)
+		}
+		return buf.Bytes()
+	case *DoubleReply:
+		return []byte("," + v.String() + CRLF)
+	case *BooleanReply:
+		if v.Value {
+			return resp3TrueBytes
+		}
+		return resp3FalseBytes
+	case *BigNumberReply:
+		return []byte("(" + v.Value + CRLF)
+	case *VerbatimReply:
+		return []byte("=" + strconv.Itoa(len(v.Format)+1+len(v.Text)) + CRLF + v.Format + ":" + string(v.Text) + CRLF)
+	}
+	return r.ToBytes()
+}
+
+func encodeAggregate(prefix byte, size int, replies []redis.Reply, protocol int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(string(prefix) + strconv.Itoa(size) + CRLF)
+	for _, r := range replies {
+		buf.Write(Encode(r, protocol))
+	}
+	return buf.Bytes()
+}
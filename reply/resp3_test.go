@@ -0,0 +1,46 @@
+package reply
+
+import (
+	"gedis/types/redis"
+	"math"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	cases := []struct {
+		reply redis.Reply
+		resp2 string
+		resp3 string
+	}{
+		{MakeBulkReply([]byte("a")), "$1\r\na\r\n", "$1\r\na\r\n"},
+		{MakeBulkReply([]byte{}), "$0\r\n\r\n", "$0\r\n\r\n"},
+		{MakeBulkReply(nil), "$-1\r\n", "_\r\n"},
+		{&NullBulkReply{}, "$-1\r\n", "_\r\n"},
+		{MakeNullReply(), "$-1\r\n", "_\r\n"},
+		{MakeMultiBulkReply([][]byte{[]byte("a"), nil, {}}), "*3\r\n$1\r\na\r\n$-1\r\n$0\r\n\r\n", "*3\r\n$1\r\na\r\n_\r\n$0\r\n\r\n"},
+		{MakeBulkMapReply([][]byte{[]byte("k"), []byte("v")}), "*2\r\n$1\r\nk\r\n$1\r\nv\r\n", "%1\r\n$1\r\nk\r\n$1\r\nv\r\n"},
+		{MakeMapReply([]redis.Reply{MakeBulkReply([]byte("n")), MakeDoubleReply(1.5)}), "*2\r\n$1\r\nn\r\n$3\r\n1.5\r\n", "%1\r\n$1\r\nn\r\n,1.5\r\n"},
+		{MakeSetReply([][]byte{[]byte("a"), []byte("b")}), "*2\r\n$1\r\na\r\n$1\r\nb\r\n", "~2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{MakeSetReply(nil), "*0\r\n", "~0\r\n"},
+		{MakePushReply([]redis.Reply{MakeBulkReply([]byte("message")), MakeBulkReply(nil)}), "*2\r\n$7\r\nmessage\r\n$-1\r\n", ">2\r\n$7\r\nmessage\r\n_\r\n"},
+		{MakeDoubleReply(3), "$1\r\n3\r\n", ",3\r\n"},
+		{MakeDoubleReply(math.Inf(-1)), "$4\r\n-inf\r\n", ",-inf\r\n"},
+		{MakeBooleanReply(true), ":1\r\n", "#t\r\n"},
+		{MakeBooleanReply(false), ":0\r\n", "#f\r\n"},
+		{MakeBigNumberReply("12345678901234567890"), "$20\r\n12345678901234567890\r\n", "(12345678901234567890\r\n"},
+		{MakeVerbatimReply("txt", []byte("hi")), "$2\r\nhi\r\n", "=6\r\ntxt:hi\r\n"},
+		{MakeMultiRawReply([]redis.Reply{MakeIntReply(1), MakeNullReply()}), "*2\r\n:1\r\n$-1\r\n", "*2\r\n:1\r\n_\r\n"},
+		{MakeIntReply(7), ":7\r\n", ":7\r\n"},
+	}
+	for _, c := range cases {
+		if actual := string(Encode(c.reply, Resp2)); actual != c.resp2 {
+			t.Errorf("RESP2: expect %q, actual %q", c.resp2, actual)
+		}
+		if actual := string(c.reply.ToBytes()); actual != c.resp2 {
+			t.Errorf("ToBytes: expect %q, actual %q", c.resp2, actual)
+		}
+		if actual := string(Encode(c.reply, Resp3)); actual != c.resp3 {
+			t.Errorf("RESP3: expect %q, actual %q", c.resp3, actual)
+		}
+	}
+}
@@ -66,6 +66,7 @@ type readState struct {
 	msgType           byte     //消息类型
 	args              [][]byte //参数列表
 	bulkLen           int64    //bulk长度
+	readingBody       bool     //下一行是 bulk 的内容, 内容本身可能以 $ 开头
 }
 
 func (s *readState) finished() bool {
@@ -106,8 +107,8 @@ func parse(reader io.Reader, ch chan<- *Payload) {
 		// parse line
 		if !state.readingMultiLine {
 			// receive new response
-			if msg[0] == '*' {
-				// multi bulk reply
+			if msg[0] == '*' || msg[0] == '%' || msg[0] == '~' || msg[0] == '>' {
+				// multi bulk reply, RESP3 map/set/push 的元素同样按 bulk string 解析
 				err = parseMultiBulkHeader(msg, &state)
 				if err != nil {
 					ch <- &Payload{
@@ -123,7 +124,7 @@ func parse(reader io.Reader, ch chan<- *Payload) {
 					state = readState{} // reset state
 					continue
 				}
-			} else if msg[0] == '$' { // bulk reply
+			} else if msg[0] == '$' || msg[0] == '=' { // bulk reply, RESP3 verbatim string
 				err = parseBulkHeader(msg, &state)
 				if err != nil {
 					ch <- &Payload{
@@ -162,11 +163,7 @@ func parse(reader io.Reader, ch chan<- *Payload) {
 			// if sending finished
 			if state.finished() {
 				var result redis.Reply
-				if state.msgType == '*' {
-					result = reply.MakeMultiBulkReply(state.args)
-				} else if state.msgType == '$' {
-					result = reply.MakeBulkReply(state.args[0])
-				}
+				result = makeAggregateReply(state.msgType, state.args)
 				ch <- &Payload{
 					Data: result,
 					Err:  err,
@@ -211,6 +208,9 @@ func parseMultiBulkHeader(msg []byte, state *readState) error {
 	if err != nil {
 		return errors.New("parser error: " + string(msg))
 	}
+	if msg[0] == '%' { // map 的长度为键值对数量
+		expectedLine *= 2
+	}
 	if expectedLine == 0 {
 		state.expectedArgsCount = 0
 		return nil
@@ -234,8 +234,9 @@ func parseBulkHeader(msg []byte, state *readState) error {
 	}
 	if state.bulkLen == -1 { // null bulk
 		return nil
-	} else if state.bulkLen > 0 {
+	} else if state.bulkLen >= 0 { // 空字符串的内容为单独的一行 CRLF
 		state.msgType = msg[0]
+		state.readingBody = true
 		state.readingMultiLine = true
 		state.expectedArgsCount = 1
 		state.args = make([][]byte, 0, 1)
@@ -259,6 +260,21 @@ func parseSingleLineReply(msg []byte) (redis.Reply, error) {
 			return nil, errors.New("parser error: " + string(msg))
 		}
 		result = reply.MakeIntReply(val)
+	case '_': // RESP3 null
+		result = reply.MakeNullReply()
+	case '#': // RESP3 boolean
+		if str[1:] != "t" && str[1:] != "f" {
+			return nil, errors.New("parser error: " + string(msg))
+		}
+		result = reply.MakeBooleanReply(str[1:] == "t")
+	case ',': // RESP3 double
+		val, err := strconv.ParseFloat(str[1:], 64)
+		if err != nil {
+			return nil, errors.New("parser error: " + string(msg))
+		}
+		result = reply.MakeDoubleReply(val)
+	case '(': // RESP3 big number
+		result = reply.MakeBigNumberReply(str[1:])
 	default:
 		// parse as text parser
 		strs := strings.Split(str, " ")
@@ -275,18 +291,46 @@ func parseSingleLineReply(msg []byte) (redis.Reply, error) {
 func readBody(msg []byte, state *readState) error {
 	line := msg[0 : len(msg)-2]
 	var err error
-	if line[0] == '$' {
+	if !state.readingBody && len(line) > 0 && line[0] == '$' {
 		// bulk reply
 		state.bulkLen, err = strconv.ParseInt(string(line[1:]), 10, 64)
 		if err != nil {
 			return errors.New("parser error: " + string(msg))
 		}
-		if state.bulkLen <= 0 { // null bulk in multi bulks
+		if state.bulkLen < 0 { // null bulk in multi bulks
 			state.args = append(state.args, []byte{})
 			state.bulkLen = 0
+		} else {
+			// 空字符串的内容为随后的空行, 由 else 分支追加
+			state.readingBody = true
 		}
 	} else {
 		state.args = append(state.args, line)
+		state.readingBody = false
 	}
 	return nil
 }
+
+// makeAggregateReply 根据类型前缀构造读取完成的多行回复
+func makeAggregateReply(msgType byte, args [][]byte) redis.Reply {
+	switch msgType {
+	case '$':
+		return reply.MakeBulkReply(args[0])
+	case '=': // 格式为 "txt:内容"
+		if len(args[0]) >= 4 && args[0][3] == ':' {
+			return reply.MakeVerbatimReply(string(args[0][:3]), args[0][4:])
+		}
+		return reply.MakeBulkReply(args[0])
+	case '%':
+		return reply.MakeBulkMapReply(args)
+	case '~':
+		return reply.MakeSetReply(args)
+	case '>':
+		replies := make([]redis.Reply, len(args))
+		for i, arg := range args {
+			replies[i] = reply.MakeBulkReply(arg)
+		}
+		return reply.MakePushReply(replies)
+	}
+	return reply.MakeMultiBulkReply(args)
+}
@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"gedis/reply"
+	"testing"
+)
+
+func TestParseResp3(t *testing.T) {
+	// 解析后按 RESP3 重新编码应与输入一致
+	cases := []string{
+		"*2\r\n$3\r\nget\r\n$0\r\n\r\n",
+		"*0\r\n",
+		"$0\r\n\r\n",
+		"$4\r\n$abc\r\n",
+		"$4\r\na\r\nb\r\n",
+		"%2\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		"~2\r\n$1\r\nx\r\n$1\r\ny\r\n",
+		">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$0\r\n\r\n",
+		"_\r\n",
+		"#t\r\n",
+		"#f\r\n",
+		",1.5\r\n",
+		",-inf\r\n",
+		"(12345678901234567890\r\n",
+		"=6\r\ntxt:hi\r\n",
+		"+OK\r\n",
+		"-ERR bad\r\n",
+		":-3\r\n",
+	}
+	for _, input := range cases {
+		result, err := ParseOne([]byte(input))
+		if err != nil {
+			t.Errorf("%q: %v", input, err)
+			continue
+		}
+		if actual := string(reply.Encode(result, reply.Resp3)); actual != input {
+			t.Errorf("expect %q, actual %q", input, actual)
+		}
+	}
+
+	if _, err := ParseOne([]byte("#x\r\n")); err == nil {
+		t.Error("expect error for invalid boolean")
+	}
+	if _, err := ParseOne([]byte(",abc\r\n")); err == nil {
+		t.Error("expect error for invalid double")
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	results, err := ParseBytes([]byte("$-1\r\n$0\r\n\r\n*1\r\n$1\r\na\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"$-1\r\n", "$0\r\n\r\n", "*1\r\n$1\r\na\r\n"}
+	if len(results) != len(expect) {
+		t.Fatalf("expect %d replies, actual %d", len(expect), len(results))
+	}
+	for i, result := range results {
+		if actual := string(result.ToBytes()); actual != expect[i] {
+			t.Errorf("expect %q, actual %q", expect[i], actual)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"gedis/database"
 	"gedis/pkg/utils"
+	"gedis/server/status"
 	"gedis/types/redis"
 	"gedis/types/redis/connection"
 	"net"
@@ -15,7 +16,7 @@ var (
 )
 
 const (
-	Version = "0.9.1"
+	Version = status.Version
 )
 
 type Server struct {
@@ -45,7 +46,9 @@ func NewServer(addr string) *Server {
 func (s *Server) closeClient(client *connection.Connection) {
 	_ = client.Close()
 	s.db.AfterClientClose(client)
-	s.activeConn.Delete(client)
+	if _, loaded := s.activeConn.LoadAndDelete(client); loaded {
+		status.ClientClosed()
+	}
 }
 
 func (s *Server) Handle(ctx context.Context, conn net.Conn) {
@@ -56,7 +59,9 @@ func (s *Server) Handle(ctx context.Context, conn net.Conn) {
 
 	client := connection.NewConn(conn)
 	s.activeConn.Store(client, 1)
+	status.ClientConnected()
 	client.ProcessCommand(func(buf *[][]byte) redis.Reply {
+		status.CommandProcessed()
 		return s.db.Exec(client, *buf)
 	}, func() {
 		s.closeClient(client)
@@ -1,33 +1,57 @@
+// Package status 服务器运行状态统计, 供 INFO 命令输出
 package status
 
-// ServerStatus 服务器状态
-type ServerStatus struct {
-	// Server 服务器信息
-	Server struct {
-		version         string
-		mode            string
-		os              string
-		archBits        int
-		processId       int
-		tcpPort         string
-		uptimeInSeconds int
-		uptimeInDays    int
-		configFile      string
-		executable      string
-	}
-
-	//
-	Clients struct {
-		connectedClients int
-		trackingClients  int
-	}
-
-	Memory struct {
-		usedMemory int32
-	}
-
-	Stats struct {
-		totalConnectionsReceived int64
-		totalCommandsProcessed   int64
-	}
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Version 服务器版本
+const Version = "0.9.1"
+
+var (
+	startTime                time.Time
+	connectedClients         int64
+	totalConnectionsReceived int64
+	totalCommandsProcessed   int64
+)
+
+func init() {
+	startTime = time.Now()
+}
+
+// ClientConnected 记录新建立的客户端连接
+func ClientConnected() {
+	atomic.AddInt64(&connectedClients, 1)
+	atomic.AddInt64(&totalConnectionsReceived, 1)
+}
+
+// ClientClosed 记录客户端连接关闭
+func ClientClosed() {
+	atomic.AddInt64(&connectedClients, -1)
+}
+
+// CommandProcessed 记录处理完成的命令
+func CommandProcessed() {
+	atomic.AddInt64(&totalCommandsProcessed, 1)
+}
+
+// StartTime 服务启动时间
+func StartTime() time.Time {
+	return startTime
+}
+
+// ConnectedClients 当前客户端连接数
+func ConnectedClients() int64 {
+	return atomic.LoadInt64(&connectedClients)
+}
+
+// TotalConnectionsReceived 启动以来接受的连接总数
+func TotalConnectionsReceived() int64 {
+	return atomic.LoadInt64(&totalConnectionsReceived)
+}
+
+// TotalCommandsProcessed 启动以来处理的命令总数
+func TotalCommandsProcessed() int64 {
+	return atomic.LoadInt64(&totalCommandsProcessed)
 }
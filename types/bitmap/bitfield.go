@@ -0,0 +1,79 @@
+package bitmap
+
+import "math"
+
+// BITFIELD 的溢出处理方式
+const (
+	OverflowWrap = iota // 回绕, 默认方式
+	OverflowSat         // 饱和到最大值或最小值
+	OverflowFail        // 不执行并返回 nil
+)
+
+// CheckUnsignedOverflow 检查 value + incr 是否超出 width 位无符号整数的范围,
+// 溢出时返回非 0 值并按 overflow 给出回绕或饱和后的结果, 与 redis 的 checkUnsignedBitfieldOverflow 一致
+func CheckUnsignedOverflow(value uint64, incr int64, width uint, overflow int) (int, uint64) {
+	max := uint64(math.MaxUint64)
+	if width < 64 {
+		max = 1<<width - 1
+	}
+	maxIncr := int64(max - value)
+	minIncr := -int64(value)
+
+	wrap := func() uint64 {
+		res := value + uint64(incr)
+		if width < 64 {
+			res &= max
+		}
+		return res
+	}
+	if value > max || (incr > 0 && incr > maxIncr) {
+		if overflow == OverflowWrap {
+			return 1, wrap()
+		}
+		return 1, max
+	} else if incr < 0 && incr < minIncr {
+		if overflow == OverflowWrap {
+			return -1, wrap()
+		}
+		return -1, 0
+	}
+	return 0, value + uint64(incr)
+}
+
+// CheckSignedOverflow 检查 value + incr 是否超出 width 位有符号整数的范围,
+// 溢出时返回非 0 值并按 overflow 给出回绕或饱和后的结果, 与 redis 的 checkSignedBitfieldOverflow 一致
+func CheckSignedOverflow(value int64, incr int64, width uint, overflow int) (int, int64) {
+	max := int64(math.MaxInt64)
+	if width < 64 {
+		max = 1<<(width-1) - 1
+	}
+	min := -max - 1
+	// maxIncr 和 minIncr 可能溢出, 但只在 value 在范围内时才会使用
+	maxIncr := int64(uint64(max) - uint64(value))
+	minIncr := min - value
+
+	wrap := func() int64 {
+		c := uint64(value) + uint64(incr)
+		if width < 64 {
+			mask := ^uint64(0) << width
+			if c&(1<<(width-1)) != 0 {
+				c |= mask
+			} else {
+				c &^= mask
+			}
+		}
+		return int64(c)
+	}
+	if value > max || (width != 64 && incr > maxIncr) || (value >= 0 && incr > 0 && incr > maxIncr) {
+		if overflow == OverflowWrap {
+			return 1, wrap()
+		}
+		return 1, max
+	} else if value < min || (width != 64 && incr < minIncr) || (value < 0 && incr < 0 && incr < minIncr) {
+		if overflow == OverflowWrap {
+			return -1, wrap()
+		}
+		return -1, min
+	}
+	return 0, value + incr
+}
@@ -0,0 +1,101 @@
+package bitmap
+
+import "math/bits"
+
+// 位图直接使用字符串的 []byte 保存, 与 redis 一致, 第 0 位是第一个字节的最高位
+
+// MaxOffset 位偏移量的上限(不含), 对应 512MB 的字符串
+const MaxOffset = 1 << 32
+
+// Grow 将 bs 扩展到至少包含 offset 位, 新增的位为 0
+func Grow(bs []byte, offset int64) []byte {
+	size := int(offset/8) + 1
+	if size <= len(bs) {
+		return bs
+	}
+	return append(bs, make([]byte, size-len(bs))...)
+}
+
+// GetBit 返回 offset 位的值, 超出长度的位视为 0
+func GetBit(bs []byte, offset int64) byte {
+	i := offset / 8
+	if i >= int64(len(bs)) {
+		return 0
+	}
+	return bs[i] >> (7 - uint(offset%8)) & 1
+}
+
+// SetBit 设置 offset 位的值, bs 的长度必须足够
+func SetBit(bs []byte, offset int64, val byte) {
+	i := offset / 8
+	mask := byte(1) << (7 - uint(offset%8))
+	if val == 0 {
+		bs[i] &^= mask
+	} else {
+		bs[i] |= mask
+	}
+}
+
+// Count 返回 [start, end] 范围内的位中 1 的数量, 范围必须在 bs 内
+func Count(bs []byte, start int64, end int64) int64 {
+	var count int64
+	for start <= end && start%8 != 0 {
+		count += int64(GetBit(bs, start))
+		start++
+	}
+	for end >= start && end%8 != 7 {
+		count += int64(GetBit(bs, end))
+		end--
+	}
+	if start > end {
+		return count
+	}
+	for _, b := range bs[start/8 : end/8+1] {
+		count += int64(bits.OnesCount8(b))
+	}
+	return count
+}
+
+// Pos 返回 [start, end] 范围内第一个值为 bit 的位, 不存在时返回 -1, 范围必须在 bs 内
+func Pos(bs []byte, bit byte, start int64, end int64) int64 {
+	var skip byte = 0xff // 不包含目标位的整字节
+	if bit == 1 {
+		skip = 0
+	}
+	for i := start; i <= end; {
+		if i%8 == 0 && i+7 <= end && bs[i/8] == skip {
+			i += 8
+			continue
+		}
+		if GetBit(bs, i) == bit {
+			return i
+		}
+		i++
+	}
+	return -1
+}
+
+// GetUnsigned 读取从 offset 开始的 width 位无符号整数, 超出长度的位视为 0
+func GetUnsigned(bs []byte, offset int64, width uint) uint64 {
+	var val uint64
+	for i := uint(0); i < width; i++ {
+		val = val<<1 | uint64(GetBit(bs, offset+int64(i)))
+	}
+	return val
+}
+
+// GetSigned 读取从 offset 开始的 width 位有符号整数(补码)
+func GetSigned(bs []byte, offset int64, width uint) int64 {
+	val := GetUnsigned(bs, offset, width)
+	if width < 64 && val&(1<<(width-1)) != 0 { // 符号扩展
+		val |= ^uint64(0) << width
+	}
+	return int64(val)
+}
+
+// SetUnsigned 将 val 的低 width 位写入从 offset 开始的位置, bs 的长度必须足够
+func SetUnsigned(bs []byte, offset int64, width uint, val uint64) {
+	for i := uint(0); i < width; i++ {
+		SetBit(bs, offset+int64(i), byte(val>>(width-1-i)&1))
+	}
+}
@@ -0,0 +1,68 @@
+package bitmap
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestCountAndPos(t *testing.T) {
+	bs := make([]byte, 16)
+	rand.Read(bs)
+	bs[3], bs[9] = 0, 0xff
+	size := int64(len(bs) * 8)
+	for i := 0; i < 1000; i++ {
+		start := rand.Int63n(size)
+		end := start + rand.Int63n(size-start)
+		var count int64
+		first := [2]int64{-1, -1}
+		for j := start; j <= end; j++ {
+			bit := GetBit(bs, j)
+			count += int64(bit)
+			if first[bit] < 0 {
+				first[bit] = j
+			}
+		}
+		if actual := Count(bs, start, end); actual != count {
+			t.Fatalf("count [%d, %d]: expect %d, actual %d", start, end, count, actual)
+		}
+		for bit := byte(0); bit <= 1; bit++ {
+			if actual := Pos(bs, bit, start, end); actual != first[bit] {
+				t.Fatalf("pos %d in [%d, %d]: expect %d, actual %d", bit, start, end, first[bit], actual)
+			}
+		}
+	}
+}
+
+func TestBitField(t *testing.T) {
+	bs := Grow(nil, 63)
+	SetUnsigned(bs, 3, 5, 0x1f)
+	if GetUnsigned(bs, 3, 5) != 31 || GetSigned(bs, 3, 5) != -1 || GetBit(bs, 2) != 0 || GetBit(bs, 8) != 0 {
+		t.Fatalf("unexpected bits %08b", bs)
+	}
+	cases := []struct {
+		value, incr int64
+		width       uint
+		overflow    int
+		expect      int64
+		overflowed  int
+	}{
+		{127, 1, 8, OverflowWrap, -128, 1},
+		{127, 1, 8, OverflowSat, 127, 1},
+		{-128, -1, 8, OverflowWrap, 127, -1},
+		{-128, -1, 8, OverflowSat, -128, -1},
+		{-1, 1, 8, OverflowFail, 0, 0},
+		{9223372036854775807, 1, 64, OverflowSat, 9223372036854775807, 1},
+	}
+	for _, c := range cases {
+		overflowed, val := CheckSignedOverflow(c.value, c.incr, c.width, c.overflow)
+		if overflowed != c.overflowed || val != c.expect {
+			t.Errorf("signed %d + %d: expect %d(%d), actual %d(%d)", c.value, c.incr, c.expect, c.overflowed, val, overflowed)
+		}
+	}
+	if overflowed, val := CheckUnsignedOverflow(3, 1, 2, OverflowWrap); overflowed != 1 || val != 0 {
+		t.Errorf("unsigned wrap: actual %d(%d)", val, overflowed)
+	}
+	if overflowed, val := CheckUnsignedOverflow(1, -2, 2, OverflowSat); overflowed != -1 || val != 0 {
+		t.Errorf("unsigned sat: actual %d(%d)", val, overflowed)
+	}
+}
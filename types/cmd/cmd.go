@@ -3,11 +3,25 @@ package cmd
 const (
 	// System commands
 	Auth         = "auth"
+	Hello        = "hello"
 	Subscribe    = "subscribe"
 	Publish      = "publish"
 	UnSubscribe  = "unsubscribe"
+	PSubscribe   = "psubscribe"
+	PUnSubscribe = "punsubscribe"
+	PubSub       = "pubsub"
 	BgRewriteAof = "bgrewriteaof"
 	RewriteAof   = "rewriteaof"
+	Save         = "save"
+	BgSave       = "bgsave"
+	LastSave     = "lastsave"
+	ReplicaOf    = "replicaof"
+	SlaveOf      = "slaveof"
+	Sync         = "sync"
+	PSync        = "psync"
+	ReplConf     = "replconf"
+	Cluster      = "cluster"
+	Asking       = "asking"
 	FlushAll     = "flushall"
 	Select       = "select"
 	Ping         = "ping"
@@ -20,18 +34,29 @@ const (
 	Watch   = "watch"
 
 	// Hash commands
-	HSet    = "HSet"
-	HSetNX  = "HSetNX"
-	HExists = "HExists"
-	HGet    = "HGet"
-	HDel    = "HDel"
-	HLen    = "HLen"
-	HMSet   = "HMSet"
-	HMGet   = "HMGet"
-	HKeys   = "HKeys"
-	HVals   = "HVals"
-	HGetAll = "HGetAll"
-	HIncrBy = "HIncrBy"
+	HSet         = "HSet"
+	HSetNX       = "HSetNX"
+	HExists      = "HExists"
+	HGet         = "HGet"
+	HDel         = "HDel"
+	HLen         = "HLen"
+	HMSet        = "HMSet"
+	HMGet        = "HMGet"
+	HKeys        = "HKeys"
+	HVals        = "HVals"
+	HGetAll      = "HGetAll"
+	HIncrBy      = "HIncrBy"
+	HIncrByFloat = "HIncrByFloat"
+	HStrLen      = "HStrLen"
+	HScan        = "HScan"
+	HRandField   = "HRandField"
+	HExpire      = "HExpire"
+	HPExpire     = "HPExpire"
+	HExpireAt    = "HExpireAt"
+	HPExpireAt   = "HPExpireAt"
+	HTTL         = "HTTL"
+	HPTTL        = "HPTTL"
+	HPersist     = "HPersist"
 
 	// Key commands
 	Del       = "Del"
@@ -44,6 +69,7 @@ const (
 	Persist   = "Persist"
 	Exists    = "Exists"
 	Type      = "Type"
+	Object    = "Object"
 	Rename    = "Rename"
 	RenameNx  = "RenameNx"
 	FlushDB   = "FlushDB"
@@ -62,6 +88,17 @@ const (
 	LIndex    = "LIndex"
 	LSet      = "LSet"
 	LRange    = "LRange"
+	LInsert   = "LInsert"
+	LTrim     = "LTrim"
+	LPos      = "LPos"
+	LMove     = "LMove"
+	LMPop     = "LMPop"
+
+	BLPop      = "BLPop"
+	BRPop      = "BRPop"
+	BRPopLPush = "BRPopLPush"
+	BLMove     = "BLMove"
+	BLMPop     = "BLMPop"
 
 	//Set commands
 	SAdd        = "SAdd"
@@ -76,6 +113,11 @@ const (
 	SDiff       = "SDiff"
 	SDiffStore  = "SDiffStore"
 	SRandMember = "SRandMember"
+	SPop        = "SPop"
+	SMove       = "SMove"
+	SMIsMember  = "SMIsMember"
+	SInterCard  = "SInterCard"
+	SScan       = "SScan"
 
 	//String commands
 	Set         = "Set"
@@ -97,6 +139,18 @@ const (
 	SetRange    = "SetRange"
 	GetRange    = "GetRange"
 
+	SetBit     = "SetBit"
+	GetBit     = "GetBit"
+	BitCount   = "BitCount"
+	BitPos     = "BitPos"
+	BitOp      = "BitOp"
+	BitField   = "BitField"
+	BitFieldRO = "BitField_RO"
+
+	PFAdd   = "PFAdd"
+	PFCount = "PFCount"
+	PFMerge = "PFMerge"
+
 	//SortedSet commands
 	ZAdd             = "ZAdd"
 	ZScore           = "ZScore"
@@ -106,10 +160,58 @@ const (
 	ZRevRank         = "ZRevRank"
 	ZCard            = "ZCard"
 	ZRange           = "ZRange"
+	ZRangeStore      = "ZRangeStore"
 	ZRangeByScore    = "ZRangeByScore"
 	ZRevRange        = "ZRevRange"
 	ZRevRangeByScore = "ZRevRangeByScore"
 	ZRem             = "ZRem"
 	ZRemRangeByScore = "ZRemRangeByScore"
 	ZRemRangeByRank  = "ZRemRangeByRank"
+	ZRemRangeByLex   = "ZRemRangeByLex"
+	ZRangeByLex      = "ZRangeByLex"
+	ZRevRangeByLex   = "ZRevRangeByLex"
+	ZLexCount        = "ZLexCount"
+	ZUnion           = "ZUnion"
+	ZUnionStore      = "ZUnionStore"
+	ZInter           = "ZInter"
+	ZInterStore      = "ZInterStore"
+	ZDiff            = "ZDiff"
+	ZDiffStore       = "ZDiffStore"
+	ZPopMin          = "ZPopMin"
+	ZPopMax          = "ZPopMax"
+	ZMPop            = "ZMPop"
+	BZPopMin         = "BZPopMin"
+	BZPopMax         = "BZPopMax"
+	BZMPop           = "BZMPop"
+	ZMScore          = "ZMScore"
+	ZRandMember      = "ZRandMember"
+	ZScan            = "ZScan"
+
+	//Geo commands
+	GeoAdd         = "GeoAdd"
+	GeoPos         = "GeoPos"
+	GeoDist        = "GeoDist"
+	GeoHash        = "GeoHash"
+	GeoSearch      = "GeoSearch"
+	GeoSearchStore = "GeoSearchStore"
+
+	//Stream commands
+	XAdd       = "XAdd"
+	XLen       = "XLen"
+	XRange     = "XRange"
+	XRevRange  = "XRevRange"
+	XDel       = "XDel"
+	XTrim      = "XTrim"
+	XRead      = "XRead"
+	XGroup     = "XGroup"
+	XReadGroup = "XReadGroup"
+	XAck       = "XAck"
+	XPending   = "XPending"
+	XClaim     = "XClaim"
+	XSetId     = "XSetId"
+
+	//Scripting commands
+	Eval    = "Eval"
+	EvalSha = "EvalSha"
+	Script  = "Script"
 )
@@ -192,34 +192,23 @@ func (dict *ConcurrentDict) decreaseCount() int32 {
 	return atomic.AddInt32(&dict.count, -1)
 }
 
-func (dict *ConcurrentDict) ForScanKeys(eachFn EachFunc, start int, count int) [][]byte {
-	size := 0
-	skip := 0
-	var retKeys = make([][]byte, 0, count)
-	shardCount := len(dict.table)
-OuterLoop:
-	for i := start; i < shardCount; i++ {
-		shard := dict.getShard(uint32(i))
-		if shard == nil {
-			continue
+// Scan 以分片下标为游标, 从 cursor 开始逐个分片遍历, 访问的Key达到 count 后返回下一个分片的下标, 遍历结束时返回 0
+// 分片数量固定, 所以在整个遍历过程中一直存在的Key一定会被访问到
+func (dict *ConcurrentDict) Scan(cursor uint64, count int, eachFn EachFunc) uint64 {
+	visited := 0
+	for i := cursor; i < uint64(len(dict.table)); i++ {
+		if visited >= count {
+			return i
 		}
-
+		shard := dict.table[i]
+		shard.mutex.RLock()
 		for key, value := range shard.m {
-			continues := eachFn(key, value)
-			skip++
-			if !continues {
-				continue
-			} else {
-				retKeys = append(retKeys, []byte(key))
-				size++
-			}
-
-			if size == count {
-				break OuterLoop
-			}
+			eachFn(key, value)
+			visited++
 		}
+		shard.mutex.RUnlock()
 	}
-	return retKeys
+	return 0
 }
 
 // ForEach traversal the dict
@@ -1,5 +1,7 @@
 package dict
 
+import "time"
+
 // EachFunc 遍历Key回调函数
 type EachFunc func(key string, val interface{}) bool
 
@@ -14,9 +16,19 @@ type Dict interface {
 	PutIfExists(key string, val interface{}) (result int)
 	Remove(key string) (result int)
 	ForEach(eachFn EachFunc)
-	ForScanKeys(eachFn EachFunc, start int, count int) [][]byte
+	Scan(cursor uint64, count int, eachFn EachFunc) (next uint64)
 	Keys() []string
 	RandomKeys(limit int) []string
 	RandomDistinctKeys(limit int) []string
 	Clear()
 }
+
+// Expirable 支持为单个Key设置过期时间的字典, 用于 hash 的 field 级过期
+type Expirable interface {
+	Dict
+	Expire(key string, expireTime time.Time) bool
+	Persist(key string) bool
+	ExpireTime(key string) (time.Time, bool)
+	NextExpireTime() (time.Time, bool)
+	RemoveExpired() []string
+}
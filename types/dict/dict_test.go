@@ -3,6 +3,7 @@ package dict
 import (
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestSimpleDict(t *testing.T) {
@@ -130,18 +131,128 @@ func TestConcurrentDict(t *testing.T) {
 	}
 	t.Logf("Dict: %d", d.Len())
 
-	keys := d.ForScanKeys(func(key string, val interface{}) bool {
-		return true
-	}, 0, 5)
-	t.Logf("%v", keys)
+	scanned := 0
+	var cursor uint64
+	for {
+		cursor = d.Scan(cursor, 5, func(key string, val interface{}) bool {
+			scanned++
+			return true
+		})
+		if cursor == 0 {
+			break
+		}
+	}
+	if scanned != d.Len() {
+		t.Errorf("Scan: expect %d keys, actual %d", d.Len(), scanned)
+	}
+}
+
+func TestSimpleDictScan(t *testing.T) {
+	d := MakeSimple()
+	for i := 0; i < 100; i++ {
+		d.Put(fmt.Sprintf("k%d", i), i)
+	}
+	seen := make(map[string]int)
+	cursor := uint64(0)
+	for round := 0; ; round++ {
+		cursor = d.Scan(cursor, 7, func(key string, val interface{}) bool {
+			seen[key]++
+			return true
+		})
+		// 遍历过程中删除和添加的Key不影响其他Key被访问
+		d.Remove(fmt.Sprintf("k%d", 99-round))
+		d.Put(fmt.Sprintf("n%d", round), round)
+		if cursor == 0 {
+			break
+		}
+	}
+	for i := 0; i < 50; i++ {
+		if seen[fmt.Sprintf("k%d", i)] != 1 {
+			t.Errorf("key k%d visited %d times", i, seen[fmt.Sprintf("k%d", i)])
+		}
+	}
+}
+
+func TestSimpleDictExpire(t *testing.T) {
+	d := MakeSimple()
+	d.Put("a", 1)
+	d.Put("b", 2)
+	d.Put("c", 3)
+	d.Expire("a", time.Now().Add(-time.Millisecond))
+	d.Expire("b", time.Now().Add(time.Hour))
+	if _, ok := d.Get("a"); ok || d.Len() != 2 || len(d.Keys()) != 2 {
+		t.Error("expired key should be invisible")
+	}
+	if d.Put("a", 4) != 1 {
+		t.Error("put on expired key should insert")
+	}
+	if _, ok := d.ExpireTime("a"); ok {
+		t.Error("re-inserted key should not keep expire time")
+	}
+	d.Expire("c", time.Now().Add(-time.Millisecond))
+	if removed := d.RemoveExpired(); len(removed) != 1 || removed[0] != "c" {
+		t.Errorf("remove expired: %v", removed)
+	}
+	if !d.Persist("b") || d.Persist("b") {
+		t.Error("persist")
+	}
+	if _, ok := d.NextExpireTime(); ok {
+		t.Error("no key should have expire time")
+	}
+}
 
-	keys = d.ForScanKeys(func(key string, val interface{}) bool {
-		return true
-	}, 5, 5)
-	t.Logf("%v", keys)
+func TestSimpleDictRandomExpired(t *testing.T) {
+	d := MakeSimple()
+	d.Put("a", 1)
+	d.Put("b", 2)
+	d.Expire("a", time.Now().Add(-time.Millisecond))
+	if keys := d.RandomKeys(10); len(keys) != 10 || keys[0] != "b" {
+		t.Errorf("expect only live key, actual %v", keys)
+	}
+	if keys := d.RandomDistinctKeys(10); len(keys) != 1 || keys[0] != "b" {
+		t.Errorf("expect only live key, actual %v", keys)
+	}
+	// 所有的 field 都过期时返回空, 不能一直采样
+	d.Expire("b", time.Now().Add(-time.Millisecond))
+	if keys := d.RandomKeys(1); len(keys) != 0 {
+		t.Errorf("expect no key, actual %v", keys)
+	}
+	if keys := d.RandomDistinctKeys(1); len(keys) != 0 {
+		t.Errorf("expect no key, actual %v", keys)
+	}
+	if keys := d.RandomKeys(-1); len(keys) != 0 {
+		t.Errorf("expect no key for negative limit, actual %v", keys)
+	}
+}
 
-	keys = d.ForScanKeys(func(key string, val interface{}) bool {
-		return true
-	}, 10, 5)
-	t.Logf("%v", keys)
+func TestListpackDict(t *testing.T) {
+	d := MakeListpack()
+	for i := 0; i < MaxListpackEntries; i++ {
+		d.Put(fmt.Sprintf("f%d", i), []byte("v"))
+	}
+	if d.Encoding() != EncodingListpack || d.Len() != MaxListpackEntries {
+		t.Fatalf("expect listpack, actual %s", d.Encoding())
+	}
+	if d.PutIfAbsent("f0", []byte("x")) != 0 || d.PutIfExists("f0", []byte("x")) != 1 || d.Remove("f1") != 1 {
+		t.Fatal("unexpected result")
+	}
+	if v, _ := d.Get("f0"); string(v.([]byte)) != "x" {
+		t.Fatalf("expect x, actual %s", v)
+	}
+	d.Put("f1", make([]byte, MaxListpackValue+1))
+	if d.Encoding() != EncodingHashtable || d.Len() != MaxListpackEntries || !d.Exists("f0") {
+		t.Fatalf("expect hashtable for long value, actual %s", d.Encoding())
+	}
+
+	d = MakeListpack()
+	d.Put("a", []byte("1"))
+	if d.Expire("b", time.Now()) || d.Encoding() != EncodingListpack {
+		t.Fatal("expire on absent field should not convert")
+	}
+	if !d.Expire("a", time.Now().Add(time.Hour)) || d.Encoding() != EncodingHashtable {
+		t.Fatal("expect hashtable after setting field ttl")
+	}
+	if _, ok := d.ExpireTime("a"); !ok {
+		t.Fatal("expect ttl of a")
+	}
 }
@@ -0,0 +1,278 @@
+package dict
+
+import (
+	"math/rand"
+	"time"
+)
+
+// 小的 hash 使用紧凑编码, field 数量或 field/value 长度超过阈值后转换为 hashtable 编码, 转换是单向的
+var (
+	MaxListpackEntries = 128 // hash-max-listpack-entries
+	MaxListpackValue   = 64  // hash-max-listpack-value
+)
+
+// 编码名称, 与 OBJECT ENCODING 的返回值一致
+const (
+	EncodingListpack  = "listpack"
+	EncodingHashtable = "hashtable"
+)
+
+type listpackEntry struct {
+	key string
+	val interface{}
+}
+
+// ListpackDict 按插入顺序保存在切片中的字典, 用于 hash 类型, it is not thread safe
+// 超过阈值或为 field 设置过期时间后转换为 SimpleDict
+type ListpackDict struct {
+	entries []listpackEntry
+	dict    *SimpleDict // 转换后使用
+}
+
+// MakeListpack 构造紧凑编码的字典
+func MakeListpack() *ListpackDict {
+	return &ListpackDict{}
+}
+
+// Encoding returns the name of the underlying encoding
+func (lp *ListpackDict) Encoding() string {
+	if lp.dict == nil {
+		return EncodingListpack
+	}
+	return EncodingHashtable
+}
+
+func (lp *ListpackDict) convert() {
+	lp.dict = MakeSimple()
+	for _, entry := range lp.entries {
+		lp.dict.Put(entry.key, entry.val)
+	}
+	lp.entries = nil
+}
+
+// fits 判断键值对的长度是否允许使用紧凑编码
+func fits(key string, val interface{}) bool {
+	if len(key) > MaxListpackValue {
+		return false
+	}
+	switch v := val.(type) {
+	case []byte:
+		return len(v) <= MaxListpackValue
+	case string:
+		return len(v) <= MaxListpackValue
+	}
+	return true
+}
+
+// find 返回Key的下标, 不存在时返回 -1
+func (lp *ListpackDict) find(key string) int {
+	for i := range lp.entries {
+		if lp.entries[i].key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func (lp *ListpackDict) set(i int, val interface{}) {
+	lp.entries[i].val = val
+	if !fits(lp.entries[i].key, val) {
+		lp.convert()
+	}
+}
+
+func (lp *ListpackDict) insert(key string, val interface{}) {
+	lp.entries = append(lp.entries, listpackEntry{key: key, val: val})
+	if len(lp.entries) > MaxListpackEntries || !fits(key, val) {
+		lp.convert()
+	}
+}
+
+// Get 返回字典Key对应值
+func (lp *ListpackDict) Get(key string) (val interface{}, exists bool) {
+	if lp.dict != nil {
+		return lp.dict.Get(key)
+	}
+	if i := lp.find(key); i >= 0 {
+		return lp.entries[i].val, true
+	}
+	return nil, false
+}
+
+// Len 返回Dict元素数量
+func (lp *ListpackDict) Len() int {
+	if lp.dict != nil {
+		return lp.dict.Len()
+	}
+	return len(lp.entries)
+}
+
+func (lp *ListpackDict) Exists(key string) (exists bool) {
+	if lp.dict != nil {
+		return lp.dict.Exists(key)
+	}
+	return lp.find(key) >= 0
+}
+
+// Put 设置Key的值
+func (lp *ListpackDict) Put(key string, val interface{}) (result int) {
+	if lp.dict != nil {
+		return lp.dict.Put(key, val)
+	}
+	if i := lp.find(key); i >= 0 {
+		lp.set(i, val)
+		return 0
+	}
+	lp.insert(key, val)
+	return 1
+}
+
+func (lp *ListpackDict) Inc(key string, val int) (result int) {
+	return 0
+}
+
+// PutIfAbsent 设置数据(不存在Key才设置)
+func (lp *ListpackDict) PutIfAbsent(key string, val interface{}) (result int) {
+	if lp.dict != nil {
+		return lp.dict.PutIfAbsent(key, val)
+	}
+	if lp.find(key) >= 0 {
+		return 0
+	}
+	lp.insert(key, val)
+	return 1
+}
+
+// PutIfExists 设置数据(如果存在Key)
+func (lp *ListpackDict) PutIfExists(key string, val interface{}) (result int) {
+	if lp.dict != nil {
+		return lp.dict.PutIfExists(key, val)
+	}
+	if i := lp.find(key); i >= 0 {
+		lp.set(i, val)
+		return 1
+	}
+	return 0
+}
+
+// Remove 删除Key数据
+func (lp *ListpackDict) Remove(key string) (result int) {
+	if lp.dict != nil {
+		return lp.dict.Remove(key)
+	}
+	i := lp.find(key)
+	if i < 0 {
+		return 0
+	}
+	lp.entries = append(lp.entries[:i], lp.entries[i+1:]...)
+	return 1
+}
+
+// ForEach 按插入顺序遍历所有的Keys
+func (lp *ListpackDict) ForEach(eachFn EachFunc) {
+	if lp.dict != nil {
+		lp.dict.ForEach(eachFn)
+		return
+	}
+	for _, entry := range lp.entries {
+		if !eachFn(entry.key, entry.val) {
+			break
+		}
+	}
+}
+
+// Scan 与 redis 一致, 紧凑编码时一次遍历全部Key并返回 0
+func (lp *ListpackDict) Scan(cursor uint64, count int, eachFn EachFunc) uint64 {
+	if lp.dict != nil {
+		return lp.dict.Scan(cursor, count, eachFn)
+	}
+	lp.ForEach(eachFn)
+	return 0
+}
+
+// Keys 返回所有的Keys
+func (lp *ListpackDict) Keys() []string {
+	if lp.dict != nil {
+		return lp.dict.Keys()
+	}
+	keys := make([]string, len(lp.entries))
+	for i, entry := range lp.entries {
+		keys[i] = entry.key
+	}
+	return keys
+}
+
+// RandomKeys 按数量返回随机的Keys, 可能包含重复的Key
+func (lp *ListpackDict) RandomKeys(limit int) []string {
+	if lp.dict != nil {
+		return lp.dict.RandomKeys(limit)
+	}
+	if len(lp.entries) == 0 || limit <= 0 {
+		return nil
+	}
+	result := make([]string, limit)
+	for i := range result {
+		result[i] = lp.entries[rand.Intn(len(lp.entries))].key
+	}
+	return result
+}
+
+// RandomDistinctKeys 按数量返回随机的Keys, 不包含重复的Key
+func (lp *ListpackDict) RandomDistinctKeys(limit int) []string {
+	if lp.dict != nil {
+		return lp.dict.RandomDistinctKeys(limit)
+	}
+	if limit >= len(lp.entries) {
+		return lp.Keys()
+	}
+	result := make([]string, limit)
+	for i, index := range rand.Perm(len(lp.entries))[:limit] {
+		result[i] = lp.entries[index].key
+	}
+	return result
+}
+
+// Clear 清除所有的Keys, 恢复为紧凑编码
+func (lp *ListpackDict) Clear() {
+	*lp = ListpackDict{}
+}
+
+// Expire 设置Key的过期时间, 紧凑编码不保存过期时间, 先转换为 SimpleDict
+func (lp *ListpackDict) Expire(key string, expireTime time.Time) bool {
+	if lp.dict == nil {
+		if lp.find(key) < 0 {
+			return false
+		}
+		lp.convert()
+	}
+	return lp.dict.Expire(key, expireTime)
+}
+
+// Persist 清除Key的过期时间, 没有过期时间时返回 false
+func (lp *ListpackDict) Persist(key string) bool {
+	return lp.dict != nil && lp.dict.Persist(key)
+}
+
+// ExpireTime 返回Key的过期时间, Key不存在或没有过期时间时返回 false
+func (lp *ListpackDict) ExpireTime(key string) (time.Time, bool) {
+	if lp.dict == nil {
+		return time.Time{}, false
+	}
+	return lp.dict.ExpireTime(key)
+}
+
+// NextExpireTime 返回最早的过期时间
+func (lp *ListpackDict) NextExpireTime() (time.Time, bool) {
+	if lp.dict == nil {
+		return time.Time{}, false
+	}
+	return lp.dict.NextExpireTime()
+}
+
+// RemoveExpired 删除所有已过期的Key, 返回删除的Key
+func (lp *ListpackDict) RemoveExpired() []string {
+	if lp.dict == nil {
+		return nil
+	}
+	return lp.dict.RemoveExpired()
+}
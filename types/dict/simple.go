@@ -1,14 +1,40 @@
 package dict
 
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// simpleEntry 按插入顺序编号的键值对, 编号作为 Scan 的游标
+type simpleEntry struct {
+	key      string
+	val      interface{}
+	seq      uint64
+	removed  bool
+	expireAt time.Time // 零值表示不过期
+}
+
+// expired 判断条目在 now 时是否已经过期
+func (entry *simpleEntry) expired(now time.Time) bool {
+	return !entry.expireAt.IsZero() && now.After(entry.expireAt)
+}
+
 // SimpleDict wraps a map, it is not thread safe
+// 设置了过期时间的Key过期后对读操作不可见, 由 RemoveExpired 清理, 读操作不会修改字典
 type SimpleDict struct {
-	m map[string]interface{}
+	m       map[string]*simpleEntry
+	order   []*simpleEntry // 按 seq 递增, 删除的条目延迟清理
+	removed int            // order 中已删除的条目数量
+	nextSeq uint64
+	expires map[string]*simpleEntry // 设置了过期时间的条目, 没有时为 nil
 }
 
 // MakeSimple 构造基础字典
 func MakeSimple() *SimpleDict {
 	return &SimpleDict{
-		m: make(map[string]interface{}),
+		m:       make(map[string]*simpleEntry),
+		nextSeq: 1,
 	}
 }
 
@@ -16,10 +42,22 @@ func (dict *SimpleDict) Inc(key string, val int) (result int) {
 	return 0
 }
 
+// getEntry 返回未过期的条目
+func (dict *SimpleDict) getEntry(key string) (*simpleEntry, bool) {
+	entry, ok := dict.m[key]
+	if !ok || (dict.expires != nil && entry.expired(time.Now())) {
+		return nil, false
+	}
+	return entry, true
+}
+
 // Get 返回字典Key对应值
 func (dict *SimpleDict) Get(key string) (val interface{}, exists bool) {
-	val, ok := dict.m[key]
-	return val, ok
+	entry, ok := dict.getEntry(key)
+	if !ok {
+		return nil, false
+	}
+	return entry.val, true
 }
 
 // Len 返回Dict元素数量
@@ -27,105 +65,286 @@ func (dict *SimpleDict) Len() int {
 	if dict.m == nil {
 		panic("m is nil")
 	}
-	return len(dict.m)
+	if dict.expires == nil {
+		return len(dict.m)
+	}
+	now := time.Now()
+	n := len(dict.m)
+	for _, entry := range dict.expires {
+		if entry.expired(now) {
+			n--
+		}
+	}
+	return n
 }
 
 func (dict *SimpleDict) Exists(key string) (exists bool) {
-	_, exists = dict.m[key]
+	_, exists = dict.getEntry(key)
 	return
 }
 
-// Put 设置Key的值
+func (dict *SimpleDict) insert(key string, val interface{}) {
+	if stale, ok := dict.m[key]; ok { // 已过期但还没有清理的条目
+		dict.removeEntry(stale)
+	}
+	entry := &simpleEntry{key: key, val: val, seq: dict.nextSeq}
+	dict.nextSeq++
+	dict.m[key] = entry
+	dict.order = append(dict.order, entry)
+}
+
+// Put 设置Key的值, 覆盖未过期的Key时保留其过期时间
 func (dict *SimpleDict) Put(key string, val interface{}) (result int) {
-	_, existed := dict.m[key]
-	dict.m[key] = val
-	if existed {
+	if entry, existed := dict.getEntry(key); existed {
+		entry.val = val
 		return 0
 	}
+	dict.insert(key, val)
 	return 1
 }
 
 // PutIfAbsent 设置数据(不存在Key才设置)
 func (dict *SimpleDict) PutIfAbsent(key string, val interface{}) (result int) {
-	_, existed := dict.m[key]
-	if existed {
+	if _, existed := dict.getEntry(key); existed {
 		return 0
 	}
-	dict.m[key] = val
+	dict.insert(key, val)
 	return 1
 }
 
 // PutIfExists 设置数据(如果存在Key)
 func (dict *SimpleDict) PutIfExists(key string, val interface{}) (result int) {
-	_, existed := dict.m[key]
-	if existed {
-		dict.m[key] = val
+	if entry, existed := dict.getEntry(key); existed {
+		entry.val = val
 		return 1
 	}
 	return 0
 }
 
-// Remove 删除Key数据
+// Remove 删除Key数据, 删除已过期的Key时返回 0
 func (dict *SimpleDict) Remove(key string) (result int) {
-	_, existed := dict.m[key]
-	delete(dict.m, key)
-	if existed {
-		return 1
+	entry, existed := dict.m[key]
+	if !existed {
+		return 0
 	}
-	return 0
+	if dict.expires != nil && entry.expired(time.Now()) {
+		result = 0
+	} else {
+		result = 1
+	}
+	dict.removeEntry(entry)
+	return result
+}
+
+func (dict *SimpleDict) removeEntry(entry *simpleEntry) {
+	delete(dict.m, entry.key)
+	if !entry.expireAt.IsZero() {
+		delete(dict.expires, entry.key)
+		if len(dict.expires) == 0 {
+			dict.expires = nil
+		}
+	}
+	entry.removed = true
+	entry.val = nil
+	dict.removed++
+	if dict.removed > len(dict.order)/2 {
+		dict.compact()
+	}
+}
+
+// Expire 设置Key的过期时间, Key不存在时返回 false
+func (dict *SimpleDict) Expire(key string, expireTime time.Time) bool {
+	entry, ok := dict.getEntry(key)
+	if !ok {
+		return false
+	}
+	if dict.expires == nil {
+		dict.expires = make(map[string]*simpleEntry)
+	}
+	entry.expireAt = expireTime
+	dict.expires[key] = entry
+	return true
+}
+
+// Persist 清除Key的过期时间, 没有过期时间时返回 false
+func (dict *SimpleDict) Persist(key string) bool {
+	entry, ok := dict.getEntry(key)
+	if !ok || entry.expireAt.IsZero() {
+		return false
+	}
+	entry.expireAt = time.Time{}
+	delete(dict.expires, key)
+	if len(dict.expires) == 0 {
+		dict.expires = nil
+	}
+	return true
+}
+
+// ExpireTime 返回Key的过期时间, Key不存在或没有过期时间时返回 false
+func (dict *SimpleDict) ExpireTime(key string) (time.Time, bool) {
+	entry, ok := dict.getEntry(key)
+	if !ok || entry.expireAt.IsZero() {
+		return time.Time{}, false
+	}
+	return entry.expireAt, true
+}
+
+// NextExpireTime 返回最早的过期时间
+func (dict *SimpleDict) NextExpireTime() (time.Time, bool) {
+	var next time.Time
+	for _, entry := range dict.expires {
+		if next.IsZero() || entry.expireAt.Before(next) {
+			next = entry.expireAt
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// RemoveExpired 删除所有已过期的Key, 返回删除的Key
+func (dict *SimpleDict) RemoveExpired() []string {
+	var removed []string
+	now := time.Now()
+	for key, entry := range dict.expires {
+		if entry.expired(now) {
+			removed = append(removed, key)
+			dict.removeEntry(entry)
+		}
+	}
+	return removed
+}
+
+// compact 清理 order 中已删除的条目, 保留的条目编号不变, 所以不影响进行中的 Scan
+func (dict *SimpleDict) compact() {
+	kept := make([]*simpleEntry, 0, len(dict.m))
+	for _, entry := range dict.order {
+		if !entry.removed {
+			kept = append(kept, entry)
+		}
+	}
+	dict.order = kept
+	dict.removed = 0
 }
 
 // Keys 返回所有的Hash keys slice
 func (dict *SimpleDict) Keys() []string {
-	result := make([]string, len(dict.m))
-	i := 0
-	for k := range dict.m {
-		result[i] = k
-		i++
+	result := make([]string, 0, len(dict.m))
+	now := time.Now()
+	for k, entry := range dict.m {
+		if dict.expires == nil || !entry.expired(now) {
+			result = append(result, k)
+		}
 	}
 	return result
 }
 
-func (dict *SimpleDict) ForScanKeys(eachFn EachFunc, start int, count int) [][]byte {
-	//TODO implement me
-	panic("implement me")
+// Scan 从游标 cursor 开始按插入顺序遍历 count 个Key, 返回下一次的游标, 遍历结束时返回 0
+// 在整个遍历过程中一直存在的Key一定会被访问到, 期间删除后重新添加的Key可能被访问两次
+func (dict *SimpleDict) Scan(cursor uint64, count int, eachFn EachFunc) uint64 {
+	i := sort.Search(len(dict.order), func(i int) bool {
+		return dict.order[i].seq >= cursor
+	})
+	visited := 0
+	now := time.Now()
+	for ; i < len(dict.order); i++ {
+		entry := dict.order[i]
+		if entry.removed || entry.expired(now) {
+			continue
+		}
+		if visited >= count {
+			return entry.seq
+		}
+		eachFn(entry.key, entry.val)
+		visited++
+	}
+	return 0
 }
 
 // ForEach 遍历所有的Keys
 func (dict *SimpleDict) ForEach(eachFu EachFunc) {
-	for k, v := range dict.m {
-		if !eachFu(k, v) {
+	now := time.Now()
+	for k, entry := range dict.m {
+		if dict.expires != nil && entry.expired(now) {
+			continue
+		}
+		if !eachFu(k, entry.val) {
 			break
 		}
 	}
 }
 
+// randomEntry 随机返回一个未删除的条目, 只用于没有过期时间的字典, order 中已删除的条目不超过一半
+func (dict *SimpleDict) randomEntry() *simpleEntry {
+	for {
+		entry := dict.order[rand.Intn(len(dict.order))]
+		if !entry.removed {
+			return entry
+		}
+	}
+}
+
+// liveEntries 以同一时刻判断过期, 返回所有有效的条目
+// 逐个采样时最后一个有效的条目可能在采样期间过期, 所以有过期时间的字典先收集有效条目
+func (dict *SimpleDict) liveEntries() []*simpleEntry {
+	now := time.Now()
+	entries := make([]*simpleEntry, 0, len(dict.m))
+	for _, entry := range dict.order {
+		if !entry.removed && !entry.expired(now) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
 // RandomKeys 按数量返回随机的Keys, 可能包含重复的Key
 func (dict *SimpleDict) RandomKeys(limit int) []string {
+	if limit <= 0 || len(dict.m) == 0 {
+		return nil
+	}
 	result := make([]string, limit)
-	for i := 0; i < limit; i++ {
-		for k := range dict.m {
-			result[i] = k
-			break
+	if dict.expires == nil {
+		for i := range result {
+			result[i] = dict.randomEntry().key
 		}
+		return result
+	}
+	entries := dict.liveEntries()
+	if len(entries) == 0 {
+		return nil
+	}
+	for i := range result {
+		result[i] = entries[rand.Intn(len(entries))].key
 	}
 	return result
 }
 
 // RandomDistinctKeys 按数量返回随机的Keys, 不包含重复的Key
 func (dict *SimpleDict) RandomDistinctKeys(limit int) []string {
-	size := limit
-	if size > len(dict.m) {
-		size = len(dict.m)
-	}
-	result := make([]string, size)
-	i := 0
-	for k := range dict.m {
-		if i == limit {
-			break
+	if limit <= 0 {
+		return nil
+	}
+	if dict.expires != nil {
+		entries := dict.liveEntries()
+		if limit > len(entries) {
+			limit = len(entries)
+		}
+		result := make([]string, limit)
+		for i, index := range rand.Perm(len(entries))[:limit] {
+			result[i] = entries[index].key
+		}
+		return result
+	}
+	if limit >= len(dict.m) {
+		return dict.Keys()
+	}
+	picked := make(map[string]struct{}, limit)
+	result := make([]string, 0, limit)
+	for len(result) < limit {
+		key := dict.randomEntry().key
+		if _, ok := picked[key]; ok {
+			continue
 		}
-		result[i] = k
-		i++
+		picked[key] = struct{}{}
+		result = append(result, key)
 	}
 	return result
 }
@@ -0,0 +1,137 @@
+package geo
+
+import "math"
+
+// 与 redis 一致, 坐标编码为 52 位的 geohash 作为 sorted set 的分数:
+// 经度和纬度各 26 位, 纬度占偶数位, 经度占奇数位, 纬度范围限制在 EPSG:3785 可表示的 ±85.05112878
+const (
+	MaxStep = 26
+
+	MinLongitude = -180
+	MaxLongitude = 180
+	MinLatitude  = -85.05112878
+	MaxLatitude  = 85.05112878
+
+	// EarthRadius 计算距离使用的地球半径(米)
+	EarthRadius = 6372797.560856
+	mercatorMax = 20037726.37
+)
+
+const alphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Hash 精度为 Step 的 geohash, 有效位数为 2*Step
+type Hash struct {
+	Bits uint64
+	Step uint
+}
+
+// Area geohash 对应的经纬度范围
+type Area struct {
+	MinLongitude, MaxLongitude float64
+	MinLatitude, MaxLatitude   float64
+}
+
+// Valid 检查坐标是否可以编码
+func Valid(longitude, latitude float64) bool {
+	return longitude >= MinLongitude && longitude <= MaxLongitude &&
+		latitude >= MinLatitude && latitude <= MaxLatitude
+}
+
+// interleave 将 x 放在偶数位, y 放在奇数位
+func interleave(x, y uint32) uint64 {
+	var bits uint64
+	for i := uint(0); i < 32; i++ {
+		bits |= uint64(x>>i&1)<<(2*i) | uint64(y>>i&1)<<(2*i+1)
+	}
+	return bits
+}
+
+func deinterleave(bits uint64) (x, y uint32) {
+	for i := uint(0); i < 32; i++ {
+		x |= uint32(bits>>(2*i)&1) << i
+		y |= uint32(bits>>(2*i+1)&1) << i
+	}
+	return x, y
+}
+
+func encode(longitude, latitude float64, minLat, maxLat float64, step uint) Hash {
+	latOffset := (latitude - minLat) / (maxLat - minLat)
+	lonOffset := (longitude - MinLongitude) / (MaxLongitude - MinLongitude)
+	latOffset *= float64(uint64(1) << step)
+	lonOffset *= float64(uint64(1) << step)
+	return Hash{
+		Bits: interleave(uint32(latOffset), uint32(lonOffset)),
+		Step: step,
+	}
+}
+
+// Encode 按 step 精度编码坐标, 坐标需要先经过 Valid 检查
+func Encode(longitude, latitude float64, step uint) Hash {
+	return encode(longitude, latitude, MinLatitude, MaxLatitude, step)
+}
+
+// Decode 返回 geohash 对应的区域
+func (hash Hash) Decode() Area {
+	lat, lon := deinterleave(hash.Bits)
+	scale := float64(uint64(1) << hash.Step)
+	latScale := MaxLatitude - MinLatitude
+	lonScale := float64(MaxLongitude - MinLongitude)
+	return Area{
+		MinLatitude:  MinLatitude + float64(lat)/scale*latScale,
+		MaxLatitude:  MinLatitude + float64(lat+1)/scale*latScale,
+		MinLongitude: MinLongitude + float64(lon)/scale*lonScale,
+		MaxLongitude: MinLongitude + float64(lon+1)/scale*lonScale,
+	}
+}
+
+// Center 返回区域的中心点, 并限制在合法范围内
+func (area Area) Center() (longitude, latitude float64) {
+	longitude = math.Max(MinLongitude, math.Min(MaxLongitude, (area.MinLongitude+area.MaxLongitude)/2))
+	latitude = math.Max(MinLatitude, math.Min(MaxLatitude, (area.MinLatitude+area.MaxLatitude)/2))
+	return longitude, latitude
+}
+
+// Score 将坐标编码为 sorted set 的分数
+func Score(longitude, latitude float64) float64 {
+	return float64(Encode(longitude, latitude, MaxStep).Bits)
+}
+
+// FromScore 将分数解码为坐标, 结果为所在区域的中心点
+func FromScore(score float64) (longitude, latitude float64) {
+	return Hash{Bits: uint64(score), Step: MaxStep}.Decode().Center()
+}
+
+// String 返回 11 个字符的标准 geohash 字符串, 纬度范围使用标准的 ±90,
+// 52 位只能表示 10 个字符, 与 redis 一致最后一个字符固定为 '0'
+func String(score float64) string {
+	longitude, latitude := FromScore(score)
+	bits := encode(longitude, latitude, -90, 90, MaxStep).Bits
+	buf := make([]byte, 11)
+	for i := 0; i < 10; i++ {
+		buf[i] = alphabet[bits>>(52-(i+1)*5)&0x1f]
+	}
+	buf[10] = alphabet[0]
+	return string(buf)
+}
+
+func degRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radDeg(rad float64) float64 {
+	return rad / (math.Pi / 180)
+}
+
+// Distance 使用 haversine 公式计算两点间的距离(米)
+func Distance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lon1r := degRad(lat1), degRad(lon1)
+	lat2r, lon2r := degRad(lat2), degRad(lon2)
+	v := math.Sin((lon2r - lon1r) / 2)
+	// 经度相同时只需计算纬度的距离
+	if v == 0 {
+		return EarthRadius * math.Abs(lat2r-lat1r)
+	}
+	u := math.Sin((lat2r - lat1r) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * EarthRadius * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,72 @@
+package geo
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestGeoHash(t *testing.T) {
+	score := Score(13.361389, 38.115556)
+	if score != 3479099956230698 {
+		t.Errorf("expect 3479099956230698, actual %f", score)
+	}
+	if hash := String(score); hash != "sqc8b49rny0" {
+		t.Errorf("expect sqc8b49rny0, actual %s", hash)
+	}
+	lon1, lat1 := FromScore(score)
+	lon2, lat2 := FromScore(Score(15.087269, 37.502669))
+	if dist := Distance(lon1, lat1, lon2, lat2); dist < 166274.15 || dist > 166274.16 {
+		t.Errorf("expect 166274.1516, actual %f", dist)
+	}
+}
+
+// TestShapeRanges 检查 Ranges 覆盖了范围内的所有坐标
+func TestShapeRanges(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	scores := make([]float64, 2000)
+	for round := 0; round < 50; round++ {
+		shape := &Shape{
+			Longitude: r.Float64()*360 - 180,
+			Latitude:  r.Float64()*160 - 80,
+			Box:       round%2 == 1,
+			Radius:    r.Float64() * 500000,
+			Width:     r.Float64() * 1000000,
+			Height:    r.Float64() * 1000000,
+		}
+		// 一半的坐标集中在中心点附近
+		for i := range scores {
+			lon, lat := r.Float64()*360-180, r.Float64()*170-85
+			if i%2 == 0 {
+				lon = clamp(shape.Longitude+r.Float64()*20-10, MinLongitude, MaxLongitude)
+				lat = clamp(shape.Latitude+r.Float64()*20-10, MinLatitude, MaxLatitude)
+			}
+			scores[i] = Score(lon, lat)
+		}
+		ranges := shape.Ranges()
+		for _, score := range scores {
+			if _, ok := shape.Contains(FromScore(score)); !ok {
+				continue
+			}
+			covered := false
+			for _, rg := range ranges {
+				if uint64(score) >= rg[0] && uint64(score) < rg[1] {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				t.Fatalf("%+v: score %f is not covered by %v", shape, score, ranges)
+			}
+		}
+	}
+}
+
+func clamp(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,141 @@
+package geo
+
+import "math"
+
+// Shape 搜索范围, 以 (Longitude, Latitude) 为中心的圆形或矩形, 长度单位均为米
+type Shape struct {
+	Longitude float64
+	Latitude  float64
+	Box       bool
+	Radius    float64 // 圆形的半径
+	Width     float64 // 矩形的宽度
+	Height    float64 // 矩形的高度
+}
+
+// Contains 检查坐标是否在范围内, 在范围内时返回与中心点的距离
+func (shape *Shape) Contains(longitude, latitude float64) (float64, bool) {
+	if !shape.Box {
+		dist := Distance(shape.Longitude, shape.Latitude, longitude, latitude)
+		return dist, dist <= shape.Radius
+	}
+	// 纬度方向的距离计算更快, 先检查纬度
+	if Distance(longitude, shape.Latitude, longitude, latitude) > shape.Height/2 {
+		return 0, false
+	}
+	if Distance(shape.Longitude, latitude, longitude, latitude) > shape.Width/2 {
+		return 0, false
+	}
+	return Distance(shape.Longitude, shape.Latitude, longitude, latitude), true
+}
+
+// boundingBox 返回包含整个范围的经纬度边界: minLon, minLat, maxLon, maxLat
+func (shape *Shape) boundingBox() (float64, float64, float64, float64) {
+	height, width := shape.Radius, shape.Radius
+	if shape.Box {
+		height, width = shape.Height/2, shape.Width/2
+	}
+	latDelta := radDeg(height / EarthRadius)
+	lonDeltaTop := radDeg(width / EarthRadius / math.Cos(degRad(shape.Latitude+latDelta)))
+	lonDeltaBottom := radDeg(width / EarthRadius / math.Cos(degRad(shape.Latitude-latDelta)))
+	// 北半球靠近赤道的一侧更窄, 取远离赤道一侧的经度范围
+	lonDelta := lonDeltaTop
+	if shape.Latitude < 0 {
+		lonDelta = lonDeltaBottom
+	}
+	return shape.Longitude - lonDelta, shape.Latitude - latDelta, shape.Longitude + lonDelta, shape.Latitude + latDelta
+}
+
+// estimateStep 估算能以 3x3 个区域覆盖指定半径的 geohash 精度
+func estimateStep(radius float64, latitude float64) uint {
+	if radius == 0 {
+		return MaxStep
+	}
+	step := 1
+	for radius < mercatorMax {
+		radius *= 2
+		step++
+	}
+	step -= 2 // 保证大多数情况下范围在区域内
+	// 高纬度地区的区域更窄, 需要降低精度
+	if latitude > 66 || latitude < -66 {
+		step--
+		if latitude > 80 || latitude < -80 {
+			step--
+		}
+	}
+	if step < 1 {
+		step = 1
+	}
+	if step > MaxStep {
+		step = MaxStep
+	}
+	return uint(step)
+}
+
+// move 在经度(奇数位)或纬度(偶数位)方向上移动 d 个区域, 超出范围时回绕
+func (hash Hash) move(odd bool, d int) Hash {
+	if d == 0 {
+		return hash
+	}
+	var mask uint64 = 0x5555555555555555
+	if odd {
+		mask = 0xaaaaaaaaaaaaaaaa
+	}
+	shift := 64 - hash.Step*2
+	v := hash.Bits & mask
+	other := hash.Bits &^ mask
+	zz := ^mask >> shift // 另一个维度的位, 加减时用于进位
+	if d > 0 {
+		v += zz + 1
+	} else {
+		v |= zz
+		v -= zz + 1
+	}
+	v &= mask >> shift
+	return Hash{Bits: v | other, Step: hash.Step}
+}
+
+// Ranges 返回覆盖搜索范围的 geohash 分数区间 [min, max), 由中心区域及其周围 8 个区域组成
+func (shape *Shape) Ranges() [][2]uint64 {
+	radius := shape.Radius
+	if shape.Box {
+		radius = math.Sqrt(shape.Width*shape.Width/4 + shape.Height*shape.Height/4)
+	}
+	minLon, minLat, maxLon, maxLat := shape.boundingBox()
+	step := estimateStep(radius, shape.Latitude)
+
+	center := Encode(shape.Longitude, shape.Latitude, step)
+	area := center.Decode()
+	// 范围靠近区域边缘时, 周围的区域可能不足以覆盖, 需要再降低一级精度
+	if step > 1 &&
+		(center.move(false, 1).Decode().MaxLatitude < maxLat ||
+			center.move(false, -1).Decode().MinLatitude > minLat ||
+			center.move(true, 1).Decode().MaxLongitude < maxLon ||
+			center.move(true, -1).Decode().MinLongitude > minLon) {
+		step--
+		center = Encode(shape.Longitude, shape.Latitude, step)
+		area = center.Decode()
+	}
+
+	var ranges [][2]uint64
+	seen := make(map[uint64]struct{}, 9)
+	for dLat := -1; dLat <= 1; dLat++ {
+		for dLon := -1; dLon <= 1; dLon++ {
+			// 排除与搜索范围不相交的区域
+			if step >= 2 && (dLat < 0 && area.MinLatitude < minLat ||
+				dLat > 0 && area.MaxLatitude > maxLat ||
+				dLon < 0 && area.MinLongitude < minLon ||
+				dLon > 0 && area.MaxLongitude > maxLon) {
+				continue
+			}
+			bits := center.move(false, dLat).move(true, dLon).Bits
+			if _, ok := seen[bits]; ok { // 精度很低时相邻区域可能重复
+				continue
+			}
+			seen[bits] = struct{}{}
+			shift := 2 * (MaxStep - step)
+			ranges = append(ranges, [2]uint64{bits << shift, (bits + 1) << shift})
+		}
+	}
+	return ranges
+}
@@ -0,0 +1,344 @@
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// HyperLogLog 保存在字符串中, 格式与 redis 一致, 可以通过 GET/SET 在两者之间迁移:
+// 16 字节的头部: "HYLL" | 编码(1 字节) | 保留(3 字节) | 基数缓存(8 字节, 小端序, 最高位为 1 表示失效)
+// 之后是 16384 个 6 位寄存器, 紧凑编码(sparse)以游程保存, 完整编码(dense)按位连续保存
+const (
+	p             = 14
+	registerCount = 1 << p
+	registerBits  = 6
+	registerMax   = 1<<registerBits - 1
+	q             = 64 - p
+	headerSize    = 16
+	denseSize     = headerSize + (registerCount*registerBits+7)/8
+
+	encodingDense  = 0
+	encodingSparse = 1
+
+	// sparse 操作码: ZERO 00xxxxxx, XZERO 01xxxxxx yyyyyyyy, VAL 1vvvvvxx
+	sparseZeroMaxLen  = 64
+	sparseXZeroMaxLen = 16384
+	sparseValMaxValue = 32
+	sparseValMaxLen   = 4
+
+	alphaInf = 0.721347520444481703680 // 1 / (2 ln 2)
+)
+
+// SparseMaxBytes sparse 编码的最大字节数(不含头部), 超过后转换为 dense 编码, 对应 hll-sparse-max-bytes
+var SparseMaxBytes = 3000
+
+// ErrInvalid 表示 sparse 编码损坏
+var ErrInvalid = errors.New("INVALIDOBJ Corrupted HLL object detected")
+
+var magic = []byte("HYLL")
+
+// Registers 展开后的全部寄存器
+type Registers [registerCount]uint8
+
+// New 创建一个空的 HyperLogLog, 使用 sparse 编码
+func New() []byte {
+	var regs Registers
+	bs := regs.Encode(false)
+	binary.LittleEndian.PutUint64(bs[8:headerSize], 0) // 基数缓存为 0 且有效
+	return bs
+}
+
+// IsValid 检查字符串是否为 HyperLogLog, 只检查头部, sparse 编码的内容在使用时检查
+func IsValid(bs []byte) bool {
+	if len(bs) < headerSize || string(bs[:4]) != string(magic) {
+		return false
+	}
+	switch bs[4] {
+	case encodingDense:
+		return len(bs) == denseSize
+	case encodingSparse:
+		return true
+	}
+	return false
+}
+
+// IsDense 返回是否为 dense 编码
+func IsDense(bs []byte) bool {
+	return bs[4] == encodingDense
+}
+
+func invalidateCache(bs []byte) {
+	bs[15] |= 1 << 7
+}
+
+// patLen 计算元素对应的寄存器及寄存器的值: 哈希值去掉寄存器下标后末尾 0 的个数加 1
+func patLen(element []byte) (int, uint8) {
+	hash := murmurHash64A(element, 0xadc83b19)
+	index := int(hash & (registerCount - 1))
+	hash >>= p
+	hash |= 1 << q // 保证循环结束且结果不超过 q+1
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+func denseGet(bs []byte, index int) uint8 {
+	i := headerSize + index*registerBits/8
+	fb := uint(index * registerBits & 7)
+	val := uint(bs[i]) >> fb
+	if i+1 < len(bs) {
+		val |= uint(bs[i+1]) << (8 - fb)
+	}
+	return uint8(val & registerMax)
+}
+
+func denseSet(bs []byte, index int, val uint8) {
+	i := headerSize + index*registerBits/8
+	fb := uint(index * registerBits & 7)
+	bs[i] &^= registerMax << fb
+	bs[i] |= val << fb
+	if i+1 < len(bs) {
+		bs[i+1] &^= registerMax >> (8 - fb)
+		bs[i+1] |= val >> (8 - fb)
+	}
+}
+
+// Add 添加元素, 返回更新后的字符串以及是否有寄存器发生变化.
+// dense 编码原地修改, sparse 编码展开后重新编码, 必要时转换为 dense 编码
+func Add(bs []byte, elements ...[]byte) ([]byte, bool, error) {
+	updated := false
+	if IsDense(bs) {
+		for _, element := range elements {
+			index, count := patLen(element)
+			if denseGet(bs, index) < count {
+				denseSet(bs, index, count)
+				updated = true
+			}
+		}
+		if updated {
+			invalidateCache(bs)
+		}
+		return bs, updated, nil
+	}
+
+	var regs Registers
+	if err := regs.Merge(bs); err != nil {
+		return nil, false, err
+	}
+	for _, element := range elements {
+		index, count := patLen(element)
+		if regs[index] < count {
+			regs[index] = count
+			updated = true
+		}
+	}
+	if !updated {
+		return bs, false, nil
+	}
+	return regs.Encode(false), true, nil
+}
+
+// Count 返回估算的基数, 单个 HyperLogLog 的基数缓存失效时重新计算并原地更新缓存
+func Count(bs []byte) (uint64, error) {
+	if bs[15]&(1<<7) == 0 {
+		return binary.LittleEndian.Uint64(bs[8:headerSize]), nil
+	}
+	var regs Registers
+	if err := regs.Merge(bs); err != nil {
+		return 0, err
+	}
+	card := regs.Count()
+	binary.LittleEndian.PutUint64(bs[8:headerSize], card)
+	return card, nil
+}
+
+// Merge 将 bs 中的寄存器合并到 regs, 每个寄存器取最大值
+func (regs *Registers) Merge(bs []byte) error {
+	if IsDense(bs) {
+		for i := range regs {
+			if val := denseGet(bs, i); val > regs[i] {
+				regs[i] = val
+			}
+		}
+		return nil
+	}
+	index := 0
+	data := bs[headerSize:]
+	for i := 0; i < len(data); i++ {
+		op := data[i]
+		var runLen int
+		var val uint8
+		switch {
+		case op&0xc0 == 0x00: // ZERO
+			runLen = int(op&0x3f) + 1
+		case op&0xc0 == 0x40: // XZERO
+			if i+1 >= len(data) {
+				return ErrInvalid
+			}
+			runLen = (int(op&0x3f)<<8 | int(data[i+1])) + 1
+			i++
+		default: // VAL
+			val = (op>>2)&0x1f + 1
+			runLen = int(op&0x03) + 1
+		}
+		if index+runLen > registerCount {
+			return ErrInvalid
+		}
+		if val > 0 {
+			for j := index; j < index+runLen; j++ {
+				if val > regs[j] {
+					regs[j] = val
+				}
+			}
+		}
+		index += runLen
+	}
+	if index != registerCount {
+		return ErrInvalid
+	}
+	return nil
+}
+
+// Encode 将寄存器编码为 HyperLogLog 字符串, 基数缓存为失效状态.
+// 不强制 dense 时优先使用 sparse 编码, 寄存器的值或编码长度超出 sparse 的限制时使用 dense 编码
+func (regs *Registers) Encode(dense bool) []byte {
+	if !dense {
+		if bs, ok := regs.encodeSparse(); ok {
+			return bs
+		}
+	}
+	bs := make([]byte, denseSize)
+	copy(bs, magic)
+	bs[4] = encodingDense
+	for i, val := range regs {
+		if val > 0 {
+			denseSet(bs, i, val)
+		}
+	}
+	invalidateCache(bs)
+	return bs
+}
+
+func (regs *Registers) encodeSparse() ([]byte, bool) {
+	bs := make([]byte, headerSize, headerSize+16)
+	copy(bs, magic)
+	bs[4] = encodingSparse
+	invalidateCache(bs)
+	for i := 0; i < registerCount; {
+		val := regs[i]
+		if val > sparseValMaxValue {
+			return nil, false
+		}
+		runLen := 1
+		for i+runLen < registerCount && regs[i+runLen] == val {
+			runLen++
+		}
+		i += runLen
+		for runLen > 0 {
+			var n int
+			switch {
+			case val > 0:
+				n = min(runLen, sparseValMaxLen)
+				bs = append(bs, 0x80|(val-1)<<2|byte(n-1))
+			case runLen > sparseZeroMaxLen:
+				n = min(runLen, sparseXZeroMaxLen)
+				bs = append(bs, 0x40|byte((n-1)>>8), byte(n-1))
+			default:
+				n = runLen
+				bs = append(bs, byte(n-1))
+			}
+			runLen -= n
+		}
+		if len(bs)-headerSize > SparseMaxBytes {
+			return nil, false
+		}
+	}
+	return bs, true
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Count 按寄存器的直方图估算基数, 与 redis 一致使用 Otmar Ertl 的改进估算方法
+func (regs *Registers) Count() uint64 {
+	var histogram [registerMax + 1]int
+	for _, val := range regs {
+		histogram[val]++
+	}
+	m := float64(registerCount)
+	z := m * tau((m-float64(histogram[q+1]))/m)
+	for j := q; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histogram[0])/m)
+	return uint64(math.Round(alphaInf * m * m / z))
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+// murmurHash64A 与 redis 使用的 MurmurHash64A 一致(小端序)
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ (uint64(len(key)) * m)
+	n := len(key) - len(key)&7
+	for i := 0; i < n; i += 8 {
+		k := binary.LittleEndian.Uint64(key[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+	}
+	tail := key[n:]
+	if len(tail) > 0 {
+		for i := len(tail) - 1; i >= 0; i-- {
+			h ^= uint64(tail[i]) << (8 * uint(i))
+		}
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
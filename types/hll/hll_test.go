@@ -0,0 +1,58 @@
+package hll
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	bs := New()
+	if card, _ := Count(bs); card != 0 || IsDense(bs) || !IsValid(bs) {
+		t.Fatal("expect empty sparse hll")
+	}
+	const n = 100000
+	for i := 0; i < n; i += 100 {
+		elements := make([][]byte, 100)
+		for j := range elements {
+			elements[j] = []byte("element:" + strconv.Itoa(i+j))
+		}
+		var err error
+		if bs, _, err = Add(bs, elements...); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			if card, _ := Count(bs); card < 98 || card > 102 {
+				t.Errorf("expect about 100 for small cardinality, actual %d", card)
+			}
+		}
+	}
+	if !IsDense(bs) || len(bs) != denseSize {
+		t.Fatalf("expect dense encoding, actual %d bytes", len(bs))
+	}
+	card, err := Count(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(float64(card)-n)/n > 0.02 {
+		t.Errorf("expect about %d, actual %d", n, card)
+	}
+	if _, updated, _ := Add(bs, []byte("element:1")); updated {
+		t.Error("existing element should not update registers")
+	}
+
+	// dense 与 sparse 相互转换后寄存器不变
+	var regs Registers
+	_ = regs.Merge(bs)
+	sparse := New()
+	sparse, _, _ = Add(sparse, []byte("a"), []byte("b"), []byte("c"))
+	_ = regs.Merge(sparse)
+	var merged Registers
+	_ = merged.Merge(regs.Encode(true))
+	if merged != regs {
+		t.Error("registers changed after encoding")
+	}
+	if _, err := Count(append(sparse[:headerSize:headerSize], 0x7f)); err != ErrInvalid {
+		t.Errorf("expect invalid, actual %v", err)
+	}
+}
@@ -242,6 +242,24 @@ func (list *LinkedList) ForEach(consumer func(int, interface{}) bool) {
 	}
 }
 
+// ReverseForEach visits each element in the list from tail to head, the index passed to consumer counts from head
+// if the consumer returns false, the loop will be break
+func (list *LinkedList) ReverseForEach(consumer func(int, interface{}) bool) {
+	if list == nil {
+		panic("list is nil")
+	}
+	n := list.last
+	i := list.size - 1
+	for n != nil {
+		goNext := consumer(i, n.val)
+		if !goNext {
+			break
+		}
+		i--
+		n = n.prev
+	}
+}
+
 // Contains returns whether the given value exist in the list
 func (list *LinkedList) Contains(val interface{}) bool {
 	contains := false
@@ -285,6 +303,25 @@ func (list *LinkedList) Range(start int, stop int) []interface{} {
 	return slice
 }
 
+// Trim removes elements which index out of [start, stop)
+func (list *LinkedList) Trim(start int, stop int) {
+	if list == nil {
+		panic("list is nil")
+	}
+	if start < 0 || start > list.size {
+		panic("`start` out of range")
+	}
+	if stop < start || stop > list.size {
+		panic("`stop` out of range")
+	}
+	for list.size > stop {
+		list.removeNode(list.last)
+	}
+	for i := 0; i < start; i++ {
+		list.removeNode(list.first)
+	}
+}
+
 // Make creates a new linked list
 func Make(vals ...interface{}) *LinkedList {
 	list := LinkedList{}
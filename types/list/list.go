@@ -0,0 +1,20 @@
+package list
+
+// List 列表的通用接口, 下标从 0 开始
+type List interface {
+	Add(val interface{})
+	Get(index int) (val interface{})
+	Set(index int, val interface{})
+	Insert(index int, val interface{})
+	Remove(index int) (val interface{})
+	RemoveLast() (val interface{})
+	RemoveAllByVal(val interface{}) int
+	RemoveByVal(val interface{}, count int) int
+	ReverseRemoveByVal(val interface{}, count int) int
+	Len() int
+	ForEach(consumer func(int, interface{}) bool)
+	ReverseForEach(consumer func(int, interface{}) bool)
+	Contains(val interface{}) bool
+	Range(start int, stop int) []interface{}
+	Trim(start int, stop int)
+}
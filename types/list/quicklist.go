@@ -0,0 +1,384 @@
+package list
+
+import (
+	"gedis/pkg/utils"
+)
+
+// pageSize 每页最多保存的元素数量
+const pageSize = 1024
+
+// QuickList 由连续数组组成的页链表, 每页保存多个元素.
+// 相比每个元素一个节点的 LinkedList 减少了指针和小对象的数量, 按下标查找时可以整页跳过
+type QuickList struct {
+	first *page
+	last  *page
+	size  int
+}
+
+type page struct {
+	vals []interface{}
+	prev *page
+	next *page
+}
+
+// MakeQuickList creates a new quick list
+func MakeQuickList(vals ...interface{}) *QuickList {
+	ql := &QuickList{}
+	for _, v := range vals {
+		ql.Add(v)
+	}
+	return ql
+}
+
+// insertPageAfter 在 prev 之后插入新页, prev 为 nil 时插入到头部
+func (ql *QuickList) insertPageAfter(prev *page, vals []interface{}) *page {
+	p := &page{
+		vals: vals,
+		prev: prev,
+	}
+	if prev == nil {
+		p.next = ql.first
+		ql.first = p
+	} else {
+		p.next = prev.next
+		prev.next = p
+	}
+	if p.next == nil {
+		ql.last = p
+	} else {
+		p.next.prev = p
+	}
+	return p
+}
+
+func (ql *QuickList) removePage(p *page) {
+	if p.prev == nil {
+		ql.first = p.next
+	} else {
+		p.prev.next = p.next
+	}
+	if p.next == nil {
+		ql.last = p.prev
+	} else {
+		p.next.prev = p.prev
+	}
+	// for gc
+	p.prev = nil
+	p.next = nil
+}
+
+// Add adds value to the tail
+func (ql *QuickList) Add(val interface{}) {
+	if ql == nil {
+		panic("list is nil")
+	}
+	ql.size++
+	if ql.last != nil && len(ql.last.vals) < pageSize {
+		ql.last.vals = append(ql.last.vals, val)
+		return
+	}
+	// 第一页按需扩容, 避免元素很少的列表也占用一整页; 已经写满一页的列表直接分配整页
+	capacity := 1
+	if ql.last != nil {
+		capacity = pageSize
+	}
+	vals := make([]interface{}, 0, capacity)
+	ql.insertPageAfter(ql.last, append(vals, val))
+}
+
+// find 返回下标所在的页以及在页内的偏移, 从距离较近的一端开始查找
+func (ql *QuickList) find(index int) (*page, int) {
+	if ql == nil {
+		panic("list is nil")
+	}
+	if index < 0 || index >= ql.size {
+		panic("index out of bound")
+	}
+	if index < ql.size/2 {
+		pageBegin := 0
+		for p := ql.first; ; p = p.next {
+			if pageBegin+len(p.vals) > index {
+				return p, index - pageBegin
+			}
+			pageBegin += len(p.vals)
+		}
+	}
+	pageBegin := ql.size
+	for p := ql.last; ; p = p.prev {
+		pageBegin -= len(p.vals)
+		if pageBegin <= index {
+			return p, index - pageBegin
+		}
+	}
+}
+
+// Get returns value at the given index
+func (ql *QuickList) Get(index int) (val interface{}) {
+	p, offset := ql.find(index)
+	return p.vals[offset]
+}
+
+// Set updates value at the given index
+func (ql *QuickList) Set(index int, val interface{}) {
+	p, offset := ql.find(index)
+	p.vals[offset] = val
+}
+
+func insertAt(page []interface{}, offset int, val interface{}) []interface{} {
+	page = append(page, nil)
+	copy(page[offset+1:], page[offset:])
+	page[offset] = val
+	return page
+}
+
+// Insert inserts value at the given index, the original element at the given index will move backward
+func (ql *QuickList) Insert(index int, val interface{}) {
+	if ql == nil {
+		panic("list is nil")
+	}
+	if index == ql.size {
+		ql.Add(val)
+		return
+	}
+	p, offset := ql.find(index)
+	ql.size++
+	if len(p.vals) < pageSize {
+		p.vals = insertAt(p.vals, offset, val)
+		return
+	}
+
+	// 页已满, 拆分为两页
+	half := pageSize / 2
+	nextVals := append([]interface{}(nil), p.vals[half:]...)
+	for i := half; i < len(p.vals); i++ {
+		p.vals[i] = nil // for gc
+	}
+	p.vals = p.vals[:half]
+	if offset < half {
+		p.vals = insertAt(p.vals, offset, val)
+	} else {
+		nextVals = insertAt(nextVals, offset-half, val)
+	}
+	ql.insertPageAfter(p, nextVals)
+}
+
+// removeAt 删除页内的元素, 页为空时删除整页
+func (ql *QuickList) removeAt(p *page, offset int) interface{} {
+	val := p.vals[offset]
+	copy(p.vals[offset:], p.vals[offset+1:])
+	p.vals[len(p.vals)-1] = nil // for gc
+	p.vals = p.vals[:len(p.vals)-1]
+	if len(p.vals) == 0 {
+		ql.removePage(p)
+	}
+	ql.size--
+	return val
+}
+
+// Remove removes value at the given index
+func (ql *QuickList) Remove(index int) (val interface{}) {
+	p, offset := ql.find(index)
+	return ql.removeAt(p, offset)
+}
+
+// RemoveLast removes the last element and returns its value
+func (ql *QuickList) RemoveLast() (val interface{}) {
+	if ql == nil {
+		panic("list is nil")
+	}
+	if ql.size == 0 {
+		return nil
+	}
+	return ql.removeAt(ql.last, len(ql.last.vals)-1)
+}
+
+// removeByVal 从一端开始删除至多 count 个与 val 相等的元素, count <= 0 表示删除全部
+func (ql *QuickList) removeByVal(val interface{}, count int, reverse bool) int {
+	if ql == nil {
+		panic("list is nil")
+	}
+	removed := 0
+	p := ql.first
+	if reverse {
+		p = ql.last
+	}
+	for p != nil && (count <= 0 || removed < count) {
+		next := p.next
+		if reverse {
+			next = p.prev
+		}
+		page := p.vals
+		kept := make([]bool, len(page))
+		for i := range page {
+			j := i
+			if reverse {
+				j = len(page) - 1 - i
+			}
+			if (count <= 0 || removed < count) && utils.Equals(page[j], val) {
+				removed++
+			} else {
+				kept[j] = true
+			}
+		}
+		// 原地压缩
+		size := 0
+		for i, v := range page {
+			if kept[i] {
+				page[size] = v
+				size++
+			}
+		}
+		for i := size; i < len(page); i++ {
+			page[i] = nil // for gc
+		}
+		ql.size -= len(page) - size
+		if size == 0 {
+			ql.removePage(p)
+		} else {
+			p.vals = page[:size]
+		}
+		p = next
+	}
+	return removed
+}
+
+// RemoveAllByVal removes all elements with the given val
+func (ql *QuickList) RemoveAllByVal(val interface{}) int {
+	return ql.removeByVal(val, 0, false)
+}
+
+// RemoveByVal removes at most `count` values of the specified value in this list
+// scan from left to right
+func (ql *QuickList) RemoveByVal(val interface{}, count int) int {
+	return ql.removeByVal(val, count, false)
+}
+
+// ReverseRemoveByVal removes at most `count` values of the specified value in this list
+// scan from right to left
+func (ql *QuickList) ReverseRemoveByVal(val interface{}, count int) int {
+	return ql.removeByVal(val, count, true)
+}
+
+// Len returns the number of elements in list
+func (ql *QuickList) Len() int {
+	if ql == nil {
+		panic("list is nil")
+	}
+	return ql.size
+}
+
+// ForEach visits each element in the list
+// if the consumer returns false, the loop will be break
+func (ql *QuickList) ForEach(consumer func(int, interface{}) bool) {
+	if ql == nil {
+		panic("list is nil")
+	}
+	i := 0
+	for p := ql.first; p != nil; p = p.next {
+		for _, v := range p.vals {
+			if !consumer(i, v) {
+				return
+			}
+			i++
+		}
+	}
+}
+
+// ReverseForEach visits each element in the list from tail to head, the index passed to consumer counts from head
+// if the consumer returns false, the loop will be break
+func (ql *QuickList) ReverseForEach(consumer func(int, interface{}) bool) {
+	if ql == nil {
+		panic("list is nil")
+	}
+	i := ql.size - 1
+	for p := ql.last; p != nil; p = p.prev {
+		for j := len(p.vals) - 1; j >= 0; j-- {
+			if !consumer(i, p.vals[j]) {
+				return
+			}
+			i--
+		}
+	}
+}
+
+// Contains returns whether the given value exist in the list
+func (ql *QuickList) Contains(val interface{}) bool {
+	contains := false
+	ql.ForEach(func(i int, actual interface{}) bool {
+		if utils.Equals(actual, val) {
+			contains = true
+			return false
+		}
+		return true
+	})
+	return contains
+}
+
+// Range returns elements which index within [start, stop)
+func (ql *QuickList) Range(start int, stop int) []interface{} {
+	if ql == nil {
+		panic("list is nil")
+	}
+	if start < 0 || start >= ql.size {
+		panic("`start` out of range")
+	}
+	if stop < start || stop > ql.size {
+		panic("`stop` out of range")
+	}
+	slice := make([]interface{}, 0, stop-start)
+	p, offset := ql.find(start)
+	for len(slice) < stop-start {
+		end := offset + stop - start - len(slice)
+		if end > len(p.vals) {
+			end = len(p.vals)
+		}
+		slice = append(slice, p.vals[offset:end]...)
+		p = p.next
+		offset = 0
+	}
+	return slice
+}
+
+// Trim removes elements which index out of [start, stop)
+func (ql *QuickList) Trim(start int, stop int) {
+	if ql == nil {
+		panic("list is nil")
+	}
+	if start < 0 || start > ql.size {
+		panic("`start` out of range")
+	}
+	if stop < start || stop > ql.size {
+		panic("`stop` out of range")
+	}
+	// 整页删除, 再截断边界所在的页
+	for tail := ql.size - stop; tail > 0; {
+		last := ql.last
+		if len(last.vals) <= tail {
+			ql.removePage(last)
+			ql.size -= len(last.vals)
+			tail -= len(last.vals)
+			continue
+		}
+		for i := len(last.vals) - tail; i < len(last.vals); i++ {
+			last.vals[i] = nil // for gc
+		}
+		last.vals = last.vals[:len(last.vals)-tail]
+		ql.size -= tail
+		tail = 0
+	}
+	for head := start; head > 0; {
+		first := ql.first
+		if len(first.vals) <= head {
+			ql.removePage(first)
+			ql.size -= len(first.vals)
+			head -= len(first.vals)
+			continue
+		}
+		// 复制剩余部分, 避免保留已删除元素所在的底层数组
+		rest := make([]interface{}, len(first.vals)-head)
+		copy(rest, first.vals[head:])
+		first.vals = rest
+		ql.size -= head
+		head = 0
+	}
+}
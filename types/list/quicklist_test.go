@@ -0,0 +1,167 @@
+package list
+
+import (
+	"math/rand"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// 以 LinkedList 为参照随机执行操作
+func TestQuickList(t *testing.T) {
+	ql := MakeQuickList()
+	expected := Make()
+	lists := []List{ql, expected}
+	for i := 0; i < 20000; i++ {
+		size := expected.Len()
+		val := []byte(strconv.Itoa(rand.Intn(50)))
+		switch op := rand.Intn(10); {
+		case op < 3 || size == 0:
+			for _, l := range lists {
+				l.Add(val)
+			}
+		case op < 5:
+			index := rand.Intn(size + 1)
+			for _, l := range lists {
+				l.Insert(index, val)
+			}
+		case op < 6:
+			index := rand.Intn(size)
+			if string(ql.Remove(index).([]byte)) != string(expected.Remove(index).([]byte)) {
+				t.Fatalf("remove %d mismatch", index)
+			}
+		case op < 7:
+			if string(ql.RemoveLast().([]byte)) != string(expected.RemoveLast().([]byte)) {
+				t.Fatal("remove last mismatch")
+			}
+		case op < 8:
+			count := rand.Intn(3) + 1
+			if ql.RemoveByVal(val, count) != expected.RemoveByVal(val, count) {
+				t.Fatal("remove by val mismatch")
+			}
+			if ql.ReverseRemoveByVal(val, count) != expected.ReverseRemoveByVal(val, count) {
+				t.Fatal("reverse remove by val mismatch")
+			}
+		case op < 9:
+			index := rand.Intn(size)
+			for _, l := range lists {
+				l.Set(index, val)
+			}
+		default:
+			if rand.Intn(20) == 0 {
+				start := rand.Intn(size + 1)
+				stop := start + rand.Intn(size-start+1)
+				for _, l := range lists {
+					l.Trim(start, stop)
+				}
+			}
+		}
+		if ql.Len() != expected.Len() {
+			t.Fatalf("len mismatch: %d != %d", ql.Len(), expected.Len())
+		}
+	}
+	if ql.Len() == 0 {
+		return
+	}
+	actual := ql.Range(0, ql.Len())
+	for i, v := range expected.Range(0, expected.Len()) {
+		if string(v.([]byte)) != string(actual[i].([]byte)) || string(v.([]byte)) != string(ql.Get(i).([]byte)) {
+			t.Fatalf("element %d mismatch", i)
+		}
+	}
+	ql.ReverseForEach(func(i int, v interface{}) bool {
+		if string(v.([]byte)) != string(expected.Get(i).([]byte)) {
+			t.Fatalf("reverse element %d mismatch", i)
+		}
+		return true
+	})
+}
+
+// TestQuickListSmallMemory 元素很少的列表不应分配整页
+func TestQuickListSmallMemory(t *testing.T) {
+	const lists = 1000
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	kept := make([]*QuickList, lists)
+	for i := range kept {
+		kept[i] = MakeQuickList([]byte("a"))
+	}
+	runtime.ReadMemStats(&after)
+	if perList := (after.TotalAlloc - before.TotalAlloc) / lists; perList > 256 {
+		t.Errorf("expect one-element list to use at most 256 bytes, actual %d", perList)
+	}
+	runtime.KeepAlive(kept)
+}
+
+const benchmarkListSize = 1000000
+
+func makeBenchmarkList(l List) List {
+	for i := 0; i < benchmarkListSize; i++ {
+		l.Add([]byte(strconv.Itoa(i)))
+	}
+	return l
+}
+
+func BenchmarkLinkedListAdd(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		makeBenchmarkList(Make())
+	}
+}
+
+func BenchmarkQuickListAdd(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		makeBenchmarkList(MakeQuickList())
+	}
+}
+
+func benchmarkGet(b *testing.B, l List) {
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Get(rand.Intn(benchmarkListSize))
+	}
+}
+
+func BenchmarkLinkedListGet(b *testing.B) {
+	benchmarkGet(b, makeBenchmarkList(Make()))
+}
+
+func BenchmarkQuickListGet(b *testing.B) {
+	benchmarkGet(b, makeBenchmarkList(MakeQuickList()))
+}
+
+func benchmarkRange(b *testing.B, l List) {
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := rand.Intn(benchmarkListSize - 100)
+		l.Range(start, start+100)
+	}
+}
+
+func BenchmarkLinkedListRange(b *testing.B) {
+	benchmarkRange(b, makeBenchmarkList(Make()))
+}
+
+func BenchmarkQuickListRange(b *testing.B) {
+	benchmarkRange(b, makeBenchmarkList(MakeQuickList()))
+}
+
+func benchmarkSmall(b *testing.B, makeList func() List) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l := makeList()
+		for j := 0; j < 3; j++ {
+			l.Add([]byte(strconv.Itoa(j)))
+		}
+	}
+}
+
+func BenchmarkLinkedListSmall(b *testing.B) {
+	benchmarkSmall(b, func() List { return Make() })
+}
+
+func BenchmarkQuickListSmall(b *testing.B) {
+	benchmarkSmall(b, func() List { return MakeQuickList() })
+}
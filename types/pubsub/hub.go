@@ -6,16 +6,19 @@ import (
 )
 
 type Hub struct {
-	subs dict.Dict // channel -> list(*Client)
-
-	subsLocker *lock.Locks // lock channel
+	subs     dict.Dict // channel -> list(*Client)
+	patterns dict.Dict // pattern -> *patternSubs
 
+	subsLocker    *lock.Locks // lock channel
+	patternLocker *lock.Locks // lock pattern, 与 channel 分开加锁避免同名时死锁
 }
 
 // MakeHub creates new hub
 func MakeHub() *Hub {
 	return &Hub{
-		subs:       dict.MakeConcurrent(4),
-		subsLocker: lock.Make(16),
+		subs:          dict.MakeConcurrent(4),
+		patterns:      dict.MakeConcurrent(4),
+		subsLocker:    lock.Make(16),
+		patternLocker: lock.Make(16),
 	}
 }
@@ -0,0 +1,188 @@
+package pubsub
+
+import (
+	"gedis/pkg/wildcard"
+	"gedis/reply"
+	"gedis/types/list"
+	"gedis/types/redis"
+	"sort"
+	"strings"
+)
+
+var (
+	_psubscribe   = "psubscribe"
+	_punsubscribe = "punsubscribe"
+	pmessageBytes = []byte("pmessage")
+)
+
+// patternSubs 订阅同一模式的连接, 模式只在第一次订阅时编译
+type patternSubs struct {
+	pattern     *wildcard.Pattern
+	subscribers *list.LinkedList
+}
+
+/*
+ * invoker should lock pattern
+ * return: is new subscribed
+ */
+func psubscribe0(hub *Hub, pattern string, client redis.Connection) bool {
+	client.PSubscribe(pattern)
+
+	raw, ok := hub.patterns.Get(pattern)
+	var subs *patternSubs
+	if ok {
+		subs, _ = raw.(*patternSubs)
+	} else {
+		subs = &patternSubs{
+			pattern:     wildcard.CompilePattern(pattern),
+			subscribers: list.Make(),
+		}
+		hub.patterns.Put(pattern, subs)
+	}
+	if subs.subscribers.Contains(client) {
+		return false
+	}
+	subs.subscribers.Add(client)
+	return true
+}
+
+/*
+ * invoker should lock pattern
+ * return: is actually un-subscribe
+ */
+func punsubscribe0(hub *Hub, pattern string, client redis.Connection) bool {
+	client.PUnSubscribe(pattern)
+
+	raw, ok := hub.patterns.Get(pattern)
+	if ok {
+		subs, _ := raw.(*patternSubs)
+		subs.subscribers.RemoveAllByVal(client)
+
+		if subs.subscribers.Len() == 0 {
+			hub.patterns.Remove(pattern)
+		}
+		return true
+	}
+	return false
+}
+
+// PSubscribe puts the given connection into subscribers of the given patterns
+func PSubscribe(hub *Hub, c redis.Connection, args [][]byte) redis.Reply {
+	patterns := make([]string, len(args))
+	for i, b := range args {
+		patterns[i] = string(b)
+	}
+
+	hub.patternLocker.Locks(patterns...)
+	defer hub.patternLocker.UnLocks(patterns...)
+
+	for _, pattern := range patterns {
+		if psubscribe0(hub, pattern, c) {
+			write(c, makeMsg(_psubscribe, pattern, subsCount(c)))
+		}
+	}
+	return &reply.NoReply{}
+}
+
+// PUnSubscribe removes the given connection from the given patterns, all patterns if no pattern given
+func PUnSubscribe(hub *Hub, c redis.Connection, args [][]byte) redis.Reply {
+	var patterns []string
+	if len(args) > 0 {
+		patterns = make([]string, len(args))
+		for i, b := range args {
+			patterns[i] = string(b)
+		}
+	} else {
+		patterns = c.GetPatterns()
+	}
+
+	hub.patternLocker.Locks(patterns...)
+	defer hub.patternLocker.UnLocks(patterns...)
+
+	if len(patterns) == 0 {
+		write(c, reply.MakePushReply([]redis.Reply{
+			reply.MakeBulkReply([]byte(_punsubscribe)),
+			reply.MakeNullBulkReply(),
+			reply.MakeIntReply(0),
+		}))
+		return &reply.NoReply{}
+	}
+
+	for _, pattern := range patterns {
+		if punsubscribe0(hub, pattern, c) {
+			write(c, makeMsg(_punsubscribe, pattern, subsCount(c)))
+		}
+	}
+	return &reply.NoReply{}
+}
+
+// publishPattern 将消息发送给模式匹配 channel 的连接
+func publishPattern(hub *Hub, channel string, message []byte) int {
+	receivers := 0
+	// 先取出模式列表再逐个加锁, 避免遍历 dict 时持有分段锁去等待模式锁
+	for _, pattern := range hub.patterns.Keys() {
+		hub.patternLocker.Lock(pattern)
+		raw, ok := hub.patterns.Get(pattern)
+		if ok {
+			subs, _ := raw.(*patternSubs)
+			if subs.pattern.IsMatch(channel) {
+				subs.subscribers.ForEach(func(i int, c interface{}) bool {
+					client, _ := c.(redis.Connection)
+					write(client, reply.MakePushReply([]redis.Reply{
+						reply.MakeBulkReply(pmessageBytes),
+						reply.MakeBulkReply([]byte(pattern)),
+						reply.MakeBulkReply([]byte(channel)),
+						reply.MakeBulkReply(message),
+					}))
+					return true
+				})
+				receivers += subs.subscribers.Len()
+			}
+		}
+		hub.patternLocker.UnLock(pattern)
+	}
+	return receivers
+}
+
+// PubSub 查询订阅状态: PUBSUB CHANNELS [pattern], PUBSUB NUMSUB [channel ...], PUBSUB NUMPAT
+func PubSub(hub *Hub, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("pubsub")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "channels":
+		if len(args) > 2 {
+			return reply.MakeArgNumErrReply("pubsub|channels")
+		}
+		var pattern *wildcard.Pattern
+		if len(args) == 2 {
+			pattern = wildcard.CompilePattern(string(args[1]))
+		}
+		channels := hub.subs.Keys()
+		sort.Strings(channels)
+		result := make([][]byte, 0, len(channels))
+		for _, channel := range channels {
+			if pattern == nil || pattern.IsMatch(channel) {
+				result = append(result, []byte(channel))
+			}
+		}
+		return reply.MakeMultiBulkReply(result)
+	case "numsub":
+		result := make([]redis.Reply, 0, 2*(len(args)-1))
+		for _, arg := range args[1:] {
+			count := 0
+			if raw, ok := hub.subs.Get(string(arg)); ok {
+				count = raw.(*list.LinkedList).Len()
+			}
+			result = append(result, reply.MakeBulkReply(arg), reply.MakeIntReply(int64(count)))
+		}
+		return reply.MakeMapReply(result)
+	case "numpat":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("pubsub|numpat")
+		}
+		return reply.MakeIntReply(int64(hub.patterns.Len()))
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try PUBSUB HELP.")
+}
@@ -4,20 +4,31 @@ import (
 	"gedis/reply"
 	"gedis/types/list"
 	"gedis/types/redis"
-	"strconv"
 )
 
 var (
-	_subscribe         = "subscribe"
-	_unsubscribe       = "unsubscribe"
-	messageBytes       = []byte("message")
-	unSubscribeNothing = []byte("*3\r\n$11\r\nunsubscribe\r\n$-1\n:0\r\n")
+	_subscribe   = "subscribe"
+	_unsubscribe = "unsubscribe"
+	messageBytes = []byte("message")
 )
 
-func makeMsg(t string, channel string, code int64) []byte {
-	return []byte("*3\r\n$" + strconv.FormatInt(int64(len(t)), 10) + reply.CRLF + t + reply.CRLF +
-		"$" + strconv.FormatInt(int64(len(channel)), 10) + reply.CRLF + channel + reply.CRLF +
-		":" + strconv.FormatInt(code, 10) + reply.CRLF)
+// makeMsg 订阅状态变化的通知, RESP3 客户端收到的是 push 消息
+func makeMsg(t string, channel string, code int64) redis.Reply {
+	return reply.MakePushReply([]redis.Reply{
+		reply.MakeBulkReply([]byte(t)),
+		reply.MakeBulkReply([]byte(channel)),
+		reply.MakeIntReply(code),
+	})
+}
+
+// subsCount 连接订阅的频道和模式总数
+func subsCount(c redis.Connection) int64 {
+	return int64(c.SubsCount() + c.PSubsCount())
+}
+
+// write 按连接协商的协议版本发送消息
+func write(c redis.Connection, msg redis.Reply) {
+	_ = c.Write(reply.Encode(msg, c.GetProtocol()))
 }
 
 /*
@@ -77,7 +88,7 @@ func Subscribe(hub *Hub, c redis.Connection, args [][]byte) redis.Reply {
 
 	for _, channel := range channels {
 		if subscribe0(hub, channel, c) {
-			_ = c.Write(makeMsg(_subscribe, channel, int64(c.SubsCount())))
+			write(c, makeMsg(_subscribe, channel, subsCount(c)))
 		}
 	}
 	return &reply.NoReply{}
@@ -94,6 +105,13 @@ func UnsubscribeAll(hub *Hub, c redis.Connection) {
 		unsubscribe0(hub, channel, c)
 	}
 
+	patterns := c.GetPatterns()
+	hub.patternLocker.Locks(patterns...)
+	defer hub.patternLocker.UnLocks(patterns...)
+
+	for _, pattern := range patterns {
+		punsubscribe0(hub, pattern, c)
+	}
 }
 
 // UnSubscribe removes the given connection from the given channel
@@ -112,13 +130,17 @@ func UnSubscribe(db *Hub, c redis.Connection, args [][]byte) redis.Reply {
 	defer db.subsLocker.UnLocks(channels...)
 
 	if len(channels) == 0 {
-		_ = c.Write(unSubscribeNothing)
+		write(c, reply.MakePushReply([]redis.Reply{
+			reply.MakeBulkReply([]byte(_unsubscribe)),
+			reply.MakeNullBulkReply(),
+			reply.MakeIntReply(0),
+		}))
 		return &reply.NoReply{}
 	}
 
 	for _, channel := range channels {
 		if unsubscribe0(db, channel, c) {
-			_ = c.Write(makeMsg(_unsubscribe, channel, int64(c.SubsCount())))
+			write(c, makeMsg(_unsubscribe, channel, subsCount(c)))
 		}
 	}
 	return &reply.NoReply{}
@@ -132,22 +154,28 @@ func Publish(hub *Hub, args [][]byte) redis.Reply {
 	channel := string(args[0])
 	message := args[1]
 
+	receivers := publishChannel(hub, channel, message) + publishPattern(hub, channel, message)
+	return reply.MakeIntReply(int64(receivers))
+}
+
+// publishChannel 将消息发送给订阅了 channel 的连接
+func publishChannel(hub *Hub, channel string, message []byte) int {
 	hub.subsLocker.Lock(channel)
 	defer hub.subsLocker.UnLock(channel)
 
 	raw, ok := hub.subs.Get(channel)
 	if !ok {
-		return reply.MakeIntReply(0)
+		return 0
 	}
 	subscribers, _ := raw.(*list.LinkedList)
 	subscribers.ForEach(func(i int, c interface{}) bool {
 		client, _ := c.(redis.Connection)
-		replyArgs := make([][]byte, 3)
-		replyArgs[0] = messageBytes
-		replyArgs[1] = []byte(channel)
-		replyArgs[2] = message
-		_ = client.Write(reply.MakeMultiBulkReply(replyArgs).ToBytes())
+		write(client, reply.MakePushReply([]redis.Reply{
+			reply.MakeBulkReply(messageBytes),
+			reply.MakeBulkReply([]byte(channel)),
+			reply.MakeBulkReply(message),
+		}))
 		return true
 	})
-	return reply.MakeIntReply(int64(subscribers.Len()))
+	return subscribers.Len()
 }
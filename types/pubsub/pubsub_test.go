@@ -0,0 +1,102 @@
+package pubsub
+
+import (
+	"gedis/pkg/utils"
+	"gedis/reply"
+	"gedis/types/redis/connection"
+	"testing"
+)
+
+func TestPatternSubscribe(t *testing.T) {
+	hub := MakeHub()
+	c1 := &connection.FakeConn{}
+	c2 := &connection.FakeConn{}
+	PSubscribe(hub, c1, utils.ToCmdLine("news.*", "h?llo"))
+	expect := "*3\r\n$10\r\npsubscribe\r\n$6\r\nnews.*\r\n:1\r\n" + "*3\r\n$10\r\npsubscribe\r\n$5\r\nh?llo\r\n:2\r\n"
+	if actual := string(c1.Bytes()); actual != expect {
+		t.Errorf("expect %q, actual %q", expect, actual)
+	}
+	Subscribe(hub, c2, utils.ToCmdLine("news.tech"))
+	PSubscribe(hub, c2, utils.ToCmdLine("news.*"))
+	c1.Clean()
+	c2.Clean()
+
+	// c2 同时通过频道和模式收到消息
+	if result := Publish(hub, utils.ToCmdLine("news.tech", "hi")); string(result.ToBytes()) != ":3\r\n" {
+		t.Errorf("expect 3 receivers, actual %s", result.ToBytes())
+	}
+	expect = "*4\r\n$8\r\npmessage\r\n$6\r\nnews.*\r\n$9\r\nnews.tech\r\n$2\r\nhi\r\n"
+	if actual := string(c1.Bytes()); actual != expect {
+		t.Errorf("expect %q, actual %q", expect, actual)
+	}
+	expect = "*3\r\n$7\r\nmessage\r\n$9\r\nnews.tech\r\n$2\r\nhi\r\n" + expect
+	if actual := string(c2.Bytes()); actual != expect {
+		t.Errorf("expect %q, actual %q", expect, actual)
+	}
+
+	// RESP3 客户端收到 push 消息
+	c1.Clean()
+	c1.SetProtocol(reply.Resp3)
+	Publish(hub, utils.ToCmdLine("hello", "x"))
+	expect = ">4\r\n$8\r\npmessage\r\n$5\r\nh?llo\r\n$5\r\nhello\r\n$1\r\nx\r\n"
+	if actual := string(c1.Bytes()); actual != expect {
+		t.Errorf("expect %q, actual %q", expect, actual)
+	}
+	c1.SetProtocol(reply.Resp2)
+
+	c1.Clean()
+	PUnSubscribe(hub, c1, utils.ToCmdLine("h?llo"))
+	expect = "*3\r\n$12\r\npunsubscribe\r\n$5\r\nh?llo\r\n:1\r\n"
+	if actual := string(c1.Bytes()); actual != expect {
+		t.Errorf("expect %q, actual %q", expect, actual)
+	}
+	if result := Publish(hub, utils.ToCmdLine("hello", "x")); string(result.ToBytes()) != ":0\r\n" {
+		t.Errorf("expect 0 receivers, actual %s", result.ToBytes())
+	}
+
+	// 不带参数时退订所有模式
+	c1.Clean()
+	PUnSubscribe(hub, c1, nil)
+	PUnSubscribe(hub, c1, nil)
+	expect = "*3\r\n$12\r\npunsubscribe\r\n$6\r\nnews.*\r\n:0\r\n" + "*3\r\n$12\r\npunsubscribe\r\n$-1\r\n:0\r\n"
+	if actual := string(c1.Bytes()); actual != expect {
+		t.Errorf("expect %q, actual %q", expect, actual)
+	}
+}
+
+func TestPubSubIntrospection(t *testing.T) {
+	hub := MakeHub()
+	c1 := &connection.FakeConn{}
+	c2 := &connection.FakeConn{}
+	Subscribe(hub, c1, utils.ToCmdLine("news.tech", "news.art", "weather"))
+	Subscribe(hub, c2, utils.ToCmdLine("news.tech"))
+	PSubscribe(hub, c1, utils.ToCmdLine("news.*"))
+	PSubscribe(hub, c2, utils.ToCmdLine("news.*", "w*"))
+
+	cases := []struct {
+		cmdLine []string
+		expect  string
+	}{
+		{[]string{"CHANNELS"}, "*3\r\n$8\r\nnews.art\r\n$9\r\nnews.tech\r\n$7\r\nweather\r\n"},
+		{[]string{"CHANNELS", "news.*"}, "*2\r\n$8\r\nnews.art\r\n$9\r\nnews.tech\r\n"},
+		{[]string{"NUMSUB", "news.tech", "weather", "none"}, "*6\r\n$9\r\nnews.tech\r\n:2\r\n$7\r\nweather\r\n:1\r\n$4\r\nnone\r\n:0\r\n"},
+		{[]string{"NUMSUB"}, "*0\r\n"},
+		{[]string{"NUMPAT"}, ":2\r\n"},
+		{[]string{"NUMPAT", "x"}, "-ERR wrong number of arguments for 'pubsub|numpat' command\r\n"},
+		{[]string{"HELP2"}, "-ERR unknown subcommand 'HELP2'. Try PUBSUB HELP.\r\n"},
+	}
+	for _, c := range cases {
+		if actual := string(PubSub(hub, utils.ToCmdLine(c.cmdLine...)).ToBytes()); actual != c.expect {
+			t.Errorf("PUBSUB %v: expect %q, actual %q", c.cmdLine, c.expect, actual)
+		}
+	}
+
+	// 连接关闭后清理所有订阅
+	UnsubscribeAll(hub, c2)
+	if actual := string(PubSub(hub, utils.ToCmdLine("NUMPAT")).ToBytes()); actual != ":1\r\n" {
+		t.Errorf("expect 1 pattern, actual %q", actual)
+	}
+	if actual := string(PubSub(hub, utils.ToCmdLine("NUMSUB", "news.tech")).ToBytes()); actual != "*2\r\n$9\r\nnews.tech\r\n:1\r\n" {
+		t.Errorf("expect 1 subscriber, actual %q", actual)
+	}
+}
@@ -20,6 +20,12 @@ type Connection interface {
 	SubsCount() int
 	GetChannels() []string
 
+	// client should keep its subscribing patterns
+	PSubscribe(pattern string)
+	PUnSubscribe(pattern string)
+	PSubsCount() int
+	GetPatterns() []string
+
 	InMultiState() bool
 	SetMultiState(bool)
 	GetQueuedCmdLine() [][][]byte
@@ -28,5 +34,11 @@ type Connection interface {
 	GetWatching() map[string]uint32
 	GetDBIndex() int
 	SelectDB(int)
+
+	// RESP protocol version negotiated by HELLO, 2 by default
+	GetProtocol() int
+	SetProtocol(int)
 	ProcessCommand(fn Func, closeFn CloseFunc)
+	// Done is closed when the client disconnects, blocking commands use it to stop waiting
+	Done() <-chan struct{}
 }
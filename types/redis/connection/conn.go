@@ -15,6 +15,9 @@ import (
 
 const DefaultDbIndex = 0
 
+// pendingPayloads 命令阻塞期间可以缓存的后续请求数量
+const pendingPayloads = 1024
+
 var (
 	unknownErrReplyBytes = []byte("-ERR unknown\r\n")
 )
@@ -25,9 +28,13 @@ type Connection struct {
 	password   string
 	selectedDB int
 	subs       map[string]bool // subscribing channels
+	psubs      map[string]bool // subscribing patterns
 	queue      [][][]byte
 	watching   map[string]uint32
-	multiState bool // queued commands for `multi`
+	multiState bool          // queued commands for `multi`
+	protocol   int           // RESP protocol version, 0 means RESP2
+	done       chan struct{} // closed when connection closed
+	closeOnce  sync.Once
 	redis.Connection
 }
 
@@ -36,6 +43,7 @@ func NewConn(conn net.Conn) *Connection {
 		conn:       conn,
 		selectedDB: DefaultDbIndex,
 		password:   "",
+		done:       make(chan struct{}),
 	}
 }
 
@@ -44,9 +52,23 @@ func (c *Connection) RemoteAddr() net.Addr {
 }
 
 func (c *Connection) Close() error {
+	c.markClosed()
 	return c.conn.Close()
 }
 
+// Done 连接关闭时被关闭的通道, 阻塞命令通过它感知客户端断开
+func (c *Connection) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Connection) markClosed() {
+	c.closeOnce.Do(func() {
+		if c.done != nil {
+			close(c.done)
+		}
+	})
+}
+
 func (c *Connection) Write(b []byte) error {
 	if len(b) == 0 {
 		return nil
@@ -132,6 +154,54 @@ func (c *Connection) SelectDB(dbNum int) {
 	c.selectedDB = dbNum
 }
 
+// GetProtocol returns RESP protocol version of the connection
+func (c *Connection) GetProtocol() int {
+	if c.protocol == 0 {
+		return reply.Resp2
+	}
+	return c.protocol
+}
+
+// SetProtocol sets RESP protocol version, called by HELLO
+func (c *Connection) SetProtocol(protocol int) {
+	c.protocol = protocol
+}
+
+// GetPatterns returns all subscribing patterns
+func (c *Connection) GetPatterns() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	patterns := make([]string, 0, len(c.psubs))
+	for pattern := range c.psubs {
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// PSubscribe add current connection into subscribers of the given pattern
+func (c *Connection) PSubscribe(pattern string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.psubs == nil {
+		c.psubs = make(map[string]bool)
+	}
+	c.psubs[pattern] = true
+}
+
+// PUnSubscribe removes current connection from subscribers of the given pattern
+func (c *Connection) PUnSubscribe(pattern string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.psubs, pattern)
+}
+
+// PSubsCount returns the number of subscribing patterns
+func (c *Connection) PSubsCount() int {
+	return len(c.psubs)
+}
+
 // Subscribe add current connection into subscribers of the given channel
 func (c *Connection) Subscribe(channel string) {
 	c.mu.Lock()
@@ -160,13 +230,11 @@ func (c *Connection) SubsCount() int {
 }
 
 func (c *Connection) ProcessCommand(fn redis.Func, closeFn redis.CloseFunc) {
-	ch := parser.ParseStream(c.conn)
+	ch := c.watchClose(parser.ParseStream(c.conn))
 
 	for payload := range ch {
 		if payload.Err != nil {
-			if payload.Err == io.EOF ||
-				payload.Err == io.ErrUnexpectedEOF ||
-				strings.Contains(payload.Err.Error(), "use of closed network connection") {
+			if isClosedErr(payload.Err) {
 				closeFn() // connection closed
 				logger.Info("connection closed: " + c.RemoteAddr().String())
 				return
@@ -193,13 +261,34 @@ func (c *Connection) ProcessCommand(fn redis.Func, closeFn redis.CloseFunc) {
 		logger.Debug(fmt.Sprintf("执行命令: %s", r))
 		result := fn(&r.Args)
 		if result != nil {
-			_ = c.Write(result.ToBytes())
+			_ = c.Write(reply.Encode(result, c.GetProtocol()))
 		} else {
 			_ = c.Write(unknownErrReplyBytes)
 		}
 	}
 }
 
+// watchClose 转发解析结果, 读到连接断开时立即关闭 done, 使阻塞中的命令能及时退出
+func (c *Connection) watchClose(in <-chan *parser.Payload) <-chan *parser.Payload {
+	out := make(chan *parser.Payload, pendingPayloads)
+	go func() {
+		defer close(out)
+		for payload := range in {
+			if payload.Err != nil && isClosedErr(payload.Err) {
+				c.markClosed()
+			}
+			out <- payload
+		}
+	}()
+	return out
+}
+
+func isClosedErr(err error) bool {
+	return err == io.EOF ||
+		err == io.ErrUnexpectedEOF ||
+		strings.Contains(err.Error(), "use of closed network connection")
+}
+
 // FakeConn implements redis.Connection for test
 type FakeConn struct {
 	Connection
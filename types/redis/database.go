@@ -21,4 +21,8 @@ type EmbedDB interface {
 
 type DataEntity struct {
 	Data interface{}
+
+	// 以下字段用于 maxmemory 淘汰, 由 database 维护
+	Size   int64  // 估算的内存占用(字节)
+	Access uint32 // LRU: 最近访问的 unix 时间(秒); LFU: 高 16 位为最近衰减时间(分钟), 低 8 位为对数访问计数
 }
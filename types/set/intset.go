@@ -0,0 +1,60 @@
+package set
+
+import (
+	"sort"
+	"strconv"
+)
+
+// 小的集合使用紧凑编码: 全部成员为整数时使用有序的 intset, 否则使用 listpack,
+// 超过阈值后转换为 hashtable 编码, 转换是单向的
+var (
+	MaxIntsetEntries   = 512 // set-max-intset-entries
+	MaxListpackEntries = 128 // set-max-listpack-entries
+	MaxListpackValue   = 64  // set-max-listpack-value
+)
+
+// 编码名称, 与 OBJECT ENCODING 的返回值一致
+const (
+	EncodingIntset    = "intset"
+	EncodingListpack  = "listpack"
+	EncodingHashtable = "hashtable"
+)
+
+// parseInt 与 redis 的 string2ll 一致, 只接受规范形式的整数, 保证转换回字符串后与原值相同
+func parseInt(val string) (int64, bool) {
+	i, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || strconv.FormatInt(i, 10) != val {
+		return 0, false
+	}
+	return i, true
+}
+
+type intset []int64
+
+// search 返回 val 的下标或应当插入的位置
+func (is intset) search(val int64) (int, bool) {
+	i := sort.Search(len(is), func(i int) bool {
+		return is[i] >= val
+	})
+	return i, i < len(is) && is[i] == val
+}
+
+func (is *intset) add(val int64) bool {
+	i, found := is.search(val)
+	if found {
+		return false
+	}
+	*is = append(*is, 0)
+	copy((*is)[i+1:], (*is)[i:])
+	(*is)[i] = val
+	return true
+}
+
+func (is *intset) remove(val int64) bool {
+	i, found := is.search(val)
+	if !found {
+		return false
+	}
+	*is = append((*is)[:i], (*is)[i+1:]...)
+	return true
+}
@@ -1,16 +1,23 @@
 package set
 
-import "gedis/types/dict"
+import (
+	"gedis/types/dict"
+	"math/rand"
+	"strconv"
+)
 
-// Set is a set of elements based on hash table
+// Set is a set of elements based on hash table, 小的集合使用 intset 或 listpack 编码
 type Set struct {
-	dict dict.Dict
+	encoding string
+	intset   intset   // EncodingIntset 时使用
+	listpack []string // EncodingListpack 时使用
+	dict     dict.Dict
 }
 
 // Make creates a new set
 func Make(members ...string) *Set {
 	set := &Set{
-		dict: dict.MakeSimple(),
+		encoding: EncodingIntset,
 	}
 	for _, member := range members {
 		set.Add(member)
@@ -18,24 +25,117 @@ func Make(members ...string) *Set {
 	return set
 }
 
+// Encoding returns the name of the underlying encoding
+func (set *Set) Encoding() string {
+	return set.encoding
+}
+
+func (set *Set) convertToListpack() {
+	set.listpack = make([]string, len(set.intset), len(set.intset)+1)
+	for i, val := range set.intset {
+		set.listpack[i] = strconv.FormatInt(val, 10)
+	}
+	set.intset = nil
+	set.encoding = EncodingListpack
+}
+
+func (set *Set) convertToHashtable() {
+	set.dict = dict.MakeSimple()
+	set.ForEach(func(member string) bool {
+		set.dict.Put(member, nil)
+		return true
+	})
+	set.intset = nil
+	set.listpack = nil
+	set.encoding = EncodingHashtable
+}
+
+// findInListpack 返回成员在 listpack 中的下标, 不存在时返回 -1
+func (set *Set) findInListpack(val string) int {
+	for i, member := range set.listpack {
+		if member == val {
+			return i
+		}
+	}
+	return -1
+}
+
 // Add adds member into set
 func (set *Set) Add(val string) int {
+	switch set.encoding {
+	case EncodingIntset:
+		if i, ok := parseInt(val); ok {
+			if !set.intset.add(i) {
+				return 0
+			}
+			if len(set.intset) > MaxIntsetEntries {
+				set.convertToHashtable()
+			}
+			return 1
+		}
+		if len(set.intset) < MaxListpackEntries && len(val) <= MaxListpackValue {
+			set.convertToListpack()
+		} else {
+			set.convertToHashtable()
+		}
+		return set.Add(val)
+	case EncodingListpack:
+		if set.findInListpack(val) >= 0 {
+			return 0
+		}
+		set.listpack = append(set.listpack, val)
+		if len(set.listpack) > MaxListpackEntries || len(val) > MaxListpackValue {
+			set.convertToHashtable()
+		}
+		return 1
+	}
 	return set.dict.Put(val, nil)
 }
 
 // Remove removes member from set
 func (set *Set) Remove(val string) int {
+	switch set.encoding {
+	case EncodingIntset:
+		if i, ok := parseInt(val); ok && set.intset.remove(i) {
+			return 1
+		}
+		return 0
+	case EncodingListpack:
+		i := set.findInListpack(val)
+		if i < 0 {
+			return 0
+		}
+		set.listpack = append(set.listpack[:i], set.listpack[i+1:]...)
+		return 1
+	}
 	return set.dict.Remove(val)
 }
 
 // Has returns true if the val exists in the set
 func (set *Set) Has(val string) bool {
+	switch set.encoding {
+	case EncodingIntset:
+		i, ok := parseInt(val)
+		if !ok {
+			return false
+		}
+		_, found := set.intset.search(i)
+		return found
+	case EncodingListpack:
+		return set.findInListpack(val) >= 0
+	}
 	_, exists := set.dict.Get(val)
 	return exists
 }
 
 // Len returns number of members in the set
 func (set *Set) Len() int {
+	switch set.encoding {
+	case EncodingIntset:
+		return len(set.intset)
+	case EncodingListpack:
+		return len(set.listpack)
+	}
 	return set.dict.Len()
 }
 
@@ -43,12 +143,12 @@ func (set *Set) Len() int {
 func (set *Set) ToSlice() []string {
 	slice := make([]string, set.Len())
 	i := 0
-	set.dict.ForEach(func(key string, val interface{}) bool {
+	set.ForEach(func(member string) bool {
 		if i < len(slice) {
-			slice[i] = key
+			slice[i] = member
 		} else {
 			// set extended during traversal
-			slice = append(slice, key)
+			slice = append(slice, member)
 		}
 		i++
 		return true
@@ -58,6 +158,22 @@ func (set *Set) ToSlice() []string {
 
 // ForEach visits each member in the set
 func (set *Set) ForEach(consumer func(member string) bool) {
+	switch set.encoding {
+	case EncodingIntset:
+		for _, val := range set.intset {
+			if !consumer(strconv.FormatInt(val, 10)) {
+				return
+			}
+		}
+		return
+	case EncodingListpack:
+		for _, member := range set.listpack {
+			if !consumer(member) {
+				return
+			}
+		}
+		return
+	}
 	set.dict.ForEach(func(key string, val interface{}) bool {
 		return consumer(key)
 	})
@@ -112,12 +228,54 @@ func (set *Set) Diff(another *Set) *Set {
 	return result
 }
 
+// getByIndex returns the member at the given position of compact encoding
+func (set *Set) getByIndex(i int) string {
+	if set.encoding == EncodingIntset {
+		return strconv.FormatInt(set.intset[i], 10)
+	}
+	return set.listpack[i]
+}
+
 // RandomMembers randomly returns keys of the given number, may contain duplicated key
 func (set *Set) RandomMembers(limit int) []string {
-	return set.dict.RandomKeys(limit)
+	if set.encoding == EncodingHashtable {
+		return set.dict.RandomKeys(limit)
+	}
+	size := set.Len()
+	if size == 0 {
+		return nil
+	}
+	result := make([]string, limit)
+	for i := range result {
+		result[i] = set.getByIndex(rand.Intn(size))
+	}
+	return result
 }
 
 // RandomDistinctMembers randomly returns keys of the given number, won't contain duplicated key
 func (set *Set) RandomDistinctMembers(limit int) []string {
-	return set.dict.RandomDistinctKeys(limit)
+	if set.encoding == EncodingHashtable {
+		return set.dict.RandomDistinctKeys(limit)
+	}
+	size := set.Len()
+	if limit >= size {
+		return set.ToSlice()
+	}
+	result := make([]string, limit)
+	for i, index := range rand.Perm(size)[:limit] {
+		result[i] = set.getByIndex(index)
+	}
+	return result
+}
+
+// Scan visits at most count members start from the given cursor and returns the next cursor, 0 means finished.
+// 与 redis 一致, 紧凑编码的集合一次返回全部成员
+func (set *Set) Scan(cursor uint64, count int, consumer func(member string) bool) uint64 {
+	if set.encoding != EncodingHashtable {
+		set.ForEach(consumer)
+		return 0
+	}
+	return set.dict.Scan(cursor, count, func(key string, val interface{}) bool {
+		return consumer(key)
+	})
 }
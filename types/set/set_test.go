@@ -0,0 +1,43 @@
+package set
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestSetEncoding(t *testing.T) {
+	set := Make("1", "2", "3")
+	if set.Encoding() != EncodingIntset {
+		t.Fatalf("expect intset, actual %s", set.Encoding())
+	}
+	// 非规范形式的整数不能保存在 intset 中
+	if set.Add("01") != 1 || set.Encoding() != EncodingListpack || !set.Has("1") || !set.Has("01") {
+		t.Fatalf("expect listpack with both 1 and 01, actual %s", set.Encoding())
+	}
+	if set.Add("1") != 0 || set.Remove("2") != 1 || set.Len() != 3 {
+		t.Fatalf("unexpected members %v", set.ToSlice())
+	}
+	for i := 0; set.Len() <= MaxListpackEntries; i++ {
+		set.Add("m" + strconv.Itoa(i))
+	}
+	if set.Encoding() != EncodingHashtable || !set.Has("01") || !set.Has("m0") {
+		t.Fatalf("expect hashtable after exceeding %d entries, actual %s", MaxListpackEntries, set.Encoding())
+	}
+
+	ints := Make()
+	for i := 0; i <= MaxIntsetEntries; i++ {
+		ints.Add(strconv.Itoa(-i))
+	}
+	if ints.Encoding() != EncodingHashtable || ints.Len() != MaxIntsetEntries+1 {
+		t.Fatalf("expect hashtable after exceeding %d entries, actual %s", MaxIntsetEntries, ints.Encoding())
+	}
+
+	long := Make("1")
+	long.Add(string(make([]byte, MaxListpackValue+1)))
+	if long.Encoding() != EncodingHashtable || long.Len() != 2 {
+		t.Fatalf("expect hashtable for long member, actual %s", long.Encoding())
+	}
+	if members := long.RandomDistinctMembers(5); len(members) != 2 {
+		t.Fatalf("expect 2 members, actual %d", len(members))
+	}
+}
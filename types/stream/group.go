@@ -0,0 +1,172 @@
+package stream
+
+import "sort"
+
+// PendingEntry 已经投递给消费者但还没有确认的条目
+type PendingEntry struct {
+	ID            ID
+	Consumer      string
+	DeliveryTime  int64 // 最后一次投递的时间, unix 毫秒
+	DeliveryCount int64
+}
+
+// Consumer 消费组中的消费者
+type Consumer struct {
+	Name     string
+	SeenTime int64 // 最后一次活动的时间, unix 毫秒
+}
+
+// Group 消费组, 记录已投递的最大 ID 和待确认列表(PEL)
+type Group struct {
+	Name      string
+	LastID    ID
+	pending   []*PendingEntry // 按 ID 排序
+	consumers map[string]*Consumer
+}
+
+// CreateGroup 创建消费组, 已存在时返回 false
+func (s *Stream) CreateGroup(name string, lastID ID) (*Group, bool) {
+	if _, ok := s.groups[name]; ok {
+		return nil, false
+	}
+	group := &Group{
+		Name:      name,
+		LastID:    lastID,
+		consumers: make(map[string]*Consumer),
+	}
+	s.groups[name] = group
+	return group, true
+}
+
+// Group returns consumer group of given name
+func (s *Stream) Group(name string) (*Group, bool) {
+	group, ok := s.groups[name]
+	return group, ok
+}
+
+// DestroyGroup removes consumer group
+func (s *Stream) DestroyGroup(name string) bool {
+	if _, ok := s.groups[name]; !ok {
+		return false
+	}
+	delete(s.groups, name)
+	return true
+}
+
+// Groups 按名称排序的所有消费组
+func (s *Stream) Groups() []*Group {
+	groups := make([]*Group, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
+
+// Consumer returns consumer of given name
+func (g *Group) Consumer(name string) (*Consumer, bool) {
+	consumer, ok := g.consumers[name]
+	return consumer, ok
+}
+
+// CreateConsumer 创建消费者, 已存在时返回已有的消费者和 false
+func (g *Group) CreateConsumer(name string, now int64) (*Consumer, bool) {
+	if consumer, ok := g.consumers[name]; ok {
+		return consumer, false
+	}
+	consumer := &Consumer{Name: name, SeenTime: now}
+	g.consumers[name] = consumer
+	return consumer, true
+}
+
+// DeleteConsumer 删除消费者及其待确认条目, 返回删除的待确认条目数量
+func (g *Group) DeleteConsumer(name string) int {
+	if _, ok := g.consumers[name]; !ok {
+		return 0
+	}
+	delete(g.consumers, name)
+	kept := g.pending[:0]
+	for _, pe := range g.pending {
+		if pe.Consumer != name {
+			kept = append(kept, pe)
+		}
+	}
+	removed := len(g.pending) - len(kept)
+	for i := len(kept); i < len(g.pending); i++ {
+		g.pending[i] = nil
+	}
+	g.pending = kept
+	return removed
+}
+
+// Consumers 按名称排序的所有消费者
+func (g *Group) Consumers() []*Consumer {
+	consumers := make([]*Consumer, 0, len(g.consumers))
+	for _, consumer := range g.consumers {
+		consumers = append(consumers, consumer)
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Name < consumers[j].Name
+	})
+	return consumers
+}
+
+func (g *Group) searchPending(id ID) int {
+	return sort.Search(len(g.pending), func(i int) bool {
+		return !g.pending[i].ID.Less(id)
+	})
+}
+
+// Pending returns pending entry of given id
+func (g *Group) Pending(id ID) (*PendingEntry, bool) {
+	i := g.searchPending(id)
+	if i < len(g.pending) && g.pending[i].ID == id {
+		return g.pending[i], true
+	}
+	return nil, false
+}
+
+// PendingLen returns number of pending entries
+func (g *Group) PendingLen() int {
+	return len(g.pending)
+}
+
+// AddPending 加入或替换待确认条目
+func (g *Group) AddPending(pe *PendingEntry) {
+	i := g.searchPending(pe.ID)
+	if i < len(g.pending) && g.pending[i].ID == pe.ID {
+		g.pending[i] = pe
+		return
+	}
+	g.pending = append(g.pending, nil)
+	copy(g.pending[i+1:], g.pending[i:])
+	g.pending[i] = pe
+}
+
+// Ack 确认条目, 不在待确认列表中时返回 false
+func (g *Group) Ack(id ID) bool {
+	i := g.searchPending(id)
+	if i == len(g.pending) || g.pending[i].ID != id {
+		return false
+	}
+	copy(g.pending[i:], g.pending[i+1:])
+	g.pending[len(g.pending)-1] = nil
+	g.pending = g.pending[:len(g.pending)-1]
+	return true
+}
+
+// PendingRange 返回 ID 在 [start, end] 之间且满足 filter 的待确认条目, count <= 0 表示不限制数量
+func (g *Group) PendingRange(start, end ID, count int, filter func(pe *PendingEntry) bool) []*PendingEntry {
+	var result []*PendingEntry
+	for _, pe := range g.pending[g.searchPending(start):] {
+		if end.Less(pe.ID) || (count > 0 && len(result) >= count) {
+			break
+		}
+		if filter == nil || filter(pe) {
+			result = append(result, pe)
+		}
+	}
+	return result
+}
@@ -0,0 +1,329 @@
+// Package stream 流数据结构, 按 ID 有序追加的日志
+package stream
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// nodeSize 每个节点最多保存的条目数, 条目按 ID 顺序分块存储, 追加和按 ID 查找都不需要移动整个日志
+const nodeSize = 128
+
+// ErrInvalidID ID 格式错误
+var ErrInvalidID = errors.New("ERR Invalid stream ID specified as stream command argument")
+
+// ID 条目 ID, 格式为 <毫秒时间戳>-<序号>
+type ID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MinID 最小的 ID 0-0
+var MinID = ID{}
+
+// MaxID 最大的 ID
+var MaxID = ID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+// ParseID 解析 <ms>-<seq>, 省略序号时使用 defaultSeq
+func ParseID(s string, defaultSeq uint64) (ID, error) {
+	msPart, seqPart := s, ""
+	hasSeq := false
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		msPart, seqPart = s[:i], s[i+1:]
+		hasSeq = true
+	}
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return ID{}, ErrInvalidID
+	}
+	seq := defaultSeq
+	if hasSeq {
+		seq, err = strconv.ParseUint(seqPart, 10, 64)
+		if err != nil {
+			return ID{}, ErrInvalidID
+		}
+	}
+	return ID{Ms: ms, Seq: seq}, nil
+}
+
+func (id ID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Compare 比较两个 ID, 返回 -1, 0, 1
+func (id ID) Compare(other ID) int {
+	switch {
+	case id.Ms < other.Ms:
+		return -1
+	case id.Ms > other.Ms:
+		return 1
+	case id.Seq < other.Seq:
+		return -1
+	case id.Seq > other.Seq:
+		return 1
+	}
+	return 0
+}
+
+// Less 判断 id 是否小于 other
+func (id ID) Less(other ID) bool {
+	return id.Compare(other) < 0
+}
+
+// Next 返回比 id 大的最小 ID, 已经是最大 ID 时返回 false
+func (id ID) Next() (ID, bool) {
+	if id.Seq < math.MaxUint64 {
+		return ID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	}
+	if id.Ms < math.MaxUint64 {
+		return ID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+// Prev 返回比 id 小的最大 ID, 已经是 0-0 时返回 false
+func (id ID) Prev() (ID, bool) {
+	if id.Seq > 0 {
+		return ID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	}
+	if id.Ms > 0 {
+		return ID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// Entry 流中的一个条目, Fields 为 field value 交替排列
+type Entry struct {
+	ID     ID
+	Fields [][]byte
+}
+
+type node struct {
+	entries []*Entry
+}
+
+func (n *node) first() ID {
+	return n.entries[0].ID
+}
+
+func (n *node) last() ID {
+	return n.entries[len(n.entries)-1].ID
+}
+
+// Stream 流, 条目 ID 单调递增
+type Stream struct {
+	nodes  []*node
+	length int
+	lastID ID // 曾经添加过的最大 ID, 条目被删除后也不会变小
+	groups map[string]*Group
+}
+
+// Make creates an empty stream
+func Make() *Stream {
+	return &Stream{
+		groups: make(map[string]*Group),
+	}
+}
+
+// Len returns number of entries
+func (s *Stream) Len() int {
+	return s.length
+}
+
+// LastID returns the largest ID ever added
+func (s *Stream) LastID() ID {
+	return s.lastID
+}
+
+// SetLastID 修改最大 ID, 不能小于现有的最后一个条目
+func (s *Stream) SetLastID(id ID) bool {
+	if s.length > 0 && id.Less(s.nodes[len(s.nodes)-1].last()) {
+		return false
+	}
+	s.lastID = id
+	return true
+}
+
+// NextID 生成自动 ID, 时间回拨时沿用最后一个 ID 的时间戳并增加序号
+func (s *Stream) NextID(ms uint64) (ID, bool) {
+	if ms > s.lastID.Ms {
+		return ID{Ms: ms}, true
+	}
+	return s.lastID.Next()
+}
+
+// Add 追加条目, ID 必须大于 LastID
+func (s *Stream) Add(id ID, fields [][]byte) bool {
+	if !s.lastID.Less(id) {
+		return false
+	}
+	entry := &Entry{ID: id, Fields: fields}
+	if len(s.nodes) == 0 || len(s.nodes[len(s.nodes)-1].entries) >= nodeSize {
+		s.nodes = append(s.nodes, &node{entries: make([]*Entry, 0, nodeSize)})
+	}
+	last := s.nodes[len(s.nodes)-1]
+	last.entries = append(last.entries, entry)
+	s.length++
+	s.lastID = id
+	return true
+}
+
+// seek 返回第一个 ID >= id 的条目位置
+func (s *Stream) seek(id ID) (int, int) {
+	i := sort.Search(len(s.nodes), func(i int) bool {
+		return !s.nodes[i].last().Less(id)
+	})
+	if i == len(s.nodes) {
+		return i, 0
+	}
+	entries := s.nodes[i].entries
+	j := sort.Search(len(entries), func(j int) bool {
+		return !entries[j].ID.Less(id)
+	})
+	return i, j
+}
+
+// Get returns entry of given id
+func (s *Stream) Get(id ID) (*Entry, bool) {
+	i, j := s.seek(id)
+	if i == len(s.nodes) || s.nodes[i].entries[j].ID != id {
+		return nil, false
+	}
+	return s.nodes[i].entries[j], true
+}
+
+// First returns the first entry
+func (s *Stream) First() (*Entry, bool) {
+	if s.length == 0 {
+		return nil, false
+	}
+	return s.nodes[0].entries[0], true
+}
+
+// Last returns the last entry
+func (s *Stream) Last() (*Entry, bool) {
+	if s.length == 0 {
+		return nil, false
+	}
+	n := s.nodes[len(s.nodes)-1]
+	return n.entries[len(n.entries)-1], true
+}
+
+// Delete removes entry of given id
+func (s *Stream) Delete(id ID) bool {
+	i, j := s.seek(id)
+	if i == len(s.nodes) || s.nodes[i].entries[j].ID != id {
+		return false
+	}
+	s.removeAt(i, j)
+	return true
+}
+
+func (s *Stream) removeAt(i, j int) {
+	n := s.nodes[i]
+	copy(n.entries[j:], n.entries[j+1:])
+	n.entries[len(n.entries)-1] = nil
+	n.entries = n.entries[:len(n.entries)-1]
+	if len(n.entries) == 0 {
+		copy(s.nodes[i:], s.nodes[i+1:])
+		s.nodes[len(s.nodes)-1] = nil
+		s.nodes = s.nodes[:len(s.nodes)-1]
+	}
+	s.length--
+}
+
+// Range 返回 ID 在 [start, end] 之间的条目, count <= 0 表示不限制数量, reverse 为 true 时从大到小返回
+func (s *Stream) Range(start, end ID, count int, reverse bool) []*Entry {
+	var result []*Entry
+	if end.Less(start) {
+		return result
+	}
+	if !reverse {
+		i, j := s.seek(start)
+		for ; i < len(s.nodes); i, j = i+1, 0 {
+			for _, entry := range s.nodes[i].entries[j:] {
+				if end.Less(entry.ID) || (count > 0 && len(result) >= count) {
+					return result
+				}
+				result = append(result, entry)
+			}
+		}
+		return result
+	}
+
+	// 从第一个 ID > end 的位置开始向前遍历
+	i, j := len(s.nodes), 0
+	if next, ok := end.Next(); ok {
+		i, j = s.seek(next)
+	}
+	for {
+		if j > 0 {
+			j--
+		} else {
+			i--
+			if i < 0 {
+				return result
+			}
+			j = len(s.nodes[i].entries) - 1
+		}
+		entry := s.nodes[i].entries[j]
+		if entry.ID.Less(start) || (count > 0 && len(result) >= count) {
+			return result
+		}
+		result = append(result, entry)
+	}
+}
+
+// ForEach visits entries in order
+func (s *Stream) ForEach(consumer func(entry *Entry) bool) {
+	for _, n := range s.nodes {
+		for _, entry := range n.entries {
+			if !consumer(entry) {
+				return
+			}
+		}
+	}
+}
+
+// TrimMaxLen 从头部删除条目直到长度不超过 maxLen, limit > 0 时最多删除 limit 个, 返回删除数量
+func (s *Stream) TrimMaxLen(maxLen int, limit int) int {
+	removed := 0
+	for s.length > maxLen && (limit <= 0 || removed < limit) {
+		n := s.nodes[0]
+		if s.length-len(n.entries) >= maxLen && (limit <= 0 || removed+len(n.entries) <= limit) {
+			// 整个节点都需要删除
+			removed += len(n.entries)
+			s.length -= len(n.entries)
+			s.nodes[0] = nil
+			s.nodes = s.nodes[1:]
+			continue
+		}
+		s.removeAt(0, 0)
+		removed++
+	}
+	return removed
+}
+
+// TrimMinID 删除 ID 小于 minID 的条目, limit > 0 时最多删除 limit 个, 返回删除数量
+func (s *Stream) TrimMinID(minID ID, limit int) int {
+	removed := 0
+	for s.length > 0 && (limit <= 0 || removed < limit) {
+		n := s.nodes[0]
+		if !n.first().Less(minID) {
+			break
+		}
+		if n.last().Less(minID) && (limit <= 0 || removed+len(n.entries) <= limit) {
+			removed += len(n.entries)
+			s.length -= len(n.entries)
+			s.nodes[0] = nil
+			s.nodes = s.nodes[1:]
+			continue
+		}
+		s.removeAt(0, 0)
+		removed++
+	}
+	return removed
+}
@@ -0,0 +1,55 @@
+package stream
+
+import "testing"
+
+func TestStreamRange(t *testing.T) {
+	s := Make()
+	for i := 1; i <= 1000; i++ {
+		if !s.Add(ID{Ms: uint64(i)}, [][]byte{[]byte("f"), []byte("v")}) {
+			t.Fatalf("add %d failed", i)
+		}
+	}
+	if s.Add(ID{Ms: 1000}, nil) {
+		t.Error("id should be greater than last id")
+	}
+	if entries := s.Range(ID{Ms: 100}, ID{Ms: 300}, 0, false); len(entries) != 201 || entries[0].ID.Ms != 100 {
+		t.Errorf("range: %d", len(entries))
+	}
+	if entries := s.Range(MinID, MaxID, 3, true); len(entries) != 3 || entries[0].ID.Ms != 1000 || entries[2].ID.Ms != 998 {
+		t.Errorf("reverse range: %v", entries)
+	}
+	if entries := s.Range(ID{Ms: 127}, ID{Ms: 130}, 0, true); len(entries) != 4 || entries[3].ID.Ms != 127 {
+		t.Errorf("reverse range across nodes: %v", entries)
+	}
+
+	if !s.Delete(ID{Ms: 129}) || s.Delete(ID{Ms: 129}) {
+		t.Error("delete")
+	}
+	if _, ok := s.Get(ID{Ms: 129}); ok || s.Len() != 999 {
+		t.Error("get deleted entry")
+	}
+	if removed := s.TrimMaxLen(500, 0); removed != 499 || s.Len() != 500 {
+		t.Errorf("trim maxlen: %d", removed)
+	}
+	if first, _ := s.First(); first.ID.Ms != 501 {
+		t.Errorf("first after trim: %s", first.ID)
+	}
+	if removed := s.TrimMinID(ID{Ms: 900}, 0); removed != 399 {
+		t.Errorf("trim minid: %d", removed)
+	}
+	if id, _ := s.NextID(10); id != (ID{Ms: 1000, Seq: 1}) {
+		t.Errorf("next id: %s", id)
+	}
+}
+
+func TestParseID(t *testing.T) {
+	if id, err := ParseID("1526919030474-55", 0); err != nil || id != (ID{Ms: 1526919030474, Seq: 55}) {
+		t.Errorf("parse: %v %v", id, err)
+	}
+	if id, err := ParseID("5", 9); err != nil || id != (ID{Ms: 5, Seq: 9}) {
+		t.Errorf("parse default seq: %v %v", id, err)
+	}
+	if _, err := ParseID("5-x", 0); err == nil {
+		t.Error("expect error")
+	}
+}
@@ -0,0 +1,94 @@
+package zset
+
+import "sort"
+
+// 小的有序集合使用紧凑编码: 按 (score, member) 升序保存在切片中, 不维护 dict 和跳表,
+// 元素数量或 member 长度超过阈值后转换为 skiplist 编码, 转换是单向的
+var (
+	MaxListpackEntries = 128 // zset-max-listpack-entries
+	MaxListpackValue   = 64  // zset-max-listpack-value
+)
+
+// 编码名称, 与 OBJECT ENCODING 的返回值一致
+const (
+	EncodingListpack = "listpack"
+	EncodingSkiplist = "skiplist"
+)
+
+type listpack []*Element
+
+func elementLess(a *Element, score float64, member string) bool {
+	return a.Score < score || (a.Score == score && a.Member < member)
+}
+
+// find 返回 member 的下标, 不存在时返回 -1
+func (lp listpack) find(member string) int {
+	for i, element := range lp {
+		if element.Member == member {
+			return i
+		}
+	}
+	return -1
+}
+
+func (lp *listpack) insert(member string, score float64) {
+	i := sort.Search(len(*lp), func(i int) bool {
+		return !elementLess((*lp)[i], score, member)
+	})
+	*lp = append(*lp, nil)
+	copy((*lp)[i+1:], (*lp)[i:])
+	(*lp)[i] = &Element{Member: member, Score: score}
+}
+
+// removeRange 删除下标在 [start, stop) 之间的元素并返回
+func (lp *listpack) removeRange(start, stop int) []*Element {
+	removed := make([]*Element, stop-start)
+	copy(removed, (*lp)[start:stop])
+	*lp = append((*lp)[:start], (*lp)[stop:]...)
+	return removed
+}
+
+// scoreRange 返回 score 在给定范围内的元素下标 [start, stop)
+func (lp listpack) scoreRange(min *ScoreBorder, max *ScoreBorder) (int, int) {
+	start := sort.Search(len(lp), func(i int) bool {
+		return min.less(lp[i].Score)
+	})
+	stop := start + sort.Search(len(lp)-start, func(i int) bool {
+		return !max.greater(lp[start+i].Score)
+	})
+	return start, stop
+}
+
+// lexRange 返回 member 在给定范围内的元素下标 [start, stop), 仅当所有 score 相同时结果有意义
+func (lp listpack) lexRange(min *LexBorder, max *LexBorder) (int, int) {
+	start := sort.Search(len(lp), func(i int) bool {
+		return min.less(lp[i].Member)
+	})
+	stop := start + sort.Search(len(lp)-start, func(i int) bool {
+		return !max.greater(lp[start+i].Member)
+	})
+	return start, stop
+}
+
+// forEachInRange 从下标范围 [start, stop) 中跳过 offset 个元素后最多访问 limit 个, limit 为负数表示不限制
+func (lp listpack) forEachInRange(start, stop int, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
+	n := int64(stop - start)
+	if offset >= n {
+		return
+	}
+	n -= offset
+	if limit >= 0 && limit < n {
+		n = limit
+	}
+	for i := int64(0); i < n; i++ {
+		var element *Element
+		if desc {
+			element = lp[int64(stop)-1-offset-i]
+		} else {
+			element = lp[int64(start)+offset+i]
+		}
+		if !consumer(element) {
+			return
+		}
+	}
+}
@@ -225,7 +225,11 @@ func (l *skiplist) getByRank(rank int64) *node {
 
 func (l *skiplist) hasInRange(min *ScoreBorder, max *ScoreBorder) bool {
 	// min & max = empty
-	if min.Value > max.Value || (min.Value == max.Value && (min.Exclude || max.Exclude)) {
+	if min.Inf == positiveInf || max.Inf == negativeInf {
+		return false
+	}
+	if min.Inf == 0 && max.Inf == 0 &&
+		(min.Value > max.Value || (min.Value == max.Value && (min.Exclude || max.Exclude))) {
 		return false
 	}
 	// min > tail
@@ -341,3 +345,95 @@ func (l *skiplist) RemoveRangeByRank(start int64, stop int64) (removed []*Elemen
 	}
 	return removed
 }
+
+// 以下按 member 字典序查找, 与 redis 一致, 仅当所有 member 的 score 相同时结果有意义
+
+func (l *skiplist) hasInLexRange(min *LexBorder, max *LexBorder) bool {
+	// min & max = empty
+	if min.Inf == positiveInf || max.Inf == negativeInf {
+		return false
+	}
+	if min.Inf == 0 && max.Inf == 0 &&
+		(min.Value > max.Value || (min.Value == max.Value && (min.Exclude || max.Exclude))) {
+		return false
+	}
+	// min > tail
+	n := l.tail
+	if n == nil || !min.less(n.Member) {
+		return false
+	}
+	// max < head
+	n = l.header.level[0].forward
+	if n == nil || !max.greater(n.Member) {
+		return false
+	}
+	return true
+}
+
+func (l *skiplist) getFirstInLexRange(min *LexBorder, max *LexBorder) *node {
+	if !l.hasInLexRange(min, max) {
+		return nil
+	}
+	n := l.header
+	// scan from top level
+	for level := l.level - 1; level >= 0; level-- {
+		for n.level[level].forward != nil && !min.less(n.level[level].forward.Member) {
+			n = n.level[level].forward
+		}
+	}
+	n = n.level[0].forward
+	if !max.greater(n.Member) {
+		return nil
+	}
+	return n
+}
+
+func (l *skiplist) getLastInLexRange(min *LexBorder, max *LexBorder) *node {
+	if !l.hasInLexRange(min, max) {
+		return nil
+	}
+	n := l.header
+	// scan from top level
+	for level := l.level - 1; level >= 0; level-- {
+		for n.level[level].forward != nil && max.greater(n.level[level].forward.Member) {
+			n = n.level[level].forward
+		}
+	}
+	if !min.less(n.Member) {
+		return nil
+	}
+	return n
+}
+
+// RemoveRangeByLex removes nodes which member within the given border
+func (l *skiplist) RemoveRangeByLex(min *LexBorder, max *LexBorder) (removed []*Element) {
+	update := make([]*node, maxLevel)
+	removed = make([]*Element, 0)
+	// find backward nodes (of target range) or last node of each level
+	node := l.header
+	for i := l.level - 1; i >= 0; i-- {
+		for node.level[i].forward != nil {
+			if min.less(node.level[i].forward.Member) { // already in range
+				break
+			}
+			node = node.level[i].forward
+		}
+		update[i] = node
+	}
+
+	// node is the first one within range
+	node = node.level[0].forward
+
+	// remove nodes in range
+	for node != nil {
+		if !max.greater(node.Member) { // already out of range
+			break
+		}
+		next := node.level[0].forward
+		removedElement := node.Element
+		removed = append(removed, &removedElement)
+		l.removeNode(node, update)
+		node = next
+	}
+	return removed
+}
@@ -1,23 +1,57 @@
 package zset
 
-import "strconv"
+import (
+	"math/rand"
+	"strconv"
+)
 
 // SortedSet is a set which keys sorted by bound score
 type SortedSet struct {
+	listpack listpack // 紧凑编码, skiplist 为 nil 时使用
 	dict     map[string]*Element
 	skiplist *skiplist //跳表
 }
 
-// Make makes a new SortedSet
+// Make makes a new SortedSet, 初始为紧凑编码
 func Make() *SortedSet {
-	return &SortedSet{
-		dict:     make(map[string]*Element),
-		skiplist: makeSkiplist(),
+	return &SortedSet{}
+}
+
+// Encoding returns the name of the underlying encoding
+func (sortedSet *SortedSet) Encoding() string {
+	if sortedSet.skiplist == nil {
+		return EncodingListpack
+	}
+	return EncodingSkiplist
+}
+
+// convert 将紧凑编码转换为 dict + skiplist
+func (sortedSet *SortedSet) convert() {
+	sortedSet.dict = make(map[string]*Element, len(sortedSet.listpack))
+	sortedSet.skiplist = makeSkiplist()
+	for _, element := range sortedSet.listpack {
+		sortedSet.dict[element.Member] = element
+		sortedSet.skiplist.insert(element.Member, element.Score)
 	}
+	sortedSet.listpack = nil
 }
 
 // Add puts member into set,  and returns whether has inserted new node
 func (sortedSet *SortedSet) Add(member string, score float64) bool {
+	if sortedSet.skiplist == nil {
+		i := sortedSet.listpack.find(member)
+		if i >= 0 {
+			if sortedSet.listpack[i].Score == score {
+				return false
+			}
+			sortedSet.listpack.removeRange(i, i+1)
+		}
+		sortedSet.listpack.insert(member, score)
+		if len(sortedSet.listpack) > MaxListpackEntries || len(member) > MaxListpackValue {
+			sortedSet.convert()
+		}
+		return i < 0
+	}
 	element, ok := sortedSet.dict[member]
 	sortedSet.dict[member] = &Element{
 		Member: member,
@@ -36,11 +70,20 @@ func (sortedSet *SortedSet) Add(member string, score float64) bool {
 
 // Len returns number of members in set
 func (sortedSet *SortedSet) Len() int64 {
+	if sortedSet.skiplist == nil {
+		return int64(len(sortedSet.listpack))
+	}
 	return int64(len(sortedSet.dict))
 }
 
 // Get returns the given member
 func (sortedSet *SortedSet) Get(member string) (element *Element, ok bool) {
+	if sortedSet.skiplist == nil {
+		if i := sortedSet.listpack.find(member); i >= 0 {
+			return sortedSet.listpack[i], true
+		}
+		return nil, false
+	}
 	element, ok = sortedSet.dict[member]
 	if !ok {
 		return nil, false
@@ -50,6 +93,14 @@ func (sortedSet *SortedSet) Get(member string) (element *Element, ok bool) {
 
 // Remove removes the given member from set
 func (sortedSet *SortedSet) Remove(member string) bool {
+	if sortedSet.skiplist == nil {
+		i := sortedSet.listpack.find(member)
+		if i < 0 {
+			return false
+		}
+		sortedSet.listpack.removeRange(i, i+1)
+		return true
+	}
 	v, ok := sortedSet.dict[member]
 	if ok {
 		sortedSet.skiplist.remove(member, v.Score)
@@ -61,6 +112,13 @@ func (sortedSet *SortedSet) Remove(member string) bool {
 
 // GetRank returns the rank of the given member, sort by ascending order, rank starts from 0
 func (sortedSet *SortedSet) GetRank(member string, desc bool) (rank int64) {
+	if sortedSet.skiplist == nil {
+		i := sortedSet.listpack.find(member)
+		if i >= 0 && desc {
+			i = len(sortedSet.listpack) - 1 - i
+		}
+		return int64(i)
+	}
 	element, ok := sortedSet.dict[member]
 	if !ok {
 		return -1
@@ -83,6 +141,10 @@ func (sortedSet *SortedSet) ForEach(start int64, stop int64, desc bool, consumer
 	if stop < start || stop > size {
 		panic("illegal end " + strconv.FormatInt(stop, 10))
 	}
+	if sortedSet.skiplist == nil {
+		sortedSet.listpack.forEachInRange(0, int(size), start, stop-start, desc, consumer)
+		return
+	}
 
 	// find start node
 	var node *node
@@ -126,20 +188,12 @@ func (sortedSet *SortedSet) Range(start int64, stop int64, desc bool) []*Element
 
 // Count returns the number of  members which score within the given border
 func (sortedSet *SortedSet) Count(min *ScoreBorder, max *ScoreBorder) int64 {
+	if sortedSet.skiplist == nil {
+		start, stop := sortedSet.listpack.scoreRange(min, max)
+		return int64(stop - start)
+	}
 	var i int64 = 0
-	// ascending order
-	sortedSet.ForEach(0, sortedSet.Len(), false, func(element *Element) bool {
-		gtMin := min.less(element.Score) // greater than min
-		if !gtMin {
-			// has not into range, continue foreach
-			return true
-		}
-		ltMax := max.greater(element.Score) // less than max
-		if !ltMax {
-			// break through score border, break foreach
-			return false
-		}
-		// gtMin && ltMax
+	sortedSet.ForEachByScore(min, max, 0, -1, false, func(element *Element) bool {
 		i++
 		return true
 	})
@@ -148,6 +202,11 @@ func (sortedSet *SortedSet) Count(min *ScoreBorder, max *ScoreBorder) int64 {
 
 // ForEachByScore visits members which score within the given border
 func (sortedSet *SortedSet) ForEachByScore(min *ScoreBorder, max *ScoreBorder, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
+	if sortedSet.skiplist == nil {
+		start, stop := sortedSet.listpack.scoreRange(min, max)
+		sortedSet.listpack.forEachInRange(start, stop, offset, limit, desc, consumer)
+		return
+	}
 	// find start node
 	var node *node
 	if desc {
@@ -167,6 +226,11 @@ func (sortedSet *SortedSet) ForEachByScore(min *ScoreBorder, max *ScoreBorder, o
 
 	// A negative limit returns all elements from the offset
 	for i := 0; (i < int(limit) || limit < 0) && node != nil; i++ {
+		gtMin := min.less(node.Element.Score) // greater than min
+		ltMax := max.greater(node.Element.Score)
+		if !gtMin || !ltMax {
+			break // break through score border
+		}
 		if !consumer(&node.Element) {
 			break
 		}
@@ -175,14 +239,6 @@ func (sortedSet *SortedSet) ForEachByScore(min *ScoreBorder, max *ScoreBorder, o
 		} else {
 			node = node.level[0].forward
 		}
-		if node == nil {
-			break
-		}
-		gtMin := min.less(node.Element.Score) // greater than min
-		ltMax := max.greater(node.Element.Score)
-		if !gtMin || !ltMax {
-			break // break through score border
-		}
 	}
 }
 
@@ -202,6 +258,10 @@ func (sortedSet *SortedSet) RangeByScore(min *ScoreBorder, max *ScoreBorder, off
 
 // RemoveByScore removes members which score within the given border
 func (sortedSet *SortedSet) RemoveByScore(min *ScoreBorder, max *ScoreBorder) int64 {
+	if sortedSet.skiplist == nil {
+		start, stop := sortedSet.listpack.scoreRange(min, max)
+		return int64(len(sortedSet.listpack.removeRange(start, stop)))
+	}
 	removed := sortedSet.skiplist.RemoveRangeByScore(min, max)
 	for _, element := range removed {
 		delete(sortedSet.dict, element.Member)
@@ -212,9 +272,187 @@ func (sortedSet *SortedSet) RemoveByScore(min *ScoreBorder, max *ScoreBorder) in
 // RemoveByRank removes member ranking within [start, stop)
 // sort by ascending order and rank starts from 0
 func (sortedSet *SortedSet) RemoveByRank(start int64, stop int64) int64 {
+	if sortedSet.skiplist == nil {
+		return int64(len(sortedSet.listpack.removeRange(int(start), int(stop))))
+	}
 	removed := sortedSet.skiplist.RemoveRangeByRank(start+1, stop+1)
 	for _, element := range removed {
 		delete(sortedSet.dict, element.Member)
 	}
 	return int64(len(removed))
 }
+
+// CountByLex returns the number of members which member within the given border
+func (sortedSet *SortedSet) CountByLex(min *LexBorder, max *LexBorder) int64 {
+	if sortedSet.skiplist == nil {
+		start, stop := sortedSet.listpack.lexRange(min, max)
+		return int64(stop - start)
+	}
+	first := sortedSet.skiplist.getFirstInLexRange(min, max)
+	if first == nil {
+		return 0
+	}
+	last := sortedSet.skiplist.getLastInLexRange(min, max)
+	return sortedSet.skiplist.getRank(last.Member, last.Score) - sortedSet.skiplist.getRank(first.Member, first.Score) + 1
+}
+
+// ForEachByLex visits members which member within the given border
+func (sortedSet *SortedSet) ForEachByLex(min *LexBorder, max *LexBorder, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
+	if sortedSet.skiplist == nil {
+		start, stop := sortedSet.listpack.lexRange(min, max)
+		sortedSet.listpack.forEachInRange(start, stop, offset, limit, desc, consumer)
+		return
+	}
+	// find start node
+	var node *node
+	if desc {
+		node = sortedSet.skiplist.getLastInLexRange(min, max)
+	} else {
+		node = sortedSet.skiplist.getFirstInLexRange(min, max)
+	}
+
+	for node != nil && offset > 0 {
+		if desc {
+			node = node.backward
+		} else {
+			node = node.level[0].forward
+		}
+		offset--
+	}
+
+	// A negative limit returns all elements from the offset
+	for i := 0; (i < int(limit) || limit < 0) && node != nil; i++ {
+		if !min.less(node.Member) || !max.greater(node.Member) {
+			break // break through lex border
+		}
+		if !consumer(&node.Element) {
+			break
+		}
+		if desc {
+			node = node.backward
+		} else {
+			node = node.level[0].forward
+		}
+	}
+}
+
+// RangeByLex returns members which member within the given border
+// param limit: <0 means no limit
+func (sortedSet *SortedSet) RangeByLex(min *LexBorder, max *LexBorder, offset int64, limit int64, desc bool) []*Element {
+	if limit == 0 || offset < 0 {
+		return make([]*Element, 0)
+	}
+	slice := make([]*Element, 0)
+	sortedSet.ForEachByLex(min, max, offset, limit, desc, func(element *Element) bool {
+		slice = append(slice, element)
+		return true
+	})
+	return slice
+}
+
+// RemoveByLex removes members which member within the given border
+func (sortedSet *SortedSet) RemoveByLex(min *LexBorder, max *LexBorder) int64 {
+	if sortedSet.skiplist == nil {
+		start, stop := sortedSet.listpack.lexRange(min, max)
+		return int64(len(sortedSet.listpack.removeRange(start, stop)))
+	}
+	removed := sortedSet.skiplist.RemoveRangeByLex(min, max)
+	for _, element := range removed {
+		delete(sortedSet.dict, element.Member)
+	}
+	return int64(len(removed))
+}
+
+// PopMin removes and returns at most count members with the lowest scores, in ascending order
+func (sortedSet *SortedSet) PopMin(count int) []*Element {
+	if sortedSet.skiplist == nil {
+		if count > len(sortedSet.listpack) {
+			count = len(sortedSet.listpack)
+		}
+		return sortedSet.listpack.removeRange(0, count)
+	}
+	removed := sortedSet.skiplist.RemoveRangeByRank(1, int64(count)+1)
+	for _, element := range removed {
+		delete(sortedSet.dict, element.Member)
+	}
+	return removed
+}
+
+// PopMax removes and returns at most count members with the highest scores, in descending order
+func (sortedSet *SortedSet) PopMax(count int) []*Element {
+	size := sortedSet.Len()
+	if int64(count) > size {
+		count = int(size)
+	}
+	var removed []*Element
+	if sortedSet.skiplist == nil {
+		removed = sortedSet.listpack.removeRange(int(size)-count, int(size))
+	} else {
+		removed = sortedSet.skiplist.RemoveRangeByRank(size-int64(count)+1, size+1)
+		for _, element := range removed {
+			delete(sortedSet.dict, element.Member)
+		}
+	}
+	for i, j := 0, len(removed)-1; i < j; i, j = i+1, j-1 {
+		removed[i], removed[j] = removed[j], removed[i]
+	}
+	return removed
+}
+
+// getByRank returns the member of the given rank, sort by ascending order, rank starts from 0
+func (sortedSet *SortedSet) getByRank(rank int64) *Element {
+	if sortedSet.skiplist == nil {
+		return sortedSet.listpack[rank]
+	}
+	return &sortedSet.skiplist.getByRank(rank + 1).Element
+}
+
+// RandomMembers returns count random members, may contain duplicates
+func (sortedSet *SortedSet) RandomMembers(count int) []*Element {
+	size := sortedSet.Len()
+	if size == 0 {
+		return nil
+	}
+	result := make([]*Element, count)
+	for i := range result {
+		result[i] = sortedSet.getByRank(rand.Int63n(size))
+	}
+	return result
+}
+
+// RandomDistinctMembers returns at most count distinct random members
+func (sortedSet *SortedSet) RandomDistinctMembers(count int) []*Element {
+	size := sortedSet.Len()
+	if int64(count) >= size {
+		return sortedSet.Range(0, size, false)
+	}
+	picked := make(map[int64]struct{}, count)
+	result := make([]*Element, 0, count)
+	for len(result) < count {
+		rank := rand.Int63n(size)
+		if _, ok := picked[rank]; ok {
+			continue
+		}
+		picked[rank] = struct{}{}
+		result = append(result, sortedSet.getByRank(rank))
+	}
+	return result
+}
+
+// Scan visits at most count members start from the given cursor and returns the next cursor, 0 means finished.
+// 游标即升序排名, 两次调用之间增删元素可能导致元素被重复返回或遗漏
+func (sortedSet *SortedSet) Scan(cursor uint64, count int, consumer func(element *Element) bool) uint64 {
+	size := uint64(sortedSet.Len())
+	if cursor >= size {
+		return 0
+	}
+	stop := cursor + uint64(count)
+	if stop > size {
+		stop = size
+	}
+	sortedSet.ForEach(int64(cursor), int64(stop), false, consumer)
+	if stop == size {
+		return 0
+	}
+	return stop
+}
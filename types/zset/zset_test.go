@@ -1,6 +1,10 @@
 package zset
 
-import "testing"
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
 
 func TestSkipList(t *testing.T) {
 	skipList := makeSkiplist()
@@ -11,3 +15,87 @@ func TestSkipList(t *testing.T) {
 
 	t.Logf("%v", skipList.getRank("a1", 200))
 }
+
+func TestSortedSetLex(t *testing.T) {
+	set := Make()
+	for _, member := range []string{"a", "b", "c", "d", "e"} {
+		set.Add(member, 0)
+	}
+	min, _ := ParseLexBorder("(a")
+	max, _ := ParseLexBorder("[d")
+	if n := set.CountByLex(min, max); n != 3 {
+		t.Errorf("expect 3, actual %d", n)
+	}
+	elements := set.RangeByLex(min, max, 1, -1, true)
+	if len(elements) != 2 || elements[0].Member != "c" || elements[1].Member != "b" {
+		t.Errorf("unexpected range %v", elements)
+	}
+	if removed := set.RemoveByLex(min, max); removed != 3 || set.Len() != 2 {
+		t.Errorf("expect 3 removed, actual %d", removed)
+	}
+	if _, err := ParseLexBorder("a"); err == nil {
+		t.Error("expect error")
+	}
+}
+
+func TestSortedSetEncoding(t *testing.T) {
+	compact, full := Make(), Make()
+	full.convert()
+	sameElements := func(op string, a, b []*Element) {
+		if len(a) != len(b) {
+			t.Fatalf("%s: expect %d elements, actual %d", op, len(b), len(a))
+		}
+		for i := range a {
+			if *a[i] != *b[i] {
+				t.Fatalf("%s: expect %v, actual %v", op, *b[i], *a[i])
+			}
+		}
+	}
+	borders := []string{"-inf", "(3", "3", "7", "(12", "+inf"}
+	for i := 0; i < 2000; i++ {
+		member := strconv.Itoa(rand.Intn(30))
+		score := float64(rand.Intn(15))
+		min, _ := ParseScoreBorder(borders[rand.Intn(3)])
+		max, _ := ParseScoreBorder(borders[3+rand.Intn(3)])
+		switch rand.Intn(6) {
+		case 0, 1:
+			if compact.Add(member, score) != full.Add(member, score) {
+				t.Fatalf("add %s: inconsistent result", member)
+			}
+		case 2:
+			if compact.Remove(member) != full.Remove(member) {
+				t.Fatalf("remove %s: inconsistent result", member)
+			}
+		case 3:
+			if compact.GetRank(member, i%2 == 0) != full.GetRank(member, i%2 == 0) {
+				t.Fatalf("rank %s: inconsistent result", member)
+			}
+		case 4:
+			offset, limit := int64(rand.Intn(3)), int64(rand.Intn(5)-1)
+			sameElements("range by score",
+				compact.RangeByScore(min, max, offset, limit, i%2 == 0),
+				full.RangeByScore(min, max, offset, limit, i%2 == 0))
+		case 5:
+			if rand.Intn(10) == 0 {
+				sameElements("pop max", compact.PopMax(1), full.PopMax(1))
+			} else if compact.Count(min, max) != full.Count(min, max) {
+				t.Fatalf("count: inconsistent result")
+			}
+		}
+		if compact.Len() != full.Len() {
+			t.Fatalf("expect %d elements, actual %d", full.Len(), compact.Len())
+		}
+		if full.Len() > 0 {
+			sameElements("range", compact.Range(0, compact.Len(), false), full.Range(0, full.Len(), false))
+		}
+	}
+	if compact.Encoding() != EncodingListpack || full.Encoding() != EncodingSkiplist {
+		t.Errorf("unexpected encoding %s, %s", compact.Encoding(), full.Encoding())
+	}
+	for i := 0; i <= MaxListpackEntries; i++ {
+		compact.Add("m"+strconv.Itoa(i), float64(i))
+	}
+	if compact.Encoding() != EncodingSkiplist {
+		t.Errorf("expect skiplist after exceeding %d entries", MaxListpackEntries)
+	}
+}